@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -40,6 +41,14 @@ func model2csv(m *pgmetrics.Model, w *csv.Writer) (err error) {
 
 	// meta data
 	struct2csv("pgmetrics.meta.", m.Metadata, w)
+	labels := make([]string, 0, len(m.Metadata.Labels))
+	for k := range m.Metadata.Labels {
+		labels = append(labels, k)
+	}
+	sort.Strings(labels)
+	for _, k := range labels {
+		rec2csv("pgmetrics.meta.labels."+k, cleanstr(m.Metadata.Labels[k]), w)
+	}
 
 	// top-level fields
 	struct2csv("pgmetrics.", *m, w)
@@ -118,6 +127,23 @@ func model2csv(m *pgmetrics.Model, w *csv.Writer) (err error) {
 		struct2csv(head, l, w)
 	}
 
+	// rates
+	if m.Rates != nil {
+		struct2csv("pgmetrics.rates.", *m.Rates, w)
+		for _, d := range m.Rates.Databases {
+			head := fmt.Sprintf("pgmetrics.rates.databases.%s.", d.Name)
+			struct2csv(head, d, w)
+		}
+		for _, t := range m.Rates.Tables {
+			head := fmt.Sprintf("pgmetrics.rates.tables.%s.%s.%s.", t.DBName, t.SchemaName, t.Name)
+			struct2csv(head, t, w)
+		}
+		for _, sr := range m.Rates.Slots {
+			head := fmt.Sprintf("pgmetrics.rates.slots.%s.", sr.SlotName)
+			struct2csv(head, sr, w)
+		}
+	}
+
 	// system metrics
 	if m.System != nil {
 		struct2csv("pgmetrics.system.", *(m.System), w)
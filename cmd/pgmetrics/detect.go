@@ -0,0 +1,76 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rapidloop/pgmetrics/collector"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// autoDetect finds the servers running on this host, and returns the ones
+// selected by the value of --auto-detect: the N'th (1-based), "all" of them,
+// or if "ask", the only one or the ones chosen by the user.
+func autoDetect(choice string) []collector.LocalServer {
+	servers := collector.LocalServers()
+	if len(servers) == 0 {
+		log.Fatal("no running servers found on this host (try running as the postgres user)")
+	}
+	if choice == "ask" {
+		if len(servers) == 1 {
+			return servers
+		}
+		listServers(os.Stderr, servers)
+		if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+			log.Fatal(`more than one server found, use --auto-detect=N or --auto-detect=all`)
+		}
+		fmt.Fprintf(os.Stderr, `Collect from which server (1-%d, or "all")? `, len(servers))
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			os.Exit(1)
+		}
+		choice = strings.TrimSpace(line)
+	}
+	if choice == "all" {
+		return servers
+	}
+	n, err := strconv.Atoi(choice)
+	if err != nil || n < 1 || n > len(servers) {
+		listServers(os.Stderr, servers)
+		log.Fatalf("bad choice %q, need a number from 1 to %d, or \"all\"", choice, len(servers))
+	}
+	return servers[n-1 : n]
+}
+
+func listServers(w io.Writer, servers []collector.LocalServer) {
+	fmt.Fprintln(w, "PostgreSQL servers running on this host:")
+	for i, ls := range servers {
+		version := ls.Version
+		if len(version) == 0 {
+			version = "?"
+		}
+		fmt.Fprintf(w, "  %d. port %d, version %s, pid %d, data directory %s\n",
+			i+1, ls.Port, version, ls.PID, ls.DataDir)
+	}
+}
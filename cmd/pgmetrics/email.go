@@ -0,0 +1,144 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rapidloop/pgmetrics"
+	"github.com/rapidloop/pgmetrics/report"
+)
+
+// smtpTimeout is the time allowed to connect to the SMTP server.
+const smtpTimeout = 30 * time.Second
+
+// emailReport mails the health summary and the text report of the result
+// to the --email-to addresses, unless --email-on-issues was given and there
+// are no issues.
+func emailReport(o options, result *pgmetrics.Model) {
+	ro := o.reportOptions()
+	issues := report.Issues(result, ro)
+	if o.emailOnIssues && len(issues) == 0 {
+		return
+	}
+
+	var body bytes.Buffer
+	if err := report.WriteSummary(&body, result, ro); err != nil {
+		log.Fatal(err)
+	}
+	if err := report.Write(&body, result, ro); err != nil {
+		log.Fatal(err)
+	}
+	subject := "pgmetrics: no issues found"
+	if n := len(issues); n == 1 {
+		subject = "pgmetrics: 1 issue needs attention"
+	} else if n > 1 {
+		subject = fmt.Sprintf("pgmetrics: %d issues need attention", n)
+	}
+	if len(result.Metadata.ClusterName) > 0 {
+		subject += " in " + result.Metadata.ClusterName
+	}
+
+	from := o.emailFrom
+	if len(from) == 0 {
+		host, _ := os.Hostname()
+		from = "pgmetrics@" + host
+	}
+	var auth []byte
+	if len(o.smtpAuth) > 0 {
+		auth = readSecretFile(o.smtpAuth)
+	}
+	if err := sendMail(o.smtpServer, auth, from, o.emailTo, subject, body.Bytes()); err != nil {
+		log.Fatalf("failed to send email: %v", err)
+	}
+}
+
+// sendMail sends a plain text mail via the SMTP server at addr (host:port).
+// Port 465 uses implicit TLS, otherwise STARTTLS is used if the server offers
+// it. If auth is not empty, it should be "user:password", and is used for
+// PLAIN authentication, which net/smtp allows only over TLS or to localhost.
+func sendMail(addr string, auth []byte, from string, to []string, subject string, body []byte) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("tcp", addr, smtpTimeout)
+	if err != nil {
+		return err
+	}
+	tlsConfig := &tls.Config{ServerName: host}
+	if port == "465" {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok && port != "465" {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if len(auth) > 0 {
+		pos := bytes.IndexByte(auth, ':')
+		if pos < 1 {
+			return errors.New(`SMTP auth file must contain "user:password"`)
+		}
+		if err := c.Auth(smtp.PlainAuth("", string(auth[:pos]), string(auth[pos+1:]), host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, t := range to {
+		if err := c.Rcpt(t); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	msg.Write(body) // line endings are converted by the writer
+	if _, err := w.Write(msg.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
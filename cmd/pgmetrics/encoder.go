@@ -0,0 +1,92 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/rapidloop/pgmetrics"
+	"github.com/rapidloop/pgmetrics/report"
+)
+
+// encoder writes a model in one of the output formats.
+type encoder interface {
+	Encode(w io.Writer, result *pgmetrics.Model, o report.Options) error
+}
+
+// encoderFunc is an encoder that is a plain function.
+type encoderFunc func(w io.Writer, result *pgmetrics.Model, o report.Options) error
+
+func (f encoderFunc) Encode(w io.Writer, result *pgmetrics.Model, o report.Options) error {
+	return f(w, result, o)
+}
+
+// encoders are the output formats that can be given with -f/--format, by
+// name.
+var encoders = make(map[string]encoder)
+
+// registerEncoder makes the encoder available as the output format name.
+// Additional formats can be added by calling this from an init function in
+// another file of this package. It panics if the name is already taken.
+func registerEncoder(name string, e encoder) {
+	if _, ok := encoders[name]; ok {
+		panic("pgmetrics: output format " + name + " registered twice")
+	}
+	encoders[name] = e
+}
+
+// encoderNames returns the names of the output formats, like `"csv",
+// "human" or "json"`, for messages.
+func encoderNames() string {
+	names := make([]string, 0, len(encoders))
+	for name := range encoders {
+		names = append(names, fmt.Sprintf("%q", name))
+	}
+	sort.Strings(names)
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+func init() {
+	registerEncoder("human", encoderFunc(report.Write))
+	registerEncoder("json", encoderFunc(encodeJSON))
+	registerEncoder("csv", encoderFunc(encodeCSV))
+	registerEncoder("slack", encoderFunc(report.WriteSlack))
+	registerEncoder("teams", encoderFunc(report.WriteTeams))
+}
+
+func encodeJSON(w io.Writer, result *pgmetrics.Model, _ report.Options) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
+
+func encodeCSV(w io.Writer, result *pgmetrics.Model, _ report.Options) error {
+	cw := csv.NewWriter(w)
+	if err := model2csv(result, cw); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
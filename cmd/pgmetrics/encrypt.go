@@ -0,0 +1,108 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Encrypted files start with encMagic, followed by the scrypt salt, the GCM
+// nonce and the AES-256-GCM sealed contents. The key is derived from the
+// passphrase using scrypt.
+var encMagic = []byte("PGMETRICS-ENC1\n")
+
+const (
+	encSaltLen = 16
+	encKeyLen  = 32 // AES-256
+)
+
+func isEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, encMagic)
+}
+
+func encKey(passphrase, salt []byte) ([]byte, error) {
+	return scrypt.Key(passphrase, salt, 1<<15, 8, 1, encKeyLen)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encrypt returns the encrypted form of data, ready to be written to a file.
+func encrypt(data, passphrase []byte) ([]byte, error) {
+	salt := make([]byte, encSaltLen)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	key, err := encKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(encMagic)+len(salt)+len(nonce)+len(data)+gcm.Overhead())
+	out = append(out, encMagic...)
+	out = append(out, salt...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, data, encMagic), nil
+}
+
+// decrypt reverses encrypt.
+func decrypt(data, passphrase []byte) ([]byte, error) {
+	if !isEncrypted(data) {
+		return nil, errors.New("not an encrypted file")
+	}
+	data = data[len(encMagic):]
+	if len(data) < encSaltLen {
+		return nil, errors.New("encrypted file is truncated")
+	}
+	salt, data := data[:encSaltLen], data[encSaltLen:]
+	key, err := encKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("encrypted file is truncated")
+	}
+	nonce, data := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	out, err := gcm.Open(nil, nonce, data, encMagic)
+	if err != nil {
+		return nil, errors.New("decryption failed, wrong passphrase or corrupted file")
+	}
+	return out, nil
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// fetchTimeout is the time allowed to download an input file.
+const fetchTimeout = 60 * time.Second
+
+// readInput reads an input file, which can also be an s3://bucket/key,
+// gs://bucket/object or http(s):// URL.
+func readInput(name string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(name, "s3://"):
+		return readS3(name)
+	case strings.HasPrefix(name, "gs://"):
+		// use the JSON API's public endpoint, with an OAuth token if
+		// one is available (like from "gcloud auth print-access-token")
+		bucket, object := splitBucketURL(name, "gs://")
+		u := "https://storage.googleapis.com/" + bucket + "/" +
+			(&url.URL{Path: object}).EscapedPath()
+		return readURL(u, os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"))
+	case strings.HasPrefix(name, "https://"), strings.HasPrefix(name, "http://"):
+		return readURL(name, "")
+	}
+	return ioutil.ReadFile(name)
+}
+
+func splitBucketURL(name, scheme string) (bucket, key string) {
+	parts := strings.SplitN(strings.TrimPrefix(name, scheme), "/", 2)
+	bucket = parts[0]
+	if len(parts) == 2 {
+		key = parts[1]
+	}
+	return
+}
+
+func readURL(u, token string) ([]byte, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	client := http.Client{Timeout: fetchTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// readS3 downloads the object using the usual AWS credentials and config.
+// The region of the bucket is looked up if it is not configured.
+func readS3(name string) ([]byte, error) {
+	bucket, key := splitBucketURL(name, "s3://")
+	if len(bucket) == 0 || len(key) == 0 {
+		return nil, fmt.Errorf("%s: bad S3 URL, need s3://bucket/key", name)
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	if sess.Config.Region == nil || len(*sess.Config.Region) == 0 {
+		region, err := s3manager.GetBucketRegion(ctx, sess, bucket, "us-east-1")
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to get bucket region: %v", name, err)
+		}
+		sess.Config.Region = aws.String(region)
+	}
+	out, err := s3.New(sess).GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return ioutil.ReadAll(out.Body)
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rapidloop/pgmetrics"
+	"github.com/rapidloop/pgmetrics/collector"
+)
+
+// followEvent is a line of output of --log-follow.
+type followEvent struct {
+	Type       string                `json:"type"` // "plan", "autovacuum" or "deadlock"
+	Plan       *pgmetrics.Plan       `json:"plan,omitempty"`
+	AutoVacuum *pgmetrics.AutoVacuum `json:"autovacuum,omitempty"`
+	Deadlock   *pgmetrics.Deadlock   `json:"deadlock,omitempty"`
+}
+
+// followWriter writes the events from the log as JSON objects, one per line.
+type followWriter struct {
+	collector.NopLogEventHandler
+	enc *json.Encoder
+}
+
+func (w *followWriter) write(e followEvent) {
+	if err := w.enc.Encode(e); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func (w *followWriter) OnPlan(p pgmetrics.Plan) {
+	w.write(followEvent{Type: "plan", Plan: &p})
+}
+
+func (w *followWriter) OnAutoVacuum(av pgmetrics.AutoVacuum) {
+	w.write(followEvent{Type: "autovacuum", AutoVacuum: &av})
+}
+
+func (w *followWriter) OnDeadlock(d pgmetrics.Deadlock) {
+	w.write(followEvent{Type: "deadlock", Deadlock: &d})
+}
+
+// followLog writes the events in the log lines as they are written, to the
+// output file (appending to it) or stdout, until interrupted.
+func followLog(o options, args []string) {
+	var out io.Writer = os.Stdout
+	if o.output != "" && o.output != "-" {
+		f, err := os.OpenFile(o.output, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	done := make(chan struct{})
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		close(done)
+	}()
+
+	cc := o.CollectConfig
+	cc.LogHandler = &followWriter{enc: json.NewEncoder(out)}
+	if err := collector.FollowLog(cc, args, done); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -17,19 +17,25 @@
 package main
 
 import (
-	"encoding/csv"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"net"
 	"os"
 	"os/exec"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/howeyc/gopass"
 	"github.com/pborman/getopt"
 	"github.com/rapidloop/pgmetrics"
 	"github.com/rapidloop/pgmetrics/collector"
+	"github.com/rapidloop/pgmetrics/report"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
@@ -37,16 +43,60 @@ const usage = `pgmetrics collects PostgreSQL information and metrics.
 
 Usage:
   pgmetrics [OPTION]... [DBNAME]
+  pgmetrics COMMAND [OPTION]... [ARG]...
+  pgmetrics [OPTION]... -i FILE [FILE [FILE]]
+  pgmetrics [OPTION]... --drift -i FILE FILE...
+  pgmetrics [OPTION]... --trend -i FILE FILE...
+  pgmetrics [OPTION]... --rollup -i FILE [FILE...]
+  pgmetrics merge [OPTION]... FILE FILE...
+  pgmetrics query [OPTION]... SQL FILE...
+  pgmetrics selftest [OPTION]... [VERSION]...
+
+Commands:
+  collect [OPTION]... [DBNAME]
+                               collect from a server, same as without a
+                                   command
+  report [OPTION]... FILE...   display previously saved JSON file(s), same
+                                   as -i FILE [FILE...]
+  check [OPTION]... [DBNAME]   collect, or read with -i, and write the health
+                                   summary as plain text (or with -f, for
+                                   "slack" or "teams"); exit status is 1 if
+                                   there are any issues
+  diff [OPTION]... FILE FILE...
+                               display the files side by side, or with
+                                   --drift or --trend, report those
+  merge, query, selftest       see "pgmetrics COMMAND --help"
 
 General options:
   -t, --timeout=SECS           individual query timeout in seconds (default: 5)
   -i, --input=FILE             don't connect to db, instead read and display
-                                   this previously saved JSON file
+                                   this previously saved JSON file; up to 2
+                                   more files given as arguments are displayed
+                                   side by side with this one; files can also
+                                   be s3://, gs:// or https:// URLs
   -V, --version                output version information, then exit
+      --verify                 with -i and --sign-key, only verify the signature
+                                   of the input file(s), then exit
+      --drift                  with -i and more files, report the settings of
+                                   each server that differ from the majority
+                                   of servers of the same role
+      --trend                  with -i and more files, all from the same
+                                   cluster, report how the calls and time of
+                                   the top statements changed across them,
+                                   and the queries whose plans (as logged by
+                                   auto_explain) changed
+      --rollup                 with -i and any more files, all from the same
+                                   cluster and each with a log span following
+                                   the previous one, report the errors, slow
+                                   queries, autovacuums and other events seen
+                                   in the log, by week
   -?, --help[=options]         show this help, then exit
       --help=variables         list environment variables, then exit
 
 Collection options:
+      --profile=NAME           use the "quick", "standard" or "deep" set of
+                                   collection options; options given explicitly
+                                   take precedence over those of the profile
   -S, --no-sizes               don't collect tablespace and relation sizes
   -c, --schema=REGEXP          collect only from schema(s) matching POSIX regexp
   -C, --exclude-schema=REGEXP  do NOT collect from schema(s) matching POSIX regexp
@@ -60,25 +110,138 @@ Collection options:
                                    queries (default: 500)
       --statements-limit=LIMIT collect only utmost LIMIT number of row from
                                    pg_stat_statements (default: 100)
+      --activity-query=WHAT    collect "full" text, "none" or only the first N
+                                   characters of queries in pg_stat_activity
+                                   (default: same as --sql-length)
+      --explain-top=N          get generic plans (EXPLAIN without ANALYZE) of the
+                                   top N statements from pg_stat_statements
+                                   (default: 0, do not explain)
       --only-listed            collect info only about the databases listed as
                                    command-line args (use with Heroku)
-      --log-file               location of PostgreSQL log file
-      --log-span=MINS          examine the last MINS minutes of logs (default: 5)
+      --log-file               location of PostgreSQL log file; a ".csv" or ".json"
+                                   file is read as a csvlog or jsonlog file;
+                                   gzip and zstd compressed files are read too;
+                                   if not given, the log file is located using
+                                   pg_current_logfile() or log_directory
+      --log-span=MINS          examine the last MINS minutes of logs, including
+                                   the files rotated out within that time
+                                   (default: 5)
+      --log-wrapped=FIELD      log file lines are JSON objects (as written by log
+                                   shippers), with the original line in FIELD
+      --log-follow             instead of collecting, follow the log file (also
+                                   across rotations) and write the plans,
+                                   autovacuum runs and deadlocks logged from
+                                   now on as JSON objects, one per line,
+                                   until interrupted
+      --wal-sample=SECS        measure WAL generation rate over SECS seconds
+                                   (default: 0, do not measure); with
+                                   --sample-interval, measured over that
+                                   interval instead
+      --sample-interval=SECS   sample counters twice, SECS seconds apart, and
+                                   compute rates (default: 0, do not sample)
+      --max-server-cost        keep the load on the server low: use short
+                                   timeouts, pause between expensive queries,
+                                   and skip the scan for orphaned large objects
+      --max-connections=N      collect from up to N databases at a time, each
+                                   over its own connection (default: 1)
+      --max-heavy-queries=N    with --max-connections, run the expensive
+                                   queries in at most N databases at a time
+                                   (default: no limit)
+      --record-fixture=FILE    record the results of all queries made into FILE
+      --fixture=FILE           don't connect to db, instead replay the query
+                                   results recorded in FILE; the output is the
+                                   same each time
+      --suspicious-queries     look for patterns seen in SQL injection attempts
+                                   (like pg_sleep calls and UNION probes) in
+                                   statements, activity and the log
+      --reset-statements       reset the statistics of pg_stat_statements after
+                                   collecting them, so that the next run
+                                   reports only the statements since this one
+      --schema-fingerprints    compute a hash of the definition of each table,
+                                   view and function, to detect schema drift
+      --lo-orphans             count the large objects not referenced from any
+                                   oid or lo column (scans each such table;
+                                   skipped with --max-server-cost)
+      --preflight              before collecting, connect to check that the
+                                   databases can be connected to, that the
+                                   role can see the statistics of other roles
+                                   and that pg_stat_statements can be queried
+      --replica=CONNINFO       run the expensive queries (bloat, large objects,
+                                   schema fingerprints) on this standby of the
+                                   cluster instead, like "host=replica1"
       --aws-rds-dbid           AWS RDS/Aurora database instance identifier
 
 Output options:
-  -f, --format=FORMAT          output format; "human", "json" or "csv" (default: "human")
+      --cluster-name=NAME      name to record for this cluster in the output
+      --label=KEY=VALUE        label to record in the output; can be repeated
+  -f, --format=FORMAT          output format; "human", "json", "csv", or a health
+                                   summary that can be posted to a webhook,
+                                   "slack" or "teams" (default: "human")
   -l, --toolong=SECS           for human output, transactions running longer than
                                    this are considered too long (default: 60)
+      --time-format=FMT        for human output, show times with a "12h" (default)
+                                   or "24h" clock
+      --time-zone=ZONE         for human output, show times in this zone, with
+                                   the zone name: "UTC", or a name like
+                                   "Europe/Berlin" (default: "local", the
+                                   local zone, without the zone name)
+      --thousands-sep=SEP      for human output, separate thousands in counters
+                                   with SEP, like "," or "." (default: none)
   -o, --output=FILE            write output to the specified file
+      --embed-checks           for json output, include the health summary
+                                   checks with their thresholds and results
+      --redact=PROFILE         remove or mask information for less trusted
+                                   consumers: "developer" (no network or
+                                   access details), "vendor" (also no SQL or
+                                   user names), "full" (nothing removed), or
+                                   a JSON file with the "drop" and "mask"
+                                   lists of keys
       --no-pager               do not invoke the pager for tty output
+      --status-file=FILE       write a JSON summary of the run to FILE as it
+                                   progresses, with the status ("ok" only if
+                                   the run succeeded), the sections run with
+                                   their status and duration, and the health
+                                   check outcome
+      --encrypt=FILE           encrypt the output file (-o) with the passphrase
+                                   in FILE; with -i, decrypt encrypted input
+                                   file(s) using the passphrase
+      --sign-key=FILE          sign the output file (-o) using the secret key in
+                                   FILE, into a ".sig" file alongside it; with
+                                   -i, verify the input file(s) using the key
+      --email-to=ADDRS         also email the health summary and text report to
+                                   these comma-separated addresses
+      --email-from=ADDR        sender address for email (default:
+                                   pgmetrics@HOSTNAME)
+      --email-on-issues        send the email only if the health summary has
+                                   any issues
+      --smtp-server=HOST:PORT  SMTP server to send email through; port 465 uses
+                                   TLS, others STARTTLS if offered (default:
+                                   "localhost:25")
+      --smtp-auth=FILE         authenticate to the SMTP server using
+                                   "user:password" in FILE
 
 Connection options:
   -h, --host=HOSTNAME          database server host or socket directory
-                                   (default: "%s")
+                                   (default: %s)
   -p, --port=PORT              database server port (default: %d)
   -U, --username=USERNAME      database user name (default: "%s")
   -w, --no-password            never prompt for password
+      --peer                   connect over the local unix socket using peer
+                                   authentication, as the OS user; implies -w
+      --auto-detect[=N|all]    collect from a server running on this host,
+                                   found from its processes; if there are
+                                   many, ask which one, or use the N'th, or
+                                   all of them one after the other
+      --target=[NAME=]PORT     collect from the server on this port, or
+                                   "[NAME=]HOST:PORT"; can be repeated to
+                                   collect from each in turn; NAME is the
+                                   cluster name to record, and with many
+                                   targets, the output for each goes to the
+                                   -o file with NAME (or the port) added,
+                                   like "out-NAME.json"
+      --combined               with many servers (--target or --auto-detect),
+                                   write a side-by-side report of them, to
+                                   stdout or the -o file
       --role=ROLE              do SET ROLE before collection
 
 For more information, visit <https://pgmetrics.io>.
@@ -120,6 +283,10 @@ more details about these refer to the AWS documentation.
 `
 
 var version string // set during build
+
+// maxCompare is the max number of snapshots that can be displayed side by side.
+const maxCompare = 3
+
 var ignoreEnvs = []string{
 	"PGHOSTADDR", "PGSERVICE", "PGSERVICEFILE", "PGREALM", "PGREQUIRESSL",
 	"PGSSLCRL", "PGREQUIREPEER", "PGKRBSRVNAME", "PGGSSLIB", "PGSYSCONFDIR",
@@ -129,23 +296,55 @@ var ignoreEnvs = []string{
 type options struct {
 	// collection options
 	collector.CollectConfig
+	profile string
 	// general
 	input     string
 	help      string
 	helpShort bool
 	version   bool
 	// output
-	format     string
-	output     string
-	tooLongSec uint
-	nopager    bool
+	format      string
+	output      string
+	tooLongSec  uint
+	timeFormat  string
+	timeZone    string
+	location    *time.Location // from timeZone, nil if local
+	thousands   string
+	nopager     bool
+	clusterName string
+	labels      []string
+	signKey     string
+	verify      bool
+	encrypt     string
+	command     string // "collect", "report", "check", "diff" or "" if none
+	drift       bool
+	trend       bool
+	rollup      bool
+	logFollow   bool
+	statusFile  string
+	embedChecks bool
+	redact      string
+	// email
+	emailTo       []string
+	emailFrom     string
+	emailOnIssues bool
+	smtpServer    string
+	smtpAuth      string
 	// connection
 	passNone bool
+	peer     bool
+	// auto-detect: "" if not used, "ask", "all" or the 1-based number
+	autoDetect string
+	// servers given with --target
+	targetSpecs []string
+	targets     []target
+	combined    bool
 }
 
 func (o *options) defaults() {
 	// collection options
 	o.CollectConfig = collector.DefaultCollectConfig()
+	o.profile = ""
 	// general
 	o.input = ""
 	o.help = ""
@@ -155,9 +354,36 @@ func (o *options) defaults() {
 	o.format = "human"
 	o.output = ""
 	o.tooLongSec = 60
+	o.timeFormat = "12h"
+	o.timeZone = "local"
+	o.location = nil
+	o.thousands = ""
 	o.nopager = false
+	o.clusterName = ""
+	o.labels = nil
+	o.signKey = ""
+	o.verify = false
+	o.encrypt = ""
+	o.drift = false
+	o.trend = false
+	o.rollup = false
+	o.logFollow = false
+	o.statusFile = ""
+	o.embedChecks = false
+	o.redact = ""
+	// email
+	o.emailTo = nil
+	o.emailFrom = ""
+	o.emailOnIssues = false
+	o.smtpServer = "localhost:25"
+	o.smtpAuth = ""
 	// connection
 	o.passNone = false
+	o.peer = false
+	o.autoDetect = ""
+	o.targetSpecs = nil
+	o.targets = nil
+	o.combined = false
 }
 
 func (o *options) usage(code int) {
@@ -166,13 +392,28 @@ func (o *options) usage(code int) {
 		fp = os.Stderr
 	}
 	if o.helpShort || code != 0 || o.help == "short" {
-		fmt.Fprintf(fp, usage, o.CollectConfig.Host, o.CollectConfig.Port, o.CollectConfig.User)
+		host := strconv.Quote(o.CollectConfig.Host)
+		if len(o.CollectConfig.Host) == 0 {
+			host = "socket directory of the local server"
+		}
+		fmt.Fprintf(fp, usage, host, o.CollectConfig.Port, o.CollectConfig.User)
 	} else if o.help == "variables" {
 		fmt.Fprint(fp, variables)
 	}
 	os.Exit(code)
 }
 
+// reportOptions returns the options for rendering the report, summary and
+// other outputs.
+func (o *options) reportOptions() report.Options {
+	return report.Options{
+		TooLongSecs:  o.tooLongSec,
+		Location:     o.location,
+		Clock24:      o.timeFormat == "24h",
+		ThousandsSep: o.thousands,
+	}
+}
+
 func printTry() {
 	fmt.Fprintf(os.Stderr, "Try \"pgmetrics --help\" for more information.\n")
 }
@@ -184,7 +425,7 @@ func getRegexp(r string) (err error) {
 	return
 }
 
-func (o *options) parse() (args []string) {
+func (o *options) parse(argv []string) (args []string) {
 	// make getopt
 	s := getopt.New()
 	s.SetUsage(printTry)
@@ -195,7 +436,12 @@ func (o *options) parse() (args []string) {
 	s.StringVarLong(&o.input, "input", 'i', "")
 	help := s.StringVarLong(&o.help, "help", '?', "").SetOptional()
 	s.BoolVarLong(&o.version, "version", 'V', "").SetFlag()
+	s.BoolVarLong(&o.verify, "verify", 0, "").SetFlag()
+	s.BoolVarLong(&o.drift, "drift", 0, "").SetFlag()
+	s.BoolVarLong(&o.trend, "trend", 0, "").SetFlag()
+	s.BoolVarLong(&o.rollup, "rollup", 0, "").SetFlag()
 	// collection
+	s.StringVarLong(&o.profile, "profile", 0, "")
 	s.StringVarLong(&o.CollectConfig.Schema, "schema", 'c', "")
 	s.StringVarLong(&o.CollectConfig.ExclSchema, "exclude-schema", 'C', "")
 	s.StringVarLong(&o.CollectConfig.Table, "table", 'a', "")
@@ -203,35 +449,114 @@ func (o *options) parse() (args []string) {
 	s.ListVarLong(&o.CollectConfig.Omit, "omit", 0, "")
 	s.UintVarLong(&o.CollectConfig.SQLLength, "sql-length", 0, "")
 	s.UintVarLong(&o.CollectConfig.StmtsLimit, "statements-limit", 0, "")
+	s.StringVarLong(&o.CollectConfig.ActivityQuery, "activity-query", 0, "")
+	s.UintVarLong(&o.CollectConfig.ExplainTop, "explain-top", 0, "")
 	s.BoolVarLong(&o.CollectConfig.OnlyListedDBs, "only-listed", 0, "").SetFlag()
 	s.StringVarLong(&o.CollectConfig.LogFile, "log-file", 0, "")
 	s.UintVarLong(&o.CollectConfig.LogSpan, "log-span", 0, "")
+	s.StringVarLong(&o.CollectConfig.LogWrapField, "log-wrapped", 0, "")
+	s.BoolVarLong(&o.logFollow, "log-follow", 0, "").SetFlag()
+	s.UintVarLong(&o.CollectConfig.WALSampleSec, "wal-sample", 0, "")
+	s.UintVarLong(&o.CollectConfig.SampleIntervalSec, "sample-interval", 0, "")
+	s.BoolVarLong(&o.CollectConfig.MaxServerCost, "max-server-cost", 0, "").SetFlag()
+	s.UintVarLong(&o.CollectConfig.MaxConnections, "max-connections", 0, "")
+	s.UintVarLong(&o.CollectConfig.MaxHeavyQueries, "max-heavy-queries", 0, "")
+	s.StringVarLong(&o.CollectConfig.RecordFixture, "record-fixture", 0, "")
+	s.StringVarLong(&o.CollectConfig.Fixture, "fixture", 0, "")
+	s.BoolVarLong(&o.CollectConfig.SuspiciousQueries, "suspicious-queries", 0, "").SetFlag()
+	s.BoolVarLong(&o.CollectConfig.SchemaFingerprints, "schema-fingerprints", 0, "").SetFlag()
+	s.BoolVarLong(&o.CollectConfig.LargeObjectOrphans, "lo-orphans", 0, "").SetFlag()
+	s.BoolVarLong(&o.CollectConfig.Preflight, "preflight", 0, "").SetFlag()
+	s.BoolVarLong(&o.CollectConfig.ResetStatements, "reset-statements", 0, "").SetFlag()
+	s.StringVarLong(&o.CollectConfig.Replica, "replica", 0, "")
 	s.StringVarLong(&o.CollectConfig.RDSDBIdentifier, "aws-rds-dbid", 0, "")
 	// output
 	s.StringVarLong(&o.format, "format", 'f', "")
 	s.StringVarLong(&o.output, "output", 'o', "")
 	s.UintVarLong(&o.tooLongSec, "toolong", 'l', "")
+	s.StringVarLong(&o.timeFormat, "time-format", 0, "")
+	s.StringVarLong(&o.timeZone, "time-zone", 0, "")
+	s.StringVarLong(&o.thousands, "thousands-sep", 0, "")
 	s.BoolVarLong(&o.nopager, "no-pager", 0, "").SetFlag()
+	s.StringVarLong(&o.clusterName, "cluster-name", 0, "")
+	s.ListVarLong(&o.labels, "label", 0, "")
+	s.StringVarLong(&o.signKey, "sign-key", 0, "")
+	s.StringVarLong(&o.encrypt, "encrypt", 0, "")
+	s.BoolVarLong(&o.embedChecks, "embed-checks", 0, "").SetFlag()
+	s.StringVarLong(&o.redact, "redact", 0, "")
+	s.StringVarLong(&o.statusFile, "status-file", 0, "")
+	s.ListVarLong(&o.emailTo, "email-to", 0, "")
+	s.StringVarLong(&o.emailFrom, "email-from", 0, "")
+	s.BoolVarLong(&o.emailOnIssues, "email-on-issues", 0, "").SetFlag()
+	s.StringVarLong(&o.smtpServer, "smtp-server", 0, "")
+	s.StringVarLong(&o.smtpAuth, "smtp-auth", 0, "")
 	// connection
 	s.StringVarLong(&o.CollectConfig.Host, "host", 'h', "")
 	s.Uint16VarLong(&o.CollectConfig.Port, "port", 'p', "")
 	s.StringVarLong(&o.CollectConfig.User, "username", 'U', "")
 	s.BoolVarLong(&o.passNone, "no-password", 'w', "")
+	s.BoolVarLong(&o.peer, "peer", 0, "").SetFlag()
+	autoDetect := s.StringVarLong(&o.autoDetect, "auto-detect", 0, "").SetOptional()
+	s.ListVarLong(&o.targetSpecs, "target", 0, "")
+	s.BoolVarLong(&o.combined, "combined", 0, "").SetFlag()
 	s.StringVarLong(&o.CollectConfig.Role, "role", 0, "")
 
 	// parse
-	s.Parse(os.Args)
+	s.Parse(argv)
 	if help.Seen() && o.help == "" {
 		o.help = "short"
 	}
+	if autoDetect.Seen() && o.autoDetect == "" {
+		o.autoDetect = "ask"
+	}
+	args = s.Args()
+	if (o.command == "report" || o.command == "diff") && len(o.input) == 0 && len(args) > 0 {
+		o.input, args = args[0], args[1:]
+	}
 
 	// check values
 	if o.help != "" && o.help != "short" && o.help != "variables" {
 		printTry()
 		os.Exit(2)
 	}
-	if o.format != "human" && o.format != "json" && o.format != "csv" {
-		fmt.Fprintln(os.Stderr, `option -f/--format must be "human", "json" or "csv"`)
+	if len(o.profile) > 0 && !applyProfile(o, s, o.profile) {
+		fmt.Fprintln(os.Stderr, `option --profile must be "quick", "standard" or "deep"`)
+		printTry()
+		os.Exit(2)
+	}
+	if _, ok := encoders[o.format]; !ok {
+		fmt.Fprintln(os.Stderr, "option -f/--format must be "+encoderNames())
+		printTry()
+		os.Exit(2)
+	}
+	if o.timeFormat != "12h" && o.timeFormat != "24h" {
+		fmt.Fprintln(os.Stderr, `option --time-format must be "12h" or "24h"`)
+		printTry()
+		os.Exit(2)
+	}
+	if o.timeZone != "local" {
+		loc, err := time.LoadLocation(o.timeZone)
+		if err != nil || o.timeZone == "" || o.timeZone == "Local" {
+			fmt.Fprintf(os.Stderr, "bad value \"%s\" for --time-zone, must be \"local\", \"UTC\" or a zone name like \"Europe/Berlin\"\n", o.timeZone)
+			printTry()
+			os.Exit(2)
+		}
+		o.location = loc
+	}
+	if _, ok := redactProfiles[o.redact]; len(o.redact) > 0 && !ok {
+		if _, err := os.Stat(o.redact); err != nil {
+			fmt.Fprintln(os.Stderr, `option --redact must be "developer", "vendor", "full" or a file`)
+			printTry()
+			os.Exit(2)
+		}
+	}
+	if o.embedChecks && o.format != "json" {
+		fmt.Fprintln(os.Stderr, "option --embed-checks needs JSON output (-f json)")
+		printTry()
+		os.Exit(2)
+	}
+	if o.CollectConfig.MaxConnections == 0 {
+		fmt.Fprintln(os.Stderr, "option --max-connections must be at least 1")
 		printTry()
 		os.Exit(2)
 	}
@@ -240,6 +565,77 @@ func (o *options) parse() (args []string) {
 		printTry()
 		os.Exit(2)
 	}
+	// without a host, the collector connects over the socket of the local
+	// server on the port, found only when connecting
+	if !s.IsSet("host") && (o.peer || os.Getenv("PGHOST") == "") {
+		o.CollectConfig.Host = ""
+	}
+	if len(o.autoDetect) > 0 {
+		n, err := strconv.Atoi(o.autoDetect)
+		if o.autoDetect != "ask" && o.autoDetect != "all" && (err != nil || n < 1) {
+			fmt.Fprintln(os.Stderr, `option --auto-detect must be a positive number or "all"`)
+			printTry()
+			os.Exit(2)
+		}
+		if s.IsSet("host") || s.IsSet("port") || len(o.input) > 0 || len(o.CollectConfig.Fixture) > 0 {
+			fmt.Fprintln(os.Stderr, "option --auto-detect cannot be used with -h/--host, -p/--port, -i/--input or --fixture")
+			printTry()
+			os.Exit(2)
+		}
+	}
+	if len(o.targetSpecs) > 0 {
+		if len(o.autoDetect) > 0 || s.IsSet("port") || len(o.input) > 0 || len(o.CollectConfig.Fixture) > 0 {
+			fmt.Fprintln(os.Stderr, "option --target cannot be used with --auto-detect, -p/--port, -i/--input or --fixture")
+			printTry()
+			os.Exit(2)
+		}
+		names := make(map[string]bool)
+		for _, spec := range o.targetSpecs {
+			t, err := parseTarget(spec)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				printTry()
+				os.Exit(2)
+			}
+			if names[t.name] {
+				fmt.Fprintf(os.Stderr, "more than one target named \"%s\", use NAME=HOST:PORT\n", t.name)
+				printTry()
+				os.Exit(2)
+			}
+			names[t.name] = true
+			// like -p, an empty host is the socket directory for the port
+			// of the target
+			if len(t.host) == 0 {
+				t.host = o.CollectConfig.Host
+			}
+			o.targets = append(o.targets, t)
+		}
+	}
+	if o.combined {
+		if len(o.targets) < 2 && o.autoDetect != "all" && o.autoDetect != "ask" {
+			fmt.Fprintln(os.Stderr, "option --combined needs two or more --target, or --auto-detect")
+			printTry()
+			os.Exit(2)
+		}
+		if len(o.targets) > maxCompare {
+			fmt.Fprintf(os.Stderr, "at most %d servers can be displayed side by side\n", maxCompare)
+			printTry()
+			os.Exit(2)
+		}
+		if o.format != "human" {
+			fmt.Fprintln(os.Stderr, `option --combined can be used only with "human" format`)
+			printTry()
+			os.Exit(2)
+		}
+	}
+	if o.peer {
+		if h := o.CollectConfig.Host; len(h) > 0 && !strings.HasPrefix(h, "/") {
+			fmt.Fprintln(os.Stderr, "option --peer needs a unix socket directory for -h/--host")
+			printTry()
+			os.Exit(2)
+		}
+		o.passNone = true
+	}
 	if o.CollectConfig.TimeoutSec == 0 {
 		fmt.Fprintln(os.Stderr, "timeout must be greater than 0")
 		printTry()
@@ -275,6 +671,146 @@ func (o *options) parse() (args []string) {
 		}
 	}
 
+	if aq := o.CollectConfig.ActivityQuery; aq != "" && aq != "full" && aq != "none" {
+		if n, err := strconv.Atoi(aq); err != nil || n < 0 {
+			fmt.Fprintln(os.Stderr, `option --activity-query must be "full", "none" or a number`)
+			printTry()
+			os.Exit(2)
+		}
+	}
+
+	for _, l := range o.labels {
+		if pos := strings.IndexByte(l, '='); pos < 1 {
+			fmt.Fprintf(os.Stderr, "bad label \"%s\", must be of the form KEY=VALUE\n", l)
+			printTry()
+			os.Exit(2)
+		}
+	}
+	if len(o.signKey) > 0 && len(o.input) == 0 && (o.output == "" || o.output == "-") {
+		fmt.Fprintln(os.Stderr, "option --sign-key needs an output file (-o/--output)")
+		printTry()
+		os.Exit(2)
+	}
+	if len(o.encrypt) > 0 && len(o.input) == 0 && (o.output == "" || o.output == "-") {
+		fmt.Fprintln(os.Stderr, "option --encrypt needs an output file (-o/--output)")
+		printTry()
+		os.Exit(2)
+	}
+	if len(o.CollectConfig.Fixture) > 0 && (len(o.CollectConfig.RecordFixture) > 0 || len(o.input) > 0) {
+		fmt.Fprintln(os.Stderr, "option --fixture cannot be used with --record-fixture or -i/--input")
+		printTry()
+		os.Exit(2)
+	}
+	if o.CollectConfig.ResetStatements {
+		if len(o.CollectConfig.Fixture) > 0 || len(o.input) > 0 {
+			fmt.Fprintln(os.Stderr, "option --reset-statements cannot be used with --fixture or -i/--input")
+			printTry()
+			os.Exit(2)
+		}
+		for _, om := range o.CollectConfig.Omit {
+			if om == "statements" {
+				fmt.Fprintln(os.Stderr, "option --reset-statements cannot be used with --omit=statements")
+				printTry()
+				os.Exit(2)
+			}
+		}
+	}
+	if o.command == "collect" && len(o.input) > 0 {
+		fmt.Fprintln(os.Stderr, `option -i/--input cannot be used with "pgmetrics collect", use "pgmetrics report"`)
+		printTry()
+		os.Exit(2)
+	}
+	if o.command == "report" && len(o.input) == 0 {
+		fmt.Fprintln(os.Stderr, `"pgmetrics report" needs one or more files: pgmetrics report FILE...`)
+		printTry()
+		os.Exit(2)
+	}
+	if o.command == "diff" && (len(o.input) == 0 || len(args) == 0) {
+		fmt.Fprintln(os.Stderr, `"pgmetrics diff" needs two or more files: pgmetrics diff FILE FILE...`)
+		printTry()
+		os.Exit(2)
+	}
+	if o.command == "check" {
+		if o.format != "human" && o.format != "slack" && o.format != "teams" {
+			fmt.Fprintln(os.Stderr, `"pgmetrics check" can be used only with "human", "slack" or "teams" format`)
+			printTry()
+			os.Exit(2)
+		}
+		if len(o.input) > 0 && len(args) > 0 {
+			fmt.Fprintln(os.Stderr, `"pgmetrics check" can read only one file`)
+			printTry()
+			os.Exit(2)
+		}
+	}
+	if o.drift && (len(o.input) == 0 || len(args) == 0) {
+		fmt.Fprintln(os.Stderr, "option --drift needs two or more files: -i FILE FILE...")
+		printTry()
+		os.Exit(2)
+	}
+	if o.trend && (len(o.input) == 0 || len(args) == 0) {
+		fmt.Fprintln(os.Stderr, "option --trend needs two or more files: -i FILE FILE...")
+		printTry()
+		os.Exit(2)
+	}
+	if o.trend && o.drift {
+		fmt.Fprintln(os.Stderr, "options --trend and --drift cannot be used together")
+		printTry()
+		os.Exit(2)
+	}
+	if o.logFollow && (len(o.input) > 0 || len(o.CollectConfig.Fixture) > 0 ||
+		len(o.autoDetect) > 0 || o.command != "") {
+		fmt.Fprintln(os.Stderr, "option --log-follow cannot be used with -i/--input, --fixture, --auto-detect or commands")
+		printTry()
+		os.Exit(2)
+	}
+	if o.logFollow && len(o.CollectConfig.LogWrapField) > 0 {
+		fmt.Fprintln(os.Stderr, "option --log-follow cannot be used with --log-wrapped")
+		printTry()
+		os.Exit(2)
+	}
+	if o.rollup && len(o.input) == 0 {
+		fmt.Fprintln(os.Stderr, "option --rollup needs one or more files: -i FILE [FILE...]")
+		printTry()
+		os.Exit(2)
+	}
+	if o.rollup && (o.trend || o.drift) {
+		fmt.Fprintln(os.Stderr, "option --rollup cannot be used with --trend or --drift")
+		printTry()
+		os.Exit(2)
+	}
+	if o.rollup && o.format != "human" {
+		fmt.Fprintln(os.Stderr, `option --rollup can be used only with "human" format`)
+		printTry()
+		os.Exit(2)
+	}
+	if len(o.emailTo) > 0 && (o.drift || o.trend || o.rollup || len(args) > 0 && len(o.input) > 0) {
+		fmt.Fprintln(os.Stderr, "option --email-to cannot be used with multiple input files")
+		printTry()
+		os.Exit(2)
+	}
+	if _, _, err := net.SplitHostPort(o.smtpServer); err != nil {
+		fmt.Fprintln(os.Stderr, "option --smtp-server must be of the form HOST:PORT")
+		printTry()
+		os.Exit(2)
+	}
+	if o.verify && (len(o.signKey) == 0 || len(o.input) == 0) {
+		fmt.Fprintln(os.Stderr, "option --verify needs -i/--input and --sign-key")
+		printTry()
+		os.Exit(2)
+	}
+	if len(o.input) > 0 && len(args) > 0 {
+		if len(args) > maxCompare-1 && !o.drift && !o.trend && !o.rollup {
+			fmt.Fprintf(os.Stderr, "at most %d files can be displayed side by side\n", maxCompare)
+			printTry()
+			os.Exit(2)
+		}
+		if o.format != "human" {
+			fmt.Fprintln(os.Stderr, `multiple input files can be displayed only in "human" format`)
+			printTry()
+			os.Exit(2)
+		}
+	}
+
 	// help action
 	if o.helpShort || o.help == "short" || o.help == "variables" {
 		o.usage(0)
@@ -290,37 +826,70 @@ func (o *options) parse() (args []string) {
 	}
 
 	// return remaining args
-	return s.Args()
+	return args
 }
 
-func writeTo(fd io.Writer, o options, result *pgmetrics.Model) {
-	switch o.format {
-	case "json":
-		writeJSONTo(fd, result)
-	case "csv":
-		writeCSVTo(fd, result)
-	default:
-		writeHumanTo(fd, o, result)
+func writeTo(fd io.Writer, o options, results []*pgmetrics.Model) {
+	ro := o.reportOptions()
+	if o.command == "check" && o.format == "human" {
+		for _, result := range results {
+			if err := report.WriteSummary(fd, result, ro); err != nil {
+				log.Fatal(err)
+			}
+		}
+		return
+	}
+	if o.drift {
+		if err := report.WriteDrift(fd, results, ro); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if o.trend {
+		if err := report.WriteTrend(fd, results, ro); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if o.rollup {
+		if err := report.WriteRollup(fd, results, ro); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
+	if len(results) > 1 && len(o.input) == 0 && !o.combined {
+		// collected from each of the servers found by --auto-detect, or
+		// given with --target
+		for _, result := range results {
+			writeModelTo(fd, o, ro, result)
+		}
+		return
+	}
+	if len(results) > 1 {
+		if err := report.WriteCompare(fd, results, ro); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	writeModelTo(fd, o, ro, results[0])
 }
 
-func writeJSONTo(fd io.Writer, result *pgmetrics.Model) {
-	enc := json.NewEncoder(fd)
-	enc.SetIndent("", "  ")
-	if err := enc.Encode(result); err != nil {
+func writeModelTo(fd io.Writer, o options, ro report.Options, result *pgmetrics.Model) {
+	if o.format == "json" && o.embedChecks {
+		result.HealthChecks = report.HealthChecks(result, ro)
+	}
+	if err := encoders[o.format].Encode(fd, result, ro); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func writeCSVTo(fd io.Writer, result *pgmetrics.Model) {
-	w := csv.NewWriter(fd)
-	if err := model2csv(result, w); err != nil {
+func writeJSONTo(fd io.Writer, result *pgmetrics.Model) {
+	if err := encodeJSON(fd, result, report.Options{}); err != nil {
 		log.Fatal(err)
 	}
-	w.Flush()
 }
 
-func process(result *pgmetrics.Model, o options, args []string) {
+func process(results []*pgmetrics.Model, o options, args []string) {
 	if o.output == "-" {
 		o.output = ""
 	}
@@ -345,18 +914,36 @@ func process(result *pgmetrics.Model, o options, args []string) {
 		if err := cmd.Start(); err != nil {
 			log.Fatal(err)
 		}
-		writeTo(pagerStdin, o, result)
+		writeTo(pagerStdin, o, results)
 		pagerStdin.Close()
 		_ = cmd.Wait()
+	} else if o.output != "" && len(o.encrypt) > 0 {
+		var buf bytes.Buffer
+		writeTo(&buf, o, results)
+		data, err := encrypt(buf.Bytes(), readSecretFile(o.encrypt))
+		if err != nil {
+			log.Fatalf("encryption failed: %v", err)
+		}
+		if err := ioutil.WriteFile(o.output, data, 0600); err != nil {
+			log.Fatal(err)
+		}
+		if len(o.signKey) > 0 && len(o.input) == 0 {
+			signFile(o.output, readSecretFile(o.signKey))
+		}
 	} else if o.output != "" {
 		f, err := os.Create(o.output)
 		if err != nil {
 			log.Fatal(err)
 		}
-		writeTo(f, o, result)
-		f.Close()
+		writeTo(f, o, results)
+		if err := f.Close(); err != nil {
+			log.Fatal(err)
+		}
+		if len(o.signKey) > 0 && len(o.input) == 0 {
+			signFile(o.output, readSecretFile(o.signKey))
+		}
 	} else {
-		writeTo(os.Stdout, o, result)
+		writeTo(os.Stdout, o, results)
 	}
 }
 
@@ -364,11 +951,42 @@ func main() {
 	for _, e := range ignoreEnvs {
 		os.Unsetenv(e)
 	}
+	if len(os.Args) > 1 && os.Args[1] == "merge" {
+		mergeMain(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "query" {
+		queryMain(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "selftest" {
+		selftestMain(os.Args[2:])
+		return
+	}
 
 	var o options
 	o.defaults()
-	args := o.parse()
-	if !o.passNone && len(o.input) == 0 && os.Getenv("PGPASSWORD") == "" {
+	argv := os.Args
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "collect", "report", "check", "diff":
+			o.command = os.Args[1]
+			argv = append([]string{os.Args[0]}, os.Args[2:]...)
+		}
+	}
+	args := o.parse(argv)
+	log.SetFlags(0)
+	log.SetPrefix("pgmetrics: ")
+	if len(o.statusFile) > 0 {
+		startStatus(o.statusFile)
+	}
+
+	var servers []collector.LocalServer
+	if len(o.autoDetect) > 0 {
+		servers = autoDetect(o.autoDetect)
+	}
+	if !o.passNone && len(o.input) == 0 && len(o.CollectConfig.Fixture) == 0 &&
+		os.Getenv("PGPASSWORD") == "" {
 		fmt.Fprint(os.Stderr, "Password: ")
 		p, err := gopass.GetPasswd()
 		if err != nil {
@@ -377,32 +995,206 @@ func main() {
 		o.CollectConfig.Password = string(p)
 	}
 
-	log.SetFlags(0)
-	log.SetPrefix("pgmetrics: ")
+	if o.logFollow {
+		section("follow", o.CollectConfig.LogFile, func() { followLog(o, args) })
+		finishStatus(o, nil)
+		return
+	}
 
 	// collect or load data
-	var result *pgmetrics.Model
+	var results []*pgmetrics.Model
 	if len(o.input) > 0 {
-		f, err := os.Open(o.input)
-		if err != nil {
-			log.Fatal(err)
+		inputs := append([]string{o.input}, args...)
+		if len(o.signKey) > 0 {
+			key := readSecretFile(o.signKey)
+			for _, input := range inputs {
+				section("verify", input, func() {
+					if err := verifyFile(input, key); err != nil {
+						log.Fatalf("%s: %v", input, err)
+					}
+				})
+				if o.verify {
+					fmt.Printf("%s: signature OK\n", input)
+				}
+			}
+			if o.verify {
+				finishStatus(o, nil)
+				os.Exit(0)
+			}
+		}
+		var passphrase []byte
+		if len(o.encrypt) > 0 {
+			passphrase = readSecretFile(o.encrypt)
 		}
-		var obj pgmetrics.Model
-		if err = json.NewDecoder(f).Decode(&obj); err != nil {
-			log.Fatalf("%s: %v", o.input, err)
+		for _, input := range inputs {
+			section("load", input, func() {
+				results = append(results, loadModel(input, passphrase))
+			})
 		}
-		result = &obj
-		f.Close()
 	} else {
-		result = collector.Collect(o.CollectConfig, args)
-		// add the user agent
-		if len(version) == 0 {
-			result.Metadata.UserAgent = "pgmetrics/devel"
+		configs := []collector.CollectConfig{o.CollectConfig}
+		if len(o.targets) > 0 {
+			configs = nil
+			for _, t := range o.targets {
+				cc := o.CollectConfig
+				cc.Host, cc.Port = t.host, t.port
+				configs = append(configs, cc)
+			}
+		}
+		if len(servers) > 0 {
+			configs = nil
+			for _, ls := range servers {
+				cc := o.CollectConfig
+				cc.Port = ls.Port
+				if len(ls.SocketDir) > 0 {
+					cc.Host = ls.SocketDir
+				} else {
+					cc.Host = "localhost"
+				}
+				configs = append(configs, cc)
+			}
+		}
+		section("preflight", "", func() { preflight(o, configs, args) })
+		for i, cc := range configs {
+			var result *pgmetrics.Model
+			section("collect", cc.Host+":"+strconv.Itoa(int(cc.Port)), func() {
+				result = collector.Collect(cc, args)
+			})
+			// add the user agent
+			if len(version) == 0 {
+				result.Metadata.UserAgent = "pgmetrics/devel"
+			} else {
+				result.Metadata.UserAgent = "pgmetrics/" + version
+			}
+			// add the cluster name and labels
+			result.Metadata.ClusterName = o.clusterName
+			if len(o.targets) > 0 && o.targets[i].named {
+				result.Metadata.ClusterName = o.targets[i].name
+			}
+			for _, l := range o.labels {
+				if result.Metadata.Labels == nil {
+					result.Metadata.Labels = make(map[string]string)
+				}
+				pos := strings.IndexByte(l, '=')
+				result.Metadata.Labels[l[:pos]] = l[pos+1:]
+			}
+			results = append(results, result)
+		}
+	}
+
+	// remove what the consumers of the output should not see
+	if len(o.redact) > 0 {
+		section("redact", o.redact, func() {
+			p, err := getRedactProfile(o.redact)
+			if err != nil {
+				log.Fatal(err)
+			}
+			for _, r := range results {
+				if err := redact(r, p); err != nil {
+					log.Fatalf("redaction failed: %v", err)
+				}
+				r.Metadata.Redaction = o.redact
+			}
+		})
+	}
+
+	// process it, into a file for each target if there are many
+	if len(o.targets) > 1 && o.output != "" && o.output != "-" {
+		for i, r := range results {
+			ot := o
+			ot.output = targetOutput(o.output, o.targets[i])
+			ot.combined = false
+			section("output", ot.output, func() { process([]*pgmetrics.Model{r}, ot, args) })
+		}
+		if o.combined {
+			section("output", o.output, func() { process(results, o, args) })
+		}
+	} else {
+		output := o.output
+		if output == "" || output == "-" {
+			output = "stdout"
+		}
+		section("output", output, func() { process(results, o, args) })
+	}
+	if len(o.emailTo) > 0 {
+		for _, r := range results {
+			section("email", strings.Join(o.emailTo, ","), func() { emailReport(o, r) })
+		}
+	}
+	finishStatus(o, results)
+	if o.command == "check" {
+		for _, r := range results {
+			if len(report.Issues(r, o.reportOptions())) > 0 {
+				os.Exit(1)
+			}
+		}
+	}
+}
+
+// preflight checks that the collections can be done and the output written,
+// before starting the collections. All the problems found are reported, and
+// those that would make the collection or the output fail cause an exit.
+func preflight(o options, configs []collector.CollectConfig, args []string) {
+	var problems []collector.PreflightProblem
+	var outputs []string
+	if o.output != "" && o.output != "-" {
+		outputs = append(outputs, o.output)
+		if len(o.targets) > 1 {
+			if !o.combined {
+				outputs = nil
+			}
+			for _, t := range o.targets {
+				outputs = append(outputs, targetOutput(o.output, t))
+			}
+		}
+	}
+	for _, output := range outputs {
+		_, statErr := os.Stat(output)
+		if f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE, 0644); err != nil {
+			problems = append(problems, collector.PreflightProblem{
+				Message: fmt.Sprintf("cannot write output file: %v", err),
+			})
 		} else {
-			result.Metadata.UserAgent = "pgmetrics/" + version
+			f.Close()
+			if os.IsNotExist(statErr) {
+				os.Remove(output)
+			}
 		}
 	}
+	for _, cc := range configs {
+		problems = append(problems, collector.Preflight(cc, args)...)
+	}
+	failed := false
+	for _, p := range problems {
+		if p.Warning {
+			log.Printf("warning: %s", p.Message)
+		} else {
+			log.Print(p.Message)
+			failed = true
+		}
+	}
+	if failed {
+		log.Fatal("not collecting, fix the problems above and retry")
+	}
+}
 
-	// process it
-	process(result, o, args)
+// loadModel reads a JSON file, decrypting it first if it is encrypted.
+func loadModel(input string, passphrase []byte) *pgmetrics.Model {
+	data, err := readInput(input)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if isEncrypted(data) {
+		if passphrase == nil {
+			log.Fatalf("%s: file is encrypted, use --encrypt to specify the passphrase", input)
+		}
+		if data, err = decrypt(data, passphrase); err != nil {
+			log.Fatalf("%s: %v", input, err)
+		}
+	}
+	var obj pgmetrics.Model
+	if err = json.Unmarshal(data, &obj); err != nil {
+		log.Fatalf("%s: %v", input, err)
+	}
+	return &obj
 }
@@ -0,0 +1,204 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/pborman/getopt"
+	"github.com/rapidloop/pgmetrics"
+)
+
+const mergeUsage = `pgmetrics merge combines JSON outputs of pgmetrics, collected separately
+from different databases of the same cluster, into a single JSON output.
+
+Usage:
+  pgmetrics merge [OPTION]... FILE FILE...
+
+Options:
+  -o, --output=FILE            write output to the specified file
+      --encrypt=FILE           decrypt encrypted input file(s) using the
+                                   passphrase in FILE
+  -?, --help                   show this help, then exit
+
+Cluster-level information is taken from the first file. Database-level
+information (tables, indexes, sequences, functions, extensions, triggers,
+materialized views, publications, subscriptions and schema fingerprints) is
+taken from each file for the databases collected in it.
+`
+
+// mergeMain implements "pgmetrics merge".
+func mergeMain(args []string) {
+	log.SetFlags(0)
+	log.SetPrefix("pgmetrics: ")
+
+	var output, passfile string
+	var help bool
+	s := getopt.New()
+	s.StringVarLong(&output, "output", 'o', "")
+	s.StringVarLong(&passfile, "encrypt", 0, "")
+	s.BoolVarLong(&help, "help", '?', "").SetFlag()
+	if err := s.Getopt(append([]string{"pgmetrics merge"}, args...), nil); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, `Try "pgmetrics merge --help" for more information.`)
+		os.Exit(2)
+	}
+	if help {
+		fmt.Print(mergeUsage)
+		os.Exit(0)
+	}
+	if len(s.Args()) < 2 {
+		fmt.Fprintln(os.Stderr, "need two or more files to merge")
+		fmt.Fprintln(os.Stderr, `Try "pgmetrics merge --help" for more information.`)
+		os.Exit(2)
+	}
+
+	var passphrase []byte
+	if len(passfile) > 0 {
+		passphrase = readSecretFile(passfile)
+	}
+	var models []*pgmetrics.Model
+	for _, f := range s.Args() {
+		models = append(models, loadModel(f, passphrase))
+	}
+	merged, err := mergeModels(models)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fd := os.Stdout
+	if len(output) > 0 && output != "-" {
+		if fd, err = os.Create(output); err != nil {
+			log.Fatal(err)
+		}
+	}
+	writeJSONTo(fd, merged)
+	if fd != os.Stdout {
+		if err := fd.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// mergeModels merges the database-level information from the other models
+// into the first one. All models must be from the same cluster.
+func mergeModels(models []*pgmetrics.Model) (*pgmetrics.Model, error) {
+	base := models[0]
+	if base.PgBouncer != nil {
+		return nil, errors.New("cannot merge pgbouncer outputs")
+	}
+	have := make(map[string]bool) // databases already merged
+	for _, db := range base.Metadata.CollectedDBs {
+		have[db] = true
+	}
+	for i, m := range models[1:] {
+		if m.PgBouncer != nil {
+			return nil, errors.New("cannot merge pgbouncer outputs")
+		}
+		if m.SystemIdentifier != base.SystemIdentifier {
+			return nil, fmt.Errorf("file #%d is from a different cluster (system identifier %s, expected %s)",
+				i+2, m.SystemIdentifier, base.SystemIdentifier)
+		}
+		for _, db := range m.Metadata.CollectedDBs {
+			if have[db] {
+				continue
+			}
+			have[db] = true
+			mergeDB(base, m, db)
+		}
+		// pg_stat_statements returns statements for the whole cluster, but
+		// is collected only from a database where it is installed
+		if len(base.Statements) == 0 {
+			base.Statements = m.Statements
+		}
+	}
+	return base, nil
+}
+
+// mergeDB copies the information about the database dbname from m to base.
+func mergeDB(base, m *pgmetrics.Model, dbname string) {
+	base.Metadata.CollectedDBs = append(base.Metadata.CollectedDBs, dbname)
+
+	// the large object counts etc. are collected only for collected databases
+	if d := m.DatabaseByName(dbname); d != nil {
+		if bd := base.DatabaseByName(dbname); bd != nil {
+			*bd = *d
+		} else {
+			base.Databases = append(base.Databases, *d)
+		}
+	}
+	for _, t := range m.Tables {
+		if t.DBName == dbname {
+			base.Tables = append(base.Tables, t)
+		}
+	}
+	for _, idx := range m.Indexes {
+		if idx.DBName == dbname {
+			base.Indexes = append(base.Indexes, idx)
+		}
+	}
+	for _, sq := range m.Sequences {
+		if sq.DBName == dbname {
+			base.Sequences = append(base.Sequences, sq)
+		}
+	}
+	for _, uf := range m.UserFunctions {
+		if uf.DBName == dbname {
+			base.UserFunctions = append(base.UserFunctions, uf)
+		}
+	}
+	for _, e := range m.Extensions {
+		if e.DBName != dbname {
+			continue
+		}
+		base.Extensions = append(base.Extensions, e)
+		for i := range base.PreloadLibraries {
+			if pl := &base.PreloadLibraries[i]; pl.Name == e.Name {
+				pl.Extension = true
+				pl.InstalledIn = append(pl.InstalledIn, dbname)
+			}
+		}
+	}
+	for _, tg := range m.DisabledTriggers {
+		if tg.DBName == dbname {
+			base.DisabledTriggers = append(base.DisabledTriggers, tg)
+		}
+	}
+	for _, p := range m.Publications {
+		if p.DBName == dbname {
+			base.Publications = append(base.Publications, p)
+		}
+	}
+	for _, sub := range m.Subscriptions {
+		if sub.DBName == dbname {
+			base.Subscriptions = append(base.Subscriptions, sub)
+		}
+	}
+	for _, mv := range m.MatViews {
+		if mv.DBName == dbname {
+			base.MatViews = append(base.MatViews, mv)
+		}
+	}
+	for _, f := range m.SchemaFingerprints {
+		if f.DBName == dbname {
+			base.SchemaFingerprints = append(base.SchemaFingerprints, f)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import "github.com/pborman/getopt"
+
+// profileSetting is the value a profile gives to a command-line option.
+type profileSetting struct {
+	option string // long name of the option
+	apply  func(o *options)
+}
+
+// profiles are named sets of collection options, selected with --profile.
+// Options explicitly given on the command-line take precedence.
+var profiles = map[string][]profileSetting{
+	// a health check that finishes in a few seconds: only cluster-level
+	// information, no sizes
+	"quick": {
+		{"no-sizes", func(o *options) { o.CollectConfig.NoSizes = true }},
+		{"omit", func(o *options) {
+			o.CollectConfig.Omit = []string{"tables", "indexes", "sequences",
+				"functions", "extensions", "triggers", "statements", "log"}
+		}},
+	},
+	// same as not specifying a profile
+	"standard": nil,
+	// an audit that takes a few minutes: sample rates (including the WAL
+	// rate), look further back in the log and check for suspicious queries
+	// as well as schema drift. The top statements are not explained, that
+	// needs an explicit --explain-top.
+	"deep": {
+		{"log-span", func(o *options) { o.CollectConfig.LogSpan = 60 }},
+		{"sample-interval", func(o *options) { o.CollectConfig.SampleIntervalSec = 60 }},
+		{"statements-limit", func(o *options) { o.CollectConfig.StmtsLimit = 500 }},
+		{"suspicious-queries", func(o *options) { o.CollectConfig.SuspiciousQueries = true }},
+		{"schema-fingerprints", func(o *options) { o.CollectConfig.SchemaFingerprints = true }},
+	},
+}
+
+// applyProfile sets the options of the named profile that were not given on
+// the command-line. It returns false if there is no such profile.
+func applyProfile(o *options, s *getopt.Set, name string) bool {
+	settings, ok := profiles[name]
+	if !ok {
+		return false
+	}
+	for _, ps := range settings {
+		if !s.IsSet(ps.option) {
+			ps.apply(o)
+		}
+	}
+	return true
+}
@@ -0,0 +1,261 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pborman/getopt"
+	"github.com/rapidloop/pgmetrics"
+	"github.com/rapidloop/pgmetrics/query"
+)
+
+const queryUsage = `pgmetrics query runs an SQL query on one or more JSON outputs of pgmetrics.
+
+Usage:
+  pgmetrics query [OPTION]... SQL FILE...
+  pgmetrics query --tables
+
+Options:
+  -f, --format=FORMAT          output format; "human", "json" or "csv"
+                                   (default: "human")
+  -o, --output=FILE            write output to the specified file
+      --tables                 list the tables and their columns, then exit
+      --encrypt=FILE           decrypt encrypted input file(s) using the
+                                   passphrase in FILE
+  -?, --help                   show this help, then exit
+
+Each section of the JSON output is a table with the same name, like "tables",
+"indexes" or "settings", and with a column for each field. The top-level
+fields are in the "snapshots" table, which also has the file name. All
+tables have a "snapshot" column, the number of the file the row is from,
+starting at 1.
+
+Queries are SELECT statements with FROM, [LEFT] JOIN, WHERE, GROUP BY, HAVING,
+ORDER BY, LIMIT and OFFSET. The functions are count, sum, avg, min, max and
+string_agg, and coalesce, nullif, lower, upper, length, substr, replace, abs,
+round, datetime (of seconds since the epoch) and size_pretty (of bytes).
+Keywords used as names, like "end", must be quoted with double quotes.
+
+Example:
+  pgmetrics query "SELECT t.name, size_pretty(SUM(i.size))
+      FROM tables t JOIN indexes i ON i.table_oid = t.oid AND
+          i.db_name = t.db_name
+      GROUP BY t.name ORDER BY SUM(i.size) DESC LIMIT 10" out.json
+`
+
+// queryMain implements "pgmetrics query".
+func queryMain(args []string) {
+	log.SetFlags(0)
+	log.SetPrefix("pgmetrics: ")
+
+	format := "human"
+	var output, passfile string
+	var tables, help bool
+	s := getopt.New()
+	s.StringVarLong(&format, "format", 'f', "")
+	s.StringVarLong(&output, "output", 'o', "")
+	s.BoolVarLong(&tables, "tables", 0, "").SetFlag()
+	s.StringVarLong(&passfile, "encrypt", 0, "")
+	s.BoolVarLong(&help, "help", '?', "").SetFlag()
+	if err := s.Getopt(append([]string{"pgmetrics query"}, args...), nil); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, `Try "pgmetrics query --help" for more information.`)
+		os.Exit(2)
+	}
+	if help {
+		fmt.Print(queryUsage)
+		os.Exit(0)
+	}
+	if format != "human" && format != "json" && format != "csv" {
+		fmt.Fprintln(os.Stderr, `format must be "human", "json" or "csv"`)
+		fmt.Fprintln(os.Stderr, `Try "pgmetrics query --help" for more information.`)
+		os.Exit(2)
+	}
+	if !tables && len(s.Args()) < 2 {
+		fmt.Fprintln(os.Stderr, "need a query and one or more files to run it on")
+		fmt.Fprintln(os.Stderr, `Try "pgmetrics query --help" for more information.`)
+		os.Exit(2)
+	}
+
+	var result *query.Result
+	if tables {
+		result = &query.Result{Columns: []string{"table", "columns"}}
+		for _, t := range query.Load(nil, nil).Tables() {
+			result.Rows = append(result.Rows,
+				[]interface{}{t.Name, strings.Join(t.Columns, ", ")})
+		}
+	} else {
+		var passphrase []byte
+		if len(passfile) > 0 {
+			passphrase = readSecretFile(passfile)
+		}
+		files := s.Args()[1:]
+		var models []*pgmetrics.Model
+		for _, f := range files {
+			models = append(models, loadModel(f, passphrase))
+		}
+		var err error
+		if result, err = query.Load(models, files).Query(s.Args()[0]); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	fd := os.Stdout
+	if len(output) > 0 && output != "-" {
+		var err error
+		if fd, err = os.Create(output); err != nil {
+			log.Fatal(err)
+		}
+	}
+	switch format {
+	case "human":
+		if tables {
+			writeTableList(fd, result)
+		} else {
+			writeResultTable(fd, result)
+		}
+	case "json":
+		writeResultJSON(fd, result)
+	case "csv":
+		writeResultCSV(fd, result)
+	}
+	if fd != os.Stdout {
+		if err := fd.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// writeResultTable writes the result as a table, with numbers aligned to
+// the right, followed by the number of rows.
+func writeResultTable(fd io.Writer, r *query.Result) {
+	widths := make([]int, len(r.Columns))
+	for i, c := range r.Columns {
+		widths[i] = utf8.RuneCountInString(c)
+	}
+	cells := make([][]string, len(r.Rows))
+	for i, row := range r.Rows {
+		cells[i] = make([]string, len(row))
+		for j, v := range row {
+			// one line per cell
+			s := strings.Replace(query.Format(v), "\n", " ", -1)
+			cells[i][j] = s
+			if n := utf8.RuneCountInString(s); n > widths[j] {
+				widths[j] = n
+			}
+		}
+	}
+	line := func() {
+		fmt.Fprint(fd, "+")
+		for _, w := range widths {
+			fmt.Fprint(fd, strings.Repeat("-", w+2), "+")
+		}
+		fmt.Fprintln(fd)
+	}
+	cell := func(s string, w int, right bool) {
+		pad := strings.Repeat(" ", w-utf8.RuneCountInString(s))
+		if right {
+			fmt.Fprint(fd, " ", pad, s, " |")
+		} else {
+			fmt.Fprint(fd, " ", s, pad, " |")
+		}
+	}
+	line()
+	fmt.Fprint(fd, "|")
+	for i, c := range r.Columns {
+		cell(c, widths[i], false)
+	}
+	fmt.Fprintln(fd)
+	line()
+	for i, row := range r.Rows {
+		fmt.Fprint(fd, "|")
+		for j, v := range row {
+			_, isInt := v.(int64)
+			_, isFloat := v.(float64)
+			cell(cells[i][j], widths[j], isInt || isFloat)
+		}
+		fmt.Fprintln(fd)
+	}
+	if len(r.Rows) > 0 {
+		line()
+	}
+	if len(r.Rows) == 1 {
+		fmt.Fprintln(fd, "(1 row)")
+	} else {
+		fmt.Fprintf(fd, "(%d rows)\n", len(r.Rows))
+	}
+}
+
+// writeTableList writes the tables and their columns listed by --tables, as
+// the names of the tables followed by their columns, wrapped.
+func writeTableList(fd io.Writer, r *query.Result) {
+	for _, row := range r.Rows {
+		fmt.Fprintf(fd, "%s:\n", row[0])
+		line := "   "
+		for _, c := range strings.Split(row[1].(string), ", ") {
+			if len(line)+1+len(c) > 78 {
+				fmt.Fprintln(fd, line)
+				line = "   "
+			}
+			line += " " + c
+		}
+		fmt.Fprintln(fd, line)
+	}
+}
+
+// writeResultJSON writes the result as an object with the column names and
+// the rows as arrays of values, so that the order of the columns is kept.
+func writeResultJSON(fd io.Writer, r *query.Result) {
+	out := struct {
+		Columns []string        `json:"columns"`
+		Rows    [][]interface{} `json:"rows"`
+	}{r.Columns, r.Rows}
+	if out.Rows == nil {
+		out.Rows = [][]interface{}{}
+	}
+	enc := json.NewEncoder(fd)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// writeResultCSV writes the result as CSV, with a header row of the column
+// names. NULLs are written as empty values.
+func writeResultCSV(fd io.Writer, r *query.Result) {
+	w := csv.NewWriter(fd)
+	w.Write(r.Columns)
+	for _, row := range r.Rows {
+		rec := make([]string, len(row))
+		for i, v := range row {
+			rec[i] = query.Format(v)
+		}
+		w.Write(rec)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/rapidloop/pgmetrics"
+)
+
+// redactProfile lists what is removed from the output for a class of
+// consumers. The names are those of the keys in the JSON output.
+type redactProfile struct {
+	Drop []string `json:"drop"` // top-level sections to remove
+	Mask []string `json:"mask"` // keys whose string values are masked, at any level
+}
+
+// Keys that hold addresses and connection information.
+var redactNetwork = []string{"client_addr", "client_hostname", "host",
+	"sender_host", "conninfo", "primary_conninfo", "hostname", "address",
+	"upstream", "replica"}
+
+// redactProfiles are the built-in profiles for --redact.
+var redactProfiles = map[string]*redactProfile{
+	// everything, for the DBAs
+	"full": {},
+	// for developers: queries and schema, but not the network and access
+	// control details
+	"developer": {
+		Drop: []string{"hba_rules", "failed_logins"},
+		Mask: redactNetwork,
+	},
+	// for third parties like support vendors: also no SQL text, and no
+	// names of users or of the cluster
+	"vendor": {
+		Drop: []string{"hba_rules", "failed_logins", "roles", "suspicious_queries"},
+		Mask: append([]string{"query", "statement", "plan", "detail", "message", "user",
+			"users", "role_name", "force_user", "application_name",
+			"cluster_name", "labels"}, redactNetwork...),
+	},
+}
+
+// getRedactProfile returns the named built-in profile, or else loads one
+// from the file of that name.
+func getRedactProfile(name string) (*redactProfile, error) {
+	if p, ok := redactProfiles[name]; ok {
+		return p, nil
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var p redactProfile
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return &p, nil
+}
+
+// redact applies the profile to the model. Masked values are replaced with a
+// hash of the value, so that the same name is masked the same way in every
+// section it appears.
+func redact(m *pgmetrics.Model, p *redactProfile) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	var doc map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber() // keep large integers as-is
+	if err := dec.Decode(&doc); err != nil {
+		return err
+	}
+
+	for _, k := range p.Drop {
+		delete(doc, k)
+	}
+	mask := make(map[string]bool)
+	for _, k := range p.Mask {
+		mask[k] = true
+	}
+	redactWalk(doc, mask, false)
+
+	if data, err = json.Marshal(doc); err != nil {
+		return err
+	}
+	var out pgmetrics.Model
+	if err := json.Unmarshal(data, &out); err != nil {
+		return err
+	}
+	*m = out
+	return nil
+}
+
+// redactWalk masks the strings under the keys in mask, or all of them if
+// masking is true, and returns the possibly replaced value.
+func redactWalk(v interface{}, mask map[string]bool, masking bool) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, val := range x {
+			x[k] = redactWalk(val, mask, masking || mask[k])
+		}
+	case []interface{}:
+		for i, val := range x {
+			x[i] = redactWalk(val, mask, masking)
+		}
+	case string:
+		if masking && len(x) > 0 {
+			h := sha256.Sum256([]byte(x))
+			return "redacted:" + hex.EncodeToString(h[:4])
+		}
+	}
+	return v
+}
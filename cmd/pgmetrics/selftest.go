@@ -0,0 +1,216 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pborman/getopt"
+	"github.com/rapidloop/pgmetrics"
+)
+
+const selftestUsage = `pgmetrics selftest starts a Postgres container of each given major version
+using docker, collects from it with this pgmetrics binary, and checks that
+all the information available in that version was collected.
+
+Usage:
+  pgmetrics selftest [OPTION]... [VERSION]...
+
+Options:
+      --docker=PATH            docker command to use (default: "docker")
+      --image=NAME             image to use, tagged by version (default:
+                                   "postgres")
+      --keep                   do not remove the containers afterwards
+  -?, --help                   show this help, then exit
+
+The default versions are 9.6 to 17. The images are pulled if needed.
+`
+
+// selftestVersions are the major versions tested by default.
+var selftestVersions = []string{"9.6", "10", "11", "12", "13", "14", "15", "16", "17"}
+
+// selftestWait is how long to wait for a container to accept connections.
+const selftestWait = 2 * time.Minute
+
+// selftestCheck is something that should be in the output of a collection
+// from a server of at least version minVersion (as in server_version_num).
+type selftestCheck struct {
+	what       string
+	minVersion int
+	ok         func(m *pgmetrics.Model) bool
+}
+
+var selftestChecks = []selftestCheck{
+	{"server start time", 0, func(m *pgmetrics.Model) bool { return m.StartTime > 0 }},
+	{"settings", 0, func(m *pgmetrics.Model) bool { return len(m.Settings) > 0 }},
+	{"databases", 0, func(m *pgmetrics.Model) bool { return len(m.Databases) > 0 }},
+	{"tablespaces", 0, func(m *pgmetrics.Model) bool { return len(m.Tablespaces) > 0 }},
+	{"roles", 0, func(m *pgmetrics.Model) bool { return len(m.Roles) > 0 }},
+	{"collected database", 0, func(m *pgmetrics.Model) bool { return len(m.Metadata.CollectedDBs) > 0 }},
+	{"system identifier", 90600, func(m *pgmetrics.Model) bool { return len(m.SystemIdentifier) > 0 }},
+	{"checkpoint LSN", 90600, func(m *pgmetrics.Model) bool { return len(m.CheckpointLSN) > 0 }},
+	{"backend type counts", 100000, func(m *pgmetrics.Model) bool { return len(m.BackendTypeCounts) > 0 }},
+	{"hba rules", 100000, func(m *pgmetrics.Model) bool { return len(m.HBARules) > 0 }},
+	{"I/O stats", 160000, func(m *pgmetrics.Model) bool { return len(m.IOStats) > 0 }},
+	{"checkpointer stats", 170000, func(m *pgmetrics.Model) bool { return m.Checkpointer != nil }},
+}
+
+// selftestMain implements "pgmetrics selftest".
+func selftestMain(args []string) {
+	log.SetFlags(0)
+	log.SetPrefix("pgmetrics: ")
+
+	docker, image := "docker", "postgres"
+	var keep, help bool
+	s := getopt.New()
+	s.StringVarLong(&docker, "docker", 0, "")
+	s.StringVarLong(&image, "image", 0, "")
+	s.BoolVarLong(&keep, "keep", 0, "").SetFlag()
+	s.BoolVarLong(&help, "help", '?', "").SetFlag()
+	if err := s.Getopt(append([]string{"pgmetrics selftest"}, args...), nil); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, `Try "pgmetrics selftest --help" for more information.`)
+		os.Exit(2)
+	}
+	if help {
+		fmt.Print(selftestUsage)
+		os.Exit(0)
+	}
+	versions := s.Args()
+	if len(versions) == 0 {
+		versions = selftestVersions
+	}
+	self, err := os.Executable()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	failed := 0
+	for _, v := range versions {
+		tag := image + ":" + v
+		fmt.Printf("%s: ", tag)
+		problems, err := selftestVersion(docker, tag, self, keep)
+		switch {
+		case err != nil:
+			fmt.Printf("error: %v\n", err)
+			failed++
+		case len(problems) > 0:
+			fmt.Printf("FAILED, missing %s\n", strings.Join(problems, ", "))
+			failed++
+		default:
+			fmt.Println("ok")
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("%d of %d versions failed\n", failed, len(versions))
+		os.Exit(1)
+	}
+}
+
+// selftestVersion runs a container from the image, collects from it and
+// returns what was expected but not found in the output.
+func selftestVersion(docker, tag, self string, keep bool) (problems []string, err error) {
+	const password = "pgmetrics"
+	out, err := runDocker(docker, "run", "-d", "--rm", "-e", "POSTGRES_PASSWORD="+password,
+		"-p", "127.0.0.1::5432", tag)
+	if err != nil {
+		return nil, err
+	}
+	id := strings.TrimSpace(out)
+	if !keep {
+		defer func() {
+			_, _ = runDocker(docker, "rm", "-f", id)
+		}()
+	}
+
+	// find the port on the host
+	if out, err = runDocker(docker, "port", id, "5432/tcp"); err != nil {
+		return nil, err
+	}
+	host, port, err := net.SplitHostPort(strings.TrimSpace(strings.SplitN(out, "\n", 2)[0]))
+	if err != nil {
+		return nil, fmt.Errorf("bad output from docker port: %v", err)
+	}
+
+	// wait for the server, the one started by the image for initializing
+	// does not listen on TCP
+	deadline := time.Now().Add(selftestWait)
+	for {
+		if _, err := runDocker(docker, "exec", id, "pg_isready", "-q", "-h", "127.0.0.1", "-U", "postgres"); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.New("timed out waiting for the server to start")
+		}
+		time.Sleep(time.Second)
+	}
+
+	// collect
+	cmd := exec.Command(self, "-h", host, "-p", port, "-U", "postgres", "-w",
+		"-f", "json", "--no-pager", "postgres")
+	cmd.Env = append(os.Environ(), "PGPASSWORD="+password, "PGSSLMODE=disable")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("collection failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	var m pgmetrics.Model
+	if err := json.Unmarshal(stdout.Bytes(), &m); err != nil {
+		return nil, fmt.Errorf("bad output from collection: %v", err)
+	}
+
+	version := 0
+	if s, ok := m.Settings["server_version_num"]; ok {
+		version, _ = strconv.Atoi(s.Setting)
+	}
+	if version == 0 {
+		return []string{"server_version_num"}, nil
+	}
+	for _, c := range selftestChecks {
+		if version >= c.minVersion && !c.ok(&m) {
+			problems = append(problems, c.what)
+		}
+	}
+	return problems, nil
+}
+
+// runDocker runs docker with the args and returns its output. The error
+// includes what docker printed to stderr.
+func runDocker(docker string, args ...string) (string, error) {
+	cmd := exec.Command(docker, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) == 0 {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("docker %s: %s", args[0], msg)
+	}
+	return string(out), nil
+}
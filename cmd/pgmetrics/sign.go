@@ -0,0 +1,94 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+// Snapshots are signed with HMAC-SHA256 using a shared secret key. The
+// signature is stored in a separate file, named after the snapshot file with
+// sigSuffix appended, containing sigPrefix followed by the hex-encoded MAC.
+const (
+	sigSuffix = ".sig"
+	sigPrefix = "hmac-sha256:"
+)
+
+// readSecretFile reads a secret key or passphrase from the file. Leading and
+// trailing whitespace is not considered part of the secret.
+func readSecretFile(file string) []byte {
+	key, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	key = bytes.TrimSpace(key)
+	if len(key) == 0 {
+		log.Fatalf("%s: file is empty", file)
+	}
+	return key
+}
+
+func computeSig(data, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// signFile writes the signature of the file into the signature file.
+func signFile(file string, key []byte) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sig := sigPrefix + hex.EncodeToString(computeSig(data, key)) + "\n"
+	if err := ioutil.WriteFile(file+sigSuffix, []byte(sig), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// verifyFile checks the file against its signature file. The file can also
+// be a URL, see readInput.
+func verifyFile(file string, key []byte) error {
+	data, err := readInput(file)
+	if err != nil {
+		return err
+	}
+	sigdata, err := readInput(file + sigSuffix)
+	if err != nil {
+		return fmt.Errorf("failed to read signature: %v", err)
+	}
+	sigstr := strings.TrimSpace(string(sigdata))
+	if !strings.HasPrefix(sigstr, sigPrefix) {
+		return errors.New("unsupported signature format")
+	}
+	sig, err := hex.DecodeString(sigstr[len(sigPrefix):])
+	if err != nil {
+		return fmt.Errorf("bad signature: %v", err)
+	}
+	if !hmac.Equal(sig, computeSig(data, key)) {
+		return errors.New("signature mismatch, file was modified or key is wrong")
+	}
+	return nil
+}
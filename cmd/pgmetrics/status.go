@@ -0,0 +1,191 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rapidloop/pgmetrics"
+	"github.com/rapidloop/pgmetrics/report"
+)
+
+// runStatus is the summary of a run, written to the --status-file as the
+// run progresses. If the run fails, the status remains "running" or is
+// "failed", so only "ok" means success.
+type runStatus struct {
+	Status   string          `json:"status"` // "running", "ok" or "failed"
+	Version  string          `json:"version"`
+	Started  int64           `json:"started" unit:"epoch"`
+	Finished int64           `json:"finished,omitempty" unit:"epoch"`
+	Duration float64         `json:"duration" unit:"s"`
+	Error    string          `json:"error,omitempty"` // message the run failed with
+	Warnings []string        `json:"warnings,omitempty"`
+	Sections []statusSection `json:"sections"`
+	Checks   []statusChecks  `json:"checks,omitempty"`
+}
+
+// statusSection is a step of the run, like collecting from a server or
+// writing the output.
+type statusSection struct {
+	Name     string  `json:"name"`             // "preflight", "collect", "load", "output", "email" etc.
+	Target   string  `json:"target,omitempty"` // the server, file or addresses, if any
+	Status   string  `json:"status"`           // "running", "ok" or "failed"
+	Duration float64 `json:"duration" unit:"s"`
+	Error    string  `json:"error,omitempty"`
+	started  time.Time
+}
+
+// statusChecks is the outcome of the health checks of a result.
+type statusChecks struct {
+	Cluster string   `json:"cluster,omitempty"`
+	Checks  int      `json:"checks"`           // number of checks done
+	Failed  []string `json:"failed,omitempty"` // rules of the checks that failed
+}
+
+// status is the status of this run, nil if --status-file was not given.
+var (
+	statusMu   sync.Mutex
+	status     *runStatus
+	statusFile string
+	statusAt   time.Time // when the run started
+)
+
+// startStatus starts writing the status of the run to file. The messages
+// logged are recorded as warnings, or if they are not, as errors that fail
+// the section being run, since the collector and the rest of the code exit
+// using log.Fatal. If the section then completes, the error is taken to be a
+// warning instead.
+func startStatus(file string) {
+	statusFile = file
+	statusAt = time.Now()
+	v := version
+	if len(v) == 0 {
+		v = "devel"
+	}
+	status = &runStatus{Status: "running", Version: v, Started: statusAt.Unix()}
+	log.SetOutput(statusLogWriter{})
+	saveStatus()
+}
+
+// statusLogWriter records the messages logged in the status, and writes
+// them to stderr.
+type statusLogWriter struct{}
+
+func (statusLogWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSpace(strings.TrimPrefix(string(p), log.Prefix()))
+	statusMu.Lock()
+	if strings.HasPrefix(msg, "warning: ") {
+		status.Warnings = append(status.Warnings, strings.TrimPrefix(msg, "warning: "))
+	} else {
+		status.Status, status.Error = "failed", msg
+		for i := range status.Sections {
+			if s := &status.Sections[i]; s.Status == "running" {
+				s.Status, s.Error = "failed", msg
+				s.Duration = time.Since(s.started).Seconds()
+			}
+		}
+	}
+	statusMu.Unlock()
+	saveStatus()
+	return os.Stderr.Write(p)
+}
+
+// section runs f as a section of the run with the given name and target,
+// recording it in the status.
+func section(name, target string, f func()) {
+	if status == nil {
+		f()
+		return
+	}
+	statusMu.Lock()
+	status.Sections = append(status.Sections, statusSection{Name: name,
+		Target: target, Status: "running", started: time.Now()})
+	i := len(status.Sections) - 1
+	statusMu.Unlock()
+	saveStatus()
+
+	f()
+
+	// the section completed, so the errors logged were not fatal after all
+	statusMu.Lock()
+	s := &status.Sections[i]
+	if s.Status == "failed" {
+		status.Warnings = append(status.Warnings, s.Error)
+		status.Status, status.Error, s.Error = "running", "", ""
+	}
+	s.Status = "ok"
+	s.Duration = time.Since(s.started).Seconds()
+	statusMu.Unlock()
+	saveStatus()
+}
+
+// finishStatus records the run as finished, along with the outcome of the
+// health checks of the results.
+func finishStatus(o options, results []*pgmetrics.Model) {
+	if status == nil {
+		return
+	}
+	statusMu.Lock()
+	for _, r := range results {
+		if r.PgBouncer != nil {
+			continue
+		}
+		checks := report.HealthChecks(r, o.reportOptions())
+		sc := statusChecks{Cluster: r.Metadata.ClusterName, Checks: len(checks)}
+		for _, c := range checks {
+			if c.Failed {
+				sc.Failed = append(sc.Failed, c.Rule)
+			}
+		}
+		status.Checks = append(status.Checks, sc)
+	}
+	if status.Status == "failed" { // not fatal, logged outside a section
+		status.Warnings = append(status.Warnings, status.Error)
+		status.Error = ""
+	}
+	status.Status = "ok"
+	status.Finished = time.Now().Unix()
+	statusMu.Unlock()
+	saveStatus()
+}
+
+// saveStatus writes the status to the file, replacing it atomically so that
+// readers never see a partial file. Errors are printed but do not stop the
+// run.
+func saveStatus() {
+	statusMu.Lock()
+	status.Duration = time.Since(statusAt).Seconds()
+	data, err := json.MarshalIndent(status, "", "  ")
+	statusMu.Unlock()
+	if err != nil {
+		return
+	}
+	tmp := statusFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		os.Stderr.WriteString("pgmetrics: failed to write status file: " + err.Error() + "\n")
+		return
+	}
+	if err := os.Rename(tmp, statusFile); err != nil {
+		os.Stderr.WriteString("pgmetrics: failed to write status file: " + err.Error() + "\n")
+	}
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// target is a server to collect from, given with --target.
+type target struct {
+	name  string // as given, or the port
+	named bool   // name was given
+	host  string // "" if not given
+	port  uint16
+}
+
+// parseTarget parses a --target value, of the form [NAME=][HOST:]PORT.
+func parseTarget(spec string) (t target, err error) {
+	rest := spec
+	if pos := strings.IndexByte(rest, '='); pos >= 0 {
+		t.name, rest, t.named = rest[:pos], rest[pos+1:], true
+		if len(t.name) == 0 || strings.ContainsAny(t.name, `/\:`) {
+			return t, fmt.Errorf("bad name in target %q", spec)
+		}
+	}
+	if pos := strings.LastIndexByte(rest, ':'); pos >= 0 {
+		t.host, rest = rest[:pos], rest[pos+1:]
+		if len(t.host) == 0 {
+			return t, fmt.Errorf("bad host in target %q", spec)
+		}
+	}
+	p, err := strconv.Atoi(rest)
+	if err != nil || p < 1 || p > 65535 {
+		return t, fmt.Errorf("bad port in target %q", spec)
+	}
+	t.port = uint16(p)
+	if len(t.name) == 0 {
+		t.name = rest
+	}
+	return t, nil
+}
+
+// targetOutput returns the name of the output file for a target, which is
+// the -o file with the name of the target added, like "out-5433.json".
+func targetOutput(output string, t target) string {
+	ext := filepath.Ext(output)
+	return strings.TrimSuffix(output, ext) + "-" + t.name + ext
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collector
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/rapidloop/pgmetrics"
+)
+
+// sampleAVWorkers counts the autovacuum workers currently running. Errors are
+// ignored, the sample is just not taken.
+func (c *collector) sampleAVWorkers() {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	q := `SELECT COUNT(*) FROM pg_stat_activity WHERE backend_type = 'autovacuum worker'`
+	if c.version < 100000 {
+		q = `SELECT COUNT(*) FROM pg_stat_activity WHERE query LIKE 'autovacuum: %'`
+	}
+	var n int
+	if err := c.db.QueryRowContext(ctx, q).Scan(&n); err != nil {
+		return
+	}
+	if len(c.avSamples) == 0 {
+		c.avFirst = time.Now()
+	}
+	c.avSamples = append(c.avSamples, n)
+	c.avLast = time.Now()
+}
+
+// sampleAVWorkersFor keeps counting the autovacuum workers about once a
+// second, for the given duration.
+func (c *collector) sampleAVWorkersFor(connstr string, o CollectConfig, d time.Duration) {
+	db := c.openDB(connstr, o)
+	defer db.Close()
+	c.db = db
+
+	end := time.Now().Add(d)
+	for {
+		left := time.Until(end)
+		if left <= 0 {
+			break
+		}
+		if left > time.Second {
+			left = time.Second
+		}
+		time.Sleep(left)
+		c.sampleAVWorkers()
+	}
+}
+
+// computeAVSaturation compares the sampled autovacuum worker counts against
+// autovacuum_max_workers, and counts the tables that are due for an
+// autovacuum. Per-table storage parameters that override the thresholds are
+// not considered.
+func (c *collector) computeAVSaturation() {
+	maxWorkers, _ := strconv.Atoi(c.setting("autovacuum_max_workers"))
+	if c.setting("autovacuum") != "on" || maxWorkers <= 0 || len(c.avSamples) == 0 {
+		return
+	}
+
+	av := &pgmetrics.AutovacuumSaturation{
+		MaxWorkers: maxWorkers,
+		Samples:    len(c.avSamples),
+		Interval:   c.avLast.Sub(c.avFirst).Seconds(),
+	}
+	var sum int
+	for _, n := range c.avSamples {
+		sum += n
+		if n >= maxWorkers {
+			av.BusySamples++
+		}
+		if n > av.PeakWorkers {
+			av.PeakWorkers = n
+		}
+	}
+	av.AvgWorkers = float64(sum) / float64(len(c.avSamples))
+
+	threshold, _ := strconv.ParseInt(c.setting("autovacuum_vacuum_threshold"), 10, 64)
+	scale, _ := strconv.ParseFloat(c.setting("autovacuum_vacuum_scale_factor"), 64)
+	freezeAge, _ := strconv.Atoi(c.setting("autovacuum_freeze_max_age"))
+	for _, t := range c.result.Tables {
+		if float64(t.NDeadTup) > float64(threshold)+scale*float64(t.NLiveTup) {
+			av.TablesDue++
+		} else if freezeAge > 0 && t.AgeRelFrozenXid > freezeAge {
+			av.TablesDue++
+		}
+	}
+	c.result.AutovacuumSaturation = av
+}
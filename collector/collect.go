@@ -19,14 +19,17 @@ package collector
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"log"
 	"math"
+	"net"
 	"os"
 	"os/user"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -64,20 +67,37 @@ type CollectConfig struct {
 	NoSizes    bool
 
 	// collection
-	Schema          string
-	ExclSchema      string
-	Table           string
-	ExclTable       string
-	SQLLength       uint
-	StmtsLimit      uint
-	Omit            []string
-	OnlyListedDBs   bool
-	LogFile         string
-	LogSpan         uint
-	RDSDBIdentifier string
+	Schema             string
+	ExclSchema         string
+	Table              string
+	ExclTable          string
+	SQLLength          uint
+	StmtsLimit         uint
+	Omit               []string
+	OnlyListedDBs      bool
+	LogFile            string
+	LogSpan            uint
+	LogWrapField       string // log lines are JSON objects, with the original line in this field
+	RDSDBIdentifier    string
+	WALSampleSec       uint
+	SampleIntervalSec  uint
+	ExplainTop         uint
+	ActivityQuery      string // "full", "none" or number of chars, "" for SQLLength
+	MaxServerCost      bool
+	RecordFixture      string          // file to record query results into
+	Fixture            string          // file to replay query results from, instead of connecting
+	SuspiciousQueries  bool            // look for patterns seen in SQL injection attempts
+	SchemaFingerprints bool            // hash the definitions of tables, views and functions
+	Replica            string          // conninfo of a standby to run expensive queries on
+	LogHandler         LogEventHandler // notified of events parsed from the log file
+	MaxConnections     uint            // databases collected at once, 1 for one after the other
+	MaxHeavyQueries    uint            // databases running expensive queries at once, 0 for no limit
+	ResetStatements    bool            // call pg_stat_statements_reset() after collecting
+	LargeObjectOrphans bool            // count the large objects not referenced from any table
+	Preflight          bool            // let Preflight connect to check the server too
 
 	// connection
-	Host     string
+	Host     string // "" for the socket directory of the local server on Port
 	Port     uint16
 	User     string
 	Password string
@@ -102,6 +122,23 @@ func DefaultCollectConfig() CollectConfig {
 		SQLLength:  500,
 		StmtsLimit: 100,
 		LogSpan:    5,
+		//LogWrapField: "",
+		//WALSampleSec: 0,
+		//SampleIntervalSec: 0,
+		//ExplainTop: 0,
+		//ActivityQuery: "",
+		//MaxServerCost: false,
+		//RecordFixture: "",
+		//Fixture: "",
+		//SuspiciousQueries: false,
+		//SchemaFingerprints: false,
+		//Replica: "",
+		//LogHandler: nil,
+		MaxConnections: 1,
+		//MaxHeavyQueries: 0,
+		//ResetStatements: false,
+		//LargeObjectOrphans: false,
+		//Preflight: false,
 
 		// ------------------ connection
 		//Password: "",
@@ -155,34 +192,41 @@ func getRegexp(r string) (rx *regexp.Regexp) {
 // backwards-compatibility will be broken when that happens. You've been warned.
 func Collect(o CollectConfig, dbnames []string) *pgmetrics.Model {
 	// form connection string
-	var connstr string
-	if len(o.Host) > 0 {
-		connstr += makeKV("host", o.Host)
-	}
-	connstr += makeKV("port", strconv.Itoa(int(o.Port)))
-	if len(o.User) > 0 {
-		connstr += makeKV("user", o.User)
-	}
-	if len(o.Password) > 0 {
-		connstr += makeKV("password", o.Password)
-	}
-	if os.Getenv("PGSSLMODE") == "" {
-		connstr += makeKV("sslmode", "disable")
-	}
-	connstr += makeKV("application_name", "pgmetrics")
-
-	// set timeouts (but not for pgbouncer, it does not like them)
-	if !(len(dbnames) == 1 && dbnames[0] == "pgbouncer") {
-		connstr += makeKV("lock_timeout", "50") // 50 msec. Just fail fast on locks.
-		connstr += makeKV("statement_timeout", strconv.Itoa(int(o.TimeoutSec)*1000))
-	}
+	connstr := connString(o, dbnames)
 
 	// collect from 1 or more DBs
+	start := time.Now()
 	c := &collector{
 		dbnames: dbnames,
+		qerrs:   &queryErrors{},
+	}
+	if len(o.Fixture) > 0 {
+		f, err := loadFixture(o.Fixture)
+		if err != nil {
+			log.Fatal(err)
+		}
+		c.fixture = f
+	} else if len(o.RecordFixture) > 0 {
+		c.fixture = newFixtureRecorder()
+	}
+	if len(dbnames) == 1 && dbnames[0] == "pgbouncer" {
+		o.Replica = "" // not applicable
+	}
+	// the databases after the first can be collected in parallel, except
+	// when keeping the server load low or for fixtures, which need the
+	// queries to be made in the same order each time
+	parallel := o.MaxConnections
+	if o.MaxServerCost || c.fixture != nil {
+		parallel = 1
+	}
+	if o.MaxHeavyQueries > 0 && o.MaxHeavyQueries < parallel {
+		c.heavySem = make(chan struct{}, o.MaxHeavyQueries)
 	}
 	if len(dbnames) == 0 {
 		collectFromDB(connstr, c, o)
+	} else if parallel > 1 && len(dbnames) > 2 {
+		collectFromDB(connstr+makeKV("dbname", dbnames[0]), c, o)
+		collectParallel(connstr, c, dbnames[1:], parallel, o)
 	} else {
 		for _, dbname := range dbnames {
 			collectFromDB(connstr+makeKV("dbname", dbname), c, o)
@@ -191,22 +235,110 @@ func Collect(o CollectConfig, dbnames []string) *pgmetrics.Model {
 	if !arrayHas(o.Omit, "log") && c.local {
 		c.collectLogs(o)
 	}
+	c.fillPreloadLibraries()
+	if o.SuspiciousQueries {
+		c.findSuspicious()
+	}
+
+	// take two samples of counters and compute rates, if asked for
+	if o.SampleIntervalSec > 0 && !(len(dbnames) == 1 && dbnames[0] == "pgbouncer") {
+		c.collectRates(connstr, dbnames, o)
+	}
+	c.computeAVSaturation()
+
+	// reset the statements only after everything that uses them is done
+	if o.ResetStatements && len(c.stmtsDB) > 0 {
+		c.resetStatements(connstr+makeKV("dbname", c.stmtsDB), o)
+	}
 
 	// collect from RDS if database id is specified
 	if len(o.RDSDBIdentifier) > 0 {
 		collectFromRDS(o.RDSDBIdentifier, &c.result)
 	}
 
+	if c.fixture != nil && !c.fixture.replay {
+		if err := c.fixture.save(o.RecordFixture); err != nil {
+			log.Fatalf("failed to save fixture: %v", err)
+		}
+	}
+
+	c.fillDiagnostics()
+	c.fillCollectorStats(start)
 	return &c.result
 }
 
+// connString returns the connection string for the options, without a
+// dbname. Without a host, the socket directory of the local server on the
+// port is used.
+func connString(o CollectConfig, dbnames []string) string {
+	var connstr string
+	if len(o.Host) > 0 {
+		connstr += makeKV("host", o.Host)
+	} else if len(o.Fixture) == 0 {
+		connstr += makeKV("host", LocalSocketDir(o.Port))
+	}
+	connstr += makeKV("port", strconv.Itoa(int(o.Port)))
+	if len(o.User) > 0 {
+		connstr += makeKV("user", o.User)
+	}
+	if len(o.Password) > 0 {
+		connstr += makeKV("password", o.Password)
+	}
+	if os.Getenv("PGSSLMODE") == "" {
+		connstr += makeKV("sslmode", "disable")
+	}
+	connstr += makeKV("application_name", "pgmetrics")
+
+	// set timeouts (but not for pgbouncer, it does not like them)
+	if !(len(dbnames) == 1 && dbnames[0] == "pgbouncer") {
+		// 50 msec lock timeout: just fail fast on locks
+		lockTimeout, stmtTimeout := 50, int(o.TimeoutSec)*1000
+		if o.MaxServerCost {
+			lockTimeout = lowCostLockTimeout
+			if stmtTimeout > lowCostStmtTimeout {
+				stmtTimeout = lowCostStmtTimeout
+			}
+		}
+		connstr += makeKV("lock_timeout", strconv.Itoa(lockTimeout))
+		connstr += makeKV("statement_timeout", strconv.Itoa(stmtTimeout))
+	}
+	return connstr
+}
+
 func collectFromDB(connstr string, c *collector, o CollectConfig) {
+	db := c.openDB(connstr, o)
+	defer db.Close()
+
+	// connect to the replica too, for the same database, if given
+	if len(o.Replica) > 0 {
+		c.replica = c.openReplica(connstr, db, o)
+		defer func() {
+			c.replica.Close()
+			c.replica = nil
+		}()
+	}
+
+	// collect
+	c.collect(db, o)
+}
+
+// openDB connects to the database, checks the connection and does a SET ROLE
+// if required. Any errors are fatal. When recording or replaying a fixture,
+// the connection goes through it. Queries made over the connection are
+// counted in c.counter, and those that fail are recorded in c.qerrs.
+func (c *collector) openDB(connstr string, o CollectConfig) *sql.DB {
 	// connect
-	db, err := sql.Open("postgres", connstr)
+	var conn driver.Connector
+	var err error
+	if c.fixture != nil {
+		conn, err = c.fixture.connector(connstr)
+	} else {
+		conn, err = pq.NewConnector(connstr)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer db.Close()
+	db := sql.OpenDB(&countingConnector{qc: &c.counter, qe: c.qerrs, inner: conn})
 
 	// ping
 	t := time.Duration(o.TimeoutSec) * time.Second
@@ -229,12 +361,29 @@ func collectFromDB(connstr string, c *collector, o CollectConfig) {
 		}
 	}
 
-	// collect
+	// idle_in_transaction_session_timeout is only in v9.6+, and can't be set
+	// in the connection string for older versions, so try and ignore errors
+	if o.MaxServerCost {
+		ctx3, cancel3 := context.WithTimeout(tolerateErrors(context.Background()), t)
+		defer cancel3()
+		_, _ = db.ExecContext(ctx3, "SET idle_in_transaction_session_timeout = "+
+			strconv.Itoa(lowCostIdleTimeout))
+	}
+
 	db.SetMaxIdleConns(1)
 	db.SetMaxOpenConns(1)
-	c.collect(db, o)
+	return db
 }
 
+// Limits used with CollectConfig.MaxServerCost, to keep the load placed on
+// the server by the collection to a minimum.
+const (
+	lowCostLockTimeout = 10                     // msec
+	lowCostStmtTimeout = 2000                   // msec, upper limit for statement_timeout
+	lowCostIdleTimeout = 5000                   // msec, idle_in_transaction_session_timeout
+	lowCostPause       = 250 * time.Millisecond // between expensive queries
+)
+
 type collector struct {
 	db           *sql.DB
 	result       pgmetrics.Model
@@ -248,11 +397,31 @@ type collector struct {
 	rxTable      *regexp.Regexp
 	rxExclTable  *regexp.Regexp
 	sqlLength    uint
+	activityLen  int // chars of pg_stat_activity.query to collect
 	stmtsLimit   uint
 	dbnames      []string
 	curlogfile   string
 	logSpan      uint
+	logWrapField string          // see CollectConfig.LogWrapField
+	logHandler   LogEventHandler // see CollectConfig.LogHandler, nil if not used
 	currLog      logEntry
+	lowCost      bool          // minimize server load, see CollectConfig.MaxServerCost
+	fixture      *fixture      // recording or replaying query results, if not nil
+	counter      queryCounter  // queries and rows, for Metadata.Collector
+	qerrs        *queryErrors  // failed queries, for Diagnostics; shared with workers
+	suspicious   bool          // see CollectConfig.SuspiciousQueries
+	replica      *sql.DB       // see CollectConfig.Replica, nil if not used
+	heavySem     chan struct{} // see CollectConfig.MaxHeavyQueries, nil if no limit
+	stmtsDB      string        // database the statements were collected from
+	stmtsDone    bool          // statements already fetched by another collector
+	loggedErrors []loggedError
+	logMsgs      []pgmetrics.LogMessage // messages counted for LogVolume
+	logMsgIndex  map[string]int         // level + message => index in logMsgs
+	logErrIndex  map[string]int         // level + sqlstate or message => index in LogErrorSummary
+	ckptStart    *pgmetrics.Checkpoint  // checkpoint that started, not yet complete
+	avSamples    []int                  // counts of running autovacuum workers
+	avFirst      time.Time              // when the first of avSamples was taken
+	avLast       time.Time              // when the last of avSamples was taken
 }
 
 func (c *collector) collect(db *sql.DB, o CollectConfig) {
@@ -277,11 +446,31 @@ func (c *collector) collectFirst(db *sql.DB, o CollectConfig) {
 
 	// save limits
 	c.sqlLength = o.SQLLength
+	switch o.ActivityQuery {
+	case "full":
+		c.activityLen = math.MaxInt32
+	case "none":
+		c.activityLen = 0
+	default:
+		if n, err := strconv.Atoi(o.ActivityQuery); err == nil && n >= 0 {
+			c.activityLen = n
+		} else {
+			c.activityLen = int(o.SQLLength)
+		}
+	}
 	c.stmtsLimit = o.StmtsLimit
 	c.logSpan = o.LogSpan
+	c.logWrapField = o.LogWrapField
+	c.logHandler = o.LogHandler
+	c.lowCost = o.MaxServerCost
+	c.suspicious = o.SuspiciousQueries
 
-	// current time is the report start time
+	// current time is the report start time, or the time of recording when
+	// replaying a fixture
 	c.result.Metadata.At = time.Now().Unix()
+	if c.fixture != nil && c.fixture.replay {
+		c.result.Metadata.At = c.fixture.At
+	}
 	c.result.Metadata.Version = pgmetrics.ModelSchemaVersion
 
 	if len(c.dbnames) == 1 && c.dbnames[0] == "pgbouncer" {
@@ -297,6 +486,11 @@ func (c *collector) collectFirst(db *sql.DB, o CollectConfig) {
 			c.version = v
 		}
 		c.getLocal()
+		if c.fixture != nil && c.fixture.replay {
+			// the files and system metrics are of this machine, not the
+			// one the fixture was recorded on
+			c.local = false
+		}
 		if c.local {
 			c.dataDir = c.setting("data_directory")
 			if len(c.dataDir) == 0 {
@@ -306,8 +500,8 @@ func (c *collector) collectFirst(db *sql.DB, o CollectConfig) {
 
 		c.collectCluster(o)
 		if c.local {
-			// Only implemented for Linux for now.
-			if runtime.GOOS == "linux" {
+			// Not implemented for Windows yet.
+			if runtime.GOOS != "windows" {
 				c.collectSystem(o)
 			}
 		}
@@ -323,6 +517,8 @@ func (c *collector) collectNext(db *sql.DB, o CollectConfig) {
 // cluster-level info and stats
 func (c *collector) collectCluster(o CollectConfig) {
 	c.getStartTime()
+	c.getClockSkew()
+	c.getRecoveryState()
 
 	if c.version >= 90600 {
 		c.getControlSystemv96()
@@ -340,6 +536,10 @@ func (c *collector) collectCluster(o CollectConfig) {
 		c.getControlCheckpointv96()
 	}
 
+	if c.version >= 90600 && c.result.TimelineID > 1 {
+		c.getTimelineHistory()
+	}
+
 	if c.version >= 90600 {
 		c.getActivityv96()
 	} else if c.version >= 90400 {
@@ -351,12 +551,27 @@ func (c *collector) collectCluster(o CollectConfig) {
 	if c.version >= 100000 {
 		c.getBETypeCountsv10()
 	}
+	c.sampleAVWorkers()
+
+	// whether preloaded libraries are also extensions can be known only if
+	// extensions are collected
+	c.getPreloadLibraries(!arrayHas(o.Omit, "extensions"))
 
 	if c.version >= 90400 {
 		c.getWALArchiver()
 	}
 
-	c.getBGWriter()
+	if c.version >= 170000 {
+		c.getBGWriterv17()
+	} else {
+		c.getBGWriter()
+	}
+	if c.version >= 160000 {
+		c.getIOStatsv16()
+	}
+	if c.version >= 170000 && c.setting("summarize_wal") == "on" {
+		c.getWALSummarizerv17()
+	}
 
 	if c.version >= 100000 {
 		c.getReplicationv10()
@@ -364,8 +579,14 @@ func (c *collector) collectCluster(o CollectConfig) {
 		c.getReplicationv9()
 	}
 
-	if c.version >= 90600 {
-		c.getWalReceiverv96()
+	// standby-only information
+	if c.result.IsInRecovery {
+		if c.version >= 90600 {
+			c.getWalReceiverv96()
+		}
+		if c.version >= 150000 {
+			c.getRecoveryPrefetchv15()
+		}
 	}
 
 	if c.version >= 100000 {
@@ -378,15 +599,41 @@ func (c *collector) collectCluster(o CollectConfig) {
 		c.getVacuumProgress()
 	}
 
+	c.getBackupState()
+
+	c.pause()
 	c.getDatabases(!o.NoSizes, o.OnlyListedDBs, c.dbnames)
+	if c.result.IsInRecovery {
+		c.getDatabaseConflicts()
+	}
+	c.pause()
 	c.getTablespaces(!o.NoSizes)
 
 	if c.version >= 90400 {
 		c.getReplicationSlotsv94()
 	}
 
+	if c.version >= 90500 {
+		c.getReplicationOriginsv95()
+	}
+
+	if c.version >= 90400 {
+		c.getXminHoldersv94()
+	}
+
 	c.getRoles()
+	c.getRolePasswords()
+	if c.version >= 100000 {
+		c.getHBARules()
+	}
+
+	// WAL generation rate, needs roles and databases to be collected first;
+	// with a sample interval, it is computed from the rate samples instead
+	if o.WALSampleSec > 0 && o.SampleIntervalSec == 0 && !c.result.IsInRecovery && !c.isAWSAurora() {
+		c.getWALActivity(time.Duration(o.WALSampleSec) * time.Second)
+	}
 
+	c.pause()
 	if c.version >= 120000 {
 		c.getWALCountsv12()
 	} else if c.version >= 110000 {
@@ -395,7 +642,8 @@ func (c *collector) collectCluster(o CollectConfig) {
 		c.getWALCounts()
 	}
 
-	if c.version >= 90600 {
+	// LISTEN is not possible on standbys, so the queue is always empty
+	if c.version >= 90600 && !c.result.IsInRecovery {
 		c.getNotification()
 	}
 
@@ -410,16 +658,19 @@ func (c *collector) collectCluster(o CollectConfig) {
 func (c *collector) collectDatabase(o CollectConfig) {
 	currdb := c.getCurrentDatabase()
 	if !arrayHas(o.Omit, "tables") {
-		c.getTables(!o.NoSizes)
+		c.heavy(func() { c.getTables(!o.NoSizes) })
 		// partition information, added schema v1.2
 		if c.version >= 100000 {
 			c.getPartitionInfo()
 		}
 		// parent information, added schema v1.2
 		c.getParentInfo()
+		if c.version >= 90300 {
+			c.getMatViews(!o.NoSizes)
+		}
 	}
 	if !arrayHas(o.Omit, "tables") && !arrayHas(o.Omit, "indexes") {
-		c.getIndexes(!o.NoSizes)
+		c.heavy(func() { c.getIndexes(!o.NoSizes) })
 	}
 	if !arrayHas(o.Omit, "sequences") {
 		c.getSequences()
@@ -428,15 +679,28 @@ func (c *collector) collectDatabase(o CollectConfig) {
 		c.getUserFunctions()
 	}
 	if !arrayHas(o.Omit, "extensions") {
+		extIdx := len(c.result.Extensions)
 		c.getExtensions()
+		if !o.NoSizes {
+			c.heavy(func() { c.getExtensionSizes(extIdx) })
+		}
 	}
 	if !arrayHas(o.Omit, "tables") && !arrayHas(o.Omit, "triggers") {
 		c.getDisabledTriggers()
 	}
 	if !arrayHas(o.Omit, "statements") {
-		c.getStatements(currdb)
+		c.heavy(func() {
+			c.getStatements(currdb)
+			if o.ExplainTop > 0 {
+				c.explainStatements(currdb, int(o.ExplainTop))
+			}
+		})
+	}
+	if o.SchemaFingerprints {
+		c.heavy(func() { c.getSchemaFingerprints(currdb) })
 	}
-	c.getBloat()
+	c.heavy(c.getBloat)
+	c.heavy(func() { c.getLargeObjects(currdb, !o.NoSizes, o.LargeObjectOrphans) })
 
 	// logical replication, added schema v1.2
 	if c.version >= 100000 {
@@ -445,6 +709,14 @@ func (c *collector) collectDatabase(o CollectConfig) {
 	}
 }
 
+// pause waits for a while before an expensive query, if the load on the
+// server is to be kept to a minimum.
+func (c *collector) pause() {
+	if c.lowCost {
+		time.Sleep(lowCostPause)
+	}
+}
+
 func arrayHas(arr []string, val string) bool {
 	for _, elem := range arr {
 		if elem == val {
@@ -562,6 +834,50 @@ func (c *collector) getWALArchiver() {
 		&a.StatsReset); err != nil {
 		log.Fatalf("pg_stat_archiver query failed: %v", err)
 	}
+
+	// how far behind is archiving? needs the current WAL position, which is
+	// not available on standbys or Aurora
+	if len(a.LastArchivedWAL) < 24 || c.result.IsInRecovery || c.isAWSAurora() ||
+		c.setting("archive_mode") == "off" {
+		return
+	}
+	q = `SELECT pg_walfile_name(pg_current_wal_lsn()), pg_current_wal_lsn()`
+	if c.version < 100000 {
+		q = `SELECT pg_xlogfile_name(pg_current_xlog_location()), pg_current_xlog_location()`
+	}
+	var curr, lsn string
+	if err := c.db.QueryRowContext(ctx, q).Scan(&curr, &lsn); err != nil {
+		log.Printf("warning: current WAL file query failed: %v", err)
+		return
+	}
+	segSize := int64(c.getWALSegmentSize())
+	lastSeg, ok1 := walSegNo(a.LastArchivedWAL, segSize)
+	currSeg, ok2 := walSegNo(curr, segSize)
+	pos, ok3 := parseLSN(lsn)
+	if !ok1 || !ok2 || !ok3 {
+		return
+	}
+	a.CurrentWAL = curr
+	if currSeg > lastSeg {
+		// the current file is still being written to, and can't be archived
+		a.LagSegments = currSeg - lastSeg - 1
+		a.LagBytes = pos - (lastSeg+1)*segSize
+	}
+}
+
+// walSegNo returns the segment number of a WAL file name, like
+// "000000010000000A000000C3". Names of .partial and .backup files, which
+// start with the WAL file name, are also accepted.
+func walSegNo(name string, segSize int64) (int64, bool) {
+	if len(name) < 24 || segSize <= 0 {
+		return 0, false
+	}
+	hi, err1 := strconv.ParseUint(name[8:16], 16, 32)
+	lo, err2 := strconv.ParseUint(name[16:24], 16, 32)
+	if err1 != nil || err2 != nil {
+		return 0, false
+	}
+	return int64(hi)*(0x100000000/segSize) + int64(lo), true
 }
 
 // have we connected to a postgres server running on the local machine?
@@ -596,6 +912,124 @@ func (c *collector) getBGWriter() {
 	bg.StatsReset = statsReset.Unix()
 }
 
+// getBGWriterv17 gets the bgwriter stats for v17+, where the checkpoint
+// stats have moved to pg_stat_checkpointer, and the backend writes to
+// pg_stat_io. The old BGWriter fields are filled in from these.
+func (c *collector) getBGWriterv17() {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	q := `SELECT buffers_clean, maxwritten_clean, buffers_alloc, stats_reset
+		  FROM pg_stat_bgwriter`
+	bg := &c.result.BGWriter
+	var statsReset time.Time
+	if err := c.db.QueryRowContext(ctx, q).Scan(&bg.BuffersClean,
+		&bg.MaxWrittenClean, &bg.BuffersAlloc, &statsReset); err != nil {
+		log.Fatalf("pg_stat_bgwriter query failed: %v", err)
+	}
+	bg.StatsReset = statsReset.Unix()
+
+	q = `SELECT num_timed, num_requested, @num_done@, restartpoints_timed,
+			restartpoints_req, restartpoints_done, write_time, sync_time,
+			buffers_written, @slru_written@, stats_reset
+		  FROM pg_stat_checkpointer`
+	if c.version >= 180000 {
+		q = strings.Replace(q, "@num_done@", "num_done", 1)
+		q = strings.Replace(q, "@slru_written@", "slru_written", 1)
+	} else {
+		q = strings.Replace(q, "@num_done@", "0", 1)
+		q = strings.Replace(q, "@slru_written@", "0", 1)
+	}
+	var cp pgmetrics.Checkpointer
+	if err := c.db.QueryRowContext(ctx, q).Scan(&cp.NumTimed, &cp.NumRequested,
+		&cp.NumDone, &cp.RestartpointsTimed, &cp.RestartpointsRequested,
+		&cp.RestartpointsDone, &cp.WriteTime, &cp.SyncTime, &cp.BuffersWritten,
+		&cp.SLRUWritten, &statsReset); err != nil {
+		log.Fatalf("pg_stat_checkpointer query failed: %v", err)
+	}
+	cp.StatsReset = statsReset.Unix()
+	c.result.Checkpointer = &cp
+	bg.CheckpointsTimed = cp.NumTimed
+	bg.CheckpointsRequested = cp.NumRequested
+	bg.CheckpointWriteTime = cp.WriteTime
+	bg.CheckpointSyncTime = cp.SyncTime
+	bg.BuffersCheckpoint = cp.BuffersWritten
+
+	q = `SELECT COALESCE(SUM(writes), 0)::bigint, COALESCE(SUM(fsyncs), 0)::bigint
+		  FROM pg_stat_io
+		  WHERE backend_type = 'client backend' AND object = 'relation'`
+	if err := c.db.QueryRowContext(ctx, q).Scan(&bg.BuffersBackend,
+		&bg.BuffersBackendFsync); err != nil {
+		log.Printf("warning: pg_stat_io query failed: %v", err)
+	}
+}
+
+// getIOStatsv16 collects the rows of pg_stat_io. Before v18, the byte
+// counts are computed from op_bytes.
+func (c *collector) getIOStatsv16() {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	q := `SELECT backend_type, object, context, COALESCE(reads, 0), @read_bytes@,
+			COALESCE(read_time, 0), COALESCE(writes, 0), @write_bytes@,
+			COALESCE(write_time, 0), COALESCE(writebacks, 0),
+			COALESCE(writeback_time, 0), COALESCE(extends, 0), @extend_bytes@,
+			COALESCE(extend_time, 0), COALESCE(hits, 0), COALESCE(evictions, 0),
+			COALESCE(reuses, 0), COALESCE(fsyncs, 0), COALESCE(fsync_time, 0),
+			COALESCE(EXTRACT(EPOCH FROM stats_reset)::bigint, 0)
+		  FROM pg_stat_io
+		  ORDER BY backend_type, object, context`
+	for _, op := range []string{"read", "write", "extend"} {
+		col := "COALESCE(" + op + "_bytes, 0)::bigint"
+		if c.version < 180000 {
+			col = "COALESCE(" + op + "s::numeric * op_bytes, 0)::bigint"
+		}
+		q = strings.Replace(q, "@"+op+"_bytes@", col, 1)
+	}
+	rows, err := c.db.QueryContext(ctx, q)
+	if err != nil {
+		log.Printf("warning: pg_stat_io query failed: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s pgmetrics.IOStat
+		if err := rows.Scan(&s.BackendType, &s.Object, &s.Context, &s.Reads,
+			&s.ReadBytes, &s.ReadTime, &s.Writes, &s.WriteBytes, &s.WriteTime,
+			&s.Writebacks, &s.WritebackTime, &s.Extends, &s.ExtendBytes,
+			&s.ExtendTime, &s.Hits, &s.Evictions, &s.Reuses, &s.Fsyncs,
+			&s.FsyncTime, &s.StatsReset); err != nil {
+			log.Fatalf("pg_stat_io query failed: %v", err)
+		}
+		c.result.IOStats = append(c.result.IOStats, s)
+	}
+	if err := rows.Err(); err != nil {
+		log.Fatalf("pg_stat_io query failed: %v", err)
+	}
+}
+
+// getWALSummarizerv17 gets the state of the WAL summarizer and the WAL
+// summaries available for incremental backups. The functions are not
+// accessible to all users, so errors are ignored.
+func (c *collector) getWALSummarizerv17() {
+	ctx, cancel := context.WithTimeout(tolerateErrors(context.Background()), c.timeout)
+	defer cancel()
+
+	q := `SELECT summarized_tli, summarized_lsn::text, pending_lsn::text,
+			COALESCE(summarizer_pid, 0)
+		  FROM pg_get_wal_summarizer_state()`
+	var ws pgmetrics.WALSummarizer
+	if err := c.db.QueryRowContext(ctx, q).Scan(&ws.SummarizedTLI,
+		&ws.SummarizedLSN, &ws.PendingLSN, &ws.PID); err != nil {
+		return
+	}
+	q = `SELECT COUNT(*), COALESCE(MIN(start_lsn)::text, '')
+		  FROM pg_available_wal_summaries()`
+	_ = c.db.QueryRowContext(ctx, q).Scan(&ws.Summaries, &ws.OldestLSN)
+	c.result.WALSummarizer = &ws
+}
+
 func (c *collector) getReplicationv10() {
 	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
 	defer cancel()
@@ -697,13 +1131,25 @@ func (c *collector) getWalReceiverv96() {
 			received_tli, last_msg_send_time, last_msg_receipt_time,
 			latest_end_lsn,
 			COALESCE(EXTRACT(EPOCH FROM latest_end_time)::bigint, 0),
-			COALESCE(slot_name, ''), conninfo
+			COALESCE(slot_name, ''), conninfo,
+			COALESCE(written_lsn::text, ''),
+			COALESCE(sender_host, ''), COALESCE(sender_port, 0)
 		  FROM pg_stat_wal_receiver`
+	if c.version >= 130000 { // received_lsn was renamed to flushed_lsn in v13
+		q = strings.Replace(q, "received_lsn", "flushed_lsn", 1)
+	} else { // written_lsn only in v13+
+		q = strings.Replace(q, "written_lsn::text", "''", 1)
+	}
+	if c.version < 110000 { // sender_{host,port} only in v11+
+		q = strings.Replace(q, "sender_host", "''", 1)
+		q = strings.Replace(q, "sender_port", "0", 1)
+	}
 	var r pgmetrics.ReplicationIn
 	var msgSend, msgRecv pq.NullTime
 	if err := c.db.QueryRowContext(ctx, q).Scan(&r.Status, &r.ReceiveStartLSN, &r.ReceiveStartTLI,
 		&r.ReceivedLSN, &r.ReceivedTLI, &msgSend, &msgRecv,
-		&r.LatestEndLSN, &r.LatestEndTime, &r.SlotName, &r.Conninfo); err != nil {
+		&r.LatestEndLSN, &r.LatestEndTime, &r.SlotName, &r.Conninfo,
+		&r.WrittenLSN, &r.SenderHost, &r.SenderPort); err != nil {
 		if err == sql.ErrNoRows {
 			return // not an error
 		}
@@ -721,6 +1167,111 @@ func (c *collector) getWalReceiverv96() {
 		r.LastMsgReceiptTime = msgRecv.Time.Unix()
 	}
 	c.result.ReplicationIncoming = &r
+	c.result.Metadata.Upstream = getUpstream(&r)
+}
+
+// getUpstream returns the host:port of the server that the wal receiver is
+// streaming from. The sender_{host,port} are used if available, else these
+// are pulled out from the conninfo.
+func getUpstream(r *pgmetrics.ReplicationIn) string {
+	host, port := r.SenderHost, ""
+	if r.SenderPort != 0 {
+		port = strconv.Itoa(r.SenderPort)
+	}
+	if len(host) == 0 {
+		for _, kv := range strings.Fields(r.Conninfo) {
+			if strings.HasPrefix(kv, "host=") {
+				host = strings.Trim(kv[5:], "'")
+			} else if strings.HasPrefix(kv, "port=") {
+				port = strings.Trim(kv[5:], "'")
+			}
+		}
+	}
+	if len(host) == 0 {
+		return ""
+	}
+	if len(port) == 0 {
+		port = "5432"
+	}
+	if strings.HasPrefix(host, "/") {
+		return host + ":" + port // unix socket
+	}
+	return net.JoinHostPort(host, port)
+}
+
+func (c *collector) getRecoveryPrefetchv15() {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	q := `SELECT prefetch, hit, skip_init, skip_new, skip_fpw, skip_rep,
+			wal_distance, block_distance, io_depth,
+			COALESCE(EXTRACT(EPOCH FROM stats_reset)::bigint, 0)
+		  FROM pg_stat_recovery_prefetch`
+	var p pgmetrics.RecoveryPrefetch
+	if err := c.db.QueryRowContext(ctx, q).Scan(&p.Prefetch, &p.Hit,
+		&p.SkipInit, &p.SkipNew, &p.SkipFPW, &p.SkipRep, &p.WALDistance,
+		&p.BlockDistance, &p.IODepth, &p.StatsReset); err != nil {
+		log.Printf("warning: pg_stat_recovery_prefetch query failed: %v", err)
+		return
+	}
+	c.result.RecoveryPrefetch = &p
+}
+
+// getRecoveryState checks if the server is a standby, and records the role
+// of the server in the metadata. This is done before the other cluster-level
+// collections, so that they can use it to decide what to collect.
+func (c *collector) getRecoveryState() {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	q := `SELECT pg_is_in_recovery()`
+	if err := c.db.QueryRowContext(ctx, q).Scan(&c.result.IsInRecovery); err != nil {
+		log.Fatalf("pg_is_in_recovery() failed: %v", err)
+	}
+	if c.result.IsInRecovery {
+		c.result.Metadata.ServerRole = "standby"
+	} else {
+		c.result.Metadata.ServerRole = "primary"
+	}
+}
+
+// getDatabaseConflicts fills in the recovery conflict counts of each
+// database, from pg_stat_database_conflicts. Only relevant for standbys.
+func (c *collector) getDatabaseConflicts() {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	q := `SELECT datid, confl_tablespace, confl_lock, confl_snapshot,
+			confl_bufferpin, confl_deadlock, confl_active_logicalslot
+		  FROM pg_stat_database_conflicts`
+	if c.version < 160000 { // confl_active_logicalslot only in v16+
+		q = strings.Replace(q, "confl_active_logicalslot", "0", 1)
+	}
+	rows, err := c.db.QueryContext(ctx, q)
+	if err != nil {
+		log.Printf("warning: pg_stat_database_conflicts query failed: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var oid int
+		var t, l, s, b, d, ls int64
+		if err := rows.Scan(&oid, &t, &l, &s, &b, &d, &ls); err != nil {
+			log.Fatalf("pg_stat_database_conflicts query failed: %v", err)
+		}
+		if db := c.result.DatabaseByOID(oid); db != nil {
+			db.ConflTablespace = t
+			db.ConflLock = l
+			db.ConflSnapshot = s
+			db.ConflBufferpin = b
+			db.ConflDeadlock = d
+			db.ConflLogicalSlot = ls
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Fatalf("pg_stat_database_conflicts query failed: %v", err)
+	}
 }
 
 func (c *collector) getAdminFuncv9() {
@@ -852,6 +1403,51 @@ func (c *collector) getLastXactv95() {
 	if err := c.db.QueryRowContext(ctx, q).Scan(&c.result.LastXactXid, &c.result.LastXactTimestamp); err != nil {
 		log.Printf("warning: pg_last_committed_xact() failed: %v", err) // continue anyway
 	}
+
+	// the oldest xid with a commit timestamp is available from v9.6
+	if c.version < 90600 {
+		return
+	}
+	q = `SELECT oldest_commit_ts_xid::text::bigint FROM pg_control_checkpoint()`
+	var xid int
+	if err := c.db.QueryRowContext(ctx, q).Scan(&xid); err != nil {
+		log.Printf("warning: pg_control_checkpoint() failed: %v", err)
+		return
+	}
+	if xid < 3 { // not a normal xid, no commit timestamps yet
+		return
+	}
+	q = `SELECT COALESCE(EXTRACT(EPOCH FROM pg_xact_commit_timestamp($1::text::xid))::bigint, 0)`
+	if err := c.db.QueryRowContext(ctx, q, xid).Scan(&c.result.OldestCommitTs); err != nil {
+		return // might have been truncated meanwhile
+	}
+	c.result.OldestCommitTsXid = xid
+}
+
+func (c *collector) getReplicationOriginsv95() {
+	ctx, cancel := context.WithTimeout(tolerateErrors(context.Background()), c.timeout)
+	defer cancel()
+
+	q := `SELECT local_id, external_id, COALESCE(remote_lsn::text, ''),
+			COALESCE(local_lsn::text, '')
+		  FROM pg_replication_origin_status
+		  ORDER BY local_id ASC`
+	rows, err := c.db.QueryContext(ctx, q)
+	if err != nil {
+		return // ignore errors, needs superuser (or pg_read_all_stats)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r pgmetrics.ReplicationOrigin
+		if err := rows.Scan(&r.ID, &r.Name, &r.RemoteLSN, &r.LocalLSN); err != nil {
+			log.Fatalf("pg_replication_origin_status query failed: %v", err)
+		}
+		c.result.ReplicationOrigins = append(c.result.ReplicationOrigins, r)
+	}
+	if err := rows.Err(); err != nil {
+		log.Fatalf("pg_replication_origin_status query failed: %v", err)
+	}
 }
 
 func (c *collector) getStartTime() {
@@ -864,6 +1460,28 @@ func (c *collector) getStartTime() {
 	}
 }
 
+// getClockSkew gets the time on the server's clock, and how far ahead it is
+// of the clock here, allowing half the round trip time for the query. When
+// replaying a fixture, the time of recording is used as the time here.
+func (c *collector) getClockSkew() {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	var server float64
+	t0 := time.Now()
+	q := `SELECT EXTRACT(EPOCH FROM clock_timestamp())`
+	if err := c.db.QueryRowContext(ctx, q).Scan(&server); err != nil {
+		log.Printf("warning: clock_timestamp() failed: %v", err)
+		return
+	}
+	here := float64(t0.UnixNano()+time.Now().UnixNano()) / 2e9
+	if c.fixture != nil && c.fixture.replay {
+		here = float64(c.fixture.At)
+	}
+	c.result.Metadata.ServerAt = int64(server)
+	c.result.Metadata.ClockSkew = math.Round((server-here)*1000) / 1000
+}
+
 func (c *collector) getControlSystemv96() {
 	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
 	defer cancel()
@@ -956,6 +1574,79 @@ func (c *collector) getControlCheckpointv11() {
 	c.fixAuroraCheckpoint()
 }
 
+// getTimelineHistory reads the history file of the current timeline, and
+// records the timeline switches listed in it. The modification times of the
+// history files are used as the approximate time of each switch.
+func (c *collector) getTimelineHistory() {
+	// no one has perms for pg_read_file in AWS RDS, so don't try
+	if c.isAWS() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(tolerateErrors(context.Background()), c.timeout)
+	defer cancel()
+
+	dir := "pg_wal"
+	if c.version < 100000 {
+		dir = "pg_xlog"
+	}
+	histFile := func(tli int) string {
+		return fmt.Sprintf("%s/%08X.history", dir, tli)
+	}
+
+	// read the history file (ignore errors, needs superuser)
+	var content string
+	q := `SELECT pg_read_file($1)`
+	if err := c.db.QueryRowContext(ctx, q, histFile(c.result.TimelineID)).Scan(&content); err != nil {
+		return
+	}
+	hist := parseTimelineHistory(content, c.result.TimelineID)
+
+	// get the time at which each new timeline's history file was written
+	q = `SELECT COALESCE(EXTRACT(EPOCH FROM modification)::bigint, 0)
+		  FROM pg_stat_file($1, true)`
+	for i := range hist {
+		_ = c.db.QueryRowContext(ctx, q, histFile(hist[i].TLI)).Scan(&hist[i].At)
+		// ignore errors, the file might have been removed
+	}
+
+	c.result.TimelineHistory = hist
+}
+
+// parseTimelineHistory parses the contents of the history file of timeline
+// tli. Each line has the parent timeline, the LSN at which it was switched
+// away from, and a reason. See postgres source backend/access/transam/timeline.c
+func parseTimelineHistory(content string, tli int) (out []pgmetrics.TimelineSwitch) {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		parts := strings.SplitN(line, "\t", 3)
+		if len(parts) < 2 {
+			continue
+		}
+		parent, err := strconv.Atoi(parts[0])
+		if err != nil {
+			continue
+		}
+		ts := pgmetrics.TimelineSwitch{ParentTLI: parent, SwitchLSN: parts[1]}
+		if len(parts) == 3 {
+			ts.Reason = strings.TrimSpace(parts[2])
+		}
+		out = append(out, ts)
+	}
+	// the new timeline of each entry is the parent in the next one
+	for i := range out {
+		if i+1 < len(out) {
+			out[i].TLI = out[i+1].ParentTLI
+		} else {
+			out[i].TLI = tli
+		}
+	}
+	return
+}
+
 func (c *collector) fixAuroraCheckpoint() {
 	// AWS Aurora reports {checkpoint,prior}_location as invalid LSNs. Reset
 	// them to empty strings instead.
@@ -979,13 +1670,14 @@ func (c *collector) getActivityv96() {
 			COALESCE(EXTRACT(EPOCH FROM state_change)::bigint, 0),
 			COALESCE(wait_event_type, ''), COALESCE(wait_event, ''),
 			COALESCE(state, ''), COALESCE(backend_xid, ''),
-			COALESCE(backend_xmin, ''), LEFT(COALESCE(query, ''), $1)
+			COALESCE(backend_xmin, ''), LEFT(COALESCE(query, ''), $1),
+			COALESCE(octet_length(query), 0)
 		  FROM pg_stat_activity`
 	if c.version >= 100000 {
 		q += " WHERE backend_type='client backend'"
 	}
 	q += " ORDER BY pid ASC"
-	rows, err := c.db.QueryContext(ctx, q, c.sqlLength)
+	rows, err := c.db.QueryContext(ctx, q, c.activityLen)
 	if err != nil {
 		log.Fatalf("pg_stat_activity query failed: %v", err)
 	}
@@ -993,12 +1685,14 @@ func (c *collector) getActivityv96() {
 
 	for rows.Next() {
 		var b pgmetrics.Backend
+		var qlen int
 		if err := rows.Scan(&b.DBName, &b.RoleName, &b.ApplicationName,
 			&b.PID, &b.ClientAddr, &b.BackendStart, &b.XactStart, &b.QueryStart,
 			&b.StateChange, &b.WaitEventType, &b.WaitEvent, &b.State,
-			&b.BackendXid, &b.BackendXmin, &b.Query); err != nil {
+			&b.BackendXid, &b.BackendXmin, &b.Query, &qlen); err != nil {
 			log.Fatalf("pg_stat_activity query failed: %v", err)
 		}
+		b.QueryTruncated = c.queryTruncated(qlen)
 		c.result.Backends = append(c.result.Backends, b)
 	}
 	if err := rows.Err(); err != nil {
@@ -1019,10 +1713,11 @@ func (c *collector) getActivityv94() {
 			COALESCE(EXTRACT(EPOCH FROM state_change)::bigint, 0),
 			COALESCE(waiting, FALSE),
 			COALESCE(state, ''), COALESCE(backend_xid, ''),
-			COALESCE(backend_xmin, ''), COALESCE(query, '')
+			COALESCE(backend_xmin, ''), LEFT(COALESCE(query, ''), $1),
+			COALESCE(octet_length(query), 0)
 		  FROM pg_stat_activity
 		  ORDER BY pid ASC`
-	rows, err := c.db.QueryContext(ctx, q)
+	rows, err := c.db.QueryContext(ctx, q, c.activityLen)
 	if err != nil {
 		log.Fatalf("pg_stat_activity query failed: %v", err)
 	}
@@ -1030,13 +1725,15 @@ func (c *collector) getActivityv94() {
 
 	for rows.Next() {
 		var b pgmetrics.Backend
+		var qlen int
 		var waiting bool
 		if err := rows.Scan(&b.DBName, &b.RoleName, &b.ApplicationName,
 			&b.PID, &b.ClientAddr, &b.BackendStart, &b.XactStart, &b.QueryStart,
 			&b.StateChange, &waiting, &b.State,
-			&b.BackendXid, &b.BackendXmin, &b.Query); err != nil {
+			&b.BackendXid, &b.BackendXmin, &b.Query, &qlen); err != nil {
 			log.Fatalf("pg_stat_activity query failed: %v", err)
 		}
+		b.QueryTruncated = c.queryTruncated(qlen)
 		if waiting {
 			b.WaitEvent = "waiting"
 			b.WaitEventType = "waiting"
@@ -1060,10 +1757,11 @@ func (c *collector) getActivityv93() {
 			COALESCE(EXTRACT(EPOCH FROM query_start)::bigint, 0),
 			COALESCE(EXTRACT(EPOCH FROM state_change)::bigint, 0),
 			COALESCE(waiting, FALSE),
-			COALESCE(state, ''), COALESCE(query, '')
+			COALESCE(state, ''), LEFT(COALESCE(query, ''), $1),
+			COALESCE(octet_length(query), 0)
 		  FROM pg_stat_activity
 		  ORDER BY pid ASC`
-	rows, err := c.db.QueryContext(ctx, q)
+	rows, err := c.db.QueryContext(ctx, q, c.activityLen)
 	if err != nil {
 		log.Fatalf("pg_stat_activity query failed: %v", err)
 	}
@@ -1071,12 +1769,14 @@ func (c *collector) getActivityv93() {
 
 	for rows.Next() {
 		var b pgmetrics.Backend
+		var qlen int
 		var waiting bool
 		if err := rows.Scan(&b.DBName, &b.RoleName, &b.ApplicationName,
 			&b.PID, &b.ClientAddr, &b.BackendStart, &b.XactStart, &b.QueryStart,
-			&b.StateChange, &waiting, &b.State, &b.Query); err != nil {
+			&b.StateChange, &waiting, &b.State, &b.Query, &qlen); err != nil {
 			log.Fatalf("pg_stat_activity query failed: %v", err)
 		}
+		b.QueryTruncated = c.queryTruncated(qlen)
 		if waiting {
 			b.WaitEvent = "waiting"
 			b.WaitEventType = "waiting"
@@ -1088,6 +1788,14 @@ func (c *collector) getActivityv93() {
 	}
 }
 
+// queryTruncated returns true if a query text of qlen bytes from
+// pg_stat_activity was cut off at track_activity_query_size bytes.
+func (c *collector) queryTruncated(qlen int) bool {
+	limit, err := strconv.Atoi(c.setting("track_activity_query_size"))
+	// the text is stored NUL-terminated, in limit bytes
+	return err == nil && limit > 1 && qlen >= limit-1
+}
+
 func (c *collector) getBETypeCountsv10() {
 	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
 	defer cancel()
@@ -1133,7 +1841,8 @@ func (c *collector) getDatabases(fillSize, onlyListed bool, dbList []string) {
 			S.tup_inserted, S.tup_updated, S.tup_deleted, S.conflicts,
 			S.temp_files, S.temp_bytes, S.deadlocks, S.blk_read_time,
 			S.blk_write_time,
-			COALESCE(EXTRACT(EPOCH FROM S.stats_reset)::bigint, 0)
+			COALESCE(EXTRACT(EPOCH FROM S.stats_reset)::bigint, 0),
+			pg_encoding_to_char(D.encoding), D.datcollate, D.datctype, @locale@
 		  FROM pg_database AS D JOIN pg_stat_database AS S
 			ON D.oid = S.datid
 		  WHERE (NOT D.datistemplate) @only@
@@ -1152,6 +1861,18 @@ func (c *collector) getDatabases(fillSize, onlyListed bool, dbList []string) {
 	}
 	q = strings.Replace(q, "@only@", onlyClause, 1)
 
+	// locale providers are only in v15+, datlocale was daticulocale before v17
+	locProvider := `CASE D.datlocprovider WHEN 'c' THEN 'libc' WHEN 'i' THEN 'icu'
+				WHEN 'b' THEN 'builtin' ELSE D.datlocprovider::text END`
+	switch {
+	case c.version >= 170000:
+		q = strings.Replace(q, "@locale@", locProvider+", COALESCE(D.datlocale, '')", 1)
+	case c.version >= 150000:
+		q = strings.Replace(q, "@locale@", locProvider+", COALESCE(D.daticulocale, '')", 1)
+	default:
+		q = strings.Replace(q, "@locale@", "'', ''", 1)
+	}
+
 	// do the query
 	rows, err := c.db.QueryContext(ctx, q, args...)
 	if err != nil {
@@ -1167,10 +1888,13 @@ func (c *collector) getDatabases(fillSize, onlyListed bool, dbList []string) {
 			&d.XactRollback, &d.BlksRead, &d.BlksHit, &d.TupReturned,
 			&d.TupFetched, &d.TupInserted, &d.TupUpdated, &d.TupDeleted,
 			&d.Conflicts, &d.TempFiles, &d.TempBytes, &d.Deadlocks,
-			&d.BlkReadTime, &d.BlkWriteTime, &d.StatsReset); err != nil {
+			&d.BlkReadTime, &d.BlkWriteTime, &d.StatsReset, &d.Encoding,
+			&d.Collate, &d.CType, &d.LocaleProvider, &d.Locale); err != nil {
 			log.Fatalf("pg_stat_database query failed: %v", err)
 		}
 		d.Size = -1 // will be filled in later if asked for
+		// large object info will be filled in later, for collected dbs only
+		d.LOCount, d.LOSize, d.LOOrphans = -1, -1, -1
 		c.result.Databases = append(c.result.Databases, d)
 	}
 	if err := rows.Err(); err != nil {
@@ -1254,7 +1978,10 @@ func (c *collector) getTables(fillSize bool) {
 			COALESCE(IO.toast_blks_read, 0), COALESCE(IO.toast_blks_hit, 0),
 			COALESCE(IO.tidx_blks_read, 0), COALESCE(IO.tidx_blks_hit, 0),
 			C.relkind, C.relpersistence, C.relnatts, age(C.relfrozenxid),
-			C.relispartition, C.reltablespace, COALESCE(array_to_string(C.relacl, E'\n'), '')
+			C.relispartition, C.reltablespace, COALESCE(array_to_string(C.relacl, E'\n'), ''),
+			(SELECT COUNT(*) FROM pg_index AS I WHERE I.indrelid = S.relid),
+			COALESCE((SELECT O.option_value::int FROM pg_options_to_table(C.reloptions) AS O
+				WHERE O.option_name = 'fillfactor'), 100)
 		  FROM pg_stat_user_tables AS S
 			JOIN pg_statio_user_tables AS IO
 			ON S.relid = IO.relid
@@ -1286,7 +2013,8 @@ func (c *collector) getTables(fillSize bool) {
 			&t.HeapBlksRead, &t.HeapBlksHit, &t.IdxBlksRead, &t.IdxBlksHit,
 			&t.ToastBlksRead, &t.ToastBlksHit, &t.TidxBlksRead, &t.TidxBlksHit,
 			&t.RelKind, &t.RelPersistence, &t.RelNAtts, &t.AgeRelFrozenXid,
-			&t.RelIsPartition, &tblspcOID, &t.ACL); err != nil {
+			&t.RelIsPartition, &tblspcOID, &t.ACL, &t.IndexCount,
+			&t.FillFactor); err != nil {
 			log.Fatalf("pg_stat(io)_user_tables query failed: %v", err)
 		}
 		t.Size = -1  // will be filled in later if asked for
@@ -1310,6 +2038,18 @@ func (c *collector) getTables(fillSize bool) {
 	if !fillSize {
 		return
 	}
+	// too many to get the size of each, estimate
+	if len(c.result.Tables)-startIdx >= estimateMinRelations {
+		if sizes := c.getSizeEstimates(); sizes != nil {
+			for i := startIdx; i < len(c.result.Tables); i++ {
+				t := &c.result.Tables[i]
+				if size, ok := sizes[t.OID]; ok {
+					t.Size, t.SizeEstimated = size, true
+				}
+			}
+			return
+		}
+	}
 	for i := startIdx; i < len(c.result.Tables); i++ {
 		c.fillTableSize(&c.result.Tables[i])
 	}
@@ -1368,11 +2108,76 @@ func (c *collector) getIndexes(fillSize bool) {
 	if !fillSize {
 		return
 	}
+	// too many to get the size of each, estimate
+	if len(c.result.Indexes)-startIdx >= estimateMinRelations {
+		if sizes := c.getSizeEstimates(); sizes != nil {
+			for i := startIdx; i < len(c.result.Indexes); i++ {
+				idx := &c.result.Indexes[i]
+				if size, ok := sizes[idx.OID]; ok {
+					idx.Size, idx.SizeEstimated = size, true
+				}
+			}
+			return
+		}
+	}
 	for i := startIdx; i < len(c.result.Indexes); i++ {
 		c.fillIndexSize(&c.result.Indexes[i])
 	}
 }
 
+func (c *collector) getMatViews(fillSize bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	q := `SELECT C.oid, N.nspname, C.relname, current_database(),
+			C.relispopulated
+		  FROM pg_class AS C
+			JOIN pg_namespace AS N ON C.relnamespace = N.oid
+		  WHERE C.relkind = 'm'
+		  ORDER BY C.oid ASC`
+	rows, err := c.db.QueryContext(ctx, q)
+	if err != nil {
+		log.Printf("warning: pg_class query for materialized views failed: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	startIdx := len(c.result.MatViews)
+	for rows.Next() {
+		mv := pgmetrics.MatView{Size: -1}
+		if err := rows.Scan(&mv.OID, &mv.SchemaName, &mv.Name, &mv.DBName,
+			&mv.Populated); err != nil {
+			log.Printf("warning: pg_class query for materialized views failed: %v", err)
+			return
+		}
+		if c.tableOK(mv.SchemaName, mv.Name) {
+			c.result.MatViews = append(c.result.MatViews, mv)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("warning: pg_class query for materialized views failed: %v", err)
+		return
+	}
+	rows.Close()
+
+	// size each one separately, a matview being refreshed is locked
+	if fillSize {
+		for i := startIdx; i < len(c.result.MatViews); i++ {
+			c.fillMatViewSize(&c.result.MatViews[i])
+		}
+	}
+}
+
+func (c *collector) fillMatViewSize(mv *pgmetrics.MatView) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	q := `SELECT pg_total_relation_size($1)`
+	if err := c.db.QueryRowContext(ctx, q, mv.OID).Scan(&mv.Size); err != nil {
+		mv.Size = -1
+	}
+}
+
 func (c *collector) getSequences() {
 	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
 	defer cancel()
@@ -1431,36 +2236,168 @@ func (c *collector) getUserFunctions() {
 	}
 }
 
+// getBackupState looks for backups in progress: exclusive backups (before
+// v15), the backup_label file if local, and streaming base backups (v13+).
+func (c *collector) getBackupState() {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	var bs pgmetrics.BackupState
+	if c.version >= 90300 && c.version < 150000 && !c.result.IsInRecovery {
+		q := `SELECT pg_is_in_backup(),
+				COALESCE(EXTRACT(EPOCH FROM pg_backup_start_time())::bigint, 0)`
+		if err := c.db.QueryRowContext(ctx, q).Scan(&bs.ExclusiveInProgress,
+			&bs.ExclusiveStart); err != nil {
+			log.Printf("warning: pg_is_in_backup() failed: %v", err)
+		}
+	}
+
+	if c.local && len(c.dataDir) > 0 {
+		if fi, err := os.Stat(filepath.Join(c.dataDir, "backup_label")); err == nil {
+			bs.LabelFileTime = fi.ModTime().Unix()
+		}
+	}
+
+	if c.version >= 130000 {
+		q := `SELECT p.pid, COALESCE(p.phase, ''), COALESCE(p.backup_total, 0),
+				COALESCE(p.backup_streamed, 0), COALESCE(p.tablespaces_total, 0),
+				COALESCE(p.tablespaces_streamed, 0),
+				COALESCE(EXTRACT(EPOCH FROM a.backend_start)::bigint, 0),
+				COALESCE(a.application_name, ''), COALESCE(a.client_addr::text, '')
+			  FROM pg_stat_progress_basebackup p
+			  LEFT JOIN pg_stat_activity a ON p.pid = a.pid
+			  ORDER BY p.pid ASC`
+		rows, err := c.db.QueryContext(ctx, q)
+		if err != nil {
+			log.Printf("warning: pg_stat_progress_basebackup query failed: %v", err)
+		} else {
+			defer rows.Close()
+			for rows.Next() {
+				var b pgmetrics.BaseBackupProgress
+				if err := rows.Scan(&b.PID, &b.Phase, &b.BackupTotal,
+					&b.BackupStreamed, &b.TablespacesTotal,
+					&b.TablespacesStreamed, &b.BackendStart,
+					&b.ApplicationName, &b.ClientAddr); err != nil {
+					log.Fatalf("pg_stat_progress_basebackup query failed: %v", err)
+				}
+				bs.BaseBackups = append(bs.BaseBackups, b)
+			}
+			if err := rows.Err(); err != nil {
+				log.Fatalf("pg_stat_progress_basebackup query failed: %v", err)
+			}
+		}
+	}
+
+	if bs.ExclusiveInProgress || bs.LabelFileTime > 0 || len(bs.BaseBackups) > 0 {
+		c.result.BackupState = &bs
+	}
+}
+
 func (c *collector) getVacuumProgress() {
 	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
 	defer cancel()
 
-	q := `SELECT datname, COALESCE(relid, 0), COALESCE(phase, ''),
+	q := `SELECT pid, datname, COALESCE(relid, 0), COALESCE(phase, ''),
 			COALESCE(heap_blks_total, 0), COALESCE(heap_blks_scanned, 0),
 			COALESCE(heap_blks_vacuumed, 0), COALESCE(index_vacuum_count, 0),
-			COALESCE(max_dead_tuples, 0), COALESCE(num_dead_tuples, 0)
+			COALESCE(max_dead_tuples, 0), COALESCE(num_dead_tuples, 0),
+			@v17@
 		  FROM pg_stat_progress_vacuum
 		  ORDER BY pid ASC`
+	if c.version >= 170000 { // dead tuple store is limited by size
+		q = strings.Replace(q, "COALESCE(max_dead_tuples, 0)", "0", 1)
+		q = strings.Replace(q, "num_dead_tuples", "num_dead_item_ids", 1)
+		q = strings.Replace(q, "@v17@", `COALESCE(max_dead_tuple_bytes, 0),
+			COALESCE(dead_tuple_bytes, 0), COALESCE(indexes_total, 0),
+			COALESCE(indexes_processed, 0)`, 1)
+	} else {
+		q = strings.Replace(q, "@v17@", "0, 0, 0, 0", 1)
+	}
 	rows, err := c.db.QueryContext(ctx, q)
 	if err != nil {
 		log.Fatalf("pg_stat_progress_vacuum query failed: %v", err)
 	}
-	defer rows.Close()
+	defer rows.Close()
+
+	for rows.Next() {
+		var p pgmetrics.VacuumProgressBackend
+		if err := rows.Scan(&p.PID, &p.DBName, &p.TableOID, &p.Phase, &p.HeapBlksTotal,
+			&p.HeapBlksScanned, &p.HeapBlksVacuumed, &p.IndexVacuumCount,
+			&p.MaxDeadTuples, &p.NumDeadTuples, &p.MaxDeadTupleBytes,
+			&p.DeadTupleBytes, &p.IndexesTotal, &p.IndexesProcessed); err != nil {
+			log.Fatalf("pg_stat_progress_vacuum query failed: %v", err)
+		}
+		if t := c.result.TableByOID(p.TableOID); t != nil {
+			p.TableName = t.Name
+		}
+		c.result.VacuumProgress = append(c.result.VacuumProgress, p)
+	}
+	if err := rows.Err(); err != nil {
+		log.Fatalf("pg_stat_progress_vacuum query failed: %v", err)
+	}
+}
+
+// getPreloadLibraries parses shared_preload_libraries, and if checkExt is
+// set, finds out which of the libraries are also extensions.
+func (c *collector) getPreloadLibraries(checkExt bool) {
+	var names []string
+	for _, lib := range strings.Split(c.setting("shared_preload_libraries"), ",") {
+		lib = strings.Trim(strings.TrimSpace(lib), `"`)
+		if pos := strings.LastIndexAny(lib, `/\`); pos != -1 { // like "$libdir/foo"
+			lib = lib[pos+1:]
+		}
+		lib = strings.TrimSuffix(strings.TrimSuffix(lib, ".so"), ".dll")
+		if len(lib) > 0 {
+			names = append(names, lib)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	exts := make(map[string]bool)
+	if checkExt {
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		defer cancel()
+
+		q := `SELECT name FROM pg_available_extensions WHERE name = ANY($1)`
+		rows, err := c.db.QueryContext(ctx, q, pq.Array(names))
+		if err != nil {
+			log.Fatalf("pg_available_extensions query failed: %v", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				log.Fatalf("pg_available_extensions query failed: %v", err)
+			}
+			exts[name] = true
+		}
+		if err := rows.Err(); err != nil {
+			log.Fatalf("pg_available_extensions query failed: %v", err)
+		}
+	}
 
-	for rows.Next() {
-		var p pgmetrics.VacuumProgressBackend
-		if err := rows.Scan(&p.DBName, &p.TableOID, &p.Phase, &p.HeapBlksTotal,
-			&p.HeapBlksScanned, &p.HeapBlksVacuumed, &p.IndexVacuumCount,
-			&p.MaxDeadTuples, &p.NumDeadTuples); err != nil {
-			log.Fatalf("pg_stat_progress_vacuum query failed: %v", err)
+	for _, name := range names {
+		c.result.PreloadLibraries = append(c.result.PreloadLibraries,
+			pgmetrics.PreloadLibrary{Name: name, Extension: exts[name]})
+	}
+}
+
+// fillPreloadLibraries fills in the databases in which the preloaded
+// libraries are installed as extensions. Must be called after extensions are
+// collected from all databases.
+func (c *collector) fillPreloadLibraries() {
+	for i := range c.result.PreloadLibraries {
+		pl := &c.result.PreloadLibraries[i]
+		if !pl.Extension {
+			continue
 		}
-		if t := c.result.TableByOID(p.TableOID); t != nil {
-			p.TableName = t.Name
+		for _, e := range c.result.Extensions {
+			if e.Name == pl.Name {
+				pl.InstalledIn = append(pl.InstalledIn, e.DBName)
+			}
 		}
-		c.result.VacuumProgress = append(c.result.VacuumProgress, p)
-	}
-	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_stat_progress_vacuum query failed: %v", err)
 	}
 }
 
@@ -1492,6 +2429,73 @@ func (c *collector) getExtensions() {
 	}
 }
 
+// getExtensionSizes fills in the number and total size of the tables and
+// materialized views that belong to the extensions of the current database,
+// which are at and after startIdx in c.result.Extensions. These are the
+// members of the extension, and the relations in the schemas that are (like
+// the chunks of TimescaleDB hypertables in _timescaledb_internal). Like for
+// tables, the sizes are estimated if there are too many such relations.
+func (c *collector) getExtensionSizes(startIdx int) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	q := `WITH owned AS (
+			SELECT D.refobjid AS extoid, C.oid AS reloid
+			  FROM pg_depend AS D
+				JOIN pg_class AS C ON C.oid = D.objid
+			  WHERE D.classid = 'pg_class'::regclass
+				AND D.refclassid = 'pg_extension'::regclass AND D.deptype = 'e'
+				AND C.relkind IN ('r', 'm')
+			UNION
+			SELECT D.refobjid, C.oid
+			  FROM pg_depend AS D
+				JOIN pg_class AS C ON C.relnamespace = D.objid
+			  WHERE D.classid = 'pg_namespace'::regclass
+				AND D.refclassid = 'pg_extension'::regclass AND D.deptype = 'e'
+				AND C.relkind IN ('r', 'm')
+		  )
+		  SELECT E.extname, COUNT(*),
+			COALESCE(SUM(CASE WHEN (SELECT COUNT(*) FROM owned) < $1
+				THEN pg_total_relation_size(C.oid)
+				ELSE (C.relpages::bigint + COALESCE(T.relpages, 0) +
+					COALESCE((SELECT SUM(I.relpages) FROM pg_index AS X
+						JOIN pg_class AS I ON I.oid = X.indexrelid
+						WHERE X.indrelid = C.oid), 0)) *
+					current_setting('block_size')::bigint
+				END), 0)::bigint,
+			(SELECT COUNT(*) FROM owned) >= $1
+		  FROM owned AS O
+			JOIN pg_extension AS E ON E.oid = O.extoid
+			JOIN pg_class AS C ON C.oid = O.reloid
+			LEFT JOIN pg_class AS T ON T.oid = C.reltoastrelid
+		  GROUP BY E.extname`
+	rows, err := c.heavyDB().QueryContext(ctx, q, estimateMinRelations)
+	if err != nil {
+		log.Printf("warning: extension size query failed: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var count int
+		var size int64
+		var estimated bool
+		if err := rows.Scan(&name, &count, &size, &estimated); err != nil {
+			log.Fatalf("extension size query failed: %v", err)
+		}
+		for i := startIdx; i < len(c.result.Extensions); i++ {
+			if e := &c.result.Extensions[i]; e.Name == name {
+				e.Relations, e.Size, e.SizeEstimated = count, size, estimated
+				break
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Fatalf("extension size query failed: %v", err)
+	}
+}
+
 func (c *collector) getRoles() {
 	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
 	defer cancel()
@@ -1532,13 +2536,140 @@ func (c *collector) getRoles() {
 	}
 }
 
+// getXminHoldersv94 collects the standbys, replication slots, backends and
+// prepared transactions that are holding back the xmin horizon. Only the
+// oldest few backends and prepared transactions are included.
+func (c *collector) getXminHoldersv94() {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	q := `SELECT 'standby', COALESCE(NULLIF(application_name, ''), client_addr::text, pid::text),
+			backend_xmin::text::bigint, age(backend_xmin)
+		  FROM pg_stat_replication
+		  WHERE backend_xmin IS NOT NULL
+		UNION ALL
+		  SELECT 'slot', slot_name, xmin::text::bigint, age(xmin)
+		  FROM pg_replication_slots
+		  WHERE xmin IS NOT NULL
+		UNION ALL
+		  SELECT 'slot catalog', slot_name, catalog_xmin::text::bigint, age(catalog_xmin)
+		  FROM pg_replication_slots
+		  WHERE catalog_xmin IS NOT NULL
+		UNION ALL
+		  (SELECT 'backend', pid::text || ' (' || COALESCE(usename, '') || '@' || COALESCE(datname, '') || ')',
+			CASE WHEN age(backend_xid) > COALESCE(age(backend_xmin), -1)
+				THEN backend_xid ELSE backend_xmin END::text::bigint,
+			GREATEST(age(backend_xid), age(backend_xmin))
+		  FROM pg_stat_activity
+		  WHERE pid <> pg_backend_pid() AND backend_type <> 'walsender'
+			AND (backend_xid IS NOT NULL OR backend_xmin IS NOT NULL)
+		  ORDER BY 4 DESC LIMIT 5)
+		UNION ALL
+		  (SELECT 'prepared', gid, transaction::text::bigint, age(transaction)
+		  FROM pg_prepared_xacts
+		  ORDER BY 4 DESC LIMIT 5)
+		ORDER BY 4 DESC`
+	if c.version < 100000 { // backend_type only in v10+, walsenders not listed before that
+		q = strings.Replace(q, "backend_type <> 'walsender'", "TRUE", 1)
+	}
+	rows, err := c.db.QueryContext(ctx, q)
+	if err != nil {
+		log.Printf("warning: xmin horizon query failed: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var h pgmetrics.XminHolder
+		if err := rows.Scan(&h.Kind, &h.Name, &h.Xmin, &h.Age); err != nil {
+			log.Fatalf("xmin horizon query failed: %v", err)
+		}
+		c.result.XminHolders = append(c.result.XminHolders, h)
+	}
+	if err := rows.Err(); err != nil {
+		log.Fatalf("xmin horizon query failed: %v", err)
+	}
+}
+
+// getRolePasswords fills in the type of password stored for each role. This
+// needs read access to pg_authid, errors are ignored.
+func (c *collector) getRolePasswords() {
+	ctx, cancel := context.WithTimeout(tolerateErrors(context.Background()), c.timeout)
+	defer cancel()
+
+	q := `SELECT oid,
+			CASE WHEN rolpassword IS NULL THEN 'none'
+				 WHEN rolpassword ~ '^md5[0-9a-f]{32}$' THEN 'md5'
+				 WHEN rolpassword LIKE 'SCRAM-SHA-256$%' THEN 'scram-sha-256'
+				 ELSE 'plain' END
+		  FROM pg_authid`
+	rows, err := c.db.QueryContext(ctx, q)
+	if err != nil {
+		return // usually permission denied, ignore
+	}
+	defer rows.Close()
+
+	types := make(map[int]string)
+	for rows.Next() {
+		var oid int
+		var ptype string
+		if err := rows.Scan(&oid, &ptype); err != nil {
+			return
+		}
+		types[oid] = ptype
+	}
+	if err := rows.Err(); err != nil {
+		return
+	}
+	for i := range c.result.Roles {
+		c.result.Roles[i].PasswordType = types[c.result.Roles[i].OID]
+	}
+}
+
+// getHBARules reads the client authentication rules from pg_hba_file_rules.
+// This needs superuser privileges, errors are ignored.
+func (c *collector) getHBARules() {
+	ctx, cancel := context.WithTimeout(tolerateErrors(context.Background()), c.timeout)
+	defer cancel()
+
+	q := `SELECT COALESCE(line_number, 0), COALESCE(type, ''),
+			COALESCE(database, '{}'), COALESCE(user_name, '{}'),
+			COALESCE(address, ''), COALESCE(netmask, ''),
+			COALESCE(auth_method, ''), COALESCE(error, '')
+		  FROM pg_hba_file_rules
+		  ORDER BY line_number ASC`
+	rows, err := c.db.QueryContext(ctx, q)
+	if err != nil {
+		return // usually permission denied, ignore
+	}
+	defer rows.Close()
+
+	var rules []pgmetrics.HBARule
+	for rows.Next() {
+		var r pgmetrics.HBARule
+		if err := rows.Scan(&r.Line, &r.Type, pq.Array(&r.Databases),
+			pq.Array(&r.Users), &r.Address, &r.Netmask, &r.AuthMethod,
+			&r.Error); err != nil {
+			log.Printf("warning: pg_hba_file_rules query failed: %v", err)
+			return
+		}
+		rules = append(rules, r)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("warning: pg_hba_file_rules query failed: %v", err)
+		return
+	}
+	c.result.HBARules = rules
+}
+
 func (c *collector) getReplicationSlotsv94() {
 	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
 	defer cancel()
 
 	q := `SELECT slot_name, COALESCE(plugin, ''), slot_type,
 			COALESCE(database, ''), active, xmin, catalog_xmin,
-			restart_lsn, confirmed_flush_lsn, temporary
+			restart_lsn, confirmed_flush_lsn, temporary, two_phase,
+			COALESCE(EXTRACT(EPOCH FROM inactive_since)::bigint, 0)
 		  FROM pg_replication_slots
 		  ORDER BY slot_name ASC`
 	if c.version < 90600 { // confirmed_flush_lsn only in v9.6+
@@ -1547,6 +2678,12 @@ func (c *collector) getReplicationSlotsv94() {
 	if c.version < 100000 { // temporary only in v10+
 		q = strings.Replace(q, "temporary", "FALSE", 1)
 	}
+	if c.version < 140000 { // two_phase only in v14+
+		q = strings.Replace(q, "two_phase", "FALSE", 1)
+	}
+	if c.version < 170000 { // inactive_since only in v17+
+		q = strings.Replace(q, "COALESCE(EXTRACT(EPOCH FROM inactive_since)::bigint, 0)", "0", 1)
+	}
 	rows, err := c.db.QueryContext(ctx, q)
 	if err != nil {
 		log.Printf("warning: pg_replication_slots query failed: %v", err)
@@ -1560,7 +2697,7 @@ func (c *collector) getReplicationSlotsv94() {
 		var rlsn, cflsn sql.NullString
 		if err := rows.Scan(&rs.SlotName, &rs.Plugin, &rs.SlotType,
 			&rs.DBName, &rs.Active, &xmin, &cXmin, &rlsn, &cflsn,
-			&rs.Temporary); err != nil {
+			&rs.Temporary, &rs.TwoPhase, &rs.InactiveSince); err != nil {
 			log.Fatalf("pg_replication_slots query failed: %v", err)
 		}
 		rs.Xmin = int(xmin.Int64)
@@ -1611,7 +2748,7 @@ func (c *collector) getDisabledTriggers() {
 func (c *collector) getStatements(currdb string) {
 	// Even if PSS is installed only in one database, querying it gives queries
 	// from across all databases. Fetching this information once is enough.
-	if len(c.result.Statements) > 0 {
+	if c.stmtsDone || len(c.result.Statements) > 0 {
 		return
 	}
 
@@ -1626,11 +2763,18 @@ func (c *collector) getStatements(currdb string) {
 	if !found {
 		return
 	}
+	c.queryStatements(currdb)
+}
 
+// queryStatements fetches the top statements from pg_stat_statements, which
+// must be installed in the current database.
+func (c *collector) queryStatements(currdb string) {
 	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
 	defer cancel()
 
-	q := `SELECT userid, dbid, queryid, LEFT(COALESCE(query, ''), $1), calls, total_time,
+	// the full query text is fetched to compute the fingerprint, and
+	// truncated later
+	q := `SELECT userid, dbid, queryid, COALESCE(query, ''), calls, total_time,
 			min_time, max_time, stddev_time, rows, shared_blks_hit,
 			shared_blks_read, shared_blks_dirtied, shared_blks_written,
 			local_blks_hit, local_blks_read, local_blks_dirtied,
@@ -1638,8 +2782,27 @@ func (c *collector) getStatements(currdb string) {
 			blk_read_time, blk_write_time
 		  FROM pg_stat_statements
 		  ORDER BY total_time DESC
-		  LIMIT $2`
-	rows, err := c.db.QueryContext(ctx, q, c.sqlLength, c.stmtsLimit)
+		  LIMIT $1`
+	// the query is adjusted to the version of pg_stat_statements by retrying
+	// on errors, only the last error is recorded
+	probe := tolerateErrors(ctx)
+	rows, err := c.db.QueryContext(probe, q, c.stmtsLimit)
+	// pg_stat_statements v1.8 (postgres v13) and later track planning and
+	// execution times separately, use the execution times.
+	if err != nil && strings.Contains(err.Error(), "total_time") {
+		for _, col := range []string{"total", "min", "max", "stddev"} {
+			q = strings.Replace(q, col+"_time", col+"_exec_time", -1)
+		}
+		rows, err = c.db.QueryContext(probe, q, c.stmtsLimit)
+	}
+	// v1.11 (postgres v17) and later split out the block I/O times into
+	// shared and local.
+	if err != nil && strings.Contains(err.Error(), "blk_read_time") {
+		q = strings.Replace(q, "blk_read_time, blk_write_time",
+			`shared_blk_read_time + local_blk_read_time,
+			shared_blk_write_time + local_blk_write_time`, 1)
+		rows, err = c.db.QueryContext(probe, q, c.stmtsLimit)
+	}
 	if err != nil {
 		// If we get an error about "min_time" we probably have an old (v1.2)
 		// version of pg_stat_statements which does not have min_time, max_time
@@ -1651,17 +2814,19 @@ func (c *collector) getStatements(currdb string) {
 			q = strings.Replace(q, "min_time", "0", 1)
 			q = strings.Replace(q, "max_time", "0", 1)
 			q = strings.Replace(q, "stddev_time", "0", 1)
-			rows, err = c.db.QueryContext(ctx, q, c.sqlLength, c.stmtsLimit)
+			rows, err = c.db.QueryContext(probe, q, c.stmtsLimit)
 		}
-		// If we still have errors, silently give up on querying
-		// pg_stat_statements.
+		// If we still have errors, give up on querying pg_stat_statements,
+		// noting it only in the diagnostics.
 		if err != nil {
+			c.qerrs.add(q, err)
 			return
 		}
 	}
 	defer rows.Close()
 
 	c.result.Statements = make([]pgmetrics.Statement, 0, c.stmtsLimit)
+	c.stmtsDB = currdb
 	for rows.Next() {
 		var s pgmetrics.Statement
 		var queryID sql.NullInt64
@@ -1683,11 +2848,281 @@ func (c *collector) getStatements(currdb string) {
 		}
 		// Query ID, set to 0 if null
 		s.QueryID = queryID.Int64
+		// Fingerprint, then truncate the query like LEFT() would have
+		s.Fingerprint = pgmetrics.Fingerprint(s.Query)
+		if rs := []rune(s.Query); uint(len(rs)) > c.sqlLength {
+			s.Query = string(rs[:c.sqlLength])
+		}
 		c.result.Statements = append(c.result.Statements, s)
 	}
 	if err := rows.Err(); err != nil {
 		log.Fatalf("pg_stat_statements failed: %v", err)
 	}
+
+	if c.version >= 140000 {
+		c.getStatementsInfo()
+	}
+}
+
+// resetStatements resets pg_stat_statements, over a new connection to the
+// database the statements were collected from, and records that it did.
+func (c *collector) resetStatements(connstr string, o CollectConfig) {
+	db := c.openDB(connstr, o)
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	if _, err := db.ExecContext(ctx, `SELECT pg_stat_statements_reset()`); err != nil {
+		log.Printf("warning: pg_stat_statements_reset failed: %v", err)
+		return
+	}
+	c.result.Metadata.StatementsReset = time.Now().Unix()
+}
+
+// getStatementsInfo gets the time pg_stat_statements was last reset, so that
+// its counters can be interpreted.
+func (c *collector) getStatementsInfo() {
+	ctx, cancel := context.WithTimeout(tolerateErrors(context.Background()), c.timeout)
+	defer cancel()
+
+	q := `SELECT dealloc, COALESCE(EXTRACT(EPOCH FROM stats_reset)::bigint, 0)
+		  FROM pg_stat_statements_info`
+	var si pgmetrics.StatementsInfo
+	if err := c.db.QueryRowContext(ctx, q).Scan(&si.Dealloc, &si.StatsReset); err != nil {
+		return // extension older than v1.9, not an error
+	}
+	c.result.StatementsInfo = &si
+}
+
+type walStmtKey struct {
+	userOID int
+	dbOID   int
+	queryID int64
+}
+
+// walStmtSample returns the cumulative WAL stats of each pg_stat_statements
+// entry. Returns nil if pg_stat_statements is not available.
+func (c *collector) walStmtSample() map[walStmtKey]pgmetrics.WALStatement {
+	ctx, cancel := context.WithTimeout(tolerateErrors(context.Background()), c.timeout)
+	defer cancel()
+
+	q := `SELECT userid, dbid, COALESCE(queryid, 0),
+			LEFT(COALESCE(MIN(query), ''), $1), SUM(calls),
+			SUM(wal_records), SUM(wal_fpi), SUM(wal_bytes)::bigint
+		  FROM pg_stat_statements
+		  GROUP BY userid, dbid, queryid`
+	rows, err := c.db.QueryContext(ctx, q, c.sqlLength)
+	if err != nil {
+		return nil // not installed, or no permissions
+	}
+	defer rows.Close()
+
+	out := make(map[walStmtKey]pgmetrics.WALStatement)
+	for rows.Next() {
+		var s pgmetrics.WALStatement
+		if err := rows.Scan(&s.UserOID, &s.DBOID, &s.QueryID, &s.Query,
+			&s.Calls, &s.WALRecords, &s.WALFPI, &s.WALBytes); err != nil {
+			log.Fatalf("pg_stat_statements scan failed: %v", err)
+		}
+		out[walStmtKey{s.UserOID, s.DBOID, s.QueryID}] = s
+	}
+	if err := rows.Err(); err != nil {
+		log.Fatalf("pg_stat_statements failed: %v", err)
+	}
+	return out
+}
+
+// walStmtsTop is the max number of statements reported in WAL activity.
+const walStmtsTop = 10
+
+func (c *collector) getWALActivity(interval time.Duration) {
+	qLSN := `SELECT pg_current_wal_lsn()`
+	qDiff := `SELECT pg_wal_lsn_diff($1, $2)::bigint`
+	if c.version < 100000 {
+		qLSN = `SELECT pg_current_xlog_location()`
+		qDiff = `SELECT pg_xlog_location_diff($1, $2)::bigint`
+	}
+	getLSN := func() (lsn string, ok bool) {
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		defer cancel()
+		if err := c.db.QueryRowContext(ctx, qLSN).Scan(&lsn); err != nil {
+			log.Printf("warning: failed to get current wal position: %v", err)
+			return "", false
+		}
+		return lsn, true
+	}
+
+	// first sample
+	var before map[walStmtKey]pgmetrics.WALStatement
+	if c.version >= 130000 {
+		before = c.walStmtSample()
+	}
+	start, ok := getLSN()
+	if !ok {
+		return
+	}
+	t1 := time.Now()
+
+	time.Sleep(interval)
+
+	// second sample
+	end, ok := getLSN()
+	if !ok {
+		return
+	}
+	secs := time.Since(t1).Seconds()
+	var after map[walStmtKey]pgmetrics.WALStatement
+	if before != nil {
+		after = c.walStmtSample()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	var bytes int64
+	if err := c.db.QueryRowContext(ctx, qDiff, end, start).Scan(&bytes); err != nil {
+		log.Printf("warning: failed to compute wal position difference: %v", err)
+		return
+	}
+
+	c.result.WALActivity = c.makeWALActivity(start, end, bytes, secs, before, after)
+}
+
+// makeWALActivity returns the WAL activity between two samples, secs apart,
+// of the WAL position and of the pg_stat_statements WAL stats.
+func (c *collector) makeWALActivity(start, end string, bytes int64, secs float64,
+	before, after map[walStmtKey]pgmetrics.WALStatement) *pgmetrics.WALActivity {
+	wa := pgmetrics.WALActivity{
+		Interval: secs,
+		StartLSN: start,
+		EndLSN:   end,
+		Bytes:    bytes,
+	}
+	if secs > 0 {
+		wa.BytesPerSec = float64(wa.Bytes) / secs
+	}
+
+	// diff the statements, entries not seen in the first sample are new and
+	// counted in full
+	for k, s := range after {
+		if b, ok := before[k]; ok {
+			s.Calls -= b.Calls
+			s.WALRecords -= b.WALRecords
+			s.WALFPI -= b.WALFPI
+			s.WALBytes -= b.WALBytes
+		}
+		if s.WALBytes <= 0 {
+			continue
+		}
+		if r := c.result.RoleByOID(s.UserOID); r != nil {
+			s.UserName = r.Name
+		}
+		if d := c.result.DatabaseByOID(s.DBOID); d != nil {
+			s.DBName = d.Name
+		}
+		wa.TopStatements = append(wa.TopStatements, s)
+	}
+	sort.Slice(wa.TopStatements, func(i, j int) bool {
+		return wa.TopStatements[i].WALBytes > wa.TopStatements[j].WALBytes
+	})
+	if len(wa.TopStatements) > walStmtsTop {
+		wa.TopStatements = wa.TopStatements[:walStmtsTop]
+	}
+	return &wa
+}
+
+var rxExplainable = regexp.MustCompile(`(?i)^\s*(SELECT|WITH|INSERT|UPDATE|DELETE|VALUES|TABLE)\b`)
+var rxParam = regexp.MustCompile(`\$([0-9]+)`)
+
+// explainStatements gets the generic plans of those of the top n statements
+// that were executed in the current database. The EXPLAINs are run in a
+// read-only transaction, and never with ANALYZE, so the statements are never
+// actually executed.
+func (c *collector) explainStatements(currdb string, n int) {
+	if c.version < 120000 { // needs GENERIC_PLAN (v16+) or plan_cache_mode (v12+)
+		return
+	}
+	for i := 0; i < n && i < len(c.result.Statements); i++ {
+		s := &c.result.Statements[i]
+		if s.DBName != currdb || len(s.Plan) > 0 {
+			continue
+		}
+		s.Plan = c.explainStatement(s)
+	}
+}
+
+func (c *collector) explainStatement(s *pgmetrics.Statement) string {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	// the collected text might have been truncated, get it in full
+	var query string
+	q := `SELECT query FROM pg_stat_statements
+		  WHERE userid = $1 AND dbid = $2 AND queryid = $3
+		  LIMIT 1`
+	if err := c.db.QueryRowContext(ctx, q, s.UserOID, s.DBOID, s.QueryID).Scan(&query); err != nil {
+		return ""
+	}
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+	if !rxExplainable.MatchString(query) || strings.Contains(query, ";") {
+		return ""
+	}
+
+	tx, err := c.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return ""
+	}
+	// prepared statements outlive the transaction, deallocate after rollback
+	prepared := false
+	defer func() {
+		tx.Rollback()
+		if prepared {
+			c.db.ExecContext(ctx, "DEALLOCATE pgmetrics_explain")
+		}
+	}()
+
+	var eq string
+	if c.version >= 160000 {
+		eq = "EXPLAIN (GENERIC_PLAN) " + query
+	} else {
+		// prepare it and explain the execution of the generic plan, with
+		// all parameters as NULL
+		nparams := 0
+		for _, m := range rxParam.FindAllStringSubmatch(query, -1) {
+			if p, _ := strconv.Atoi(m[1]); p > nparams {
+				nparams = p
+			}
+		}
+		if _, err := tx.ExecContext(ctx, "SET LOCAL plan_cache_mode = force_generic_plan"); err != nil {
+			return ""
+		}
+		if _, err := tx.ExecContext(ctx, "PREPARE pgmetrics_explain AS "+query); err != nil {
+			return ""
+		}
+		prepared = true
+		eq = "EXPLAIN EXECUTE pgmetrics_explain"
+		if nparams > 0 {
+			eq += "(" + strings.Repeat("NULL, ", nparams-1) + "NULL)"
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, eq)
+	if err != nil {
+		return ""
+	}
+	defer rows.Close()
+	var lines []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return ""
+		}
+		lines = append(lines, line)
+	}
+	if rows.Err() != nil {
+		return ""
+	}
+	return strings.Join(lines, "\n")
 }
 
 func (c *collector) getWALSegmentSize() (out int) {
@@ -1769,7 +3204,7 @@ func (c *collector) getWALCounts() {
 // getWALCountsActual actually executes the given queries to get the WAL file
 // and archive ready counts.
 func (c *collector) getWALCountsActual(q1, q2 string) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(tolerateErrors(context.Background()), c.timeout)
 	defer cancel()
 
 	// see postgres source include/access/xlog_internal.h
@@ -2068,7 +3503,7 @@ func (c *collector) getBloat() {
 	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
 	defer cancel()
 
-	rows, err := c.db.QueryContext(ctx, sqlBloat)
+	rows, err := c.heavyDB().QueryContext(ctx, sqlBloat)
 	if err != nil {
 		log.Fatalf("bloat query failed: %v", err)
 	}
@@ -2098,6 +3533,111 @@ func (c *collector) getBloat() {
 	}
 }
 
+// getLargeObjects fills in the large object count, the size of pg_largeobject
+// and, if asked for, the number of orphaned large objects for the current
+// database. A large object is considered orphaned if its OID does not appear
+// in any column of type oid or lo in any user table (this is the same logic as
+// vacuumlo). Finding them scans every such table, so it is never done when
+// keeping the load on the server low.
+func (c *collector) getLargeObjects(currdb string, fillSize, findOrphans bool) {
+	d := c.result.DatabaseByName(currdb)
+	if d == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	// with too many to count, estimate the count and sample for orphans
+	// (TABLESAMPLE is only in v9.5+)
+	if n := c.getLOCountEstimate(); n >= estimateMinLOs && c.version >= 90500 {
+		d.LOCount, d.LOEstimated = n, true
+	} else {
+		q := `SELECT COUNT(*) FROM pg_largeobject_metadata`
+		if err := c.heavyDB().QueryRowContext(ctx, q).Scan(&d.LOCount); err != nil {
+			log.Printf("warning: pg_largeobject_metadata query failed: %v", err)
+			return
+		}
+	}
+
+	if fillSize {
+		q := `SELECT pg_total_relation_size('pg_catalog.pg_largeobject'::regclass)`
+		if err := c.heavyDB().QueryRowContext(ctx, q).Scan(&d.LOSize); err != nil {
+			d.LOSize = -1
+		}
+	}
+
+	if !findOrphans || c.lowCost {
+		return
+	}
+	if d.LOCount == 0 {
+		d.LOOrphans = 0
+		return
+	}
+
+	// get all the columns that can reference a large object
+	q := `SELECT quote_ident(N.nspname) || '.' || quote_ident(C.relname),
+			quote_ident(A.attname)
+		  FROM pg_attribute AS A
+			JOIN pg_class AS C ON A.attrelid = C.oid
+			JOIN pg_namespace AS N ON C.relnamespace = N.oid
+			JOIN pg_type AS T ON A.atttypid = T.oid
+		  WHERE A.attnum > 0 AND NOT A.attisdropped
+			AND C.relkind IN ('r', 'm')
+			AND T.typname IN ('oid', 'lo')
+			AND N.nspname NOT IN ('pg_catalog', 'information_schema')
+			AND N.nspname !~ '^pg_toast'`
+	rows, err := c.heavyDB().QueryContext(ctx, q)
+	if err != nil {
+		log.Printf("warning: large object reference query failed: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	var conds []string
+	for rows.Next() {
+		var rel, col string
+		if err := rows.Scan(&rel, &col); err != nil {
+			log.Fatalf("large object reference query failed: %v", err)
+		}
+		conds = append(conds, fmt.Sprintf(
+			"NOT EXISTS (SELECT 1 FROM %s WHERE %s = M.oid)", rel, col))
+	}
+	if err := rows.Err(); err != nil {
+		log.Fatalf("large object reference query failed: %v", err)
+	}
+
+	// no columns can refer to large objects, so all of them are orphans
+	if len(conds) == 0 {
+		d.LOOrphans = d.LOCount
+		return
+	}
+
+	if d.LOEstimated {
+		// the orphans in a sample of the large objects, scaled up
+		pct := 100 * float64(estimateLOSample) / float64(d.LOCount)
+		q = fmt.Sprintf(`SELECT COUNT(*), COUNT(*) FILTER (WHERE %s)
+			  FROM pg_largeobject_metadata AS M TABLESAMPLE SYSTEM (%g)`,
+			strings.Join(conds, " AND "), pct)
+		var sampled, orphans int64
+		if err := c.heavyDB().QueryRowContext(ctx, q).Scan(&sampled, &orphans); err != nil {
+			log.Printf("warning: orphaned large objects query failed: %v", err)
+			d.LOOrphans = -1
+		} else if sampled == 0 {
+			d.LOOrphans = -1
+		} else {
+			d.LOOrphans = int64(float64(orphans) / float64(sampled) * float64(d.LOCount))
+		}
+		return
+	}
+	q = `SELECT COUNT(*) FROM pg_largeobject_metadata AS M WHERE ` +
+		strings.Join(conds, " AND ")
+	if err := c.heavyDB().QueryRowContext(ctx, q).Scan(&d.LOOrphans); err != nil {
+		log.Printf("warning: orphaned large objects query failed: %v", err)
+		d.LOOrphans = -1
+	}
+}
+
 //------------------------------------------------------------------------------
 // PgBouncer
 
@@ -2376,7 +3916,7 @@ func (c *collector) getLogInfo() {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(tolerateErrors(context.Background()), c.timeout)
 	defer cancel()
 
 	q := `SELECT COALESCE(pg_current_logfile(),'')`
@@ -2394,25 +3934,48 @@ func fileExists(f string) bool {
 }
 
 func (c *collector) collectLogs(o CollectConfig) {
+	if logfile := c.findLogFile(o); len(logfile) > 0 {
+		//log.Printf("found log file location %s, using span %d", logfile, c.logSpan)
+		c.readLog(logfile)
+	}
+}
+
+// findLogFile returns the location of the log file, or "" after printing
+// a warning if it could not be found.
+func (c *collector) findLogFile(o CollectConfig) string {
 	// try to guess the log file location:
 	//  1. use the user-supplied filename
 	//	2. if pg_current_logfile is available, try "$PGDATA/" + that
-	//	3. /var/log/postgresql/postgresql-{MAJOR_VERSION}-main.log
+	//	3. the newest file in log_directory named like log_filename
+	//	4. /var/log/postgresql/postgresql-{MAJOR_VERSION}-main.log
 	var logfile string
+	if len(o.LogFile) == 0 && onlyEventLog(c.setting("log_destination")) {
+		log.Print("warning: log_destination is eventlog, reading the Windows Event Log is not supported")
+		return ""
+	}
 	if len(o.LogFile) > 0 {
 		if !fileExists(o.LogFile) {
 			log.Printf("warning: failed to locate/read specified log file %s", o.LogFile)
-			return
+			return ""
 		}
 		logfile = o.LogFile
 	} else {
 		if len(c.curlogfile) > 0 {
-			if f := filepath.Join(c.dataDir, c.curlogfile); fileExists(f) {
+			// relative to the data directory, unless log_directory is an
+			// absolute path (like "C:\pglogs" or "/var/log/pg")
+			f := filepath.FromSlash(c.curlogfile)
+			if !filepath.IsAbs(f) {
+				f = filepath.Join(c.dataDir, f)
+			}
+			if fileExists(f) {
 				logfile = f
 			}
 		}
-		var mv string
 		if len(logfile) == 0 {
+			logfile = c.newestLogFile()
+		}
+		var mv string
+		if len(logfile) == 0 && runtime.GOOS != "windows" {
 			if c.version >= 100000 {
 				mv = strconv.Itoa(c.version / 10000)
 			} else {
@@ -2424,12 +3987,27 @@ func (c *collector) collectLogs(o CollectConfig) {
 		}
 		if len(logfile) == 0 {
 			log.Print("warning: failed to guess log file location/access denied, specify explicitly with --log-file")
-			return
+			return ""
 		}
 	}
 
-	//log.Printf("found log file location %s, using span %d", logfile, c.logSpan)
-	c.readLog(logfile)
+	return logfile
+}
+
+// onlyEventLog returns true if the log_destination setting has eventlog as
+// the only destination.
+func onlyEventLog(dest string) bool {
+	var seen bool
+	for _, d := range strings.Split(dest, ",") {
+		switch strings.ToLower(strings.TrimSpace(d)) {
+		case "eventlog":
+			seen = true
+		case "":
+		default:
+			return false
+		}
+	}
+	return seen
 }
 
 func collectFromRDS(dbid string, result *pgmetrics.Model) {
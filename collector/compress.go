@@ -0,0 +1,91 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// logCompression returns "gzip" or "zstd" if the file is compressed, going by
+// its first bytes, as log files rotated by logrotate can be. It returns ""
+// if the file is not compressed.
+func logCompression(f *os.File) string {
+	var magic [4]byte
+	n, _ := f.ReadAt(magic[:], 0)
+	switch {
+	case bytes.HasPrefix(magic[:n], gzipMagic):
+		return "gzip"
+	case bytes.HasPrefix(magic[:n], zstdMagic):
+		return "zstd"
+	}
+	return ""
+}
+
+// readCompressedLog returns the whole decompressed content of the log file.
+// There is no zstd decoder in the standard library, so the zstd command is
+// used for that.
+func readCompressedLog(f *os.File, kind string) ([]byte, error) {
+	switch kind {
+	case "gzip":
+		r, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name(), err)
+		}
+		defer r.Close()
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name(), err)
+		}
+		return data, nil
+	case "zstd":
+		var stderr bytes.Buffer
+		cmd := exec.Command("zstd", "-dcq", "--", f.Name())
+		cmd.Stderr = &stderr
+		data, err := cmd.Output()
+		if err != nil {
+			if msg := strings.TrimSpace(stderr.String()); len(msg) > 0 {
+				err = fmt.Errorf("%v: %s", err, msg)
+			}
+			return nil, fmt.Errorf("%s: failed to decompress using the zstd command: %v", f.Name(), err)
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("%s: unknown compression %q", f.Name(), kind)
+}
+
+// trimCompressedExt removes the extension of a compressed file from the name,
+// like "postgresql.csv.gz" to "postgresql.csv".
+func trimCompressedExt(filename string) string {
+	lower := strings.ToLower(filename)
+	for _, ext := range []string{".gz", ".zst", ".zstd"} {
+		if strings.HasSuffix(lower, ext) {
+			return filename[:len(filename)-len(ext)]
+		}
+	}
+	return filename
+}
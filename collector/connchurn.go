@@ -0,0 +1,76 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collector
+
+import (
+	"strconv"
+
+	"github.com/rapidloop/pgmetrics"
+)
+
+// sessionBuckets are the upper bounds, in seconds, of the session times
+// counted in each bucket of ConnectionCounts.Histogram.
+var sessionBuckets = []float64{0.1, 1, 10, 60, 600, 3600}
+
+// connChurn returns the connection churn, creating it if needed.
+func (c *collector) connChurn() *pgmetrics.ConnectionChurn {
+	if c.result.ConnectionChurn == nil {
+		c.result.ConnectionChurn = &pgmetrics.ConnectionChurn{
+			Buckets: sessionBuckets,
+			Counts:  []pgmetrics.ConnectionCounts{},
+		}
+	}
+	return c.result.ConnectionChurn
+}
+
+// connCounts returns the counts for the database and user.
+func (c *collector) connCounts(db, user string) *pgmetrics.ConnectionCounts {
+	cc := c.connChurn()
+	for i := range cc.Counts {
+		if cc.Counts[i].Database == db && cc.Counts[i].UserName == user {
+			return &cc.Counts[i]
+		}
+	}
+	cc.Counts = append(cc.Counts, pgmetrics.ConnectionCounts{
+		Database:  db,
+		UserName:  user,
+		Histogram: make([]int, len(sessionBuckets)+1),
+	})
+	return &cc.Counts[len(cc.Counts)-1]
+}
+
+func (c *collector) processConnect(db, user string) {
+	c.connCounts(db, user).Connections++
+}
+
+// processDisconnect counts a disconnection, the submatches being the hours,
+// minutes and seconds of the session time, the user and the database.
+func (c *collector) processDisconnect(sm []string) {
+	h, _ := strconv.Atoi(sm[1])
+	m, _ := strconv.Atoi(sm[2])
+	s, _ := strconv.ParseFloat(sm[3], 64)
+	secs := float64(h*3600+m*60) + s
+
+	cc := c.connCounts(sm[5], sm[4])
+	cc.Disconnections++
+	cc.SessionTime += secs
+	i := 0
+	for i < len(sessionBuckets) && secs > sessionBuckets[i] {
+		i++
+	}
+	cc.Histogram[i]++
+}
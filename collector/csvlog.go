@@ -0,0 +1,110 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collector
+
+import (
+	"bytes"
+	"encoding/csv"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// csvlog columns, the same in all versions; later versions only add more
+// columns at the end
+const (
+	csvLogTime      = 0
+	csvUserName     = 1
+	csvDatabaseName = 2
+	csvConnFrom     = 4
+	csvSeverity     = 11
+	csvSQLState     = 12
+	csvMessage      = 13
+	csvDetail       = 14
+	csvHint         = 15
+	csvContext      = 18
+	csvQuery        = 19
+	csvMinColumns   = 20
+)
+
+// rxCSVStart matches the start of a csvlog record, which is the log time.
+var rxCSVStart = regexp.MustCompile(`(?m)^(\d{4}-\d\d-\d\d \d\d:\d\d:\d\d\.\d{3} [^,\n]+),`)
+
+// isCSVLog returns true if the log file was written with log_destination =
+// csvlog, going by its name.
+func isCSVLog(filename string) bool {
+	return strings.HasSuffix(strings.ToLower(trimCompressedExt(filename)), ".csv")
+}
+
+// parseCSVLogTime parses the log time of csvlog and jsonlog records, which
+// is like the %m escape of log_line_prefix.
+func parseCSVLogTime(s string) (time.Time, error) {
+	return time.Parse("2006-01-02 15:04:05.000 MST", s)
+}
+
+// readCSVLog reads a log file written with log_destination = csvlog.
+func (c *collector) readCSVLog(filename string) error {
+	window := time.Duration(c.logSpan) * time.Minute
+	start := time.Now().Add(-window)
+	buf, err := c.readLogTail(filename, rxCSVStart, start, parseCSVLogTime)
+	if err != nil || buf == nil {
+		return err
+	}
+	r := csv.NewReader(bytes.NewReader(buf))
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+
+	count := 0
+	for {
+		// stop at the end, or at a partially written last record
+		rec, err := r.Read()
+		if err != nil {
+			break
+		}
+		if len(rec) < csvMinColumns {
+			continue
+		}
+		t, err := parseCSVLogTime(rec[csvLogTime])
+		if err != nil || t.Before(start) {
+			continue
+		}
+		host := rec[csvConnFrom]
+		if pos := strings.LastIndexByte(host, ':'); pos > 0 { // host:port
+			host = host[:pos]
+		}
+		plen := len(rec) - 1 // the commas and the other fields
+		for i, field := range rec {
+			if i != csvMessage {
+				plen += len(field)
+			}
+		}
+		c.processLogRecord(count == 0, plen, t, rec[csvUserName], rec[csvDatabaseName],
+			host, rec[csvSeverity], rec[csvSQLState], rec[csvMessage], rec[csvDetail], rec[csvHint],
+			rec[csvContext], rec[csvQuery])
+		count++
+	}
+
+	if count > 0 {
+		c.processLogEntry()
+	}
+	return nil
+}
+
+// withTabs returns the csvlog field as it would be in a stderr log.
+func withTabs(field string) string {
+	return strings.ReplaceAll(strings.TrimSuffix(field, "\n"), "\n", "\n\t")
+}
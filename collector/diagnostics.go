@@ -0,0 +1,124 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collector
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rapidloop/pgmetrics"
+	"github.com/rapidloop/pq"
+)
+
+// maxQueryErrors is the most number of failed queries kept in the
+// diagnostics. The rest are only counted.
+const maxQueryErrors = 100
+
+// diagSettings are the settings included in the diagnostics, being the ones
+// most likely to affect whether a query works.
+var diagSettings = []string{
+	"server_version",
+	"server_version_num",
+	"search_path",
+	"shared_preload_libraries",
+	"statement_timeout",
+	"lock_timeout",
+	"default_transaction_read_only",
+	"transaction_read_only",
+	"track_activities",
+	"track_counts",
+	"track_io_timing",
+	"lc_messages",
+}
+
+// queryErrors keeps the queries that failed, across all connections.
+type queryErrors struct {
+	mu   sync.Mutex
+	list []pgmetrics.QueryError
+	more int
+}
+
+// add records that query failed with err. Errors that are not failures of
+// the query itself are ignored, as is everything if qe is nil.
+func (qe *queryErrors) add(query string, err error) {
+	if qe == nil || err == nil || err == io.EOF || err == driver.ErrSkip ||
+		err == driver.ErrBadConn {
+		return
+	}
+	e := pgmetrics.QueryError{
+		At:      time.Now().Unix(),
+		Query:   query,
+		Message: err.Error(),
+	}
+	if pe, ok := err.(*pq.Error); ok {
+		e.SQLState = string(pe.Code)
+		e.Message = pe.Message
+		e.Detail = pe.Detail
+		e.Hint = pe.Hint
+	}
+	qe.mu.Lock()
+	if len(qe.list) < maxQueryErrors {
+		qe.list = append(qe.list, e)
+	} else {
+		qe.more++
+	}
+	qe.mu.Unlock()
+}
+
+type toleratedKey struct{}
+
+// tolerateErrors returns a context for queries that are expected to fail at
+// times, like probes for the columns of a version of an extension, or reads
+// that need privileges the user might not have. Their failures are handled
+// by the collector and are not recorded in the diagnostics.
+func tolerateErrors(ctx context.Context) context.Context {
+	return context.WithValue(ctx, toleratedKey{}, true)
+}
+
+// errorsTolerated returns true if ctx is from tolerateErrors.
+func errorsTolerated(ctx context.Context) bool {
+	t, _ := ctx.Value(toleratedKey{}).(bool)
+	return t
+}
+
+// fillDiagnostics adds the queries that failed, if any, to the result, along
+// with the settings relevant to them.
+func (c *collector) fillDiagnostics() {
+	qe := c.qerrs
+	if qe == nil {
+		return
+	}
+	qe.mu.Lock()
+	defer qe.mu.Unlock()
+	if len(qe.list) == 0 && qe.more == 0 {
+		return
+	}
+	d := &pgmetrics.Diagnostics{
+		Settings:   make(map[string]string),
+		Errors:     qe.list,
+		MoreErrors: qe.more,
+	}
+	for _, name := range diagSettings {
+		if s, ok := c.result.Settings[name]; ok {
+			d.Settings[name] = s.Setting
+		}
+	}
+	c.result.Diagnostics = d
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collector
+
+import (
+	"context"
+	"log"
+)
+
+// Beyond these, estimates are collected instead of exact values, so that the
+// time taken stays bounded on clusters with very many relations or large
+// objects.
+const (
+	estimateMinRelations = 10000  // tables or indexes in a database, to estimate their sizes
+	estimateMinLOs       = 100000 // large objects in a database, to estimate their counts
+	estimateLOSample     = 10000  // large objects to sample, roughly
+)
+
+// getSizeEstimates returns the estimated sizes of the tables, materialized
+// views and indexes of the current database, from the page counts in
+// pg_class (which are updated by vacuum and analyze), in a single query
+// instead of one for each relation. The size of a table includes that of its
+// toast table.
+func (c *collector) getSizeEstimates() map[int]int64 {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	q := `SELECT C.oid,
+			(C.relpages::bigint + COALESCE(T.relpages, 0)) *
+				current_setting('block_size')::bigint
+		  FROM pg_class AS C
+			LEFT JOIN pg_class AS T ON T.oid = C.reltoastrelid
+		  WHERE C.relkind IN ('r', 'm', 'p', 'i', 'I')`
+	rows, err := c.db.QueryContext(ctx, q)
+	if err != nil {
+		log.Printf("warning: relation size estimate query failed: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	sizes := make(map[int]int64)
+	for rows.Next() {
+		var oid int
+		var size int64
+		if err := rows.Scan(&oid, &size); err != nil {
+			log.Fatalf("relation size estimate query failed: %v", err)
+		}
+		sizes[oid] = size
+	}
+	if err := rows.Err(); err != nil {
+		log.Fatalf("relation size estimate query failed: %v", err)
+	}
+	return sizes
+}
+
+// getLOCountEstimate returns the number of large objects in the current
+// database as estimated by the planner, or -1 if not known.
+func (c *collector) getLOCountEstimate() int64 {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	// reltuples is -1 if never vacuumed or analyzed in v14+, and 0 before
+	q := `SELECT reltuples::bigint FROM pg_class
+		  WHERE oid = 'pg_catalog.pg_largeobject_metadata'::regclass`
+	var n int64
+	if err := c.heavyDB().QueryRowContext(ctx, q).Scan(&n); err != nil || n <= 0 {
+		return -1
+	}
+	return n
+}
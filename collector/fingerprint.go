@@ -0,0 +1,106 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collector
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strings"
+
+	"github.com/rapidloop/pgmetrics"
+)
+
+// getSchemaFingerprints computes a hash of the definition of each table,
+// view, materialized view and function in the current database. Tables are
+// defined by their columns, constraints and indexes. Objects that belong to
+// extensions are not included.
+func (c *collector) getSchemaFingerprints(currdb string) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	q := `WITH objs AS (
+			SELECT 'table' AS kind, n.nspname, c.relname AS name,
+				'pg_class'::regclass AS classid, c.oid AS oid,
+				COALESCE((SELECT string_agg(a.attname || ' ' ||
+					format_type(a.atttypid, a.atttypmod) ||
+					CASE WHEN a.attnotnull THEN ' NOT NULL' ELSE '' END ||
+					COALESCE(' DEFAULT ' || pg_get_expr(d.adbin, d.adrelid), ''),
+					', ' ORDER BY a.attnum)
+				  FROM pg_attribute a
+				  LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+				  WHERE a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped), '') ||
+				COALESCE((SELECT '; ' || string_agg(co.conname || ' ' ||
+					pg_get_constraintdef(co.oid), '; ' ORDER BY co.conname)
+				  FROM pg_constraint co WHERE co.conrelid = c.oid), '') ||
+				COALESCE((SELECT '; ' || string_agg(pg_get_indexdef(i.indexrelid),
+					'; ' ORDER BY pg_get_indexdef(i.indexrelid))
+				  FROM pg_index i WHERE i.indrelid = c.oid), '') AS def
+			  FROM pg_class c JOIN pg_namespace n ON c.relnamespace = n.oid
+			  WHERE c.relkind IN ('r', 'p') AND @user@
+			UNION ALL
+			SELECT CASE c.relkind WHEN 'v' THEN 'view' ELSE 'materialized view' END,
+				n.nspname, c.relname, 'pg_class'::regclass, c.oid, pg_get_viewdef(c.oid)
+			  FROM pg_class c JOIN pg_namespace n ON c.relnamespace = n.oid
+			  WHERE c.relkind IN ('v', 'm') AND @user@
+			UNION ALL
+			SELECT 'function', n.nspname,
+				p.proname || '(' || pg_get_function_identity_arguments(p.oid) || ')',
+				'pg_proc'::regclass, p.oid, pg_get_functiondef(p.oid)
+			  FROM pg_proc p JOIN pg_namespace n ON p.pronamespace = n.oid
+			  WHERE @notagg@ AND @user@
+		  )
+		  SELECT kind, nspname, name, COALESCE(def, '')
+		  FROM objs
+		  WHERE NOT EXISTS (SELECT 1 FROM pg_depend
+				WHERE classid = objs.classid AND objid = objs.oid AND deptype = 'e')
+		  ORDER BY kind, nspname, name`
+	q = strings.Replace(q, "@user@",
+		"n.nspname NOT IN ('pg_catalog', 'information_schema')", -1)
+	if c.version >= 110000 {
+		q = strings.Replace(q, "@notagg@", "p.prokind IN ('f', 'p')", 1)
+	} else {
+		q = strings.Replace(q, "@notagg@", "NOT p.proisagg", 1)
+	}
+	rows, err := c.heavyDB().QueryContext(ctx, q)
+	if err != nil {
+		log.Printf("warning: schema fingerprints query failed: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var f pgmetrics.SchemaFingerprint
+		var def string
+		if err := rows.Scan(&f.Kind, &f.SchemaName, &f.Name, &def); err != nil {
+			log.Fatalf("schema fingerprints query failed: %v", err)
+		}
+		if f.Kind == "function" && !c.schemaOK(f.SchemaName) {
+			continue
+		} else if f.Kind != "function" && !c.tableOK(f.SchemaName, f.Name) {
+			continue
+		}
+		sum := sha256.Sum256([]byte(def))
+		f.DBName = currdb
+		f.Hash = hex.EncodeToString(sum[:])
+		c.result.SchemaFingerprints = append(c.result.SchemaFingerprints, f)
+	}
+	if err := rows.Err(); err != nil {
+		log.Fatalf("schema fingerprints query failed: %v", err)
+	}
+}
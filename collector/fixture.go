@@ -0,0 +1,360 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collector
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rapidloop/pq"
+)
+
+// A fixture is a recording of the results of all the queries made during a
+// collection. A collection can be replayed from a fixture instead of a live
+// server, yielding the same output each time. This lets dashboards and other
+// consumers of pgmetrics output be tested against canned data from each
+// supported version of Postgres.
+//
+// Queries are matched by their text and arguments. The same query can be
+// made more than once (for example, once per database), so the results for
+// each are replayed in the order they were recorded.
+type fixture struct {
+	Version int             `json:"fixture_version"`
+	At      int64           `json:"at"` // when the recording was started
+	Queries []*fixtureQuery `json:"queries"`
+
+	mu     sync.Mutex
+	replay bool
+	queue  map[string][]*fixtureQuery
+}
+
+type fixtureQuery struct {
+	Query   string          `json:"query"`
+	Args    []string        `json:"args,omitempty"`
+	Error   string          `json:"error,omitempty"`
+	Columns []string        `json:"columns,omitempty"`
+	Rows    [][]interface{} `json:"rows,omitempty"`
+}
+
+const fixtureVersion = 1
+
+func newFixtureRecorder() *fixture {
+	return &fixture{
+		Version: fixtureVersion,
+		At:      time.Now().Unix(),
+	}
+}
+
+func loadFixture(file string) (*fixture, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var f fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	if f.Version != fixtureVersion {
+		return nil, fmt.Errorf("%s: unsupported fixture version %d", file, f.Version)
+	}
+	f.replay = true
+	f.queue = make(map[string][]*fixtureQuery)
+	for _, q := range f.Queries {
+		k := fixtureKey(q.Query, q.Args)
+		f.queue[k] = append(f.queue[k], q)
+	}
+	return &f, nil
+}
+
+func (f *fixture) save(file string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(data, '\n'), 0644)
+}
+
+func fixtureKey(query string, args []string) string {
+	return query + "\x00" + strings.Join(args, "\x00")
+}
+
+func fixtureArgs(args []driver.NamedValue) (out []string) {
+	for _, a := range args {
+		out = append(out, encodeFixtureValue(a.Value).(string))
+	}
+	return
+}
+
+// Values are stored as strings with a one-letter type prefix, so that they
+// are handed back to database/sql with the same type the driver returned.
+func encodeFixtureValue(v driver.Value) interface{} {
+	switch x := v.(type) {
+	case nil:
+		return nil
+	case int64:
+		return "i:" + strconv.FormatInt(x, 10)
+	case float64:
+		return "f:" + strconv.FormatFloat(x, 'g', -1, 64)
+	case bool:
+		return "b:" + strconv.FormatBool(x)
+	case string:
+		return "s:" + x
+	case []byte:
+		if utf8.Valid(x) {
+			return "y:" + string(x)
+		}
+		return "z:" + base64.StdEncoding.EncodeToString(x)
+	case time.Time:
+		return "t:" + x.Format(time.RFC3339Nano)
+	}
+	return "s:" + fmt.Sprint(v)
+}
+
+func decodeFixtureValue(v interface{}) (driver.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	s, ok := v.(string)
+	if !ok || len(s) < 2 || s[1] != ':' {
+		return nil, fmt.Errorf("fixture: bad value %v", v)
+	}
+	switch val := s[2:]; s[0] {
+	case 'i':
+		return strconv.ParseInt(val, 10, 64)
+	case 'f':
+		return strconv.ParseFloat(val, 64)
+	case 'b':
+		return strconv.ParseBool(val)
+	case 's':
+		return val, nil
+	case 'y':
+		return []byte(val), nil
+	case 'z':
+		return base64.StdEncoding.DecodeString(val)
+	case 't':
+		return time.Parse(time.RFC3339Nano, val)
+	}
+	return nil, fmt.Errorf("fixture: bad value %q", s)
+}
+
+// next returns the next recorded result for the query.
+func (f *fixture) next(query string, args []driver.NamedValue) (*fixtureQuery, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	k := fixtureKey(query, fixtureArgs(args))
+	q := f.queue[k]
+	if len(q) == 0 {
+		return nil, fmt.Errorf("fixture: no recorded result for query: %s",
+			strings.Join(strings.Fields(query), " "))
+	}
+	f.queue[k] = q[1:]
+	return q[0], nil
+}
+
+func (f *fixture) add(q *fixtureQuery) {
+	f.mu.Lock()
+	f.Queries = append(f.Queries, q)
+	f.mu.Unlock()
+}
+
+// connector returns a driver.Connector that either replays from the fixture,
+// or connects to the server using connstr and records into the fixture.
+func (f *fixture) connector(connstr string) (driver.Connector, error) {
+	if f.replay {
+		return &fixtureConnector{f: f}, nil
+	}
+	inner, err := pq.NewConnector(connstr)
+	if err != nil {
+		return nil, err
+	}
+	return &fixtureConnector{f: f, inner: inner}, nil
+}
+
+type fixtureConnector struct {
+	f     *fixture
+	inner driver.Connector // nil when replaying
+}
+
+func (fc *fixtureConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	if fc.inner == nil {
+		return &fixtureConn{f: fc.f}, nil
+	}
+	cn, err := fc.inner.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &fixtureConn{f: fc.f, inner: cn}, nil
+}
+
+func (fc *fixtureConnector) Driver() driver.Driver {
+	if fc.inner == nil {
+		return fixtureDriver{}
+	}
+	return fc.inner.Driver()
+}
+
+// fixtureDriver is only used via fixtureConnector, and cannot open
+// connections by name.
+type fixtureDriver struct{}
+
+func (fixtureDriver) Open(name string) (driver.Conn, error) {
+	return nil, errors.New("fixture: cannot open connections by name")
+}
+
+type fixtureConn struct {
+	f     *fixture
+	inner driver.Conn // nil when replaying
+}
+
+var errFixturePrepare = errors.New("fixture: prepared statements are not supported")
+
+func (fc *fixtureConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errFixturePrepare
+}
+
+func (fc *fixtureConn) Close() error {
+	if fc.inner == nil {
+		return nil
+	}
+	return fc.inner.Close()
+}
+
+func (fc *fixtureConn) Begin() (driver.Tx, error) {
+	return fc.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (fc *fixtureConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if fc.inner == nil {
+		return fixtureTx{}, nil
+	}
+	return fc.inner.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+func (fc *fixtureConn) Ping(ctx context.Context) error {
+	if fc.inner == nil {
+		return nil
+	}
+	if p, ok := fc.inner.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// Statements like SET ROLE are not recorded, only their success matters.
+func (fc *fixtureConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if fc.inner == nil {
+		return driver.RowsAffected(0), nil
+	}
+	return fc.inner.(driver.ExecerContext).ExecContext(ctx, query, args)
+}
+
+func (fc *fixtureConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if fc.inner == nil {
+		q, err := fc.f.next(query, args)
+		if err != nil {
+			return nil, err
+		}
+		if len(q.Error) > 0 {
+			return nil, errors.New(q.Error)
+		}
+		return &fixtureRows{q: q}, nil
+	}
+
+	// record
+	q := &fixtureQuery{Query: query, Args: fixtureArgs(args)}
+	rows, err := fc.inner.(driver.QueryerContext).QueryContext(ctx, query, args)
+	if err == nil {
+		err = q.fill(rows)
+		rows.Close()
+	}
+	if err != nil {
+		q.Error = err.Error()
+		q.Columns, q.Rows = nil, nil
+		fc.f.add(q)
+		return nil, err
+	}
+	fc.f.add(q)
+	return &fixtureRows{q: q}, nil
+}
+
+// fill reads all the rows into q.
+func (q *fixtureQuery) fill(rows driver.Rows) error {
+	q.Columns = rows.Columns()
+	dest := make([]driver.Value, len(q.Columns))
+	for {
+		if err := rows.Next(dest); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		row := make([]interface{}, len(dest))
+		for i, v := range dest {
+			row[i] = encodeFixtureValue(v)
+		}
+		q.Rows = append(q.Rows, row)
+	}
+}
+
+type fixtureRows struct {
+	q   *fixtureQuery
+	pos int
+}
+
+func (r *fixtureRows) Columns() []string {
+	return r.q.Columns
+}
+
+func (r *fixtureRows) Close() error {
+	return nil
+}
+
+func (r *fixtureRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.q.Rows) {
+		return io.EOF
+	}
+	row := r.q.Rows[r.pos]
+	r.pos++
+	if len(row) != len(dest) {
+		return fmt.Errorf("fixture: row has %d values, expected %d", len(row), len(dest))
+	}
+	for i := range row {
+		v, err := decodeFixtureValue(row[i])
+		if err != nil {
+			return err
+		}
+		dest[i] = v
+	}
+	return nil
+}
+
+type fixtureTx struct{}
+
+func (fixtureTx) Commit() error   { return nil }
+func (fixtureTx) Rollback() error { return nil }
@@ -0,0 +1,210 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// followInterval is how often the log file is checked for new lines.
+const followInterval = time.Second
+
+// FollowLog reads the lines written to the log file from now on, until done
+// is closed, and notifies o.LogHandler of the events in them as they appear.
+// The server is connected to only at the start, to get the settings needed
+// to read and locate the log file (given by o.LogFile, or found like Collect
+// does). The log file is followed across rotations, whether done by Postgres
+// (a new file is started) or by logrotate (the file is renamed or truncated).
+//
+// Only log files written with log_destination = stderr can be followed. Like
+// Collect, it does a log.Fatal() if the server cannot be connected to.
+func FollowLog(o CollectConfig, dbnames []string, done <-chan struct{}) error {
+	if o.LogHandler == nil {
+		return errors.New("no log event handler was specified")
+	}
+	if len(o.LogWrapField) > 0 {
+		return errors.New("wrapped log lines cannot be followed")
+	}
+
+	// get the settings needed
+	c := &collector{}
+	connstr := connString(o, dbnames)
+	if len(dbnames) > 0 {
+		connstr += makeKV("dbname", dbnames[0])
+	}
+	c.db = c.openDB(connstr, o)
+	c.timeout = time.Duration(o.TimeoutSec) * time.Second
+	c.getSettings()
+	if v, err := strconv.Atoi(c.setting("server_version_num")); err != nil {
+		log.Fatalf("bad server_version_num: %v", err)
+	} else {
+		c.version = v
+	}
+	c.getLocal()
+	if c.local {
+		c.dataDir = c.setting("data_directory")
+		if len(c.dataDir) == 0 {
+			c.dataDir = os.Getenv("PGDATA")
+		}
+		c.getLogInfo()
+	}
+	c.db.Close()
+	c.db = nil
+	c.sqlLength = o.SQLLength
+	c.logHandler = o.LogHandler
+
+	if !c.local && len(o.LogFile) == 0 {
+		return errors.New("server is not local, specify the log file with --log-file")
+	}
+	filename := c.findLogFile(o)
+	if len(filename) == 0 {
+		return errors.New("no log file to follow")
+	}
+	if isCSVLog(filename) || c.isJSONLog(filename) {
+		return fmt.Errorf("%s: only stderr log files can be followed", filename)
+	}
+	prefix, err := compilePrefix(c.setting("log_line_prefix"))
+	if err != nil {
+		return err
+	}
+	return c.follow(filename, prefix, done)
+}
+
+// follow processes the lines written to the stderr log file from now on,
+// until done is closed.
+func (c *collector) follow(filename string, prefix *regexp.Regexp, done <-chan struct{}) error {
+	// start at the end
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer func() { f.Close() }()
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+
+	// buf has the lines read that the next lines may add to, which are
+	// from the start of the last prefixed line. pending is true if the entry
+	// of the lines already processed has not been processed yet.
+	var buf []byte
+	var pending bool
+	flush := func() {
+		if c.parseLogBuf(buf, prefix, time.Time{}, !pending) > 0 || pending {
+			c.processLogEntry()
+		}
+		buf, pending = nil, false
+		c.clearLogResults()
+	}
+
+	ticker := time.NewTicker(followInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			flush()
+			return nil
+		case <-ticker.C:
+		}
+
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		if len(data) > 0 {
+			buf = append(buf, data...)
+			locs := prefix.FindAllIndex(buf, -1)
+			if n := len(locs); n > 0 && locs[n-1][0] > 0 {
+				cut := locs[n-1][0]
+				if c.parseLogBuf(buf[:cut], prefix, time.Time{}, !pending) > 0 {
+					pending = true
+				}
+				buf = append([]byte(nil), buf[cut:]...)
+			}
+			continue
+		}
+		// nothing was written since the last check, what we have is complete
+		if len(buf) > 0 || pending {
+			flush()
+		}
+
+		// the file might have been rotated
+		next, rewind := c.rotatedTo(f, filename)
+		if len(next) > 0 {
+			flush()
+			nf, err := os.Open(next)
+			if err != nil {
+				return err
+			}
+			f.Close()
+			f, filename = nf, next
+		} else if rewind {
+			flush()
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// rotatedTo checks if the log file f, opened from filename and read till the
+// end, has been rotated. It returns the name of the file that is being
+// written to now, if it is not f, or rewind = true if f has been truncated.
+func (c *collector) rotatedTo(f *os.File, filename string) (next string, rewind bool) {
+	fi, err := f.Stat()
+	if err != nil {
+		return
+	}
+	// Postgres starts a new file, named by log_filename
+	if newest := c.newestLogFile(); len(newest) > 0 && newest != filename {
+		if nfi, err := os.Stat(newest); err == nil && nfi.ModTime().After(fi.ModTime()) {
+			return newest, false
+		}
+	}
+	// logrotate renames the file and creates a new one, or truncates it
+	nfi, err := os.Stat(filename)
+	if err != nil {
+		return // renamed, but the new one has not been created yet
+	}
+	if !os.SameFile(fi, nfi) {
+		return filename, false
+	}
+	if pos, err := f.Seek(0, io.SeekCurrent); err == nil && nfi.Size() < pos {
+		return "", true
+	}
+	return
+}
+
+// clearLogResults drops the information collected from the log lines read
+// so far, which is not needed when only the log handler is of interest.
+func (c *collector) clearLogResults() {
+	r := &c.result
+	r.Plans, r.AutoVacuums, r.Deadlocks = nil, nil, nil
+	r.LogHours, r.ArchiveFailures, r.ArchivedWALs = nil, nil, nil
+	r.DDLEvents, r.FailedLogins, r.LogVolume = nil, nil, nil
+	r.Checkpoints, r.LockWaits, r.TempFileEvents = nil, nil, nil
+	r.ConnectionChurn, r.LogErrorSummary = nil, nil
+	c.logMsgs, c.logMsgIndex, c.loggedErrors = nil, nil, nil
+	c.logErrIndex = nil
+}
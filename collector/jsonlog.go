@@ -0,0 +1,84 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// jsonLogRecord is a line of a log file written with log_destination =
+// jsonlog (v15+). Fields that are empty are left out by the server.
+type jsonLogRecord struct {
+	Timestamp  string `json:"timestamp"`
+	User       string `json:"user"`
+	DBName     string `json:"dbname"`
+	RemoteHost string `json:"remote_host"`
+	Severity   string `json:"error_severity"`
+	StateCode  string `json:"state_code"`
+	Message    string `json:"message"`
+	Detail     string `json:"detail"`
+	Hint       string `json:"hint"`
+	Context    string `json:"context"`
+	Statement  string `json:"statement"`
+}
+
+// rxJSONStart matches the start of a jsonlog record, which is the log time.
+var rxJSONStart = regexp.MustCompile(`(?m)^\{"timestamp":"(\d{4}-\d\d-\d\d \d\d:\d\d:\d\d\.\d{3} [^"]+)"`)
+
+// isJSONLog returns true if the log file was written with log_destination =
+// jsonlog, going by its name. Log files re-emitted by log shippers as JSON
+// (--log-wrapped) are not jsonlog files.
+func (c *collector) isJSONLog(filename string) bool {
+	return len(c.logWrapField) == 0 && strings.HasSuffix(strings.ToLower(trimCompressedExt(filename)), ".json")
+}
+
+// readJSONLog reads a log file written with log_destination = jsonlog, one
+// JSON object per line.
+func (c *collector) readJSONLog(filename string) error {
+	window := time.Duration(c.logSpan) * time.Minute
+	start := time.Now().Add(-window)
+	buf, err := c.readLogTail(filename, rxJSONStart, start, parseCSVLogTime)
+	if err != nil || buf == nil {
+		return err
+	}
+
+	count := 0
+	for _, line := range bytes.Split(buf, []byte("\n")) {
+		// skip partially written last lines
+		var rec jsonLogRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			continue
+		}
+		t, err := parseCSVLogTime(rec.Timestamp)
+		if err != nil || t.Before(start) {
+			continue
+		}
+		c.processLogRecord(count == 0, len(line)-len(rec.Message), t, rec.User,
+			rec.DBName, rec.RemoteHost, rec.Severity, rec.StateCode, rec.Message, rec.Detail,
+			rec.Hint, rec.Context, rec.Statement)
+		count++
+	}
+
+	if count > 0 {
+		c.processLogEntry()
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,36 +14,75 @@ import (
 	"time"
 
 	"github.com/rapidloop/pgmetrics"
+	"github.com/rapidloop/pq"
 )
 
 var (
-	rxLogLevel  = regexp.MustCompile(`^([A-Z]+):\s+`)
-	rxAEStart   = regexp.MustCompile(`^duration: [0-9]+\.[0-9]+ ms  plan:\n[ \t]+({[ \t]*\n)?(<explain xml.*\n)?(Query Text: ".*"\n)?(Query Text: [^"].*\n)?`)
-	rxAESwitch1 = regexp.MustCompile(`^\s+Query Text: (.*)$`)
-	rxAESwitch2 = regexp.MustCompile(`cost=\d+.*rows=\d`)
-	rxAVStart   = regexp.MustCompile(`automatic (aggressive )?vacuum (to prevent wraparound )?of table "([^"]+)": index`)
-	rxAVElapsed = regexp.MustCompile(`, elapsed: ([0-9.]+) s`)
+	rxLogLevel   = regexp.MustCompile(`^([A-Z]+):\s+`)
+	rxAEStart    = regexp.MustCompile(`^duration: [0-9]+\.[0-9]+ ms  plan:\n[ \t]+({[ \t]*\n)?(<explain xml.*\n)?(Query Text: ".*"\n)?(Query Text: [^"].*\n)?`)
+	rxAESwitch1  = regexp.MustCompile(`^\s+Query Text: (.*)$`)
+	rxAESwitch2  = regexp.MustCompile(`cost=\d+.*rows=\d`)
+	rxAVStart    = regexp.MustCompile(`automatic (aggressive )?vacuum (to prevent wraparound )?of table "([^"]+)": index`)
+	rxAVElapsed  = regexp.MustCompile(`, elapsed: ([0-9.]+) s`)
+	rxAVPages    = regexp.MustCompile(`pages: (\d+) removed, (\d+) remain`)
+	rxAVTuples   = regexp.MustCompile(`tuples: (\d+) removed, (\d+) remain, (\d+) are dead but not yet removable`)
+	rxAVBuffers  = regexp.MustCompile(`buffer usage: (\d+) hits, (\d+) (?:misses|reads), (\d+) dirtied`)
+	rxAVWAL      = regexp.MustCompile(`WAL usage: (\d+) records, (\d+) full page images, (\d+) bytes`)
+	rxAVIOTime   = regexp.MustCompile(`I/O timings: read: ([0-9.]+) ms, write: ([0-9.]+) ms`)
+	rxArchFail   = regexp.MustCompile(`^archive command (failed with exit code \d+|was terminated by .*)$`)
+	rxArchGiveUp = regexp.MustCompile(`^archiving (?:write-ahead|transaction) log file "([^"]+)" failed too many times`)
+	rxArchCmd    = regexp.MustCompile(`^The failed archive command was: (.*)$`)
+	rxArchived   = regexp.MustCompile(`^archived (?:write-ahead|transaction) log file "([^"]+)"$`)
+	rxRestored   = regexp.MustCompile(`^restored log file "([^"]+)" from archive$`)
+	rxRefreshMV  = regexp.MustCompile(`(?i)^(?:duration: [0-9.]+ ms  )?statement: refresh\s+materialized\s+view\s+(?:concurrently\s+)?([^\s;]+)`)
+	rxDDL        = regexp.MustCompile(`(?is)^(?:duration: [0-9.]+ ms  )?statement: \s*((create|alter|drop|comment|grant|revoke|security\s+label)\b.*)`)
+	rxDDLObject  = regexp.MustCompile(`(?i)^(?:(?:or\s+replace|temp|temporary|unlogged|unique|global|local|recursive|trusted|procedural)\s+)*((?:materialized|foreign|event|constraint|default|text\s+search|access|operator|user)\s+\w+|\w+)`)
+	rxDuration   = regexp.MustCompile(`^duration: [0-9]+\.[0-9]+ ms  (?:statement|execute|parse|bind)`)
+	rxAuthFail   = regexp.MustCompile(`^(\S+) authentication failed for user "([^"]*)"`)
+	rxNoHBA      = regexp.MustCompile(`^no pg_hba\.conf entry for (?:replication connection from )?host "([^"]*)", user "([^"]*)"(?:, database "([^"]*)")?`)
+	rxCkptStart  = regexp.MustCompile(`^(checkpoint|restartpoint) starting: ?(.*)$`)
+	rxCkptDone   = regexp.MustCompile(`^(checkpoint|restartpoint) complete: wrote (\d+) buffers \(([0-9.]+)%\)[^;]*; (\d+) (?:WAL|transaction log) file\(s\) added, (\d+) removed, (\d+) recycled; write=([0-9.]+) s, sync=([0-9.]+) s, total=([0-9.]+) s(?:; sync files=(\d+), longest=([0-9.]+) s)?(?:, average=[0-9.]+ s)?(?:; distance=(\d+) kB)?`)
+	rxLockWait   = regexp.MustCompile(`^process (\d+) (still waiting for|acquired) (\S+) on (.+) after ([0-9.]+) ms`)
+	rxLockRel    = regexp.MustCompile(`relation (\d+) of database (\d+)`)
+	rxLockHolder = regexp.MustCompile(`holding the lock: ([0-9, ]+)\.`)
+	rxTempFile   = regexp.MustCompile(`^temporary file: path "([^"]+)", size (\d+)`)
+	rxTempPID    = regexp.MustCompile(`pgsql_tmp(\d+)\.`)
+	rxConnRecv   = regexp.MustCompile(`^connection received: host=`)
+	rxConnAuth   = regexp.MustCompile(`^(?:replication )?connection authorized: user=(\S+)(?: database=(\S+))?`)
+	rxDisconn    = regexp.MustCompile(`^disconnection: session time: (\d+):(\d+):([0-9.]+) user=(\S*) database=(\S*)`)
+	rxWALFile    = regexp.MustCompile(`[0-9A-F]{24}(?:\.partial|\.[0-9A-F]{8}\.backup)?|[0-9A-F]{8}\.history`)
 )
 
+// readLog reads the log file, and the files rotated out before it that have
+// entries within the log span, oldest first.
 func (c *collector) readLog(filename string) {
-	var prefix string
-	if s, ok := c.result.Settings["log_line_prefix"]; ok {
-		prefix = s.Setting
-	} else {
-		log.Print("failed to get log_line_prefix setting, cannot read log file")
-		return
-	}
-
-	prefixRE, err := compilePrefix(prefix)
-	if err != nil {
-		log.Print(err)
-		return
-	}
-
-	if err := c.readLogLines(filename, prefixRE); err != nil {
-		log.Print(err)
-		return
+	var prefixRE *regexp.Regexp
+	for _, f := range append(c.rotatedLogs(filename), filename) {
+		var err error
+		switch {
+		case isCSVLog(f):
+			err = c.readCSVLog(f)
+		case c.isJSONLog(f):
+			err = c.readJSONLog(f)
+		default:
+			if prefixRE == nil {
+				s, ok := c.result.Settings["log_line_prefix"]
+				if !ok {
+					log.Print("failed to get log_line_prefix setting, cannot read log file")
+					return
+				}
+				if prefixRE, err = compilePrefix(s.Setting); err != nil {
+					log.Print(err)
+					return
+				}
+			}
+			err = c.readLogLines(f, prefixRE)
+		}
+		if err != nil {
+			log.Print(err)
+		}
 	}
+	c.finishLogVolume()
 }
 
 func (c *collector) readLogLines(filename string, prefix *regexp.Regexp) error {
@@ -56,6 +96,15 @@ func (c *collector) readLogLines(filename string, prefix *regexp.Regexp) error {
 	window := time.Duration(c.logSpan) * time.Minute
 	start := time.Now().Add(-window)
 
+	// compressed files are read whole
+	if kind := logCompression(f); len(kind) > 0 {
+		data, err := readCompressedLog(f, kind)
+		if err != nil {
+			return err
+		}
+		return c.processLogBuf(data, prefix, start)
+	}
+
 	// get current length of file
 	flen, err := f.Seek(0, 2)
 	if err != nil {
@@ -79,11 +128,19 @@ func (c *collector) readLogLines(filename string, prefix *regexp.Regexp) error {
 		}
 		//log.Printf("debug: seeked to %d", ofs)
 
-		// read the last 4k of the file
-		if _, err := io.ReadFull(f, buf); err != nil {
+		// read the last 4k of the file, or all of it if smaller
+		n := len(buf)
+		if flen-ofs < int64(n) {
+			n = int(flen - ofs)
+		}
+		if _, err := io.ReadFull(f, buf[:n]); err != nil {
 			return err
 		}
-		ts, err := firstTS(buf, prefix)
+		block := buf[:n]
+		if len(c.logWrapField) > 0 {
+			block = unwrapLogLines(block, c.logWrapField)
+		}
+		ts, err := firstTS(block, prefix)
 		if err != nil {
 			return err
 		}
@@ -112,17 +169,40 @@ func (c *collector) readLogLines(filename string, prefix *regexp.Regexp) error {
 	if _, err := io.ReadFull(f, bigbuf); err != nil {
 		return err
 	}
+	return c.processLogBuf(bigbuf, prefix, start)
+}
+
+// processLogBuf processes the log lines in bigbuf that are at or after
+// start. The first line in bigbuf can be partial.
+func (c *collector) processLogBuf(bigbuf []byte, prefix *regexp.Regexp, start time.Time) error {
+	if c.parseLogBuf(bigbuf, prefix, start, true) > 0 {
+		c.processLogEntry()
+	}
+	return nil
+}
+
+// parseLogBuf processes the log lines in bigbuf that are at or after start,
+// and returns the number of lines processed. The last entry is not processed,
+// as it may continue after bigbuf. If first is false, the lines continue an
+// entry that has not been processed yet.
+func (c *collector) parseLogBuf(bigbuf []byte, prefix *regexp.Regexp, start time.Time, first bool) int {
+	// logs written on Windows have CRLF line endings
+	bigbuf = bytes.ReplaceAll(bigbuf, []byte("\r\n"), []byte("\n"))
+	if len(c.logWrapField) > 0 {
+		bigbuf = unwrapLogLines(bigbuf, c.logWrapField)
+	}
 
 	count := 0
 	pos := prefix.FindIndex(bigbuf)
 	for len(pos) == 2 && len(bigbuf) > 0 {
 		// match again for submatches, can't do this in one go :-(
 		match := prefix.FindSubmatch(bigbuf[pos[0]:])
-		t, user, db, err := getMatchData(match, prefix)
+		t, user, db, host, state, err := getMatchData(match, prefix)
 		if err != nil {
-			return nil
+			break
 		}
 		var line string
+		plen := pos[1] - pos[0]
 		// seek to start of next line
 		pos2 := prefix.FindIndex(bigbuf[pos[1]:])
 		if pos2 == nil {
@@ -138,21 +218,133 @@ func (c *collector) readLogLines(filename string, prefix *regexp.Regexp) error {
 			if n := len(line); n > 0 && line[n-1] == '\n' {
 				line = line[0 : n-1]
 			}
+			c.countLogLine(plen, line)
 			// extract the level
 			var level string
 			if match := rxLogLevel.FindStringSubmatch(line); len(match) > 0 {
 				level = match[1]
 				line = line[len(match[0]):]
 			}
-			c.processLogLine(count == 0, t, user, db, level, line)
+			c.processLogLine(first && count == 0, t, user, db, host, level, state, line)
 			count++
 		}
 	}
+	return count
+}
 
-	if count > 0 {
-		c.processLogEntry()
+// unwrapLogLines extracts the original log lines from log lines that have
+// been re-emitted by log shippers as JSON objects, one per line, with the
+// original line as the value of a string field. The field can be nested,
+// like "log.message". Lines that are not such JSON objects (including the
+// partial lines at the start and end of buf) are dropped.
+func unwrapLogLines(buf []byte, field string) []byte {
+	path := strings.Split(field, ".")
+	var out bytes.Buffer
+	for _, line := range bytes.Split(buf, []byte("\n")) {
+		var obj interface{}
+		if err := json.Unmarshal(line, &obj); err != nil {
+			continue
+		}
+		for _, key := range path {
+			m, ok := obj.(map[string]interface{})
+			if !ok {
+				obj = nil
+				break
+			}
+			obj = m[key]
+		}
+		if msg, ok := obj.(string); ok {
+			out.WriteString(strings.TrimSuffix(msg, "\n"))
+			out.WriteByte('\n')
+		}
+	}
+	return out.Bytes()
+}
+
+// readLogTail returns the end of the log file, from the start of the first
+// record (as matched by rxStart, with the time as the first submatch) that
+// is at or before start.
+func (c *collector) readLogTail(filename string, rxStart *regexp.Regexp, start time.Time,
+	parseTime func(string) (time.Time, error)) ([]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// compressed files are read whole
+	if kind := logCompression(f); len(kind) > 0 {
+		data, err := readCompressedLog(f, kind)
+		if err != nil {
+			return nil, err
+		}
+		if pos := rxStart.FindIndex(data); pos != nil {
+			return data[pos[0]:], nil
+		}
+		return nil, nil
+	}
+
+	flen, err := f.Seek(0, 2)
+	if err != nil {
+		return nil, err
+	}
+	if flen <= 0 {
+		return nil, nil // empty file, nothing to do
+	}
+
+	// go back 4k at a time until we find a record from before the span
+	buf := make([]byte, 4096)
+	ofs := flen
+	for ofs > 0 {
+		ofs -= int64(len(buf))
+		if ofs < 0 {
+			ofs = 0
+		}
+		n := len(buf)
+		if flen-ofs < int64(n) {
+			n = int(flen - ofs)
+		}
+		if _, err := f.ReadAt(buf[:n], ofs); err != nil {
+			return nil, err
+		}
+		if sm := rxStart.FindSubmatch(buf[:n]); sm != nil {
+			if t, err := parseTime(string(sm[1])); err == nil && t.Before(start) {
+				break
+			}
+		}
+	}
+
+	// read from there into one big block, starting at the first record
+	bigbuf := make([]byte, flen-ofs)
+	if _, err := f.ReadAt(bigbuf, ofs); err != nil {
+		return nil, err
+	}
+	if len(c.logWrapField) > 0 {
+		bigbuf = unwrapLogLines(bigbuf, c.logWrapField)
+	}
+	pos := rxStart.FindIndex(bigbuf)
+	if pos == nil {
+		return nil, nil
+	}
+	return bigbuf[pos[0]:], nil
+}
+
+// processLogRecord processes a record of a csvlog or jsonlog file, which
+// has the message, detail, hint, context and statement in separate, possibly
+// multi-line, fields. These are processed like the lines of an entry in a
+// stderr log, which has a tab after each newline within a field. plen is the
+// size of the record other than the message.
+func (c *collector) processLogRecord(first bool, plen int, t time.Time, user, db, host, level,
+	state, message, detail, hint, context, statement string) {
+	line := withTabs(message)
+	c.countLogLine(plen, line)
+	c.processLogLine(first, t, user, db, host, level, state, line)
+	for _, x := range [...][2]string{{"DETAIL", detail}, {"HINT", hint},
+		{"CONTEXT", context}, {"STATEMENT", statement}} {
+		if len(x[1]) > 0 {
+			c.processLogLine(false, t, user, db, host, x[0], "", withTabs(x[1]))
+		}
 	}
-	return nil
 }
 
 var severities = []string{"DEBUG", "LOG", "INFO", "NOTICE", "WARNING", "ERROR", "FATAL", "PANIC"}
@@ -161,7 +353,9 @@ type logEntry struct {
 	t     time.Time
 	user  string
 	db    string
+	host  string
 	level string
+	state string // SQLSTATE, if known
 	line  string
 	extra []logEntryExtra
 }
@@ -180,7 +374,7 @@ type logEntryExtra struct {
 	line  string
 }
 
-func (c *collector) processLogLine(first bool, t time.Time, user, db, level, line string) {
+func (c *collector) processLogLine(first bool, t time.Time, user, db, host, level, state, line string) {
 	//log.Printf("debug:got log line [%s] [%s] [%s] [%s]", user, db, level, line)
 	// is this the start of a new entry?
 	start := false
@@ -196,7 +390,8 @@ func (c *collector) processLogLine(first bool, t time.Time, user, db, level, lin
 			c.processLogEntry()
 		}
 		// start new entry
-		c.currLog = logEntry{t: t, user: user, db: db, level: level, line: line, extra: nil}
+		c.currLog = logEntry{t: t, user: user, db: db, host: host, level: level,
+			state: state, line: line, extra: nil}
 	} else {
 		// add to extra
 		c.currLog.extra = append(c.currLog.extra, logEntryExtra{level: level, line: line})
@@ -205,12 +400,66 @@ func (c *collector) processLogLine(first bool, t time.Time, user, db, level, lin
 
 func (c *collector) processLogEntry() {
 	//log.Printf("debug: got log entry %+v", c.currLog)
+	c.countLogMessage()
+	switch c.currLog.level {
+	case "ERROR", "FATAL", "PANIC":
+		c.logHour().Errors++
+		c.countLogError()
+		if c.logHandler != nil {
+			e := c.currLog
+			c.logHandler.OnError(LogError{
+				At:        e.t.Unix(),
+				Level:     e.level,
+				Database:  e.db,
+				UserName:  e.user,
+				Host:      e.host,
+				Message:   e.line,
+				Detail:    e.get("DETAIL"),
+				Hint:      e.get("HINT"),
+				Statement: e.get("STATEMENT"),
+			})
+		}
+	}
+	if sm := rxRefreshMV.FindStringSubmatch(c.currLog.line); sm != nil {
+		c.processRefreshMV(sm[1])
+	}
+	if sm := rxDDL.FindStringSubmatch(c.currLog.line); sm != nil {
+		c.processDDL(sm[1], sm[2])
+	}
 	if sm := rxAEStart.FindStringSubmatch(c.currLog.line); sm != nil {
 		c.processAE(sm)
 	} else if sm := rxAVStart.FindStringSubmatch(c.currLog.line); sm != nil {
 		c.processAV(sm)
 	} else if c.currLog.line == "deadlock detected" {
 		c.processDeadlock()
+	} else if rxDuration.MatchString(c.currLog.line) {
+		c.logHour().SlowQueries++
+	} else if rxArchFail.MatchString(c.currLog.line) {
+		c.processArchiveFail()
+	} else if sm := rxArchGiveUp.FindStringSubmatch(c.currLog.line); sm != nil {
+		c.processArchiveGiveUp(sm)
+	} else if sm := rxArchived.FindStringSubmatch(c.currLog.line); sm != nil {
+		c.processArchived("archive", sm[1])
+	} else if sm := rxRestored.FindStringSubmatch(c.currLog.line); sm != nil {
+		c.processArchived("restore", sm[1])
+	} else if sm := rxCkptStart.FindStringSubmatch(c.currLog.line); sm != nil {
+		c.processCheckpointStart(sm)
+	} else if sm := rxCkptDone.FindStringSubmatch(c.currLog.line); sm != nil {
+		c.processCheckpointDone(sm)
+	} else if sm := rxLockWait.FindStringSubmatch(c.currLog.line); sm != nil {
+		c.processLockWait(sm)
+	} else if sm := rxTempFile.FindStringSubmatch(c.currLog.line); sm != nil {
+		c.processTempFile(sm[1], sm[2])
+	} else if rxConnRecv.MatchString(c.currLog.line) {
+		c.connChurn().Received++
+	} else if sm := rxConnAuth.FindStringSubmatch(c.currLog.line); sm != nil {
+		c.processConnect(sm[2], sm[1])
+	} else if sm := rxDisconn.FindStringSubmatch(c.currLog.line); sm != nil {
+		c.processDisconnect(sm)
+	} else if c.currLog.level == "FATAL" {
+		c.processFatal()
+	} else if c.currLog.level == "ERROR" && c.suspicious {
+		c.processError()
 	}
 }
 
@@ -238,7 +487,19 @@ func (c *collector) processAE(sm []string) {
 		log.Print("warning: xml format auto_explain output not supported yet")
 	case len(sm[3]) > 0:
 		p.Format = "yaml"
-		log.Print("warning: yaml format auto_explain output not supported yet")
+		// the document follows, each line indented by a tab; take out the
+		// query, which is a quoted string like in json
+		for _, l := range strings.Split(e.line, "\n")[1:] {
+			l = strings.TrimPrefix(l, "\t")
+			if q := strings.TrimPrefix(l, "Query Text: "); len(q) < len(l) {
+				if err := json.Unmarshal([]byte(q), &p.Query); err != nil {
+					p.Query = q
+				}
+				continue
+			}
+			p.Plan += l
+			p.Plan += "\n"
+		}
 	case len(sm[4]) > 0:
 		p.Format = "text"
 		var sp *string = nil
@@ -256,7 +517,12 @@ func (c *collector) processAE(sm []string) {
 			}
 		}
 	}
+	p.Fingerprint = pgmetrics.Fingerprint(p.Query)
 	c.result.Plans = append(c.result.Plans, p)
+	if c.logHandler != nil {
+		c.logHandler.OnPlan(p)
+	}
+	c.logHour().SlowQueries++
 }
 
 func (c *collector) processAV(sm []string) {
@@ -269,22 +535,345 @@ func (c *collector) processAV(sm []string) {
 		return
 	}
 	elapsed, _ := strconv.ParseFloat(sm2[1], 64)
-	c.result.AutoVacuums = append(c.result.AutoVacuums, pgmetrics.AutoVacuum{
+	av := pgmetrics.AutoVacuum{
 		At:      e.t.Unix(),
 		Table:   sm[3],
 		Elapsed: elapsed,
-	})
+	}
+	// the rest of the lines are present depending on the postgres version
+	atoi := func(s string) int64 {
+		v, _ := strconv.ParseInt(s, 10, 64)
+		return v
+	}
+	if m := rxAVPages.FindStringSubmatch(e.line); m != nil {
+		av.PagesRemoved, av.PagesRemain = atoi(m[1]), atoi(m[2])
+	}
+	if m := rxAVTuples.FindStringSubmatch(e.line); m != nil {
+		av.TuplesRemoved, av.TuplesRemain, av.TuplesDead = atoi(m[1]), atoi(m[2]), atoi(m[3])
+	}
+	if m := rxAVBuffers.FindStringSubmatch(e.line); m != nil {
+		av.BufferHits, av.BufferMisses, av.BufferDirtied = atoi(m[1]), atoi(m[2]), atoi(m[3])
+	}
+	if m := rxAVWAL.FindStringSubmatch(e.line); m != nil {
+		av.WALRecords, av.WALFPI, av.WALBytes = atoi(m[1]), atoi(m[2]), atoi(m[3])
+	}
+	if m := rxAVIOTime.FindStringSubmatch(e.line); m != nil {
+		av.ReadTime, _ = strconv.ParseFloat(m[1], 64)
+		av.WriteTime, _ = strconv.ParseFloat(m[2], 64)
+	}
+	c.result.AutoVacuums = append(c.result.AutoVacuums, av)
+	if c.logHandler != nil {
+		c.logHandler.OnAutoVacuum(av)
+	}
+	c.logHour().AutoVacuums++
 }
 
 func (c *collector) processDeadlock() {
 	e := c.currLog
 	text := strings.ReplaceAll(e.get("DETAIL"), "\t", "") + "\n"
-	c.result.Deadlocks = append(c.result.Deadlocks, pgmetrics.Deadlock{At: e.t.Unix(), Detail: text})
+	d := pgmetrics.Deadlock{At: e.t.Unix(), Detail: text}
+	c.result.Deadlocks = append(c.result.Deadlocks, d)
+	if c.logHandler != nil {
+		c.logHandler.OnDeadlock(d)
+	}
+	c.logHour().Deadlocks++
+}
+
+// logHour returns the counts for the hour of the current log entry.
+func (c *collector) logHour() *pgmetrics.LogHour {
+	hour := c.currLog.t.Unix() / 3600 * 3600
+	for i := len(c.result.LogHours) - 1; i >= 0; i-- { // usually the last one
+		if c.result.LogHours[i].Hour == hour {
+			return &c.result.LogHours[i]
+		}
+	}
+	c.result.LogHours = append(c.result.LogHours, pgmetrics.LogHour{Hour: hour})
+	return &c.result.LogHours[len(c.result.LogHours)-1]
+}
+
+// countLogError counts the current log entry, which is an error, against
+// its level and SQLSTATE. If the SQLSTATE was not logged, it is counted
+// against its normalized message instead.
+func (c *collector) countLogError() {
+	e := c.currLog
+	at := e.t.Unix()
+	key := e.level + " " + e.state
+	if len(e.state) == 0 {
+		key = e.level + " ? " + normalizeLogMessage(e.line)
+	}
+	if i, ok := c.logErrIndex[key]; ok {
+		ec := &c.result.LogErrorSummary[i]
+		ec.Count++
+		ec.Last = at
+		return
+	}
+	msg := e.line
+	if pos := strings.IndexByte(msg, '\n'); pos >= 0 {
+		msg = msg[:pos]
+	}
+	ec := pgmetrics.LogErrorCount{
+		Level:    e.level,
+		SQLState: e.state,
+		Count:    1,
+		First:    at,
+		Last:     at,
+		Message:  msg,
+	}
+	if len(e.state) == 5 {
+		code := pq.ErrorCode(e.state)
+		ec.Condition = code.Name()
+		ec.Class = code.Class().Name()
+	}
+	if c.logErrIndex == nil {
+		c.logErrIndex = make(map[string]int)
+	}
+	c.logErrIndex[key] = len(c.result.LogErrorSummary)
+	c.result.LogErrorSummary = append(c.result.LogErrorSummary, ec)
+}
+
+func (c *collector) processArchiveFail() {
+	e := c.currLog
+	f := pgmetrics.ArchiveFailure{At: e.t.Unix(), Error: e.line}
+	if sm := rxArchCmd.FindStringSubmatch(e.get("DETAIL")); sm != nil {
+		f.Command = sm[1]
+		f.WALFile = rxWALFile.FindString(f.Command)
+	}
+	c.result.ArchiveFailures = append(c.result.ArchiveFailures, f)
+}
+
+func (c *collector) processArchiveGiveUp(sm []string) {
+	e := c.currLog
+	c.result.ArchiveFailures = append(c.result.ArchiveFailures, pgmetrics.ArchiveFailure{
+		At:      e.t.Unix(),
+		WALFile: sm[1],
+		Error:   e.line,
+	})
+}
+
+// processArchived records a WAL file that was archived (logged only at
+// DEBUG1 level) or restored from the archive. The time taken is the time since
+// the previous file was archived or restored, or since the first failure to
+// archive this file.
+func (c *collector) processArchived(op, file string) {
+	e := c.currLog
+	a := pgmetrics.ArchivedWAL{WALFile: file, Op: op, At: e.t.Unix()}
+	var start int64
+	for i := len(c.result.ArchivedWALs) - 1; i >= 0; i-- {
+		if prev := &c.result.ArchivedWALs[i]; prev.Op == op {
+			start = prev.At
+			break
+		}
+	}
+	if op == "archive" {
+		for _, f := range c.result.ArchiveFailures {
+			if f.WALFile == file && f.At >= start {
+				if a.Failures == 0 && start == 0 {
+					start = f.At
+				}
+				a.Failures++
+			}
+		}
+	}
+	if start > 0 {
+		a.Interval = float64(a.At - start)
+	}
+	c.result.ArchivedWALs = append(c.result.ArchivedWALs, a)
+}
+
+// processDDL records a logged DDL statement. The command is the verb and,
+// for CREATE, ALTER and DROP, the kind of object.
+func (c *collector) processDDL(stmt, verb string) {
+	e := c.currLog
+	if e.level != "LOG" {
+		return // not logged by log_statement
+	}
+	command := strings.ToUpper(strings.Join(strings.Fields(verb), " "))
+	switch command {
+	case "CREATE", "ALTER", "DROP":
+		rest := strings.TrimSpace(stmt[len(verb):])
+		if sm := rxDDLObject.FindStringSubmatch(rest); sm != nil {
+			command += " " + strings.ToUpper(strings.Join(strings.Fields(sm[1]), " "))
+		}
+	}
+	if rs := []rune(stmt); uint(len(rs)) > c.sqlLength {
+		stmt = string(rs[:c.sqlLength])
+	}
+	c.result.DDLEvents = append(c.result.DDLEvents, pgmetrics.DDLEvent{
+		At:        e.t.Unix(),
+		UserName:  e.user,
+		Database:  e.db,
+		Command:   command,
+		Statement: stmt,
+	})
+}
+
+// processRefreshMV records the time of a logged REFRESH MATERIALIZED VIEW
+// statement (log_statement should be ddl or all) against the matview.
+func (c *collector) processRefreshMV(name string) {
+	e := c.currLog
+	if e.level == "ERROR" {
+		return // failed refresh
+	}
+	var schema string
+	parts := strings.SplitN(strings.Replace(name, `"`, "", -1), ".", 2)
+	if len(parts) == 2 {
+		schema, name = parts[0], parts[1]
+	} else {
+		name = parts[0]
+	}
+	for i := range c.result.MatViews {
+		mv := &c.result.MatViews[i]
+		if mv.DBName == e.db && mv.Name == name && (schema == "" || mv.SchemaName == schema) {
+			mv.LastRefresh = e.t.Unix()
+			return
+		}
+	}
+}
+
+// processCheckpointStart remembers the start of a checkpoint or restartpoint
+// (logged if log_checkpoints is on), till its completion is logged.
+func (c *collector) processCheckpointStart(sm []string) {
+	c.ckptStart = &pgmetrics.Checkpoint{
+		Start:        c.currLog.t.Unix(),
+		Restartpoint: sm[1] == "restartpoint",
+		Reason:       strings.TrimSpace(sm[2]),
+	}
+}
+
+// processCheckpointDone records a completed checkpoint or restartpoint, along
+// with its start if that was seen.
+func (c *collector) processCheckpointDone(sm []string) {
+	var cp pgmetrics.Checkpoint
+	if s := c.ckptStart; s != nil && s.Restartpoint == (sm[1] == "restartpoint") {
+		cp = *s
+	}
+	c.ckptStart = nil
+	cp.End = c.currLog.t.Unix()
+	cp.Restartpoint = sm[1] == "restartpoint"
+	cp.Buffers, _ = strconv.ParseInt(sm[2], 10, 64)
+	if pct, err := strconv.ParseFloat(sm[3], 64); err == nil {
+		cp.BuffersUsage = pct / 100
+	}
+	cp.WALAdded, _ = strconv.Atoi(sm[4])
+	cp.WALRemoved, _ = strconv.Atoi(sm[5])
+	cp.WALRecycled, _ = strconv.Atoi(sm[6])
+	cp.WriteTime, _ = strconv.ParseFloat(sm[7], 64)
+	cp.SyncTime, _ = strconv.ParseFloat(sm[8], 64)
+	cp.TotalTime, _ = strconv.ParseFloat(sm[9], 64)
+	if len(sm[10]) > 0 {
+		cp.SyncFiles, _ = strconv.Atoi(sm[10])
+		cp.SyncLongest, _ = strconv.ParseFloat(sm[11], 64)
+	}
+	if len(sm[12]) > 0 {
+		if kb, err := strconv.ParseInt(sm[12], 10, 64); err == nil {
+			cp.Distance = kb * 1024
+		}
+	}
+	c.result.Checkpoints = append(c.result.Checkpoints, cp)
+}
+
+// processLockWait records a wait for a lock (logged if log_lock_waits is on),
+// naming the relation locked if it is known.
+func (c *collector) processLockWait(sm []string) {
+	e := c.currLog
+	w := pgmetrics.LockWait{
+		At:        e.t.Unix(),
+		Acquired:  sm[2] == "acquired",
+		Mode:      sm[3],
+		Object:    sm[4],
+		UserName:  e.user,
+		Database:  e.db,
+		Statement: e.get("STATEMENT"),
+	}
+	w.PID, _ = strconv.Atoi(sm[1])
+	if ms, err := strconv.ParseFloat(sm[5], 64); err == nil {
+		w.Wait = ms / 1000
+	}
+	if sm2 := rxLockRel.FindStringSubmatch(w.Object); sm2 != nil {
+		reloid, _ := strconv.Atoi(sm2[1])
+		dboid, _ := strconv.Atoi(sm2[2])
+		if d := c.result.DatabaseByOID(dboid); d != nil {
+			for _, t := range c.result.Tables {
+				if t.OID == reloid && t.DBName == d.Name {
+					w.Relation = t.SchemaName + "." + t.Name
+					break
+				}
+			}
+		}
+	}
+	if sm2 := rxLockHolder.FindStringSubmatch(e.get("DETAIL")); sm2 != nil {
+		for _, f := range strings.Split(sm2[1], ",") {
+			if pid, err := strconv.Atoi(strings.TrimSpace(f)); err == nil {
+				w.BlockingPIDs = append(w.BlockingPIDs, pid)
+			}
+		}
+	}
+	if rs := []rune(w.Statement); uint(len(rs)) > c.sqlLength {
+		w.Statement = string(rs[:c.sqlLength])
+	}
+	c.result.LockWaits = append(c.result.LockWaits, w)
+}
+
+func (c *collector) processTempFile(path, size string) {
+	e := c.currLog
+	t := pgmetrics.TempFileEvent{
+		At:        e.t.Unix(),
+		UserName:  e.user,
+		Database:  e.db,
+		Path:      path,
+		Statement: e.get("STATEMENT"),
+	}
+	t.Size, _ = strconv.ParseInt(size, 10, 64)
+	// files are named pgsql_tmpPID.N, or are in a directory named like that
+	// for those shared by parallel workers
+	if sm := rxTempPID.FindStringSubmatch(path); sm != nil {
+		t.PID, _ = strconv.Atoi(sm[1])
+	}
+	if rs := []rune(t.Statement); uint(len(rs)) > c.sqlLength {
+		t.Statement = string(rs[:c.sqlLength])
+	}
+	c.result.TempFileEvents = append(c.result.TempFileEvents, t)
+}
+
+func (c *collector) processFatal() {
+	e := c.currLog
+	if sm := rxAuthFail.FindStringSubmatch(e.line); sm != nil {
+		c.processFailedLogin(sm[2], e.db, e.host, strings.ToLower(sm[1]))
+	} else if sm := rxNoHBA.FindStringSubmatch(e.line); sm != nil {
+		db := sm[3]
+		if len(db) == 0 { // replication connection
+			db = "replication"
+		}
+		c.processFailedLogin(sm[2], db, sm[1], "no hba entry")
+	}
+}
+
+// processFailedLogin counts the failed login against the (user, database,
+// host, reason) it was for.
+func (c *collector) processFailedLogin(user, db, host, reason string) {
+	at := c.currLog.t.Unix()
+	for i := range c.result.FailedLogins {
+		f := &c.result.FailedLogins[i]
+		if f.User == user && f.Database == db && f.Host == host && f.Reason == reason {
+			f.Count++
+			f.Last = at
+			return
+		}
+	}
+	c.result.FailedLogins = append(c.result.FailedLogins, pgmetrics.FailedLogin{
+		User:     user,
+		Database: db,
+		Host:     host,
+		Reason:   reason,
+		Count:    1,
+		First:    at,
+		Last:     at,
+	})
 }
 
 //------------------------------------------------------------------------------
 
-func getMatchData(match [][]byte, prefix *regexp.Regexp) (t time.Time, user, db string, err error) {
+func getMatchData(match [][]byte, prefix *regexp.Regexp) (t time.Time, user, db, host, state string, err error) {
 	idxT, idxM, idxN := -1, -1, -1
 	for i, s := range prefix.SubexpNames() {
 		switch s {
@@ -298,6 +887,15 @@ func getMatchData(match [][]byte, prefix *regexp.Regexp) (t time.Time, user, db
 			user = string(match[i])
 		case "d":
 			db = string(match[i])
+		case "h":
+			host = string(match[i])
+		case "e":
+			state = string(match[i])
+		case "r": // host(port)
+			host = string(match[i])
+			if pos := strings.LastIndexByte(host, '('); pos > 0 {
+				host = host[:pos]
+			}
 		}
 	}
 	if idxM != -1 && len(match[idxM]) > 0 {
@@ -397,6 +995,12 @@ func compilePrefix(prefix string) (*regexp.Regexp, error) {
 			r += `(?P<u>[A-Za-z0-9_.\[\]-]{1,64})`
 		case 'd': // database name
 			r += `(?P<d>[A-Za-z0-9_.\[\]-]{1,64})`
+		case 'h': // remote host
+			r += `(?P<h>\S+)?`
+		case 'r': // remote host and port
+			r += `(?P<r>\S+)?`
+		case 'e': // SQLSTATE error code
+			r += `(?P<e>[0-9A-Z]{5})`
 		case 'q': // rest are optional
 			r += `(?:` // needs termination
 			hasq = true
@@ -0,0 +1,174 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// rotatedLogs returns the log files that were rotated out before the
+// current log file, and were written to within the log span, oldest first.
+// These are the files in the same directory that are named by the
+// log_filename setting, as rotated by Postgres, or that are named like the
+// current file with a number or date added, as rotated by logrotate (like
+// "postgresql-15-main.log.1" or "postgresql-15-main.log.2.gz").
+func (c *collector) rotatedLogs(current string) []string {
+	fi, err := os.Stat(current)
+	if err != nil {
+		return nil
+	}
+	start := time.Now().Add(-time.Duration(c.logSpan) * time.Minute)
+	dir, name := filepath.Split(current)
+	rxRotated := regexp.MustCompile(`^` + regexp.QuoteMeta(name) + `[.-][0-9]+` + compressedExtRE + `$`)
+	rxPattern := logFilenameRE(c.setting("log_filename"), logFileExt(current))
+
+	entries, err := ioutil.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil
+	}
+	var found []string
+	mtimes := make(map[string]time.Time)
+	for _, e := range entries {
+		if e.Name() == name || !e.Mode().IsRegular() {
+			continue
+		}
+		if !rxRotated.MatchString(e.Name()) && !rxPattern.MatchString(e.Name()) {
+			continue
+		}
+		// written to within the span, and not after the current file
+		if e.ModTime().Before(start) || e.ModTime().After(fi.ModTime()) {
+			continue
+		}
+		f := filepath.Join(dir, e.Name())
+		found = append(found, f)
+		mtimes[f] = e.ModTime()
+	}
+	sort.Slice(found, func(i, j int) bool { return mtimes[found[i]].Before(mtimes[found[j]]) })
+	return found
+}
+
+// compressedExtRE matches the optional extension of a compressed file.
+const compressedExtRE = `(?:\.gz|\.zst|\.zstd)?`
+
+// logFileExt returns ".csv" or ".json" for csvlog and jsonlog files, and
+// "" for others.
+func logFileExt(filename string) string {
+	if isCSVLog(filename) {
+		return ".csv"
+	} else if strings.HasSuffix(strings.ToLower(trimCompressedExt(filename)), ".json") {
+		return ".json"
+	}
+	return ""
+}
+
+// logFilenameRE returns a regexp that matches the names of the log files
+// written by Postgres with the log_filename setting pattern, which has
+// strftime escapes. For csvlog and jsonlog files, ext is ".csv" or ".json",
+// which replaces the ".log" at the end of the pattern, or is added.
+func logFilenameRE(pattern, ext string) *regexp.Regexp {
+	if len(ext) > 0 {
+		pattern = strings.TrimSuffix(pattern, ".log") + ext
+	}
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i+1 == len(pattern) {
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case 'Y', 'm', 'd', 'H', 'M', 'S', 'j', 'y', 'I', 'e', 'u', 'w', 'U', 'W', 'V', 'G', 'g', 's':
+			b.WriteString(`\s?[0-9]+`)
+		case 'a', 'A', 'b', 'B', 'h', 'p', 'Z':
+			b.WriteString(`[A-Za-z]+`)
+		case 'z':
+			b.WriteString(`[+-][0-9]+`)
+		case '%':
+			b.WriteString("%")
+		default:
+			b.WriteString(".*?")
+		}
+	}
+	b.WriteString(compressedExtRE + "$")
+	return regexp.MustCompile(b.String())
+}
+
+// newestLogFile returns the most recently written log file in log_directory
+// that is named by the log_filename pattern, for the first destination in
+// log_destination that is written to files. This is used when
+// pg_current_logfile() is not available (before v10, or without the
+// privileges to call it). Returns "" if there is no such file.
+func (c *collector) newestLogFile() string {
+	if c.setting("logging_collector") != "on" {
+		return ""
+	}
+	dir := filepath.FromSlash(c.setting("log_directory"))
+	if len(dir) == 0 {
+		return ""
+	}
+	if !filepath.IsAbs(dir) {
+		if len(c.dataDir) == 0 {
+			return ""
+		}
+		dir = filepath.Join(c.dataDir, dir)
+	}
+	ext := "-"
+dests:
+	for _, d := range strings.Split(c.setting("log_destination"), ",") {
+		switch strings.TrimSpace(d) {
+		case "stderr":
+			ext = ""
+		case "csvlog":
+			ext = ".csv"
+		case "jsonlog":
+			ext = ".json"
+		default:
+			continue
+		}
+		break dests
+	}
+	if ext == "-" {
+		return "" // no file destinations
+	}
+	rx := logFilenameRE(c.setting("log_filename"), ext)
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	var newest os.FileInfo
+	for _, e := range entries {
+		// the current file is not compressed
+		if !e.Mode().IsRegular() || !rx.MatchString(e.Name()) || trimCompressedExt(e.Name()) != e.Name() {
+			continue
+		}
+		if newest == nil || e.ModTime().After(newest.ModTime()) {
+			newest = e
+		}
+	}
+	if newest == nil {
+		return ""
+	}
+	return filepath.Join(dir, newest.Name())
+}
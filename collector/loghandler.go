@@ -0,0 +1,60 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collector
+
+import "github.com/rapidloop/pgmetrics"
+
+// LogEventHandler is notified of the events found in the log file, as each
+// one is parsed, so that applications embedding the collector can react to
+// them without parsing the log again. Set CollectConfig.LogHandler to use it.
+//
+// The methods are called from the goroutine running Collect, in the order in
+// which the events were logged, and should not block for long. The events are
+// also present in the Model returned by Collect, as before.
+type LogEventHandler interface {
+	// OnPlan is called for each query plan logged by auto_explain.
+	OnPlan(p pgmetrics.Plan)
+	// OnAutoVacuum is called for each autovacuum run logged.
+	OnAutoVacuum(av pgmetrics.AutoVacuum)
+	// OnDeadlock is called for each deadlock logged.
+	OnDeadlock(d pgmetrics.Deadlock)
+	// OnError is called for each logged message of level ERROR, FATAL or
+	// PANIC, including the ones for deadlocks.
+	OnError(e LogError)
+}
+
+// LogError is a message of level ERROR, FATAL or PANIC from the log file.
+type LogError struct {
+	At        int64  // time when logged, as seconds since epoch
+	Level     string // ERROR, FATAL or PANIC
+	Database  string // might be empty
+	UserName  string // might be empty
+	Host      string // might be empty
+	Message   string
+	Detail    string // the DETAIL line, if any
+	Hint      string // the HINT line, if any
+	Statement string // the STATEMENT line, if any
+}
+
+// NopLogEventHandler is a LogEventHandler that does nothing. Embed it in
+// handlers that are interested in only some of the events.
+type NopLogEventHandler struct{}
+
+func (NopLogEventHandler) OnPlan(p pgmetrics.Plan)              {}
+func (NopLogEventHandler) OnAutoVacuum(av pgmetrics.AutoVacuum) {}
+func (NopLogEventHandler) OnDeadlock(d pgmetrics.Deadlock)      {}
+func (NopLogEventHandler) OnError(e LogError)                   {}
@@ -0,0 +1,113 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collector
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rapidloop/pgmetrics"
+)
+
+const (
+	logTopMessages = 10  // number of most frequent messages to keep
+	logMessageLen  = 200 // bytes of normalized message to keep
+)
+
+var (
+	rxNormQuoted = regexp.MustCompile(`"(?:[^"]|"")*"|'(?:[^']|'')*'`)
+	rxNormLSN    = regexp.MustCompile(`\b[0-9A-F]+/[0-9A-F]+\b`)
+	rxNormNumber = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+)
+
+// countLogLine adds a log line within the span, of which plen bytes were the
+// prefix, to the log volume.
+func (c *collector) countLogLine(plen int, line string) {
+	if c.result.LogVolume == nil {
+		c.result.LogVolume = &pgmetrics.LogVolume{}
+	}
+	v := c.result.LogVolume
+	v.Lines += 1 + strings.Count(line, "\n")
+	v.Bytes += int64(plen + len(line) + 1)
+}
+
+// countLogMessage counts the current log entry against its normalized
+// message.
+func (c *collector) countLogMessage() {
+	e := c.currLog
+	if c.result.LogVolume != nil {
+		c.result.LogVolume.Entries++
+	}
+	msg := normalizeLogMessage(e.line)
+	key := e.level + " " + msg
+	at := e.t.Unix()
+	if i, ok := c.logMsgIndex[key]; ok {
+		m := &c.logMsgs[i]
+		m.Count++
+		m.Last = at
+		return
+	}
+	if c.logMsgIndex == nil {
+		c.logMsgIndex = make(map[string]int)
+	}
+	c.logMsgIndex[key] = len(c.logMsgs)
+	c.logMsgs = append(c.logMsgs, pgmetrics.LogMessage{
+		Level:   e.level,
+		Message: msg,
+		Count:   1,
+		First:   at,
+		Last:    at,
+	})
+}
+
+// finishLogVolume keeps only the most frequent of the counted messages.
+func (c *collector) finishLogVolume() {
+	if c.result.LogVolume == nil || len(c.logMsgs) == 0 {
+		return
+	}
+	msgs := c.logMsgs
+	sort.SliceStable(msgs, func(i, j int) bool { return msgs[i].Count > msgs[j].Count })
+	if len(msgs) > logTopMessages {
+		msgs = msgs[:logTopMessages]
+	}
+	c.result.LogVolume.TopMessages = msgs
+	c.logMsgs, c.logMsgIndex = nil, nil
+}
+
+// normalizeLogMessage returns the first line of the log message, with the
+// quoted strings, LSNs and numbers replaced by "?", so that messages that
+// differ only in these are counted together.
+func normalizeLogMessage(msg string) string {
+	if i := strings.IndexByte(msg, '\n'); i >= 0 {
+		msg = msg[:i]
+	}
+	msg = rxNormQuoted.ReplaceAllStringFunc(msg, func(q string) string {
+		return q[:1] + "?" + q[:1]
+	})
+	msg = rxNormLSN.ReplaceAllString(msg, "?")
+	msg = rxNormNumber.ReplaceAllString(msg, "?")
+	if len(msg) > logMessageLen {
+		n := logMessageLen
+		for n > 0 && !utf8.RuneStart(msg[n]) {
+			n--
+		}
+		msg = msg[:n]
+	}
+	return msg
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collector
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rapidloop/pgmetrics"
+)
+
+// collectParallel collects from the databases, up to n at a time. The
+// cluster-level information must have been collected already. Each database
+// is collected by a copy of c with its own result, and the results are merged
+// into c.result in the order of dbnames, so that the output is the same as
+// when collecting one database after the other.
+func collectParallel(connstr string, c *collector, dbnames []string, n uint, o CollectConfig) {
+	// as in getStatements, only if the extensions are being collected
+	if !arrayHas(o.Omit, "statements") && !arrayHas(o.Omit, "extensions") {
+		c.heavy(func() { c.prefetchStatements(connstr, dbnames, o) })
+	}
+
+	workers := make([]*collector, len(dbnames))
+	sem := make(chan struct{}, n)
+	var wg sync.WaitGroup
+	for i, dbname := range dbnames {
+		workers[i] = c.worker()
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(w *collector, dbname string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			collectFromDB(connstr+makeKV("dbname", dbname), w, o)
+		}(workers[i], dbname)
+	}
+	wg.Wait()
+	for _, w := range workers {
+		c.merge(w)
+	}
+}
+
+// prefetchStatements fetches the statements before the workers start, from
+// the first of dbnames that has pg_stat_statements, unless they have been
+// fetched already. The workers then only explain those of their database.
+func (c *collector) prefetchStatements(connstr string, dbnames []string, o CollectConfig) {
+	orig := c.db
+	defer func() { c.db = orig }()
+
+	for _, dbname := range dbnames {
+		if len(c.result.Statements) > 0 {
+			return
+		}
+		db := c.openDB(connstr+makeKV("dbname", dbname), o)
+		c.db = db
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		q := `SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_stat_statements')`
+		var found bool
+		if err := db.QueryRowContext(ctx, q).Scan(&found); err == nil && found {
+			c.queryStatements(dbname)
+		}
+		cancel()
+		db.Close()
+	}
+}
+
+// worker returns a copy of c for collecting one more database, sharing the
+// cluster-level information collected so far but none of the per-database
+// information. The databases and statements are copied, since the worker
+// fills in some of their fields.
+func (c *collector) worker() *collector {
+	w := *c
+	w.counter = queryCounter{}
+	w.stmtsDone = true
+	r := &w.result
+	r.Metadata.CollectedDBs = nil
+	r.Databases = append([]pgmetrics.Database(nil), c.result.Databases...)
+	r.Tables = nil
+	r.Indexes = nil
+	r.Sequences = nil
+	r.UserFunctions = nil
+	r.Extensions = nil
+	r.DisabledTriggers = nil
+	r.MatViews = nil
+	r.SchemaFingerprints = nil
+	r.Publications = nil
+	r.Subscriptions = nil
+	r.Statements = append([]pgmetrics.Statement(nil), c.result.Statements...)
+	return &w
+}
+
+// merge adds the per-database information collected by the worker w to
+// c.result.
+func (c *collector) merge(w *collector) {
+	c.counter.queries += w.counter.queries
+	c.counter.rows += w.counter.rows
+	r := &w.result
+	c.result.Metadata.CollectedDBs = append(c.result.Metadata.CollectedDBs, r.Metadata.CollectedDBs...)
+	for _, name := range r.Metadata.CollectedDBs {
+		d, wd := c.result.DatabaseByName(name), r.DatabaseByName(name)
+		if d == nil || wd == nil {
+			continue
+		}
+		d.LOCount, d.LOSize, d.LOOrphans = wd.LOCount, wd.LOSize, wd.LOOrphans
+		d.LOEstimated = wd.LOEstimated
+	}
+	c.result.Tables = append(c.result.Tables, r.Tables...)
+	c.result.Indexes = append(c.result.Indexes, r.Indexes...)
+	c.result.Sequences = append(c.result.Sequences, r.Sequences...)
+	c.result.UserFunctions = append(c.result.UserFunctions, r.UserFunctions...)
+	c.result.Extensions = append(c.result.Extensions, r.Extensions...)
+	c.result.DisabledTriggers = append(c.result.DisabledTriggers, r.DisabledTriggers...)
+	c.result.MatViews = append(c.result.MatViews, r.MatViews...)
+	c.result.SchemaFingerprints = append(c.result.SchemaFingerprints, r.SchemaFingerprints...)
+	c.result.Publications = append(c.result.Publications, r.Publications...)
+	c.result.Subscriptions = append(c.result.Subscriptions, r.Subscriptions...)
+	// each worker explains the statements of its own database
+	if len(r.Statements) == len(c.result.Statements) {
+		for i, s := range r.Statements {
+			if len(s.Plan) > 0 {
+				c.result.Statements[i].Plan = s.Plan
+			}
+		}
+	}
+}
+
+// heavy runs f, which makes expensive queries, after pausing if the server
+// load is to be kept low, and waiting if CollectConfig.MaxHeavyQueries other
+// databases are already running theirs.
+func (c *collector) heavy(f func()) {
+	c.pause()
+	if c.heavySem != nil {
+		c.heavySem <- struct{}{}
+		defer func() { <-c.heavySem }()
+	}
+	f()
+}
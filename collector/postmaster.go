@@ -0,0 +1,112 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// postmaster is a Postgres server running on this host, as described by the
+// postmaster.pid file in its data directory.
+type postmaster struct {
+	pid       int
+	dataDir   string
+	port      int
+	socketDir string // first of unix_socket_directories, "" if none
+}
+
+// readPostmasterPid reads the postmaster.pid file in the data directory. The
+// lines are: pid, data directory, start time, port, socket directory, listen
+// address, shared memory key and (v10+) status.
+func readPostmasterPid(dataDir string) (pm postmaster, ok bool) {
+	data, err := ioutil.ReadFile(filepath.Join(dataDir, "postmaster.pid"))
+	if err != nil {
+		return
+	}
+	lines := strings.Split(string(data), "\n")
+	if len(lines) < 4 {
+		return
+	}
+	if pm.pid, err = strconv.Atoi(strings.TrimSpace(lines[0])); err != nil {
+		return
+	}
+	pm.dataDir = strings.TrimSpace(lines[1])
+	if pm.port, err = strconv.Atoi(strings.TrimSpace(lines[3])); err != nil {
+		return
+	}
+	if len(lines) > 4 {
+		pm.socketDir = strings.TrimSpace(lines[4])
+	}
+	return pm, true
+}
+
+// socketDirs are the usual locations of the unix socket of a local server:
+// the Debian/Ubuntu one and the compiled-in default.
+var socketDirs = []string{"/var/run/postgresql", "/tmp"}
+
+// LocalSocketDir returns the directory with the unix socket of a server
+// running on this host and listening on port. The postmaster.pid files of
+// running servers are looked at first, then the usual locations. If no
+// socket is found, the first of the usual locations is returned.
+func LocalSocketDir(port uint16) string {
+	for _, pm := range findPostmasters() {
+		if pm.port == int(port) && len(pm.socketDir) > 0 {
+			return pm.socketDir
+		}
+	}
+	sock := ".s.PGSQL." + strconv.Itoa(int(port))
+	for _, dir := range socketDirs {
+		if _, err := os.Stat(filepath.Join(dir, sock)); err == nil {
+			return dir
+		}
+	}
+	return socketDirs[0]
+}
+
+// LocalServer is a Postgres server found running on this host.
+type LocalServer struct {
+	PID       int
+	DataDir   string
+	Port      uint16
+	SocketDir string // "" if it does not listen on a unix socket
+	Version   string // major version from PG_VERSION, "" if unreadable
+}
+
+// LocalServers returns the servers running on this host, ordered by port.
+// Only the servers that this user is allowed to look at are found, which
+// usually needs running as the postgres user or root, and only on Linux.
+func LocalServers() (out []LocalServer) {
+	for _, pm := range findPostmasters() {
+		ls := LocalServer{
+			PID:       pm.pid,
+			DataDir:   pm.dataDir,
+			Port:      uint16(pm.port),
+			SocketDir: pm.socketDir,
+		}
+		if v, err := ioutil.ReadFile(filepath.Join(pm.dataDir, "PG_VERSION")); err == nil {
+			ls.Version = strings.TrimSpace(string(v))
+		}
+		out = append(out, ls)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Port < out[j].Port })
+	return
+}
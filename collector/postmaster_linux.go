@@ -0,0 +1,65 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// findPostmasters returns the servers running on this host. The processes
+// named postgres or postmaster are looked up in /proc; all of them run
+// in the data directory, which has the postmaster.pid file. Only the
+// processes that we are allowed to look at are found, which usually
+// needs running as the postgres user or root.
+func findPostmasters() (out []postmaster) {
+	dirs, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return
+	}
+	seen := make(map[string]bool)
+	for _, d := range dirs {
+		if _, err := strconv.Atoi(d.Name()); err != nil {
+			continue
+		}
+		base := filepath.Join("/proc", d.Name())
+		comm, err := ioutil.ReadFile(filepath.Join(base, "comm"))
+		if err != nil {
+			continue
+		}
+		if c := strings.TrimSpace(string(comm)); c != "postgres" && c != "postmaster" {
+			continue
+		}
+		cwd, err := os.Readlink(filepath.Join(base, "cwd"))
+		if err != nil || seen[cwd] {
+			continue
+		}
+		seen[cwd] = true
+		if pm, ok := readPostmasterPid(cwd); ok && isRunning(pm.pid) {
+			out = append(out, pm)
+		}
+	}
+	return
+}
+
+func isRunning(pid int) bool {
+	_, err := os.Stat("/proc/" + strconv.Itoa(pid))
+	return err == nil
+}
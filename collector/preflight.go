@@ -0,0 +1,189 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// PreflightProblem is a problem found by Preflight. Problems that are not
+// warnings would make the collection fail midway through, or not collect
+// what was asked for.
+type PreflightProblem struct {
+	Message string
+	Warning bool // the collection can go ahead, with some information missing
+}
+
+// Preflight checks, before a collection is started with the same arguments,
+// that the log file can be read. If o.Preflight is set, it also connects to
+// check that the databases can be connected to, that pg_stat_statements can
+// be queried in one of them and that the role has the privileges to see all
+// the statistics. All the problems found are returned. Like Collect, it does
+// a log.Fatal() if the server cannot be connected to.
+//
+// The server is not queried when replaying a fixture or for pgbouncer.
+func Preflight(o CollectConfig, dbnames []string) (problems []PreflightProblem) {
+	add := func(warning bool, format string, args ...interface{}) {
+		problems = append(problems, PreflightProblem{
+			Message: fmt.Sprintf(format, args...),
+			Warning: warning,
+		})
+	}
+
+	// the log file, if given, should be readable
+	if len(o.LogFile) > 0 && !arrayHas(o.Omit, "log") {
+		if f, err := os.Open(o.LogFile); err != nil {
+			add(false, "cannot read log file: %v", err)
+		} else {
+			var b [1]byte
+			if _, err := f.Read(b[:]); err != nil && err != io.EOF {
+				add(false, "cannot read log file %s: %v", o.LogFile, err)
+			}
+			f.Close()
+		}
+	}
+
+	if !o.Preflight || len(o.Fixture) > 0 || (len(dbnames) == 1 && dbnames[0] == "pgbouncer") {
+		return
+	}
+	connstr := connString(o, dbnames)
+	if len(dbnames) > 0 {
+		connstr += makeKV("dbname", dbnames[0])
+	}
+	c := &collector{}
+	c.db = c.openDB(connstr, o)
+	defer c.db.Close()
+	c.timeout = time.Duration(o.TimeoutSec) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	var version int
+	var currdb, curruser, preload string
+	q := `SELECT current_setting('server_version_num')::integer, current_database(),
+			current_user, current_setting('shared_preload_libraries')`
+	if err := c.db.QueryRowContext(ctx, q).Scan(&version, &currdb, &curruser, &preload); err != nil {
+		add(true, "preflight query failed: %v", err)
+		return
+	}
+
+	// the other databases should exist and allow connections
+	canConnect := make(map[string]bool)
+	if len(dbnames) > 1 {
+		q = `SELECT datname, datallowconn AND has_database_privilege(datname, 'CONNECT')
+			  FROM pg_database`
+		if rows, err := c.db.QueryContext(ctx, q); err == nil {
+			for rows.Next() {
+				var name string
+				var ok bool
+				if err := rows.Scan(&name, &ok); err == nil {
+					canConnect[name] = ok
+				}
+			}
+			rows.Close()
+			for _, name := range dbnames[1:] {
+				if ok, found := canConnect[name]; !found {
+					add(false, "database %q does not exist", name)
+				} else if !ok {
+					add(false, "role %q cannot connect to database %q", curruser, name)
+				}
+			}
+		}
+	}
+
+	// the role should be able to see the queries and stats of other roles
+	q = `SELECT rolsuper FROM pg_roles WHERE rolname = current_user`
+	if version >= 100000 {
+		q = `SELECT rolsuper OR pg_has_role(current_user, 'pg_monitor', 'USAGE')
+			  FROM pg_roles WHERE rolname = current_user`
+	}
+	var privileged bool
+	if err := c.db.QueryRowContext(ctx, q).Scan(&privileged); err == nil && !privileged {
+		if version >= 100000 {
+			add(true, "role %q is not a superuser or a member of pg_monitor, "+
+				"some information about other roles will not be collected", curruser)
+		} else {
+			add(true, "role %q is not a superuser, some information about "+
+				"other roles will not be collected", curruser)
+		}
+	}
+
+	// pg_stat_statements needs both the library and the extension; the
+	// statements are collected from the first database that has it
+	if !arrayHas(o.Omit, "statements") {
+		var created bool
+		q = `SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_stat_statements')`
+		if err := c.db.QueryRowContext(ctx, q).Scan(&created); err != nil {
+			return
+		}
+		checked := []string{currdb}
+		if len(dbnames) > 1 {
+			for _, name := range dbnames[1:] {
+				if created {
+					break
+				}
+				if canConnect[name] {
+					created = hasStatementsExt(connString(o, dbnames)+makeKV("dbname", name), o)
+					checked = append(checked, name)
+				}
+			}
+		}
+		loaded := false
+		for _, lib := range strings.Split(preload, ",") {
+			if strings.Trim(strings.TrimSpace(lib), `"`) == "pg_stat_statements" {
+				loaded = true
+			}
+		}
+		where := fmt.Sprintf("database %q", currdb)
+		if len(checked) > 1 {
+			where = fmt.Sprintf("any of the databases %s", strings.Join(checked, ", "))
+		}
+		if loaded && !created {
+			add(true, "pg_stat_statements is loaded but the extension is not "+
+				"created in %s, statements will not be collected", where)
+		} else if created && !loaded {
+			add(true, "pg_stat_statements extension is created but not in "+
+				"shared_preload_libraries, statements will not be collected")
+		} else if !created && o.ExplainTop > 0 {
+			add(true, "pg_stat_statements extension is not present in %s, "+
+				"statements will not be explained", where)
+		}
+	}
+
+	return
+}
+
+// hasStatementsExt returns true if the pg_stat_statements extension is
+// created in the database that connstr connects to.
+func hasStatementsExt(connstr string, o CollectConfig) bool {
+	c := &collector{}
+	c.db = c.openDB(connstr, o)
+	defer c.db.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(o.TimeoutSec)*time.Second)
+	defer cancel()
+
+	var created bool
+	q := `SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_stat_statements')`
+	if err := c.db.QueryRowContext(ctx, q).Scan(&created); err != nil {
+		return false
+	}
+	return created
+}
@@ -0,0 +1,402 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rapidloop/pgmetrics"
+)
+
+// rateSample is a set of cumulative counter values, taken at a point in time.
+type rateSample struct {
+	at       time.Time                             // when cluster-level values were sampled
+	lsn      string                                // current WAL position, primaries only
+	dbs      map[string]pgmetrics.Database         // by database name
+	tablesAt map[string]time.Time                  // when the tables of a db were sampled
+	tables   map[string]pgmetrics.Table            // by db.schema.table
+	vacuums  map[int][2]int64                      // pid -> heap blks scanned, total
+	slots    map[string]string                     // logical slot name -> confirmed_flush_lsn
+	walStmts map[walStmtKey]pgmetrics.WALStatement // WAL stats of statements, if sampled
+}
+
+func tableKey(db, schema, table string) string {
+	return db + "." + schema + "." + table
+}
+
+// collectRates takes two samples of various cumulative counters, separated by
+// the sample interval, and computes the rates from them. The samples are
+// taken after the main collection is over, using fresh connections. If a
+// sample cannot be taken, a warning is logged and no rates are reported.
+func (c *collector) collectRates(connstr string, dbnames []string, o CollectConfig) {
+	var connstrs []string
+	if len(dbnames) == 0 {
+		connstrs = append(connstrs, connstr)
+	} else {
+		for _, dbname := range dbnames {
+			connstrs = append(connstrs, connstr+makeKV("dbname", dbname))
+		}
+	}
+	withTables := !arrayHas(o.Omit, "tables") && len(c.result.Tables) > 0
+	// the WAL activity is computed from these samples, rather than from
+	// another pair taken by getWALActivity
+	withWAL := o.WALSampleSec > 0 && !c.result.IsInRecovery && !c.isAWSAurora()
+
+	// the samples use their own connections, restore the main one after
+	orig := c.db
+	defer func() { c.db = orig }()
+
+	take := func() (*rateSample, error) {
+		s := &rateSample{
+			dbs:      make(map[string]pgmetrics.Database),
+			tablesAt: make(map[string]time.Time),
+			tables:   make(map[string]pgmetrics.Table),
+			vacuums:  make(map[int][2]int64),
+			slots:    make(map[string]string),
+		}
+		for i, cs := range connstrs {
+			db := c.openDB(cs, o)
+			c.db = db
+			var err error
+			if i == 0 {
+				if withWAL && c.version >= 130000 {
+					s.walStmts = c.walStmtSample()
+				}
+				err = c.sampleCluster(s)
+			}
+			if err == nil && withTables {
+				err = c.sampleTables(s)
+			}
+			db.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	}
+
+	s1, err := take()
+	if err != nil {
+		log.Printf("warning: failed to sample counters, not computing rates: %v", err)
+		return
+	}
+	// count the autovacuum workers while waiting for the interval
+	c.sampleAVWorkersFor(connstrs[0], o, time.Duration(o.SampleIntervalSec)*time.Second)
+	s2, err := take()
+	if err != nil {
+		log.Printf("warning: failed to sample counters, not computing rates: %v", err)
+		return
+	}
+	c.result.Rates = c.computeRates(s1, s2)
+	c.computeVacuumETA(s1, s2)
+	if withWAL {
+		c.computeWALActivity(s1, s2)
+	}
+}
+
+func (c *collector) sampleCluster(s *rateSample) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	s.at = time.Now()
+	if !c.result.IsInRecovery && !c.isAWSAurora() {
+		q := `SELECT pg_current_wal_lsn()`
+		if c.version < 100000 {
+			q = `SELECT pg_current_xlog_location()`
+		}
+		if err := c.db.QueryRowContext(ctx, q).Scan(&s.lsn); err != nil {
+			log.Printf("warning: failed to get current wal position: %v", err)
+		}
+	}
+
+	q := `SELECT datname, xact_commit, xact_rollback, blks_read, blks_hit,
+			tup_returned, tup_fetched, tup_inserted, tup_updated, tup_deleted,
+			deadlocks, conflicts
+		  FROM pg_stat_database
+		  WHERE datname IS NOT NULL`
+	rows, err := c.db.QueryContext(ctx, q)
+	if err != nil {
+		return fmt.Errorf("pg_stat_database query failed: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d pgmetrics.Database
+		if err := rows.Scan(&d.Name, &d.XactCommit, &d.XactRollback,
+			&d.BlksRead, &d.BlksHit, &d.TupReturned, &d.TupFetched,
+			&d.TupInserted, &d.TupUpdated, &d.TupDeleted, &d.Deadlocks,
+			&d.Conflicts); err != nil {
+			return fmt.Errorf("pg_stat_database query failed: %v", err)
+		}
+		s.dbs[d.Name] = d
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("pg_stat_database query failed: %v", err)
+	}
+
+	if c.version >= 90600 && len(c.result.VacuumProgress) > 0 {
+		if err := c.sampleVacuums(s); err != nil {
+			return err
+		}
+	}
+
+	if c.version >= 90600 && len(c.result.ReplicationSlots) > 0 {
+		c.sampleSlots(s)
+	}
+	return nil
+}
+
+func (c *collector) sampleSlots(s *rateSample) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	q := `SELECT slot_name, confirmed_flush_lsn
+		  FROM pg_replication_slots
+		  WHERE slot_type = 'logical' AND confirmed_flush_lsn IS NOT NULL`
+	rows, err := c.db.QueryContext(ctx, q)
+	if err != nil {
+		log.Printf("warning: pg_replication_slots query failed: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, lsn string
+		if err := rows.Scan(&name, &lsn); err != nil {
+			log.Printf("warning: pg_replication_slots query failed: %v", err)
+			return
+		}
+		s.slots[name] = lsn
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("warning: pg_replication_slots query failed: %v", err)
+	}
+}
+
+func (c *collector) sampleVacuums(s *rateSample) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	q := `SELECT pid, COALESCE(heap_blks_scanned, 0), COALESCE(heap_blks_total, 0)
+		  FROM pg_stat_progress_vacuum`
+	rows, err := c.db.QueryContext(ctx, q)
+	if err != nil {
+		return fmt.Errorf("pg_stat_progress_vacuum query failed: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pid int
+		var scanned, total int64
+		if err := rows.Scan(&pid, &scanned, &total); err != nil {
+			return fmt.Errorf("pg_stat_progress_vacuum query failed: %v", err)
+		}
+		s.vacuums[pid] = [2]int64{scanned, total}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("pg_stat_progress_vacuum query failed: %v", err)
+	}
+	return nil
+}
+
+func (c *collector) sampleTables(s *rateSample) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	q := `SELECT current_database(), schemaname, relname, seq_scan, seq_tup_read,
+			COALESCE(idx_scan, 0), COALESCE(idx_tup_fetch, 0), n_tup_ins,
+			n_tup_upd, n_tup_del, n_tup_hot_upd
+		  FROM pg_stat_user_tables`
+	rows, err := c.db.QueryContext(ctx, q)
+	if err != nil {
+		return fmt.Errorf("pg_stat_user_tables query failed: %v", err)
+	}
+	defer rows.Close()
+
+	at := time.Now()
+	for rows.Next() {
+		var t pgmetrics.Table
+		if err := rows.Scan(&t.DBName, &t.SchemaName, &t.Name, &t.SeqScan,
+			&t.SeqTupRead, &t.IdxScan, &t.IdxTupFetch, &t.NTupIns, &t.NTupUpd,
+			&t.NTupDel, &t.NTupHotUpd); err != nil {
+			return fmt.Errorf("pg_stat_user_tables query failed: %v", err)
+		}
+		s.tablesAt[t.DBName] = at
+		s.tables[tableKey(t.DBName, t.SchemaName, t.Name)] = t
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("pg_stat_user_tables query failed: %v", err)
+	}
+	return nil
+}
+
+// computeRates computes the rates of the counters between the samples s1 and
+// s2. Only the databases and tables that were collected in the main
+// collection are included.
+func (c *collector) computeRates(s1, s2 *rateSample) *pgmetrics.Rates {
+	r := &pgmetrics.Rates{
+		Interval: s2.at.Sub(s1.at).Seconds(),
+	}
+	if r.Interval <= 0 {
+		return r
+	}
+	rate := func(a, b int64, secs float64) float64 {
+		if b < a { // stats were reset in between
+			return 0
+		}
+		return float64(b-a) / secs
+	}
+
+	// wal
+	if l1, ok1 := parseLSN(s1.lsn); ok1 {
+		if l2, ok2 := parseLSN(s2.lsn); ok2 {
+			r.WALBytes = rate(l1, l2, r.Interval)
+		}
+	}
+
+	// databases
+	for _, d := range c.result.Databases {
+		d1, ok1 := s1.dbs[d.Name]
+		d2, ok2 := s2.dbs[d.Name]
+		if !ok1 || !ok2 {
+			continue
+		}
+		secs := r.Interval
+		dr := pgmetrics.DatabaseRates{
+			Name:         d.Name,
+			XactCommit:   rate(d1.XactCommit, d2.XactCommit, secs),
+			XactRollback: rate(d1.XactRollback, d2.XactRollback, secs),
+			BlksRead:     rate(d1.BlksRead, d2.BlksRead, secs),
+			BlksHit:      rate(d1.BlksHit, d2.BlksHit, secs),
+			TupReturned:  rate(d1.TupReturned, d2.TupReturned, secs),
+			TupFetched:   rate(d1.TupFetched, d2.TupFetched, secs),
+			TupInserted:  rate(d1.TupInserted, d2.TupInserted, secs),
+			TupUpdated:   rate(d1.TupUpdated, d2.TupUpdated, secs),
+			TupDeleted:   rate(d1.TupDeleted, d2.TupDeleted, secs),
+			Deadlocks:    rate(d1.Deadlocks, d2.Deadlocks, secs),
+			Conflicts:    rate(d1.Conflicts, d2.Conflicts, secs),
+		}
+		dr.TPS = dr.XactCommit + dr.XactRollback
+		r.Databases = append(r.Databases, dr)
+	}
+
+	// tables
+	for _, t := range c.result.Tables {
+		key := tableKey(t.DBName, t.SchemaName, t.Name)
+		t1, ok1 := s1.tables[key]
+		t2, ok2 := s2.tables[key]
+		if !ok1 || !ok2 {
+			continue
+		}
+		secs := s2.tablesAt[t.DBName].Sub(s1.tablesAt[t.DBName]).Seconds()
+		if secs <= 0 {
+			continue
+		}
+		r.Tables = append(r.Tables, pgmetrics.TableRates{
+			DBName:      t.DBName,
+			SchemaName:  t.SchemaName,
+			Name:        t.Name,
+			SeqScan:     rate(t1.SeqScan, t2.SeqScan, secs),
+			SeqTupRead:  rate(t1.SeqTupRead, t2.SeqTupRead, secs),
+			IdxScan:     rate(t1.IdxScan, t2.IdxScan, secs),
+			IdxTupFetch: rate(t1.IdxTupFetch, t2.IdxTupFetch, secs),
+			NTupIns:     rate(t1.NTupIns, t2.NTupIns, secs),
+			NTupUpd:     rate(t1.NTupUpd, t2.NTupUpd, secs),
+			NTupDel:     rate(t1.NTupDel, t2.NTupDel, secs),
+			NTupHotUpd:  rate(t1.NTupHotUpd, t2.NTupHotUpd, secs),
+		})
+	}
+
+	// logical slots
+	l1, okl1 := parseLSN(s1.lsn)
+	l2, okl2 := parseLSN(s2.lsn)
+	for _, rs := range c.result.ReplicationSlots {
+		f1, ok1 := parseLSN(s1.slots[rs.SlotName])
+		f2, ok2 := parseLSN(s2.slots[rs.SlotName])
+		if !ok1 || !ok2 {
+			continue
+		}
+		sr := pgmetrics.SlotRates{
+			SlotName: rs.SlotName,
+			Flushed:  rate(f1, f2, r.Interval),
+		}
+		if okl1 && okl2 {
+			sr.LagDelta = float64((l2-f2)-(l1-f1)) / r.Interval
+		}
+		r.Slots = append(r.Slots, sr)
+	}
+
+	return r
+}
+
+// computeVacuumETA estimates the heap scan rate of in-progress vacuums that
+// were seen in both samples, and from it the time at which the scan will
+// complete.
+func (c *collector) computeVacuumETA(s1, s2 *rateSample) {
+	secs := s2.at.Sub(s1.at).Seconds()
+	if secs <= 0 {
+		return
+	}
+	for i := range c.result.VacuumProgress {
+		p := &c.result.VacuumProgress[i]
+		v1, ok1 := s1.vacuums[p.PID]
+		v2, ok2 := s2.vacuums[p.PID]
+		if !ok1 || !ok2 || v2[0] <= v1[0] {
+			continue
+		}
+		p.ScanRate = float64(v2[0]-v1[0]) / secs
+		if remaining := v2[1] - v2[0]; remaining > 0 {
+			eta := float64(remaining) / p.ScanRate
+			p.ScanETA = s2.at.Add(time.Duration(eta * float64(time.Second))).Unix()
+		}
+	}
+}
+
+// computeWALActivity fills in the WAL activity from the WAL positions and
+// statement WAL stats in the samples s1 and s2.
+func (c *collector) computeWALActivity(s1, s2 *rateSample) {
+	l1, ok1 := parseLSN(s1.lsn)
+	l2, ok2 := parseLSN(s2.lsn)
+	if !ok1 || !ok2 {
+		return
+	}
+	before, after := s1.walStmts, s2.walStmts
+	if before == nil {
+		after = nil
+	}
+	c.result.WALActivity = c.makeWALActivity(s1.lsn, s2.lsn, l2-l1,
+		s2.at.Sub(s1.at).Seconds(), before, after)
+}
+
+// parseLSN converts a textual LSN like "16/B374D848" into an integer.
+func parseLSN(s string) (int64, bool) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return 0, false
+	}
+	hi, err1 := strconv.ParseUint(parts[0], 16, 32)
+	lo, err2 := strconv.ParseUint(parts[1], 16, 32)
+	if err1 != nil || err2 != nil {
+		return 0, false
+	}
+	return int64(hi<<32 | lo), true
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collector
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net"
+	"strconv"
+	"time"
+)
+
+// openReplica connects to the standby given by CollectConfig.Replica, for
+// running the expensive queries (bloat, large objects, schema fingerprints)
+// there instead of on the server being collected from. The replica's
+// connection string is appended to the main one, so that it need only
+// specify what is different, typically the host and port. The replica must
+// belong to the same cluster as db.
+func (c *collector) openReplica(connstr string, db *sql.DB, o CollectConfig) *sql.DB {
+	rdb := c.openDB(connstr+" "+o.Replica, o)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(o.TimeoutSec)*time.Second)
+	defer cancel()
+
+	var inRecovery bool
+	var version int
+	var addr string
+	var port int
+	q := `SELECT pg_is_in_recovery(), current_setting('server_version_num')::integer,
+			COALESCE(host(inet_server_addr()), ''), COALESCE(inet_server_port(), 0)`
+	if err := rdb.QueryRowContext(ctx, q).Scan(&inRecovery, &version, &addr, &port); err != nil {
+		log.Fatalf("replica: failed to query server info: %v", err)
+	}
+	if !inRecovery {
+		log.Printf("warning: replica %s is not a standby, expensive queries will be run on a primary", o.Replica)
+	}
+
+	// check that the system identifiers match, if we can
+	if version >= 90600 {
+		q = `SELECT system_identifier FROM pg_control_system()`
+		var sysid, rsysid int64
+		if err := db.QueryRowContext(ctx, q).Scan(&sysid); err == nil {
+			if err := rdb.QueryRowContext(ctx, q).Scan(&rsysid); err != nil {
+				log.Fatalf("replica: pg_control_system() query failed: %v", err)
+			}
+			if sysid != rsysid {
+				log.Fatalf("replica %s is from a different cluster (system identifier %d, expected %d)",
+					o.Replica, rsysid, sysid)
+			}
+		}
+	}
+
+	if len(addr) > 0 {
+		c.result.Metadata.Replica = net.JoinHostPort(addr, strconv.Itoa(port))
+	} else {
+		c.result.Metadata.Replica = "local"
+	}
+	return rdb
+}
+
+// heavyDB returns the connection to run expensive queries on: the replica
+// if one was given, else the server being collected from.
+func (c *collector) heavyDB() *sql.DB {
+	if c.replica != nil {
+		return c.replica
+	}
+	return c.db
+}
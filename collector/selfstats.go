@@ -0,0 +1,153 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collector
+
+import (
+	"context"
+	"database/sql/driver"
+	"sync/atomic"
+	"time"
+
+	"github.com/rapidloop/pgmetrics"
+)
+
+// queryCounter keeps count of the queries made and the rows fetched by the
+// collector, across all connections.
+type queryCounter struct {
+	queries int64
+	rows    int64
+}
+
+// countingConnector wraps another connector, counting queries and rows
+// fetched over the connections it makes. Queries that fail are recorded in
+// qe, if it is not nil.
+type countingConnector struct {
+	qc    *queryCounter
+	qe    *queryErrors
+	inner driver.Connector
+}
+
+func (cc *countingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	cn, err := cc.inner.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{qc: cc.qc, qe: cc.qe, inner: cn}, nil
+}
+
+func (cc *countingConnector) Driver() driver.Driver {
+	return cc.inner.Driver()
+}
+
+type countingConn struct {
+	qc    *queryCounter
+	qe    *queryErrors
+	inner driver.Conn
+}
+
+func (cc *countingConn) Prepare(query string) (driver.Stmt, error) {
+	return cc.inner.Prepare(query)
+}
+
+func (cc *countingConn) Close() error {
+	return cc.inner.Close()
+}
+
+func (cc *countingConn) Begin() (driver.Tx, error) {
+	return cc.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (cc *countingConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := cc.inner.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return cc.inner.Begin()
+}
+
+func (cc *countingConn) Ping(ctx context.Context) error {
+	if p, ok := cc.inner.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (cc *countingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := cc.inner.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	atomic.AddInt64(&cc.qc.queries, 1)
+	res, err := e.ExecContext(ctx, query, args)
+	if !errorsTolerated(ctx) {
+		cc.qe.add(query, err)
+	}
+	return res, err
+}
+
+func (cc *countingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := cc.inner.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	atomic.AddInt64(&cc.qc.queries, 1)
+	qe := cc.qe
+	if errorsTolerated(ctx) {
+		qe = nil
+	}
+	rows, err := q.QueryContext(ctx, query, args)
+	if err != nil {
+		qe.add(query, err)
+		return nil, err
+	}
+	return &countingRows{qc: cc.qc, qe: qe, query: query, inner: rows}, nil
+}
+
+type countingRows struct {
+	qc    *queryCounter
+	qe    *queryErrors
+	query string
+	inner driver.Rows
+}
+
+func (r *countingRows) Columns() []string {
+	return r.inner.Columns()
+}
+
+func (r *countingRows) Close() error {
+	return r.inner.Close()
+}
+
+func (r *countingRows) Next(dest []driver.Value) error {
+	err := r.inner.Next(dest)
+	if err == nil {
+		atomic.AddInt64(&r.qc.rows, 1)
+	} else {
+		r.qe.add(r.query, err) // like a statement_timeout mid-way
+	}
+	return err
+}
+
+// fillCollectorStats records how long the collection took, and how much
+// work it was, for monitoring pgmetrics itself.
+func (c *collector) fillCollectorStats(start time.Time) {
+	c.result.Metadata.Collector = &pgmetrics.CollectorStats{
+		Duration:    time.Since(start).Seconds(),
+		Queries:     atomic.LoadInt64(&c.counter.queries),
+		RowsFetched: atomic.LoadInt64(&c.counter.rows),
+		PeakRSS:     peakRSS(),
+	}
+}
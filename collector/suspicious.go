@@ -0,0 +1,129 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collector
+
+import (
+	"regexp"
+
+	"github.com/rapidloop/pgmetrics"
+)
+
+// Patterns that are commonly seen in SQL injection attempts. These are
+// heuristics, and a match only means that the query deserves a closer look.
+var suspiciousPatterns = []struct {
+	name string
+	rx   *regexp.Regexp
+}{
+	{"pg_sleep call", regexp.MustCompile(`(?i)\bpg_sleep(?:_for|_until)?\s*\(`)},
+	{"union of constants", regexp.MustCompile(`(?i)\bunion\s+(?:all\s+)?select\s+(?:(?:null|\d+|\$\d+|'[^']*')\s*,\s*)*(?:null|\d+|\$\d+|'[^']*')\s*(?:--|;|$|\bfrom\b)`)},
+	{"union with catalog", regexp.MustCompile(`(?i)\bunion\b.*\b(?:information_schema|pg_shadow|pg_authid|pg_user|pg_roles)\b`)},
+	{"tautology", regexp.MustCompile(`(?i)\bor\s+(?:'1'\s*=\s*'1'|1\s*=\s*1\b|'a'\s*=\s*'a'|true\b)`)},
+	{"stacked query", regexp.MustCompile(`(?i);\s*(?:drop|truncate|alter|grant|copy|create\s+role)\b`)},
+}
+
+// Logged errors caused by quoting problems, which are expected when probing
+// for SQL injection.
+var rxQuoteErr = regexp.MustCompile(`^(?:unterminated quoted (?:string|identifier)|syntax error) at or near`)
+
+// A (db, user) with at least this many quoting errors in the log span is
+// reported.
+const suspiciousQuoteErrs = 5
+
+// loggedError is a statement that caused an error, as seen in the log.
+type loggedError struct {
+	db, user, query string
+	quoting         bool // was a quoting/syntax error
+}
+
+// processError remembers statements that failed, for checking later by
+// findSuspicious.
+func (c *collector) processError() {
+	e := c.currLog
+	q := e.get("STATEMENT")
+	if len(q) == 0 {
+		return
+	}
+	c.loggedErrors = append(c.loggedErrors, loggedError{
+		db:      e.db,
+		user:    e.user,
+		query:   q,
+		quoting: rxQuoteErr.MatchString(e.line),
+	})
+}
+
+// findSuspicious checks the queries seen in pg_stat_statements, current
+// activity, auto_explain plans and logged errors for suspicious patterns.
+func (c *collector) findSuspicious() {
+	add := func(source, pattern, db, user, query string, count int64) {
+		if rs := []rune(query); uint(len(rs)) > c.sqlLength {
+			query = string(rs[:c.sqlLength])
+		}
+		for i := range c.result.SuspiciousQueries {
+			s := &c.result.SuspiciousQueries[i]
+			if s.Source == source && s.Pattern == pattern && s.DBName == db &&
+				s.UserName == user && s.Query == query {
+				s.Count += count
+				return
+			}
+		}
+		c.result.SuspiciousQueries = append(c.result.SuspiciousQueries,
+			pgmetrics.SuspiciousQuery{Source: source, Pattern: pattern,
+				DBName: db, UserName: user, Query: query, Count: count})
+	}
+	check := func(source, db, user, query string, count int64) {
+		for _, p := range suspiciousPatterns {
+			if p.rx.MatchString(query) {
+				add(source, p.name, db, user, query, count)
+			}
+		}
+	}
+
+	for _, s := range c.result.Statements {
+		check("statements", s.DBName, s.UserName, s.Query, s.Calls)
+	}
+	for _, b := range c.result.Backends {
+		if b.ApplicationName != "pgmetrics" {
+			check("activity", b.DBName, b.RoleName, b.Query, 1)
+		}
+	}
+	for _, p := range c.result.Plans {
+		check("log", p.Database, p.UserName, p.Query, 1)
+	}
+
+	// quoting errors are counted per db and user, and reported with the
+	// last such statement
+	type dbUser struct{ db, user string }
+	var order []dbUser
+	quoting := make(map[dbUser]int64)
+	last := make(map[dbUser]string)
+	for _, e := range c.loggedErrors {
+		check("log", e.db, e.user, e.query, 1)
+		if e.quoting {
+			k := dbUser{e.db, e.user}
+			if _, ok := quoting[k]; !ok {
+				order = append(order, k)
+			}
+			quoting[k]++
+			last[k] = e.query
+		}
+	}
+	for _, k := range order {
+		if n := quoting[k]; n >= suspiciousQuoteErrs {
+			add("log", "quoting errors", k.db, k.user, last[k], n)
+		}
+	}
+}
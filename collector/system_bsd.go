@@ -0,0 +1,105 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collector
+
+import (
+	"encoding/binary"
+	"os"
+	"syscall"
+
+	"github.com/rapidloop/pgmetrics"
+)
+
+func (c *collector) collectSystem(o CollectConfig) {
+	c.result.System = &pgmetrics.SystemMetrics{}
+
+	// 1. disk space (bytes free/used/reserved, inodes free/used) for each tablespace
+	for i := range c.result.Tablespaces {
+		c.doStatFS(&c.result.Tablespaces[i])
+	}
+
+	// 2. cpu model, core count
+	c.getCPUs()
+
+	// 3. load average
+	c.getLoadAvg()
+
+	// 4. memory info: used, free, and whatever else the OS tells us
+	c.getMemory()
+
+	// 5. hostname
+	c.result.System.Hostname, _ = os.Hostname()
+}
+
+func (c *collector) getCPUs() {
+	if model, err := syscall.Sysctl(sysctlCPUModel); err == nil {
+		c.result.System.CPUModel = model
+	}
+	if n, err := syscall.SysctlUint32("hw.ncpu"); err == nil {
+		c.result.System.NumCores = int(n)
+	}
+}
+
+func (c *collector) getLoadAvg() {
+	// struct loadavg { fixpt_t ldavg[3]; long fscale; }
+	b, ok := sysctlRaw("vm.loadavg")
+	if !ok || len(b) < 16 {
+		return
+	}
+	var fscale uint64
+	if len(b) >= 24 { // 64-bit long, after 4 bytes of padding
+		fscale = binary.LittleEndian.Uint64(b[16:24])
+	} else {
+		fscale = uint64(binary.LittleEndian.Uint32(b[12:16]))
+	}
+	if fscale > 0 {
+		c.result.System.LoadAvg = float64(binary.LittleEndian.Uint32(b[0:4])) / float64(fscale)
+	}
+}
+
+// sysctlRaw returns the raw value of a non-string sysctl. syscall.Sysctl
+// drops a trailing NUL byte from the value, which has to be added back for
+// binary values.
+func sysctlRaw(name string) ([]byte, bool) {
+	s, err := syscall.Sysctl(name)
+	if err != nil {
+		return nil, false
+	}
+	b := []byte(s)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b, true
+}
+
+// sysctlUint64 returns the value of an integer sysctl, of 4 or 8 bytes.
+func sysctlUint64(name string) (uint64, bool) {
+	b, ok := sysctlRaw(name)
+	if !ok {
+		return 0, false
+	}
+	switch len(b) {
+	case 4:
+		return uint64(binary.LittleEndian.Uint32(b)), true
+	case 8:
+		return binary.LittleEndian.Uint64(b), true
+	}
+	return 0, false
+}
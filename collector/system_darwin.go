@@ -16,6 +16,56 @@
 
 package collector
 
-func (c *collector) collectSystem(o CollectConfig) {
-	// Not implemented for Darwin yet.
+import (
+	"encoding/binary"
+	"syscall"
+
+	"github.com/rapidloop/pgmetrics"
+)
+
+const sysctlCPUModel = "machdep.cpu.brand_string"
+
+func (c *collector) doStatFS(t *pgmetrics.Tablespace) {
+	path := t.Location
+	if len(path) == 0 {
+		return
+	}
+	var buf syscall.Statfs_t
+	if err := syscall.Statfs(path, &buf); err != nil {
+		return // ignore errors, not fatal
+	}
+	t.DiskUsed = int64(buf.Bsize) * int64(buf.Blocks-buf.Bfree)
+	t.DiskTotal = int64(buf.Bsize) * int64(buf.Blocks)
+	t.InodesUsed = int64(buf.Files - buf.Ffree)
+	t.InodesTotal = int64(buf.Files)
+}
+
+func (c *collector) getMemory() {
+	total, ok1 := sysctlUint64("hw.memsize")
+	pagesize, ok2 := sysctlUint64("hw.pagesize")
+	free, ok3 := sysctlUint64("vm.page_free_count")
+	if !ok1 || !ok2 || !ok3 {
+		return
+	}
+
+	// RAM
+	c.result.System.MemFree = int64(free * pagesize)
+	c.result.System.MemUsed = int64(total) - c.result.System.MemFree
+
+	// Swap: struct xsw_usage { u_int64_t total, avail, used; ... }
+	if b, ok := sysctlRaw("vm.swapusage"); ok && len(b) >= 24 {
+		if total := binary.LittleEndian.Uint64(b[0:8]); total > 0 {
+			c.result.System.SwapFree = int64(binary.LittleEndian.Uint64(b[8:16]))
+			c.result.System.SwapUsed = int64(binary.LittleEndian.Uint64(b[16:24]))
+		}
+	}
+}
+
+// peakRSS returns the maximum resident set size of this process, in bytes.
+func peakRSS() int64 {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0
+	}
+	return int64(ru.Maxrss) // in bytes on darwin
 }
@@ -16,6 +16,56 @@
 
 package collector
 
-func (c *collector) collectSystem(o CollectConfig) {
-	// Not implemented for FreeBSD yet.
+import (
+	"syscall"
+
+	"github.com/rapidloop/pgmetrics"
+)
+
+const sysctlCPUModel = "hw.model"
+
+func (c *collector) doStatFS(t *pgmetrics.Tablespace) {
+	path := t.Location
+	if len(path) == 0 {
+		return
+	}
+	var buf syscall.Statfs_t
+	if err := syscall.Statfs(path, &buf); err != nil {
+		return // ignore errors, not fatal
+	}
+	t.DiskUsed = int64(buf.Bsize) * int64(buf.Blocks-buf.Bfree)
+	t.DiskTotal = int64(buf.Bsize) * int64(buf.Blocks)
+	t.InodesUsed = int64(buf.Files) - buf.Ffree
+	t.InodesTotal = int64(buf.Files)
+}
+
+func (c *collector) getMemory() {
+	total, ok1 := sysctlUint64("hw.physmem")
+	pagesize, ok2 := sysctlUint64("hw.pagesize")
+	free, ok3 := sysctlUint64("vm.stats.vm.v_free_count")
+	if !ok1 || !ok2 || !ok3 {
+		return
+	}
+
+	// RAM: inactive pages are the closest to Linux's page cache
+	c.result.System.MemFree = int64(free * pagesize)
+	if inact, ok := sysctlUint64("vm.stats.vm.v_inactive_count"); ok {
+		c.result.System.MemCached = int64(inact * pagesize)
+	}
+	if bufspace, ok := sysctlUint64("vfs.bufspace"); ok {
+		c.result.System.MemBuffers = int64(bufspace)
+	}
+	c.result.System.MemUsed = int64(total) - c.result.System.MemFree -
+		c.result.System.MemCached - c.result.System.MemBuffers
+
+	// Swap is not collected, it needs kvm_getswapinfo(3).
+}
+
+// peakRSS returns the maximum resident set size of this process, in bytes.
+func peakRSS() int64 {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0
+	}
+	return int64(ru.Maxrss) * 1024 // in KiB on freebsd
 }
@@ -21,6 +21,7 @@ import (
 	"bytes"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
@@ -62,6 +63,35 @@ func (c *collector) doStatFS(t *pgmetrics.Tablespace) {
 	t.DiskTotal = int64(buf.Bsize) * int64(buf.Blocks)
 	t.InodesUsed = int64(buf.Files - buf.Ffree)
 	t.InodesTotal = int64(buf.Files)
+	t.Device = mountDevice(path)
+}
+
+// mountDevice returns the device mounted at the mount point which contains
+// the path, from /proc/self/mounts.
+func mountDevice(path string) string {
+	if p, err := filepath.EvalSymlinks(path); err == nil {
+		path = p
+	}
+	raw, err := ioutil.ReadFile("/proc/self/mounts")
+	if err != nil {
+		return ""
+	}
+	var dev, mnt string
+	for _, line := range strings.Split(string(raw), "\n") {
+		f := strings.Fields(line)
+		if len(f) < 2 {
+			continue
+		}
+		// mount points with spaces etc. are escaped as octal
+		m := strings.NewReplacer(`\040`, " ", `\011`, "\t", `\134`, `\`).Replace(f[1])
+		if len(m) < len(mnt) {
+			continue
+		}
+		if m == "/" || path == m || strings.HasPrefix(path, m+"/") {
+			dev, mnt = f[0], m
+		}
+	}
+	return dev
 }
 
 func (c *collector) getCPUs() {
@@ -138,3 +168,12 @@ func (c *collector) getMemory() {
 		}
 	}
 }
+
+// peakRSS returns the maximum resident set size of this process, in bytes.
+func peakRSS() int64 {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0
+	}
+	return int64(ru.Maxrss) * 1024 // in KiB on linux
+}
@@ -19,3 +19,7 @@ package collector
 func (c *collector) collectSystem(o CollectConfig) {
 	// Not implemented for windows yet.
 }
+
+func peakRSS() int64 {
+	return 0 // not implemented for windows yet
+}
@@ -0,0 +1,263 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pgmetrics
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Fingerprint returns a short, stable identifier for the query that does not
+// depend on the values of the constants or parameters in it. It is computed
+// from the NormalizeQuery form of the query.
+//
+// The same query, as logged (with constants) and as seen in
+// pg_stat_statements (with $n parameters), gets the same fingerprint. This is
+// used to join together the query-keyed sections of the model, like
+// Statements and Plans. It is not the same as the queryid computed by
+// Postgres, which needs the parse tree.
+func Fingerprint(query string) string {
+	n := NormalizeQuery(query)
+	if len(n) == 0 {
+		return ""
+	}
+	h := fnv.New64a()
+	h.Write([]byte(n))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// NormalizeQuery returns the query with comments removed, whitespace
+// collapsed, unquoted identifiers and keywords in lower case, and all
+// constants and parameters replaced with "?". Lists of constants, like in
+// "IN (1, 2, 3)", are collapsed into a single "?".
+func NormalizeQuery(query string) string {
+	toks := tokenizeQuery(query)
+
+	// fold signs into numeric constants, like postgres does
+	var out []string
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		if (t == "-" || t == "+") && i+1 < len(toks) && toks[i+1] == "?" &&
+			(len(out) == 0 || isOperandStart(out[len(out)-1])) {
+			continue
+		}
+		out = append(out, t)
+	}
+
+	// collapse "?, ?, ..." into "?"
+	toks, out = out, nil
+	for _, t := range toks {
+		if t == "?" && len(out) >= 2 && out[len(out)-1] == "," && out[len(out)-2] == "?" {
+			out = out[:len(out)-1] // drop the comma, skip the ?
+			continue
+		}
+		out = append(out, t)
+	}
+
+	// drop trailing semicolons
+	for len(out) > 0 && out[len(out)-1] == ";" {
+		out = out[:len(out)-1]
+	}
+	return strings.Join(out, " ")
+}
+
+// isOperandStart returns true if a constant can start after the token tok,
+// that is, a "-" following tok would be a unary minus.
+func isOperandStart(tok string) bool {
+	if tok == ")" || tok == "]" || tok == "?" {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(tok)
+	if r == '"' || isIdentRune(r) {
+		// keywords like "select", "where" etc. can precede a constant, but we
+		// can't tell them apart from identifiers without a grammar; treat
+		// only a few common ones as such
+		switch tok {
+		case "select", "where", "and", "or", "not", "then", "else", "when",
+			"values", "limit", "offset", "by", "in", "between", "like",
+			"is", "set", "return", "returning", "having", "on":
+			return true
+		}
+		return false
+	}
+	return true // punctuation or operator
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || r >= 0x80
+}
+
+func isOperatorRune(r rune) bool {
+	return strings.ContainsRune("+-*/<>=~!@#%^&|`?", r)
+}
+
+// tokenizeQuery splits the query into tokens, replacing constants with "?".
+func tokenizeQuery(q string) (toks []string) {
+	rs := []rune(q)
+	n := len(rs)
+	for i := 0; i < n; {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '-' && i+1 < n && rs[i+1] == '-': // line comment
+			for i < n && rs[i] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < n && rs[i+1] == '*': // block comment, can nest
+			depth := 0
+			for i < n {
+				if rs[i] == '/' && i+1 < n && rs[i+1] == '*' {
+					depth++
+					i += 2
+				} else if rs[i] == '*' && i+1 < n && rs[i+1] == '/' {
+					depth--
+					i += 2
+					if depth == 0 {
+						break
+					}
+				} else {
+					i++
+				}
+			}
+		case r == '\'': // string constant
+			i = skipQuoted(rs, i, '\'')
+			// drop a prefix like E'..', B'..', X'..' or N'..'
+			if k := len(toks) - 1; k >= 0 && len(toks[k]) == 1 &&
+				strings.Contains("ebxn", toks[k]) {
+				toks = toks[:k]
+			}
+			toks = append(toks, "?")
+		case r == '"': // quoted identifier, keep as is
+			j := skipQuoted(rs, i, '"')
+			toks = append(toks, string(rs[i:j]))
+			i = j
+		case r == '$' && i+1 < n && unicode.IsDigit(rs[i+1]): // parameter
+			i++
+			for i < n && unicode.IsDigit(rs[i]) {
+				i++
+			}
+			toks = append(toks, "?")
+		case r == '$': // maybe a dollar-quoted string
+			if j, ok := skipDollarQuoted(rs, i); ok {
+				toks = append(toks, "?")
+				i = j
+			} else {
+				toks = append(toks, "$")
+				i++
+			}
+		case unicode.IsDigit(r) || (r == '.' && i+1 < n && unicode.IsDigit(rs[i+1])):
+			i = skipNumber(rs, i)
+			toks = append(toks, "?")
+		case isIdentRune(r):
+			j := i
+			for j < n && (isIdentRune(rs[j]) || rs[j] == '$') {
+				j++
+			}
+			toks = append(toks, strings.ToLower(string(rs[i:j])))
+			i = j
+		case isOperatorRune(r):
+			j := i
+			for j < n && isOperatorRune(rs[j]) &&
+				!(rs[j] == '-' && j+1 < n && rs[j+1] == '-') &&
+				!(rs[j] == '/' && j+1 < n && rs[j+1] == '*') {
+				j++
+			}
+			if j == i { // starts a comment, handled in next iteration
+				j = i + 1
+			}
+			toks = append(toks, string(rs[i:j]))
+			i = j
+		case r == ':' && i+1 < n && rs[i+1] == ':':
+			toks = append(toks, "::")
+			i += 2
+		default:
+			toks = append(toks, string(r))
+			i++
+		}
+	}
+	return
+}
+
+// skipQuoted returns the index after the quoted item starting at rs[i]. A
+// doubled quote character inside is an escaped quote.
+func skipQuoted(rs []rune, i int, quote rune) int {
+	n := len(rs)
+	i++
+	for i < n {
+		if rs[i] == '\\' && quote == '\'' && i+1 < n {
+			i += 2 // backslash escapes, in E'' strings
+			continue
+		}
+		if rs[i] == quote {
+			if i+1 < n && rs[i+1] == quote {
+				i += 2
+				continue
+			}
+			return i + 1
+		}
+		i++
+	}
+	return n
+}
+
+// skipDollarQuoted returns the index after the dollar-quoted string starting
+// at rs[i], if there is one.
+func skipDollarQuoted(rs []rune, i int) (int, bool) {
+	n := len(rs)
+	j := i + 1
+	for j < n && rs[j] != '$' {
+		if !isIdentRune(rs[j]) {
+			return 0, false
+		}
+		j++
+	}
+	if j >= n {
+		return 0, false
+	}
+	tag := string(rs[i : j+1])
+	rest := string(rs[j+1:])
+	pos := strings.Index(rest, tag)
+	if pos == -1 {
+		return n, true // unterminated, consume it all
+	}
+	return j + 1 + utf8.RuneCountInString(rest[:pos]) + len([]rune(tag)), true
+}
+
+// skipNumber returns the index after the numeric constant starting at rs[i].
+func skipNumber(rs []rune, i int) int {
+	n := len(rs)
+	for i < n && (unicode.IsDigit(rs[i]) || rs[i] == '.' || rs[i] == '_') {
+		i++
+	}
+	if i < n && (rs[i] == 'e' || rs[i] == 'E') {
+		j := i + 1
+		if j < n && (rs[j] == '+' || rs[j] == '-') {
+			j++
+		}
+		if j < n && unicode.IsDigit(rs[j]) {
+			i = j
+			for i < n && unicode.IsDigit(rs[i]) {
+				i++
+			}
+		}
+	}
+	return i
+}
@@ -16,8 +16,27 @@
 
 package pgmetrics
 
+import "encoding/json"
+
 // ModelSchemaVersion is the schema version of the "Model" data structure
 // defined below. It is in the "semver" notation. Version history:
+//    1.9 - large objects, index count, standby info, timeline history,
+//				archive failures, wal activity, rates, oldest commit ts,
+//				replication origins, vacuum eta, statement plans,
+//				query fingerprints, cluster name and labels,
+//				backend query truncation, hba rules, password types,
+//				database locales, preload libraries, slot rates,
+//				xmin holders, checkpointer, io stats, wal summarizer,
+//				failed logins, suspicious queries, log hours,
+//				tablespace devices, autovacuum saturation,
+//				schema fingerprints, archived wals, backup state,
+//				matviews, collector stats, replica, health checks,
+//				redaction, archive lag, log volume, ddl events, fillfactor,
+//				field units, slot inactive since, clock skew,
+//				size and large object estimates, checkpoints,
+//				extension sizes, lock waits, diagnostics, temp files,
+//				connection churn, log error summary, statements info,
+//				statements reset, autovacuum details
 //    1.8 - AWS RDS/EnhancedMonitoring metrics, index defn,
 //				backend type counts, slab memory (linux), user agent
 //    1.7 - query execution plans, autovacuum, deadlocks, table acl
@@ -28,7 +47,7 @@ package pgmetrics
 //    1.2 - more table and index attributes
 //    1.1 - added NotificationQueueUsage and Statements
 //    1.0 - initial release
-const ModelSchemaVersion = "1.8"
+const ModelSchemaVersion = "1.9"
 
 // Model contains the entire information collected by a single run of
 // pgmetrics. It can be converted to and from json without loss of
@@ -36,8 +55,8 @@ const ModelSchemaVersion = "1.8"
 type Model struct {
 	Metadata Metadata `json:"meta"` // metadata about this object
 
-	StartTime        int64  `json:"start_time"`        // of postmaster
-	SystemIdentifier string `json:"system_identifier"` // from pg_control
+	StartTime        int64  `json:"start_time" unit:"epoch"` // of postmaster
+	SystemIdentifier string `json:"system_identifier"`       // from pg_control
 
 	// Checkpoint information
 	CheckpointLSN   string `json:"checkpoint_lsn"`
@@ -47,7 +66,7 @@ type Model struct {
 	NextXid         int    `json:"next_xid"`
 	OldestXid       int    `json:"oldest_xid"`
 	OldestActiveXid int    `json:"oldest_active_xid"`
-	CheckpointTime  int64  `json:"checkpoint_time"`
+	CheckpointTime  int64  `json:"checkpoint_time" unit:"epoch"`
 
 	// wal
 	WALFlushLSN  string `json:"wal_flush_lsn"`
@@ -59,11 +78,11 @@ type Model struct {
 	IsWalReplayPaused       bool   `json:"is_wal_replay_paused"`
 	LastWALReceiveLSN       string `json:"last_wal_receive_lsn"`
 	LastWALReplayLSN        string `json:"last_wal_replay_lsn"`
-	LastXActReplayTimestamp int64  `json:"last_xact_replay_timestamp"`
+	LastXActReplayTimestamp int64  `json:"last_xact_replay_timestamp" unit:"epoch"`
 
 	// last committed transaction (needs track_commit_timestamp = on)
 	LastXactXid       int   `json:"last_xact_xid"`
-	LastXactTimestamp int64 `json:"last_xact_time"`
+	LastXactTimestamp int64 `json:"last_xact_time" unit:"epoch"`
 
 	// wal - settings, archival stats
 	WALArchiving  WALArchiving `json:"wal_archiving"`
@@ -73,7 +92,7 @@ type Model struct {
 	// NotificationQueueUsage is the fraction of the asynchronous notification
 	// queue currently occupied. Postgres v9.6 and above only. Added in
 	// schema version 1.1.
-	NotificationQueueUsage float64 `json:"notification_queue_usage"`
+	NotificationQueueUsage float64 `json:"notification_queue_usage" unit:"fraction"`
 
 	// replication
 	ReplicationOutgoing []ReplicationOut  `json:"replication_outgoing,omitempty"`
@@ -144,6 +163,110 @@ type Model struct {
 
 	// the types of running backends and their counts
 	BackendTypeCounts map[string]int `json:"betypecounts,omitempty"`
+
+	// following fields are present only in schema 1.9 and later
+
+	// recovery prefetch stats, only for standbys, v15+
+	RecoveryPrefetch *RecoveryPrefetch `json:"recovery_prefetch,omitempty"`
+
+	// timeline switches from the history file of the current timeline
+	TimelineHistory []TimelineSwitch `json:"timeline_history,omitempty"`
+
+	// WAL archiving failures, from the log file
+	ArchiveFailures []ArchiveFailure `json:"archive_failures,omitempty"`
+
+	// WAL generation rate, measured over a short interval
+	WALActivity *WALActivity `json:"wal_activity,omitempty"`
+
+	// rates computed from two samples (--sample-interval)
+	Rates *Rates `json:"rates,omitempty"`
+
+	// oldest transaction with a commit timestamp still available, valid only
+	// if track_commit_timestamp is on
+	OldestCommitTsXid int   `json:"oldest_commit_ts_xid,omitempty"`
+	OldestCommitTs    int64 `json:"oldest_commit_ts,omitempty" unit:"epoch"`
+
+	// replication origins, from pg_replication_origin_status
+	ReplicationOrigins []ReplicationOrigin `json:"replication_origins,omitempty"`
+
+	// client authentication rules, from pg_hba_file_rules (v10+, needs
+	// superuser privileges)
+	HBARules []HBARule `json:"hba_rules,omitempty"`
+
+	// libraries listed in shared_preload_libraries
+	PreloadLibraries []PreloadLibrary `json:"preload_libraries,omitempty"`
+
+	// things that hold back the xmin horizon, oldest first
+	XminHolders []XminHolder `json:"xmin_holders,omitempty"`
+
+	// checkpointer stats, from pg_stat_checkpointer (v17+)
+	Checkpointer *Checkpointer `json:"checkpointer,omitempty"`
+
+	// cumulative I/O stats, from pg_stat_io (v16+)
+	IOStats []IOStat `json:"io_stats,omitempty"`
+
+	// state of the WAL summarizer, which enables incremental backups (v17+)
+	WALSummarizer *WALSummarizer `json:"wal_summarizer,omitempty"`
+
+	// failed login attempts, from the log file
+	FailedLogins []FailedLogin `json:"failed_logins,omitempty"`
+
+	// queries with patterns seen in SQL injection attempts, only if asked for
+	SuspiciousQueries []SuspiciousQuery `json:"suspicious_queries,omitempty"`
+
+	// counts of log entries by hour, from the log file
+	LogHours []LogHour `json:"log_hours,omitempty"`
+
+	// whether there are enough autovacuum workers, sampled during the run
+	AutovacuumSaturation *AutovacuumSaturation `json:"autovacuum_saturation,omitempty"`
+
+	// hashes of schema object definitions, only if asked for
+	SchemaFingerprints []SchemaFingerprint `json:"schema_fingerprints,omitempty"`
+
+	// WAL files archived or restored, from the log file
+	ArchivedWALs []ArchivedWAL `json:"archived_wals,omitempty"`
+
+	// backups in progress, present only if there are any
+	BackupState *BackupState `json:"backup_state,omitempty"`
+
+	// materialized views, in all collected databases
+	MatViews []MatView `json:"matviews,omitempty"`
+
+	// results of the health summary checks, only if asked for
+	HealthChecks []HealthCheck `json:"health_checks,omitempty"`
+
+	// size of the examined log span and its most frequent messages
+	LogVolume *LogVolume `json:"log_volume,omitempty"`
+
+	// DDL statements, from the log file (needs log_statement = ddl or all)
+	DDLEvents []DDLEvent `json:"ddl_events,omitempty"`
+
+	// checkpoints and restartpoints, from the log file (needs log_checkpoints)
+	Checkpoints []Checkpoint `json:"checkpoints,omitempty"`
+
+	// waits for locks longer than deadlock_timeout, from the log file (needs
+	// log_lock_waits)
+	LockWaits []LockWait `json:"lock_waits,omitempty"`
+
+	// queries that failed during the collection, if any
+	Diagnostics *Diagnostics `json:"diagnostics,omitempty"`
+
+	// temporary files created by queries, from the log file (needs
+	// log_temp_files)
+	TempFileEvents []TempFileEvent `json:"temp_file_events,omitempty"`
+
+	// connections and disconnections, from the log file (needs
+	// log_connections and log_disconnections)
+	ConnectionChurn *ConnectionChurn `json:"connection_churn,omitempty"`
+
+	// ERROR, FATAL and PANIC entries by SQLSTATE, from the log file (the
+	// SQLSTATE is known only if %e is in log_line_prefix, or for csvlog and
+	// jsonlog)
+	LogErrorSummary []LogErrorCount `json:"log_error_summary,omitempty"`
+
+	// when the statements were last reset, from pg_stat_statements_info
+	// (v14+, pg_stat_statements v1.9+)
+	StatementsInfo *StatementsInfo `json:"statements_info,omitempty"`
 }
 
 // DatabaseByOID iterates over the databases in the model and returns the reference
@@ -157,6 +280,18 @@ func (m *Model) DatabaseByOID(oid int) *Database {
 	return nil
 }
 
+// DatabaseByName iterates over the databases in the model and returns the
+// reference to a Database that has the given name. If there is no such
+// database, it returns nil.
+func (m *Model) DatabaseByName(name string) *Database {
+	for i, d := range m.Databases {
+		if d.Name == name {
+			return &m.Databases[i]
+		}
+	}
+	return nil
+}
+
 // RoleByOID iterates over the roles in the model and returns the reference
 // to a Role that has the given oid. If there is no such role, it returns nil.
 func (m *Model) RoleByOID(oid int) *Role {
@@ -206,26 +341,56 @@ func (m *Model) IndexByName(db, schema, index string) *Index {
 // Metadata contains information about how to interpret the other fields in
 // "Model" data structure.
 type Metadata struct {
-	Version      string   `json:"version"`       // schema version, "semver" format
-	At           int64    `json:"at"`            // time when this report was started
-	CollectedDBs []string `json:"collected_dbs"` // names of dbs we collected db-level stats from
-	Local        bool     `json:"local"`         // was connected to a local postgres server?
-	UserAgent    string   `json:"user_agent"`    // "pgmetrics/1.8.1"
+	Version      string   `json:"version"`         // schema version, "semver" format
+	At           int64    `json:"at" unit:"epoch"` // time when this report was started
+	CollectedDBs []string `json:"collected_dbs"`   // names of dbs we collected db-level stats from
+	Local        bool     `json:"local"`           // was connected to a local postgres server?
+	UserAgent    string   `json:"user_agent"`      // "pgmetrics/1.8.1"
+	// following fields present only in schema 1.9 and later
+	ServerRole string `json:"server_role,omitempty"` // "primary" or "standby"
+	Upstream   string `json:"upstream,omitempty"`    // host:port the standby is streaming from
+	// user-specified name and labels for this cluster (--cluster-name, --label)
+	ClusterName string            `json:"cluster_name,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	// host:port of the standby that the expensive queries were run on, or
+	// "local" if connected over a unix socket (--replica)
+	Replica string `json:"replica,omitempty"`
+	// name of the redaction profile applied to this output (--redact)
+	Redaction string `json:"redaction,omitempty"`
+	// resources used by pgmetrics itself for this collection
+	Collector *CollectorStats `json:"collector,omitempty"`
+	// time on the server's clock when this report was started, and how far
+	// ahead of the clock of the machine pgmetrics ran on it was, in seconds
+	// (negative if behind)
+	ServerAt  int64   `json:"server_at,omitempty" unit:"epoch"`
+	ClockSkew float64 `json:"clock_skew,omitempty" unit:"s"`
+	// time when pgmetrics reset pg_stat_statements after collecting from it
+	// (--reset-statements), 0 if it did not
+	StatementsReset int64 `json:"statements_reset,omitempty" unit:"epoch"`
+}
+
+// CollectorStats has information about the work done by pgmetrics itself to
+// collect the report, useful to monitor the monitoring. Added in schema 1.9.
+type CollectorStats struct {
+	Duration    float64 `json:"duration" unit:"s"`     // total time taken, in seconds
+	Queries     int64   `json:"queries"`               // number of queries made
+	RowsFetched int64   `json:"rows_fetched"`          // number of result rows fetched
+	PeakRSS     int64   `json:"peak_rss" unit:"bytes"` // max resident memory in bytes, 0 if unknown
 }
 
 type SystemMetrics struct {
-	CPUModel   string  `json:"cpu_model,omitempty"` // model of the CPU
-	NumCores   int     `json:"num_cores"`           // number of cores
-	LoadAvg    float64 `json:"loadavg"`             // 1-minute load average from the OS
-	MemUsed    int64   `json:"memused"`             // used RAM, in bytes
-	MemFree    int64   `json:"memfree"`             // free RAM, in bytes
-	MemBuffers int64   `json:"membuffers"`          // RAM used for buffers, in bytes
-	MemCached  int64   `json:"memcached"`           // RAM used for cache, in bytes
-	SwapUsed   int64   `json:"swapused"`            // used swap memory in bytes, 0 if no swap
-	SwapFree   int64   `json:"swapfree"`            // free swap memory in bytes, 0 if no swap
-	Hostname   string  `json:"hostname"`            // hostname from the OS
+	CPUModel   string  `json:"cpu_model,omitempty"`     // model of the CPU
+	NumCores   int     `json:"num_cores"`               // number of cores
+	LoadAvg    float64 `json:"loadavg"`                 // 1-minute load average from the OS
+	MemUsed    int64   `json:"memused" unit:"bytes"`    // used RAM, in bytes
+	MemFree    int64   `json:"memfree" unit:"bytes"`    // free RAM, in bytes
+	MemBuffers int64   `json:"membuffers" unit:"bytes"` // RAM used for buffers, in bytes
+	MemCached  int64   `json:"memcached" unit:"bytes"`  // RAM used for cache, in bytes
+	SwapUsed   int64   `json:"swapused" unit:"bytes"`   // used swap memory in bytes, 0 if no swap
+	SwapFree   int64   `json:"swapfree" unit:"bytes"`   // free swap memory in bytes, 0 if no swap
+	Hostname   string  `json:"hostname"`                // hostname from the OS
 	// following fields present only in schema 1.8 and later
-	MemSlab int64 `json:"memslab"` // RAM used for slab in bytes
+	MemSlab int64 `json:"memslab" unit:"bytes"` // RAM used for slab in bytes
 }
 
 type Backend struct {
@@ -234,16 +399,19 @@ type Backend struct {
 	ApplicationName string `json:"application_name"`
 	PID             int    `json:"pid"`
 	ClientAddr      string `json:"client_addr"`
-	BackendStart    int64  `json:"backend_start"`
-	XactStart       int64  `json:"xact_start"`
-	QueryStart      int64  `json:"query_start"`
-	StateChange     int64  `json:"state_change"`
+	BackendStart    int64  `json:"backend_start" unit:"epoch"`
+	XactStart       int64  `json:"xact_start" unit:"epoch"`
+	QueryStart      int64  `json:"query_start" unit:"epoch"`
+	StateChange     int64  `json:"state_change" unit:"epoch"`
 	WaitEventType   string `json:"wait_event_type"`
 	WaitEvent       string `json:"wait_event"`
 	State           string `json:"state"`
 	BackendXid      int    `json:"backend_xid"`
 	BackendXmin     int    `json:"backend_xmin"`
 	Query           string `json:"query"`
+
+	// following fields present only in schema 1.9 and later
+	QueryTruncated bool `json:"query_truncated,omitempty"` // query text was cut off at track_activity_query_size
 }
 
 type ReplicationSlot struct {
@@ -257,6 +425,9 @@ type ReplicationSlot struct {
 	RestartLSN        string `json:"restart_lsn"`
 	ConfirmedFlushLSN string `json:"confirmed_flush_lsn"`
 	Temporary         bool   `json:"temporary"`
+	// following fields present only in schema 1.9 and later
+	TwoPhase      bool  `json:"two_phase,omitempty"`                   // decoding of prepared transactions enabled, v14+
+	InactiveSince int64 `json:"inactive_since,omitempty" unit:"epoch"` // when the slot was last in use, if inactive, v17+
 }
 
 type Role struct {
@@ -270,8 +441,11 @@ type Role struct {
 	Rolreplication bool     `json:"rolreplication"`
 	Rolbypassrls   bool     `json:"rolbypassrls"`
 	Rolconnlimit   int      `json:"rolconnlimit"`
-	Rolvaliduntil  int64    `json:"rolvaliduntil"`
+	Rolvaliduntil  int64    `json:"rolvaliduntil" unit:"epoch"`
 	MemberOf       []string `json:"memberof"`
+
+	// following fields present only in schema 1.9 and later
+	PasswordType string `json:"password_type,omitempty"` // "md5", "scram-sha-256", "plain" or "none"; empty if pg_authid could not be read
 }
 
 type Tablespace struct {
@@ -279,11 +453,13 @@ type Tablespace struct {
 	Name        string `json:"name"`
 	Owner       string `json:"owner"`
 	Location    string `json:"location"`
-	Size        int64  `json:"size"`
-	DiskUsed    int64  `json:"disk_used"`
-	DiskTotal   int64  `json:"disk_total"`
+	Size        int64  `json:"size" unit:"bytes"`
+	DiskUsed    int64  `json:"disk_used" unit:"bytes"`
+	DiskTotal   int64  `json:"disk_total" unit:"bytes"`
 	InodesUsed  int64  `json:"inodes_used"`
 	InodesTotal int64  `json:"inodes_total"`
+	// following fields present only in schema 1.9 and later
+	Device string `json:"device,omitempty"` // device mounted at Location's mount point, linux only
 }
 
 type Database struct {
@@ -292,12 +468,12 @@ type Database struct {
 	DatDBA          int     `json:"datdba"`
 	DatTablespace   int     `json:"dattablespace"`
 	DatConnLimit    int     `json:"datconnlimit"`
-	AgeDatFrozenXid int     `json:"age_datfrozenxid"`
+	AgeDatFrozenXid int     `json:"age_datfrozenxid" unit:"xids"`
 	NumBackends     int     `json:"numbackends"`
 	XactCommit      int64   `json:"xact_commit"`
 	XactRollback    int64   `json:"xact_rollback"`
-	BlksRead        int64   `json:"blks_read"`
-	BlksHit         int64   `json:"blks_hit"`
+	BlksRead        int64   `json:"blks_read" unit:"blocks"`
+	BlksHit         int64   `json:"blks_hit" unit:"blocks"`
 	TupReturned     int64   `json:"tup_returned"`
 	TupFetched      int64   `json:"tup_fetched"`
 	TupInserted     int64   `json:"tup_inserted"`
@@ -305,12 +481,45 @@ type Database struct {
 	TupDeleted      int64   `json:"tup_deleted"`
 	Conflicts       int64   `json:"conflicts"`
 	TempFiles       int64   `json:"temp_files"`
-	TempBytes       int64   `json:"temp_bytes"`
+	TempBytes       int64   `json:"temp_bytes" unit:"bytes"`
 	Deadlocks       int64   `json:"deadlocks"`
-	BlkReadTime     float64 `json:"blk_read_time"`
-	BlkWriteTime    float64 `json:"blk_write_time"`
-	StatsReset      int64   `json:"stats_reset"`
-	Size            int64   `json:"size"`
+	BlkReadTime     float64 `json:"blk_read_time" unit:"ms"`
+	BlkWriteTime    float64 `json:"blk_write_time" unit:"ms"`
+	StatsReset      int64   `json:"stats_reset" unit:"epoch"`
+	Size            int64   `json:"size" unit:"bytes"`
+	// following fields present only in schema 1.9 and later
+	LOCount   int64 `json:"lo_count"`             // number of large objects, -1 if not collected
+	LOSize    int64 `json:"lo_size" unit:"bytes"` // size of pg_largeobject, -1 if not collected
+	LOOrphans int64 `json:"lo_orphans"`           // large objects not referenced by any oid/lo column, -1 if not collected
+	// LOCount and LOOrphans are estimates, from the row count of the
+	// catalog and a sample of it, as there are too many large objects
+	LOEstimated bool `json:"lo_estimated,omitempty"`
+	// recovery conflicts, from pg_stat_database_conflicts (standbys only)
+	ConflTablespace  int64 `json:"confl_tablespace,omitempty"`
+	ConflLock        int64 `json:"confl_lock,omitempty"`
+	ConflSnapshot    int64 `json:"confl_snapshot,omitempty"`
+	ConflBufferpin   int64 `json:"confl_bufferpin,omitempty"`
+	ConflDeadlock    int64 `json:"confl_deadlock,omitempty"`
+	ConflLogicalSlot int64 `json:"confl_active_logicalslot,omitempty"` // v16+
+	// encoding and locale
+	Encoding       string `json:"encoding,omitempty"`
+	Collate        string `json:"datcollate,omitempty"`
+	CType          string `json:"datctype,omitempty"`
+	LocaleProvider string `json:"locale_provider,omitempty"` // "libc", "icu" or "builtin", v15+
+	Locale         string `json:"locale,omitempty"`          // ICU or builtin provider locale, v15+
+}
+
+// UnmarshalJSON sets the large object fields to -1 if they are absent, as in
+// files from before schema 1.9, so that they read back as not collected
+// rather than as 0.
+func (d *Database) UnmarshalJSON(b []byte) error {
+	type database Database // without this method
+	v := database{LOCount: -1, LOSize: -1, LOOrphans: -1}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*d = Database(v)
+	return nil
 }
 
 type Table struct {
@@ -329,35 +538,41 @@ type Table struct {
 	NLiveTup         int64  `json:"n_live_tup"`
 	NDeadTup         int64  `json:"n_dead_tup"`
 	NModSinceAnalyze int64  `json:"n_mod_since_analyze"`
-	LastVacuum       int64  `json:"last_vacuum"`
-	LastAutovacuum   int64  `json:"last_autovacuum"`
-	LastAnalyze      int64  `json:"last_analyze"`
-	LastAutoanalyze  int64  `json:"last_autoanalyze"`
+	LastVacuum       int64  `json:"last_vacuum" unit:"epoch"`
+	LastAutovacuum   int64  `json:"last_autovacuum" unit:"epoch"`
+	LastAnalyze      int64  `json:"last_analyze" unit:"epoch"`
+	LastAutoanalyze  int64  `json:"last_autoanalyze" unit:"epoch"`
 	VacuumCount      int64  `json:"vacuum_count"`
 	AutovacuumCount  int64  `json:"autovacuum_count"`
 	AnalyzeCount     int64  `json:"analyze_count"`
 	AutoanalyzeCount int64  `json:"autoanalyze_count"`
-	HeapBlksRead     int64  `json:"heap_blks_read"`
-	HeapBlksHit      int64  `json:"heap_blks_hit"`
-	IdxBlksRead      int64  `json:"idx_blks_read"`
-	IdxBlksHit       int64  `json:"idx_blks_hit"`
-	ToastBlksRead    int64  `json:"toast_blks_read"`
-	ToastBlksHit     int64  `json:"toast_blks_hit"`
-	TidxBlksRead     int64  `json:"tidx_blks_read"`
-	TidxBlksHit      int64  `json:"tidx_blks_hit"`
-	Size             int64  `json:"size"`
-	Bloat            int64  `json:"bloat"`
+	HeapBlksRead     int64  `json:"heap_blks_read" unit:"blocks"`
+	HeapBlksHit      int64  `json:"heap_blks_hit" unit:"blocks"`
+	IdxBlksRead      int64  `json:"idx_blks_read" unit:"blocks"`
+	IdxBlksHit       int64  `json:"idx_blks_hit" unit:"blocks"`
+	ToastBlksRead    int64  `json:"toast_blks_read" unit:"blocks"`
+	ToastBlksHit     int64  `json:"toast_blks_hit" unit:"blocks"`
+	TidxBlksRead     int64  `json:"tidx_blks_read" unit:"blocks"`
+	TidxBlksHit      int64  `json:"tidx_blks_hit" unit:"blocks"`
+	Size             int64  `json:"size" unit:"bytes"`
+	Bloat            int64  `json:"bloat" unit:"bytes"`
 	// following fields present only in schema 1.2 and later
 	RelKind         string `json:"relkind"`
 	RelPersistence  string `json:"relpersistence"`
 	RelNAtts        int    `json:"relnatts"`
-	AgeRelFrozenXid int    `json:"age_relfrozenxid"`
+	AgeRelFrozenXid int    `json:"age_relfrozenxid" unit:"xids"`
 	RelIsPartition  bool   `json:"relispartition"`
 	TablespaceName  string `json:"tablespace_name"`
 	ParentName      string `json:"parent_name"`
 	PartitionCV     string `json:"partition_cv"` // partition constraint value
 	// following fields present only in schema 1.7 and later
 	ACL string `json:"acl,omitempty"`
+	// following fields present only in schema 1.9 and later
+	IndexCount int `json:"index_count"`          // number of indexes on this table
+	FillFactor int `json:"fillfactor,omitempty"` // fillfactor storage parameter, 100 if not set
+	// Size is an estimate from the page counts in pg_class, as there are too
+	// many tables to get the size of each
+	SizeEstimated bool `json:"size_estimated,omitempty"`
 }
 
 type Index struct {
@@ -370,16 +585,18 @@ type Index struct {
 	IdxScan     int64  `json:"idx_scan"`
 	IdxTupRead  int64  `json:"idx_tup_read"`
 	IdxTupFetch int64  `json:"idx_tup_fetch"`
-	IdxBlksRead int64  `json:"idx_blks_read"`
-	IdxBlksHit  int64  `json:"idx_blks_hit"`
-	Size        int64  `json:"size"`
-	Bloat       int64  `json:"bloat"`
+	IdxBlksRead int64  `json:"idx_blks_read" unit:"blocks"`
+	IdxBlksHit  int64  `json:"idx_blks_hit" unit:"blocks"`
+	Size        int64  `json:"size" unit:"bytes"`
+	Bloat       int64  `json:"bloat" unit:"bytes"`
 	// following fields present only in schema 1.2 and later
 	RelNAtts       int    `json:"relnatts"`
 	AMName         string `json:"amname"`
 	TablespaceName string `json:"tablespace_name"`
 	// following fields present only in schema 1.8 and later
 	Definition string `json:"def"`
+	// following fields present only in schema 1.9 and later
+	SizeEstimated bool `json:"size_estimated,omitempty"` // see Table.SizeEstimated
 }
 
 type Sequence struct {
@@ -387,8 +604,8 @@ type Sequence struct {
 	DBName     string `json:"db_name"`
 	SchemaName string `json:"schema_name"`
 	Name       string `json:"name"`
-	BlksRead   int64  `json:"blks_read"`
-	BlksHit    int64  `json:"blks_hit"`
+	BlksRead   int64  `json:"blks_read" unit:"blocks"`
+	BlksHit    int64  `json:"blks_hit" unit:"blocks"`
 }
 
 type UserFunction struct {
@@ -397,8 +614,8 @@ type UserFunction struct {
 	DBName     string  `json:"db_name"`
 	Name       string  `json:"name"`
 	Calls      int64   `json:"calls"`
-	TotalTime  float64 `json:"total_time"`
-	SelfTime   float64 `json:"self_time"`
+	TotalTime  float64 `json:"total_time" unit:"ms"`
+	SelfTime   float64 `json:"self_time" unit:"ms"`
 }
 
 type VacuumProgressBackend struct {
@@ -406,12 +623,22 @@ type VacuumProgressBackend struct {
 	TableOID         int    `json:"table_oid"`
 	TableName        string `json:"table_name"`
 	Phase            string `json:"phase"`
-	HeapBlksTotal    int64  `json:"heap_blks_total"`
-	HeapBlksScanned  int64  `json:"heap_blks_scanned"`
-	HeapBlksVacuumed int64  `json:"heap_blks_vacuumed"`
+	HeapBlksTotal    int64  `json:"heap_blks_total" unit:"blocks"`
+	HeapBlksScanned  int64  `json:"heap_blks_scanned" unit:"blocks"`
+	HeapBlksVacuumed int64  `json:"heap_blks_vacuumed" unit:"blocks"`
 	IndexVacuumCount int64  `json:"index_vacuum_count"`
 	MaxDeadTuples    int64  `json:"max_dead_tuples"`
 	NumDeadTuples    int64  `json:"num_dead_tuples"`
+	// following fields present only in schema 1.9 and later
+	PID      int     `json:"pid,omitempty"`
+	ScanRate float64 `json:"scan_rate,omitempty" unit:"blocks/s"` // heap blocks scanned per second, only if sampled
+	ScanETA  int64   `json:"scan_eta,omitempty" unit:"epoch"`     // estimated time when heap scan will complete, only if sampled
+	// v17+: the dead tuple store is limited by size, MaxDeadTuples is 0 and
+	// NumDeadTuples is the number of dead item ids collected
+	MaxDeadTupleBytes int64 `json:"max_dead_tuple_bytes,omitempty" unit:"bytes"`
+	DeadTupleBytes    int64 `json:"dead_tuple_bytes,omitempty" unit:"bytes"`
+	IndexesTotal      int64 `json:"indexes_total,omitempty"`
+	IndexesProcessed  int64 `json:"indexes_processed,omitempty"`
 }
 
 type Extension struct {
@@ -420,6 +647,15 @@ type Extension struct {
 	DefaultVersion   string `json:"default_version"`
 	InstalledVersion string `json:"installed_version"`
 	Comment          string `json:"comment"`
+
+	// following fields present only in schema 1.9 and later
+
+	// number of tables and materialized views that are members of the
+	// extension or are in its schemas, and their total size including
+	// indexes and toast tables; not collected if sizes are not
+	Relations     int   `json:"relations,omitempty"`
+	Size          int64 `json:"size,omitempty" unit:"bytes"`
+	SizeEstimated bool  `json:"size_estimated,omitempty"` // see Table.SizeEstimated
 }
 
 type Setting struct {
@@ -431,41 +667,46 @@ type Setting struct {
 type WALArchiving struct {
 	ArchivedCount    int    `json:"archived_count"`
 	LastArchivedWAL  string `json:"last_archived_wal"`
-	LastArchivedTime int64  `json:"last_archived_time"`
+	LastArchivedTime int64  `json:"last_archived_time" unit:"epoch"`
 	FailedCount      int    `json:"failed_count"`
 	LastFailedWAL    string `json:"last_failed_wal"`
-	LastFailedTime   int64  `json:"last_failed_time"`
-	StatsReset       int64  `json:"stats_reset"`
+	LastFailedTime   int64  `json:"last_failed_time" unit:"epoch"`
+	StatsReset       int64  `json:"stats_reset" unit:"epoch"`
+	// following fields present only in schema 1.9 and later, only on primaries
+	// with archiving on, and only if a file has been archived
+	CurrentWAL  string `json:"current_wal,omitempty"`                  // WAL file being written to
+	LagSegments int64  `json:"lag_segments,omitempty" unit:"segments"` // completed WAL files not yet archived
+	LagBytes    int64  `json:"lag_bytes,omitempty" unit:"bytes"`       // WAL written after the last archived file
 }
 
 type BGWriter struct {
 	CheckpointsTimed     int64   `json:"checkpoints_timed"`
 	CheckpointsRequested int64   `json:"checkpoints_req"`
-	CheckpointWriteTime  float64 `json:"checkpoint_write_time"`
-	CheckpointSyncTime   float64 `json:"checkpoint_sync_time"`
-	BuffersCheckpoint    int64   `json:"buffers_checkpoint"`
-	BuffersClean         int64   `json:"buffers_clean"`
+	CheckpointWriteTime  float64 `json:"checkpoint_write_time" unit:"ms"`
+	CheckpointSyncTime   float64 `json:"checkpoint_sync_time" unit:"ms"`
+	BuffersCheckpoint    int64   `json:"buffers_checkpoint" unit:"blocks"`
+	BuffersClean         int64   `json:"buffers_clean" unit:"blocks"`
 	MaxWrittenClean      int64   `json:"maxwritten_clean"`
-	BuffersBackend       int64   `json:"buffers_backend"`
+	BuffersBackend       int64   `json:"buffers_backend" unit:"blocks"`
 	BuffersBackendFsync  int64   `json:"buffers_backend_fsync"`
-	BuffersAlloc         int64   `json:"buffers_alloc"`
-	StatsReset           int64   `json:"stats_reset"`
+	BuffersAlloc         int64   `json:"buffers_alloc" unit:"blocks"`
+	StatsReset           int64   `json:"stats_reset" unit:"epoch"`
 }
 
 type ReplicationOut struct {
 	RoleName        string `json:"role_name"`
 	ApplicationName string `json:"application_name"`
 	ClientAddr      string `json:"client_addr"`
-	BackendStart    int64  `json:"backend_start"`
+	BackendStart    int64  `json:"backend_start" unit:"epoch"`
 	BackendXmin     int    `json:"backend_xmin"`
 	State           string `json:"state"`
 	SentLSN         string `json:"sent_lsn"`
 	WriteLSN        string `json:"write_lsn"`
 	FlushLSN        string `json:"flush_lsn"`
 	ReplayLSN       string `json:"replay_lsn"`
-	WriteLag        int    `json:"write_lag"`  // only in 10.x
-	FlushLag        int    `json:"flush_lag"`  // only in 10.x
-	ReplayLag       int    `json:"replay_lag"` // only in 10.x
+	WriteLag        int    `json:"write_lag" unit:"s"`  // only in 10.x
+	FlushLag        int    `json:"flush_lag" unit:"s"`  // only in 10.x
+	ReplayLag       int    `json:"replay_lag" unit:"s"` // only in 10.x
 	SyncPriority    int    `json:"sync_priority"`
 	SyncState       string `json:"sync_state"`
 	// following fields present only in schema 1.5 and later
@@ -478,13 +719,17 @@ type ReplicationIn struct {
 	ReceiveStartTLI    int    `json:"receive_start_tli"`
 	ReceivedLSN        string `json:"received_lsn"`
 	ReceivedTLI        int    `json:"received_tli"`
-	LastMsgSendTime    int64  `json:"last_msg_send_time"`
-	LastMsgReceiptTime int64  `json:"last_msg_receipt_time"`
-	Latency            int64  `json:"latency_micros"`
+	LastMsgSendTime    int64  `json:"last_msg_send_time" unit:"epoch"`
+	LastMsgReceiptTime int64  `json:"last_msg_receipt_time" unit:"epoch"`
+	Latency            int64  `json:"latency_micros" unit:"us"`
 	LatestEndLSN       string `json:"latest_end_lsn"`
-	LatestEndTime      int64  `json:"latest_end_time"`
+	LatestEndTime      int64  `json:"latest_end_time" unit:"epoch"`
 	SlotName           string `json:"slot_name"`
 	Conninfo           string `json:"conninfo"`
+	// following fields present only in schema 1.9 and later
+	WrittenLSN string `json:"written_lsn,omitempty"` // v13+, ReceivedLSN is the flushed LSN
+	SenderHost string `json:"sender_host,omitempty"` // v11+
+	SenderPort int    `json:"sender_port,omitempty"` // v11+
 }
 
 type Trigger struct {
@@ -499,30 +744,33 @@ type Trigger struct {
 // Statement represents a row of the pg_stat_statements view. Added in schema
 // version 1.1.
 type Statement struct {
-	UserOID           int     `json:"useroid"`             // OID of user who executed the statement
-	UserName          string  `json:"user"`                // Name of the user corresponding to useroid (might be empty)
-	DBOID             int     `json:"db_oid"`              // OID of database in which the statement was executed
-	DBName            string  `json:"db_name"`             // Name of the database corresponding to db_oid
-	QueryID           int64   `json:"queryid"`             // Internal hash code, computed from the statement's parse tree
-	Query             string  `json:"query"`               // Text of a representative statement
-	Calls             int64   `json:"calls"`               // Number of times executed
-	TotalTime         float64 `json:"total_time"`          // Total time spent in the statement, in milliseconds
-	MinTime           float64 `json:"min_time"`            // Minimum time spent in the statement, in milliseconds
-	MaxTime           float64 `json:"max_time"`            // Maximum time spent in the statement, in milliseconds
-	StddevTime        float64 `json:"stddev_time"`         // Population standard deviation of time spent in the statement, in milliseconds
-	Rows              int64   `json:"rows"`                // Total number of rows retrieved or affected by the statement
-	SharedBlksHit     int64   `json:"shared_blks_hit"`     // Total number of shared block cache hits by the statement
-	SharedBlksRead    int64   `json:"shared_blks_read"`    // Total number of shared blocks read by the statement
-	SharedBlksDirtied int64   `json:"shared_blks_dirtied"` // Total number of shared blocks dirtied by the statement
-	SharedBlksWritten int64   `json:"shared_blks_written"` // Total number of shared blocks written by the statement
-	LocalBlksHit      int64   `json:"local_blks_hit"`      // Total number of local block cache hits by the statement
-	LocalBlksRead     int64   `json:"local_blks_read"`     // Total number of local blocks read by the statement
-	LocalBlksDirtied  int64   `json:"local_blks_dirtied"`  // Total number of local blocks dirtied by the statement
-	LocalBlksWritten  int64   `json:"local_blks_written"`  // Total number of local blocks written by the statement
-	TempBlksRead      int64   `json:"temp_blks_read"`      // Total number of temp blocks read by the statement
-	TempBlksWritten   int64   `json:"temp_blks_written"`   // Total number of temp blocks written by the statement
-	BlkReadTime       float64 `json:"blk_read_time"`       // Total time the statement spent reading blocks, in milliseconds (if track_io_timing is enabled, otherwise zero)
-	BlkWriteTime      float64 `json:"blk_write_time"`      // Total time the statement spent writing blocks, in milliseconds (if track_io_timing is enabled, otherwise zero)
+	UserOID           int     `json:"useroid"`                           // OID of user who executed the statement
+	UserName          string  `json:"user"`                              // Name of the user corresponding to useroid (might be empty)
+	DBOID             int     `json:"db_oid"`                            // OID of database in which the statement was executed
+	DBName            string  `json:"db_name"`                           // Name of the database corresponding to db_oid
+	QueryID           int64   `json:"queryid"`                           // Internal hash code, computed from the statement's parse tree
+	Query             string  `json:"query"`                             // Text of a representative statement
+	Calls             int64   `json:"calls"`                             // Number of times executed
+	TotalTime         float64 `json:"total_time" unit:"ms"`              // Total time spent in the statement, in milliseconds
+	MinTime           float64 `json:"min_time" unit:"ms"`                // Minimum time spent in the statement, in milliseconds
+	MaxTime           float64 `json:"max_time" unit:"ms"`                // Maximum time spent in the statement, in milliseconds
+	StddevTime        float64 `json:"stddev_time" unit:"ms"`             // Population standard deviation of time spent in the statement, in milliseconds
+	Rows              int64   `json:"rows"`                              // Total number of rows retrieved or affected by the statement
+	SharedBlksHit     int64   `json:"shared_blks_hit" unit:"blocks"`     // Total number of shared block cache hits by the statement
+	SharedBlksRead    int64   `json:"shared_blks_read" unit:"blocks"`    // Total number of shared blocks read by the statement
+	SharedBlksDirtied int64   `json:"shared_blks_dirtied" unit:"blocks"` // Total number of shared blocks dirtied by the statement
+	SharedBlksWritten int64   `json:"shared_blks_written" unit:"blocks"` // Total number of shared blocks written by the statement
+	LocalBlksHit      int64   `json:"local_blks_hit" unit:"blocks"`      // Total number of local block cache hits by the statement
+	LocalBlksRead     int64   `json:"local_blks_read" unit:"blocks"`     // Total number of local blocks read by the statement
+	LocalBlksDirtied  int64   `json:"local_blks_dirtied" unit:"blocks"`  // Total number of local blocks dirtied by the statement
+	LocalBlksWritten  int64   `json:"local_blks_written" unit:"blocks"`  // Total number of local blocks written by the statement
+	TempBlksRead      int64   `json:"temp_blks_read" unit:"blocks"`      // Total number of temp blocks read by the statement
+	TempBlksWritten   int64   `json:"temp_blks_written" unit:"blocks"`   // Total number of temp blocks written by the statement
+	BlkReadTime       float64 `json:"blk_read_time" unit:"ms"`           // Total time the statement spent reading blocks, in milliseconds (if track_io_timing is enabled, otherwise zero)
+	BlkWriteTime      float64 `json:"blk_write_time" unit:"ms"`          // Total time the statement spent writing blocks, in milliseconds (if track_io_timing is enabled, otherwise zero)
+	// following fields present only in schema 1.9 and later
+	Plan        string `json:"plan,omitempty"`        // generic plan (EXPLAIN without ANALYZE, text format), only if asked for
+	Fingerprint string `json:"fingerprint,omitempty"` // see Fingerprint(), computed from the full query text
 }
 
 // Publication represents a single v10+ publication. Added in schema 1.2.
@@ -548,10 +796,10 @@ type Subscription struct {
 	WorkerCount        int    `json:"worker_count"`
 	ReceivedLSN        string `json:"received_lsn"`
 	LatestEndLSN       string `json:"latest_end_lsn"`
-	LastMsgSendTime    int64  `json:"last_msg_send_time"`
-	LastMsgReceiptTime int64  `json:"last_msg_receipt_time"`
-	LatestEndTime      int64  `json:"latest_end_time"`
-	Latency            int64  `json:"latency_micros"`
+	LastMsgSendTime    int64  `json:"last_msg_send_time" unit:"epoch"`
+	LastMsgReceiptTime int64  `json:"last_msg_receipt_time" unit:"epoch"`
+	LatestEndTime      int64  `json:"latest_end_time" unit:"epoch"`
+	Latency            int64  `json:"latency_micros" unit:"us"`
 }
 
 // Lock represents a single row from pg_locks. Added in schema 1.3.
@@ -571,17 +819,17 @@ type PgBouncer struct {
 	Stats     []PgBouncerStat     `json:"stats,omitempty"`
 	Databases []PgBouncerDatabase `json:"dbs,omitempty"`
 
-	SCActive  int     `json:"sc_active"`  // no. of active server conns
-	SCIdle    int     `json:"sc_idle"`    // no. of idle server conns
-	SCUsed    int     `json:"sc_used"`    // no. of used server conns
-	SCMaxWait float64 `json:"sc_maxwait"` // max wait time for server conns
-
-	CCActive  int     `json:"cc_active"`  // no. of active client conns
-	CCWaiting int     `json:"cc_waiting"` // no. of waiting client conns
-	CCIdle    int     `json:"cc_idle"`    // no. of idle client conns
-	CCUsed    int     `json:"cc_used"`    // no. of used client conns
-	CCMaxWait float64 `json:"cc_maxwait"` // max wait time for *waiting* client conns
-	CCAvgWait float64 `json:"cc_avgwait"` // avg wait time for *waiting* client conns
+	SCActive  int     `json:"sc_active"`           // no. of active server conns
+	SCIdle    int     `json:"sc_idle"`             // no. of idle server conns
+	SCUsed    int     `json:"sc_used"`             // no. of used server conns
+	SCMaxWait float64 `json:"sc_maxwait" unit:"s"` // max wait time for server conns
+
+	CCActive  int     `json:"cc_active"`           // no. of active client conns
+	CCWaiting int     `json:"cc_waiting"`          // no. of waiting client conns
+	CCIdle    int     `json:"cc_idle"`             // no. of idle client conns
+	CCUsed    int     `json:"cc_used"`             // no. of used client conns
+	CCMaxWait float64 `json:"cc_maxwait" unit:"s"` // max wait time for *waiting* client conns
+	CCAvgWait float64 `json:"cc_avgwait" unit:"s"` // avg wait time for *waiting* client conns
 }
 
 // PgBouncerPool contains information about one pool of PgBouncer (one row
@@ -596,7 +844,7 @@ type PgBouncerPool struct {
 	SvUsed    int     `json:"sv_used"`
 	SvTested  int     `json:"sv_tested"`
 	SvLogin   int     `json:"sv_login"`
-	MaxWait   float64 `json:"maxwait"` // seconds
+	MaxWait   float64 `json:"maxwait" unit:"s"` // seconds
 	Mode      string  `json:"pool_mode"`
 }
 
@@ -620,43 +868,563 @@ type PgBouncerStat struct {
 	Database        string  `json:"db_name"`
 	TotalXactCount  int64   `json:"total_xact_count"`
 	TotalQueryCount int64   `json:"total_query_count"`
-	TotalReceived   int64   `json:"total_received"`   // bytes
-	TotalSent       int64   `json:"total_sent"`       // bytes
-	TotalXactTime   float64 `json:"total_xact_time"`  // seconds
-	TotalQueryTime  float64 `json:"total_query_time"` // seconds
-	TotalWaitTime   float64 `json:"total_wait_time"`  // seconds
+	TotalReceived   int64   `json:"total_received" unit:"bytes"` // bytes
+	TotalSent       int64   `json:"total_sent" unit:"bytes"`     // bytes
+	TotalXactTime   float64 `json:"total_xact_time" unit:"s"`    // seconds
+	TotalQueryTime  float64 `json:"total_query_time" unit:"s"`   // seconds
+	TotalWaitTime   float64 `json:"total_wait_time" unit:"s"`    // seconds
 	AvgXactCount    int64   `json:"avg_xact_count"`
 	AvgQueryCount   int64   `json:"avg_query_count"`
-	AvgReceived     int64   `json:"avg_received"`   // bytes
-	AvgSent         int64   `json:"avg_sent"`       // bytes
-	AvgXactTime     float64 `json:"avg_xact_time"`  // seconds
-	AvgQueryTime    float64 `json:"avg_query_time"` // seconds
-	AvgWaitTime     float64 `json:"avg_wait_time"`  // seconds
+	AvgReceived     int64   `json:"avg_received" unit:"bytes"` // bytes
+	AvgSent         int64   `json:"avg_sent" unit:"bytes"`     // bytes
+	AvgXactTime     float64 `json:"avg_xact_time" unit:"s"`    // seconds
+	AvgQueryTime    float64 `json:"avg_query_time" unit:"s"`   // seconds
+	AvgWaitTime     float64 `json:"avg_wait_time" unit:"s"`    // seconds
 }
 
 // Plan represents a query execution plan. Added in schema 1.7.
 type Plan struct {
-	Database string `json:"db_name"` // might be empty
-	UserName string `json:"user"`    // might be empty
-	Format   string `json:"format"`  // text, json, yaml or xml
-	At       int64  `json:"at"`      // time when plan was logged, as seconds since epoch
-	Query    string `json:"query"`   // the sql query
-	Plan     string `json:"plan"`    // the plan as a string
+	Database string `json:"db_name"`         // might be empty
+	UserName string `json:"user"`            // might be empty
+	Format   string `json:"format"`          // text, json, yaml or xml
+	At       int64  `json:"at" unit:"epoch"` // time when plan was logged, as seconds since epoch
+	Query    string `json:"query"`           // the sql query
+	Plan     string `json:"plan"`            // the plan as a string
+	// following fields present only in schema 1.9 and later
+	Fingerprint string `json:"fingerprint,omitempty"` // see Fingerprint()
 }
 
 // AutoVacuum contains information about a single autovacuum run.
 // Added in schema 1.7.
 type AutoVacuum struct {
-	At      int64   `json:"at"`         // time when activity was logged, as seconds since epoch
-	Table   string  `json:"table_name"` // fully qualified, db.schema.table
-	Elapsed float64 `json:"elapsed"`    // in seconds
+	At      int64   `json:"at" unit:"epoch"`  // time when activity was logged, as seconds since epoch
+	Table   string  `json:"table_name"`       // fully qualified, db.schema.table
+	Elapsed float64 `json:"elapsed" unit:"s"` // in seconds
+	// following fields present only in schema 1.9 and later, and only if
+	// logged by the version of postgres
+	PagesRemoved  int64   `json:"pages_removed,omitempty" unit:"blocks"`
+	PagesRemain   int64   `json:"pages_remain,omitempty" unit:"blocks"`
+	TuplesRemoved int64   `json:"tuples_removed,omitempty"`
+	TuplesRemain  int64   `json:"tuples_remain,omitempty"`
+	TuplesDead    int64   `json:"tuples_dead,omitempty"`                  // dead but not yet removable
+	BufferHits    int64   `json:"buffer_hits,omitempty" unit:"blocks"`    // found in shared buffers
+	BufferMisses  int64   `json:"buffer_misses,omitempty" unit:"blocks"`  // read in, "reads" in v17+
+	BufferDirtied int64   `json:"buffer_dirtied,omitempty" unit:"blocks"` // dirtied by the vacuum
+	WALRecords    int64   `json:"wal_records,omitempty"`                  // v13+
+	WALFPI        int64   `json:"wal_fpi,omitempty"`                      // full page images, v13+
+	WALBytes      int64   `json:"wal_bytes,omitempty" unit:"bytes"`       // v13+
+	ReadTime      float64 `json:"read_time,omitempty" unit:"ms"`          // v14+, needs track_io_timing
+	WriteTime     float64 `json:"write_time,omitempty" unit:"ms"`         // v14+, needs track_io_timing
 }
 
 // Deadlock contains information about a single deadlock detection log.
 // Added in schema 1.7.
 type Deadlock struct {
-	At     int64  `json:"at"`     // time when activity was logged, as seconds since epoch
-	Detail string `json:"detail"` // information about the deadlocking processes
+	At     int64  `json:"at" unit:"epoch"` // time when activity was logged, as seconds since epoch
+	Detail string `json:"detail"`          // information about the deadlocking processes
+}
+
+// MatView is a materialized view. Added in schema 1.9.
+type MatView struct {
+	OID        int    `json:"oid"`
+	DBName     string `json:"db_name"`
+	SchemaName string `json:"schema_name"`
+	Name       string `json:"name"`
+	// false if it was created WITH NO DATA and not refreshed since
+	Populated bool  `json:"populated"`
+	Size      int64 `json:"size" unit:"bytes"` // total size in bytes, -1 if not collected
+	// last REFRESH MATERIALIZED VIEW seen in the log, as seconds since
+	// epoch; 0 if not seen
+	LastRefresh int64 `json:"last_refresh,omitempty" unit:"epoch"`
+}
+
+// HealthCheck is the result of evaluating one of the rules of the health
+// summary, along with the threshold used, so that other renderers can flag
+// values the same way pgmetrics does. A check fails if the value is at or
+// beyond the threshold. Yes/no checks have a value of 0 or 1 and a threshold
+// of 1. Added in schema 1.9.
+type HealthCheck struct {
+	Rule      string  `json:"rule"`              // like "connections", "xid_age"
+	Object    string  `json:"object,omitempty"`  // name of the database, tablespace etc.
+	Value     float64 `json:"value"`             // value of the metric checked
+	Threshold float64 `json:"threshold"`         // value at or beyond which it is an issue
+	Unit      string  `json:"unit,omitempty"`    // "%" or "" for counts and yes/no checks
+	Failed    bool    `json:"failed"`            // is the value at or beyond the threshold?
+	Message   string  `json:"message,omitempty"` // description of the issue, if failed
+}
+
+// BackupState has information about backups that are in progress. Added in
+// schema 1.9.
+type BackupState struct {
+	// an exclusive backup started with pg_start_backup() is in progress
+	// (primaries before v15 only)
+	ExclusiveInProgress bool  `json:"exclusive_in_progress"`
+	ExclusiveStart      int64 `json:"exclusive_start" unit:"epoch"` // when it was started, as seconds since epoch
+	// modification time of the backup_label file in the data directory, as
+	// seconds since epoch; 0 if the file is not present or if pgmetrics was
+	// not run locally
+	LabelFileTime int64 `json:"label_file_time" unit:"epoch"`
+	// base backups being streamed, from pg_stat_progress_basebackup (v13+)
+	BaseBackups []BaseBackupProgress `json:"base_backups,omitempty"`
+}
+
+// BaseBackupProgress is the progress of a base backup being streamed by a
+// WAL sender, from pg_stat_progress_basebackup. Added in schema 1.9.
+type BaseBackupProgress struct {
+	PID                 int    `json:"pid"`
+	Phase               string `json:"phase"`
+	BackupTotal         int64  `json:"backup_total" unit:"bytes"` // 0 if not being estimated
+	BackupStreamed      int64  `json:"backup_streamed" unit:"bytes"`
+	TablespacesTotal    int64  `json:"tablespaces_total"`
+	TablespacesStreamed int64  `json:"tablespaces_streamed"`
+	BackendStart        int64  `json:"backend_start" unit:"epoch"` // when the backup started, as seconds since epoch
+	ApplicationName     string `json:"application_name"`
+	ClientAddr          string `json:"client_addr"`
+}
+
+// RecoveryPrefetch contains stats about blocks prefetched during recovery,
+// from pg_stat_recovery_prefetch. Added in schema 1.9.
+type RecoveryPrefetch struct {
+	Prefetch      int64 `json:"prefetch"`                     // blocks prefetched because they were not in the buffer pool
+	Hit           int64 `json:"hit"`                          // blocks not prefetched because they were already in the buffer pool
+	SkipInit      int64 `json:"skip_init"`                    // blocks not prefetched because they would be zero-initialized
+	SkipNew       int64 `json:"skip_new"`                     // blocks not prefetched because they didn't exist yet
+	SkipFPW       int64 `json:"skip_fpw"`                     // blocks not prefetched because a full page image was included in the WAL
+	SkipRep       int64 `json:"skip_rep"`                     // blocks not prefetched because they were already recently prefetched
+	WALDistance   int   `json:"wal_distance" unit:"bytes"`    // how many bytes ahead the prefetcher is looking
+	BlockDistance int   `json:"block_distance" unit:"blocks"` // how many blocks ahead the prefetcher is looking
+	IODepth       int   `json:"io_depth"`                     // how many prefetches have been initiated but are not yet known to have completed
+	StatsReset    int64 `json:"stats_reset" unit:"epoch"`
+}
+
+// TimelineSwitch is one entry from a timeline history file, and represents
+// a switch (due to a promotion or PITR) from the timeline ParentTLI to TLI.
+// Added in schema 1.9.
+type TimelineSwitch struct {
+	ParentTLI int    `json:"parent_tli"`                // the timeline that ended
+	TLI       int    `json:"tli"`                       // the timeline that started
+	SwitchLSN string `json:"switch_lsn"`                // the LSN at which the switch happened
+	Reason    string `json:"reason"`                    // as recorded in the history file
+	At        int64  `json:"at,omitempty" unit:"epoch"` // approx. time of switch, from history file's mtime
+}
+
+// ArchiveFailure contains information about a single failure to archive a
+// WAL file, as logged by the archiver. Added in schema 1.9.
+type ArchiveFailure struct {
+	At      int64  `json:"at" unit:"epoch"`   // time when activity was logged, as seconds since epoch
+	WALFile string `json:"wal_file"`          // name of the file being archived, might be empty
+	Error   string `json:"error"`             // the logged error message
+	Command string `json:"command,omitempty"` // the failed archive command, if logged
+}
+
+// ArchivedWAL is a WAL file that was archived or restored, as seen in the log.
+// Successful archiving is logged only if log_min_messages is debug1 or lower.
+// Added in schema 1.9.
+type ArchivedWAL struct {
+	WALFile string `json:"wal_file"`
+	Op      string `json:"op"`              // "archive" or "restore"
+	At      int64  `json:"at" unit:"epoch"` // time when it was logged, as seconds since epoch
+	// seconds since the previous file was archived or restored, or since
+	// the first failure to archive this file; 0 if not known, as for the
+	// first file seen. This is the interval between archivals, including
+	// any time the archiver was idle, not the time taken by this one.
+	Interval float64 `json:"interval" unit:"s"`
+	Failures int     `json:"failures"` // logged failures to archive this file
+}
+
+// FailedLogin is a count of failed login attempts, as logged by the server,
+// for a combination of user, database, client host and reason. Added in
+// schema 1.9.
+type FailedLogin struct {
+	User     string `json:"user"`
+	Database string `json:"db_name"`
+	Host     string `json:"host,omitempty"` // needs %h or %r in log_line_prefix, unless from hba error
+	// authentication method that failed ("password", "ident", etc.) or
+	// "no hba entry"
+	Reason string `json:"reason"`
+	Count  int    `json:"count"`
+	First  int64  `json:"first" unit:"epoch"` // time of the first and last attempt, as seconds since epoch
+	Last   int64  `json:"last" unit:"epoch"`
+}
+
+// SuspiciousQuery is a query that matched one of the patterns commonly seen
+// in SQL injection attempts. Added in schema 1.9.
+type SuspiciousQuery struct {
+	Source   string `json:"source"`  // "statements", "activity" or "log"
+	Pattern  string `json:"pattern"` // name of the pattern that matched
+	DBName   string `json:"db_name"`
+	UserName string `json:"user"`
+	Query    string `json:"query"` // the query, or an example of it
+	Count    int64  `json:"count"` // number of calls or times seen
+}
+
+// LogHour has the counts of some kinds of log entries, for one hour of the
+// examined log span. Added in schema 1.9.
+type LogHour struct {
+	Hour        int64 `json:"hour" unit:"epoch"` // start of the hour, as seconds since epoch
+	Errors      int   `json:"errors"`            // entries with ERROR, FATAL or PANIC level
+	SlowQueries int   `json:"slow_queries"`      // logged durations and auto_explain plans
+	AutoVacuums int   `json:"autovacuums"`
+	Deadlocks   int   `json:"deadlocks"`
+}
+
+// StatementsInfo has information about pg_stat_statements itself, from
+// pg_stat_statements_info. Added in schema 1.9.
+type StatementsInfo struct {
+	// number of times the least-executed statements were dropped to make room
+	// for more, beyond pg_stat_statements.max
+	Dealloc    int64 `json:"dealloc"`
+	StatsReset int64 `json:"stats_reset" unit:"epoch"` // 0 if never reset
+}
+
+// LogErrorCount is the number of log entries of one level and SQLSTATE within
+// the examined log span. Entries logged without a SQLSTATE are counted by
+// their message instead, ignoring the quoted strings and numbers in it.
+// Added in schema 1.9.
+type LogErrorCount struct {
+	Level     string `json:"level"`     // ERROR, FATAL or PANIC
+	SQLState  string `json:"sqlstate"`  // empty if not logged
+	Condition string `json:"condition"` // like "unique_violation", empty if not known
+	Class     string `json:"class"`     // like "integrity_constraint_violation"
+	Count     int    `json:"count"`
+	First     int64  `json:"first" unit:"epoch"` // time when first logged, as seconds since epoch
+	Last      int64  `json:"last" unit:"epoch"`  // time when last logged, as seconds since epoch
+	Message   string `json:"message"`            // of the first entry, first line only
+}
+
+// LogVolume has the amount of logging within the examined log span, and the
+// messages logged most often. Added in schema 1.9.
+type LogVolume struct {
+	Entries     int          `json:"entries"` // log entries, each can have many lines
+	Lines       int          `json:"lines"`
+	Bytes       int64        `json:"bytes" unit:"bytes"`
+	TopMessages []LogMessage `json:"top_messages,omitempty"` // most frequent first
+}
+
+// LogMessage is a log message, normalized by replacing numbers and quoted
+// strings with "?", along with how often it was logged. Added in schema 1.9.
+type LogMessage struct {
+	Level   string `json:"level"`
+	Message string `json:"message"` // only the first line, normalized
+	Count   int    `json:"count"`
+	First   int64  `json:"first" unit:"epoch"` // time first logged, as seconds since epoch
+	Last    int64  `json:"last" unit:"epoch"`  // time last logged, as seconds since epoch
+}
+
+// DDLEvent is a DDL statement (CREATE, ALTER, DROP and so on) seen in the log
+// file. Added in schema 1.9.
+type DDLEvent struct {
+	At        int64  `json:"at" unit:"epoch"` // time when logged, as seconds since epoch
+	UserName  string `json:"user"`            // might be empty
+	Database  string `json:"db_name"`         // might be empty
+	Command   string `json:"command"`         // like "CREATE TABLE" or "DROP INDEX"
+	Statement string `json:"statement"`
+}
+
+// Checkpoint is a checkpoint (or a restartpoint, on a standby) that was seen
+// completing in the log file. The start time and reason are known only if
+// the start was also logged within the examined log span. Added in schema
+// 1.9.
+type Checkpoint struct {
+	Start        int64   `json:"start,omitempty" unit:"epoch"` // 0 if the start was not seen
+	End          int64   `json:"end" unit:"epoch"`
+	Restartpoint bool    `json:"restartpoint,omitempty"`
+	Reason       string  `json:"reason,omitempty"`              // flags logged at start, like "time" or "wal"
+	Buffers      int64   `json:"buffers"`                       // number of buffers written
+	BuffersUsage float64 `json:"buffers_usage" unit:"fraction"` // of shared_buffers
+	WALAdded     int     `json:"wal_added"`                     // number of WAL files added, removed and recycled
+	WALRemoved   int     `json:"wal_removed"`
+	WALRecycled  int     `json:"wal_recycled"`
+	WriteTime    float64 `json:"write_time" unit:"s"`
+	SyncTime     float64 `json:"sync_time" unit:"s"`
+	TotalTime    float64 `json:"total_time" unit:"s"`
+	SyncFiles    int     `json:"sync_files,omitempty"`            // number of files synced, from v9.1
+	SyncLongest  float64 `json:"sync_longest,omitempty" unit:"s"` // longest time to sync a file, from v9.1
+	Distance     int64   `json:"distance,omitempty" unit:"bytes"` // WAL since previous checkpoint, from v9.6
+}
+
+// LockWait is a wait for a lock that was logged as still going on after
+// deadlock_timeout, or as having ended with the lock being acquired. A long
+// wait usually has both. Added in schema 1.9.
+type LockWait struct {
+	At           int64   `json:"at" unit:"epoch"`         // time when logged, as seconds since epoch
+	PID          int     `json:"pid"`                     // of the waiting backend
+	Acquired     bool    `json:"acquired"`                // false if still waiting
+	Mode         string  `json:"mode"`                    // like "ShareLock" or "AccessExclusiveLock"
+	Object       string  `json:"object"`                  // as logged, like "transaction 1234"
+	Relation     string  `json:"relation,omitempty"`      // "schema.table" if the lock is on one that was collected
+	Wait         float64 `json:"wait" unit:"s"`           // time waited till then
+	BlockingPIDs []int   `json:"blocking_pids,omitempty"` // holding the lock, v9.6+
+	UserName     string  `json:"user"`                    // might be empty
+	Database     string  `json:"db_name"`                 // might be empty
+	Statement    string  `json:"statement,omitempty"`     // of the waiting backend, if logged
+}
+
+// TempFileEvent is a temporary file created by a query, like for a sort or
+// hash that did not fit in work_mem, as logged when it was deleted. Added in
+// schema 1.9.
+type TempFileEvent struct {
+	At        int64  `json:"at" unit:"epoch"`     // time when logged, as seconds since epoch
+	UserName  string `json:"user"`                // might be empty
+	Database  string `json:"db_name"`             // might be empty
+	PID       int    `json:"pid,omitempty"`       // of the backend, from the file name
+	Path      string `json:"path"`                // relative to the data directory
+	Size      int64  `json:"size" unit:"bytes"`   // final size of the file
+	Statement string `json:"statement,omitempty"` // that created the file, if logged
+}
+
+// ConnectionChurn has the number of connections and disconnections logged
+// within the examined log span, and how long the sessions lasted. Added in
+// schema 1.9.
+type ConnectionChurn struct {
+	Received int `json:"received"` // "connection received" lines, including failed connections
+	// upper bounds of the session times counted in each bucket of the
+	// histograms, in seconds, with one more bucket for longer sessions
+	Buckets []float64          `json:"buckets" unit:"s"`
+	Counts  []ConnectionCounts `json:"counts"` // by database and user
+}
+
+// ConnectionCounts is the number of connections and disconnections by a user
+// to a database, as logged. Replication connections have an empty database.
+// Added in schema 1.9.
+type ConnectionCounts struct {
+	Database       string  `json:"db_name"`
+	UserName       string  `json:"user"`
+	Connections    int     `json:"connections"` // that were authorized
+	Disconnections int     `json:"disconnections"`
+	SessionTime    float64 `json:"session_time" unit:"s"` // total, of the disconnected sessions
+	// disconnections by session time, with the buckets as in ConnectionChurn
+	Histogram []int `json:"histogram"`
+}
+
+// Diagnostics has the details of the queries that failed during the
+// collection, along with the settings that can affect them, so that problems
+// with specific server versions or configurations can be looked into.
+// Added in schema 1.9.
+type Diagnostics struct {
+	Settings   map[string]string `json:"settings"`              // like server_version_num and search_path
+	Errors     []QueryError      `json:"errors"`                // the first few failed queries
+	MoreErrors int               `json:"more_errors,omitempty"` // number of failed queries not in Errors
+}
+
+// QueryError is a query that failed during the collection. Added in schema 1.9.
+type QueryError struct {
+	At       int64  `json:"at" unit:"epoch"`    // time of failure, as seconds since epoch
+	Query    string `json:"query"`              // exactly as sent to the server
+	SQLState string `json:"sqlstate,omitempty"` // empty if the error was not from the server
+	Message  string `json:"message"`            // the primary error message
+	Detail   string `json:"detail,omitempty"`   // from the server, if any
+	Hint     string `json:"hint,omitempty"`     // from the server, if any
+}
+
+// AutovacuumSaturation compares the number of autovacuum workers seen running
+// during a run against autovacuum_max_workers. The workers are counted once
+// during the collection, and about once a second during the sample interval
+// if one was specified. Added in schema 1.9.
+type AutovacuumSaturation struct {
+	MaxWorkers  int     `json:"max_workers"`       // value of autovacuum_max_workers
+	Samples     int     `json:"samples"`           // number of times the workers were counted
+	Interval    float64 `json:"interval" unit:"s"` // seconds between the first and last samples
+	BusySamples int     `json:"busy_samples"`      // samples when all workers were running
+	PeakWorkers int     `json:"peak_workers"`      // most workers seen running
+	AvgWorkers  float64 `json:"avg_workers"`       // average workers seen running
+	// tables past their autovacuum vacuum or freeze thresholds, as per the
+	// global settings
+	TablesDue int `json:"tables_due"`
+}
+
+// SchemaFingerprint is a hash of the definition of a table, view,
+// materialized view or function. The hashes of the same object in two outputs
+// differ only if its definition has changed. Added in schema 1.9.
+type SchemaFingerprint struct {
+	DBName     string `json:"db_name"`
+	Kind       string `json:"kind"` // "table", "view", "materialized view" or "function"
+	SchemaName string `json:"schema_name"`
+	Name       string `json:"name"` // includes argument types for functions
+	Hash       string `json:"hash"` // hex-encoded SHA-256 of the definition
+}
+
+// WALActivity contains the rate at which WAL was generated, measured by
+// sampling the current WAL position twice, a short interval apart. Added in
+// schema 1.9.
+type WALActivity struct {
+	Interval    float64 `json:"interval" unit:"s"`            // seconds between the two samples
+	StartLSN    string  `json:"start_lsn"`                    // WAL position at first sample
+	EndLSN      string  `json:"end_lsn"`                      // WAL position at second sample
+	Bytes       int64   `json:"bytes" unit:"bytes"`           // bytes of WAL generated between the samples
+	BytesPerSec float64 `json:"bytes_per_sec" unit:"bytes/s"` // bytes of WAL generated per second
+	// statements that generated the most WAL between the samples, from
+	// pg_stat_statements (v13+ only)
+	TopStatements []WALStatement `json:"top_statements,omitempty"`
+}
+
+// WALStatement contains the WAL generated by a single pg_stat_statements
+// entry between the two samples of a WALActivity. Added in schema 1.9.
+type WALStatement struct {
+	UserOID    int    `json:"useroid"`                // OID of user who executed the statement
+	UserName   string `json:"user"`                   // Name of the user corresponding to useroid (might be empty)
+	DBOID      int    `json:"db_oid"`                 // OID of database in which the statement was executed
+	DBName     string `json:"db_name"`                // Name of the database corresponding to db_oid
+	QueryID    int64  `json:"queryid"`                // Internal hash code, computed from the statement's parse tree
+	Query      string `json:"query"`                  // Text of a representative statement
+	Calls      int64  `json:"calls"`                  // Number of times executed between the samples
+	WALRecords int64  `json:"wal_records"`            // WAL records generated between the samples
+	WALFPI     int64  `json:"wal_fpi"`                // WAL full page images generated between the samples
+	WALBytes   int64  `json:"wal_bytes" unit:"bytes"` // WAL bytes generated between the samples
+}
+
+// Rates contains the rates of change of various cumulative counters, computed
+// from two samples taken a specified interval apart during a single run. All
+// rates are per second. Added in schema 1.9.
+type Rates struct {
+	Interval  float64         `json:"interval" unit:"s"`        // actual seconds between the two samples
+	WALBytes  float64         `json:"wal_bytes" unit:"bytes/s"` // WAL bytes generated, primaries only
+	Databases []DatabaseRates `json:"databases,omitempty"`      // from pg_stat_database
+	Tables    []TableRates    `json:"tables,omitempty"`         // from pg_stat_user_tables
+	Slots     []SlotRates     `json:"slots,omitempty"`          // logical slots, from pg_replication_slots
+}
+
+// SlotRates contains the rate at which a logical replication slot is being
+// consumed, and the rate at which its lag is changing. Added in schema 1.9.
+type SlotRates struct {
+	SlotName string  `json:"slot_name"`
+	Flushed  float64 `json:"flushed" unit:"bytes/s"`             // bytes/sec by which confirmed_flush_lsn advanced
+	LagDelta float64 `json:"lag_delta,omitempty" unit:"bytes/s"` // bytes/sec by which the lag behind the current WAL position grew (negative if it shrank), primaries only
+}
+
+// DatabaseRates contains the per-second rates of the counters in
+// pg_stat_database for a single database. Added in schema 1.9.
+type DatabaseRates struct {
+	Name         string  `json:"name"`
+	TPS          float64 `json:"tps" unit:"1/s"` // commits + rollbacks
+	XactCommit   float64 `json:"xact_commit" unit:"1/s"`
+	XactRollback float64 `json:"xact_rollback" unit:"1/s"`
+	BlksRead     float64 `json:"blks_read" unit:"blocks/s"`
+	BlksHit      float64 `json:"blks_hit" unit:"blocks/s"`
+	TupReturned  float64 `json:"tup_returned" unit:"1/s"`
+	TupFetched   float64 `json:"tup_fetched" unit:"1/s"`
+	TupInserted  float64 `json:"tup_inserted" unit:"1/s"`
+	TupUpdated   float64 `json:"tup_updated" unit:"1/s"`
+	TupDeleted   float64 `json:"tup_deleted" unit:"1/s"`
+	Deadlocks    float64 `json:"deadlocks" unit:"1/s"`
+	Conflicts    float64 `json:"conflicts" unit:"1/s"` // recovery conflicts, standbys only
+}
+
+// TableRates contains the per-second rates of the counters in
+// pg_stat_user_tables for a single table. Added in schema 1.9.
+type TableRates struct {
+	DBName      string  `json:"db_name"`
+	SchemaName  string  `json:"schema_name"`
+	Name        string  `json:"name"`
+	SeqScan     float64 `json:"seq_scan" unit:"1/s"`
+	SeqTupRead  float64 `json:"seq_tup_read" unit:"1/s"`
+	IdxScan     float64 `json:"idx_scan" unit:"1/s"`
+	IdxTupFetch float64 `json:"idx_tup_fetch" unit:"1/s"`
+	NTupIns     float64 `json:"n_tup_ins" unit:"1/s"`
+	NTupUpd     float64 `json:"n_tup_upd" unit:"1/s"`
+	NTupDel     float64 `json:"n_tup_del" unit:"1/s"`
+	NTupHotUpd  float64 `json:"n_tup_hot_upd" unit:"1/s"`
+}
+
+// ReplicationOrigin represents a row of pg_replication_origin_status, and
+// records the replay progress of a logical replication source. Added in
+// schema 1.9.
+type ReplicationOrigin struct {
+	ID        int    `json:"id"`         // local_id
+	Name      string `json:"name"`       // external_id
+	RemoteLSN string `json:"remote_lsn"` // the origin's LSN up to which data has been replicated
+	LocalLSN  string `json:"local_lsn"`  // this node's LSN at which remote_lsn has been replicated
+}
+
+// HBARule represents a row of pg_hba_file_rules, a single client
+// authentication rule from pg_hba.conf. Added in schema 1.9.
+type HBARule struct {
+	Line       int      `json:"line"`        // line number in pg_hba.conf
+	Type       string   `json:"type"`        // local, host, hostssl etc.
+	Databases  []string `json:"databases"`   // database names or keywords
+	Users      []string `json:"users"`       // user names or keywords
+	Address    string   `json:"address"`     // host name or IP address, or keyword
+	Netmask    string   `json:"netmask"`     // IP address mask, if any
+	AuthMethod string   `json:"auth_method"` // trust, md5, scram-sha-256, cert etc.
+	Error      string   `json:"error"`       // why the line could not be processed, if any
+}
+
+// PreloadLibrary is a library listed in shared_preload_libraries. Added in
+// schema 1.9.
+type PreloadLibrary struct {
+	Name        string   `json:"name"`
+	Extension   bool     `json:"extension"`    // there is an extension of the same name
+	InstalledIn []string `json:"installed_in"` // collected databases where the extension is installed
+}
+
+// XminHolder is something that holds back the xmin horizon, which prevents
+// vacuum from removing rows deleted by transactions newer than Xmin. Added
+// in schema 1.9.
+type XminHolder struct {
+	// "standby" (hot_standby_feedback from a walsender), "slot" (xmin of a
+	// replication slot), "slot catalog" (catalog_xmin of a replication
+	// slot), "backend" (xid or xmin of a backend) or "prepared" (a prepared
+	// transaction)
+	Kind string `json:"kind"`
+	// application name of the standby, slot name, "pid (user@db)" of the
+	// backend or gid of the prepared transaction
+	Name string `json:"name"`
+	Xmin int    `json:"xmin"`
+	Age  int    `json:"age" unit:"xids"` // age of Xmin, in transactions
+}
+
+// Checkpointer contains the stats from pg_stat_checkpointer, which in v17
+// took over the checkpoint-related columns of pg_stat_bgwriter. The
+// BGWriter fields are still filled in from these values. Added in schema 1.9.
+type Checkpointer struct {
+	NumTimed               int64   `json:"num_timed"`
+	NumRequested           int64   `json:"num_requested"`
+	NumDone                int64   `json:"num_done"` // v18+
+	RestartpointsTimed     int64   `json:"restartpoints_timed"`
+	RestartpointsRequested int64   `json:"restartpoints_req"`
+	RestartpointsDone      int64   `json:"restartpoints_done"`
+	WriteTime              float64 `json:"write_time" unit:"ms"` // in milliseconds
+	SyncTime               float64 `json:"sync_time" unit:"ms"`  // in milliseconds
+	BuffersWritten         int64   `json:"buffers_written" unit:"blocks"`
+	SLRUWritten            int64   `json:"slru_written"` // v18+
+	StatsReset             int64   `json:"stats_reset" unit:"epoch"`
+}
+
+// IOStat is a row from pg_stat_io. Counts that are not applicable for the
+// combination of backend type, object and context are zero. Added in
+// schema 1.9.
+type IOStat struct {
+	BackendType   string  `json:"backend_type"`
+	Object        string  `json:"object"`
+	Context       string  `json:"context"`
+	Reads         int64   `json:"reads"`
+	ReadBytes     int64   `json:"read_bytes" unit:"bytes"`
+	ReadTime      float64 `json:"read_time" unit:"ms"` // in milliseconds
+	Writes        int64   `json:"writes"`
+	WriteBytes    int64   `json:"write_bytes" unit:"bytes"`
+	WriteTime     float64 `json:"write_time" unit:"ms"` // in milliseconds
+	Writebacks    int64   `json:"writebacks"`
+	WritebackTime float64 `json:"writeback_time" unit:"ms"` // in milliseconds
+	Extends       int64   `json:"extends"`
+	ExtendBytes   int64   `json:"extend_bytes" unit:"bytes"`
+	ExtendTime    float64 `json:"extend_time" unit:"ms"` // in milliseconds
+	Hits          int64   `json:"hits"`
+	Evictions     int64   `json:"evictions"`
+	Reuses        int64   `json:"reuses"`
+	Fsyncs        int64   `json:"fsyncs"`
+	FsyncTime     float64 `json:"fsync_time" unit:"ms"` // in milliseconds
+	StatsReset    int64   `json:"stats_reset" unit:"epoch"`
+}
+
+// WALSummarizer is the state of the WAL summarizer, from
+// pg_get_wal_summarizer_state(). Added in schema 1.9.
+type WALSummarizer struct {
+	SummarizedTLI int    `json:"summarized_tli"`
+	SummarizedLSN string `json:"summarized_lsn"`
+	PendingLSN    string `json:"pending_lsn"`
+	PID           int    `json:"pid,omitempty"` // 0 if not running
+	Summaries     int    `json:"summaries"`     // number of summary files available
+	OldestLSN     string `json:"oldest_lsn,omitempty"`
 }
 
 // RDS contains metrics collected from AWS RDS (also includes Aurora).
@@ -0,0 +1,188 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pgmetrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// PlanShape returns a short identifier for the shape of the plan, which is
+// the tree of plan nodes with their types and the tables and indexes they
+// use, but not the costs, row counts or timings. Two plans of a query with
+// different shapes mean the planner changed its mind, as in a "plan flip".
+// The format is that of Plan.Format; "xml" is not supported, and "" is
+// returned for it.
+func PlanShape(plan, format string) string {
+	var nodes []string
+	switch format {
+	case "text":
+		nodes = textPlanNodes(plan)
+	case "json":
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(plan), &obj); err != nil {
+			return ""
+		}
+		if p, ok := obj["Plan"].(map[string]interface{}); ok {
+			nodes = jsonPlanNodes(p, 0, nil)
+		}
+	case "yaml":
+		if obj, ok := parseYAMLPlan(plan).(map[string]interface{}); ok {
+			if p, ok := obj["Plan"].(map[string]interface{}); ok {
+				nodes = jsonPlanNodes(p, 0, nil)
+			}
+		}
+	}
+	if len(nodes) == 0 {
+		return ""
+	}
+	h := fnv.New64a()
+	h.Write([]byte(strings.Join(nodes, "\n")))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// textPlanNodes returns the nodes of a text format plan, like "Index Scan
+// using t_pkey on t", each prefixed with its indentation.
+func textPlanNodes(plan string) (nodes []string) {
+	for _, line := range strings.Split(plan, "\n") {
+		pos := strings.Index(line, "  (cost=")
+		if pos < 0 {
+			continue
+		}
+		line = strings.TrimLeft(line[:pos], "\t")
+		node := strings.TrimLeft(line, " ")
+		indent := line[:len(line)-len(node)]
+		nodes = append(nodes, indent+strings.TrimPrefix(node, "->  "))
+	}
+	return
+}
+
+// jsonPlanNodes appends the nodes of a json format plan to nodes, depth
+// first.
+func jsonPlanNodes(p map[string]interface{}, depth int, nodes []string) []string {
+	node := strings.Repeat(" ", depth)
+	for _, key := range []string{"Node Type", "Strategy", "Join Type", "Index Name", "Relation Name"} {
+		if v, ok := p[key].(string); ok {
+			node += " " + v
+		}
+	}
+	nodes = append(nodes, node)
+	if children, ok := p["Plans"].([]interface{}); ok {
+		for _, child := range children {
+			if c, ok := child.(map[string]interface{}); ok {
+				nodes = jsonPlanNodes(c, depth+1, nodes)
+			}
+		}
+	}
+	return nodes
+}
+
+// parseYAMLPlan parses a yaml format plan into the same values that
+// json.Unmarshal would give for the json format plan. Only the yaml written
+// by EXPLAIN is understood: block mappings and sequences, indented with
+// spaces, with scalars that are numbers, booleans or quoted like json
+// strings. Returns nil if the plan has none of these.
+func parseYAMLPlan(plan string) interface{} {
+	var lines []string
+	for _, l := range strings.Split(plan, "\n") {
+		if l = strings.TrimRight(strings.TrimPrefix(l, "\t"), " "); len(strings.TrimSpace(l)) > 0 {
+			lines = append(lines, l)
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	v, _ := yamlBlock(lines, 0, yamlIndent(lines[0]))
+	return v
+}
+
+// yamlIndent returns the number of spaces at the start of line.
+func yamlIndent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// yamlBlock parses the mapping or sequence starting at lines[i], whose
+// entries are at the given indent. It returns the value and the index of
+// the line after it.
+func yamlBlock(lines []string, i, indent int) (interface{}, int) {
+	if strings.HasPrefix(lines[i][indent:], "- ") || lines[i][indent:] == "-" {
+		var seq []interface{}
+		for i < len(lines) && yamlIndent(lines[i]) == indent && lines[i][indent] == '-' {
+			item := strings.TrimPrefix(lines[i][indent+1:], " ")
+			if !strings.Contains(item, ": ") && !strings.HasSuffix(item, ":") {
+				if len(item) == 0 && i+1 < len(lines) && yamlIndent(lines[i+1]) > indent {
+					var v interface{}
+					v, i = yamlBlock(lines, i+1, yamlIndent(lines[i+1]))
+					seq = append(seq, v)
+					continue
+				}
+				seq = append(seq, yamlScalar(item))
+				i++
+				continue
+			}
+			// a mapping, with its first entry on the line of the "-"
+			lines[i] = strings.Repeat(" ", indent+2) + item
+			var v interface{}
+			v, i = yamlBlock(lines, i, indent+2)
+			seq = append(seq, v)
+		}
+		return seq, i
+	}
+	m := make(map[string]interface{})
+	for i < len(lines) && yamlIndent(lines[i]) == indent && lines[i][indent] != '-' {
+		entry := lines[i][indent:]
+		var key, value string
+		if pos := strings.Index(entry, ": "); pos >= 0 {
+			key, value = entry[:pos], strings.TrimSpace(entry[pos+2:])
+		} else {
+			key = strings.TrimSuffix(entry, ":")
+		}
+		i++
+		if len(value) > 0 {
+			m[key] = yamlScalar(value)
+		} else if i < len(lines) && (yamlIndent(lines[i]) > indent ||
+			yamlIndent(lines[i]) == indent && lines[i][indent] == '-') {
+			m[key], i = yamlBlock(lines, i, yamlIndent(lines[i]))
+		} else {
+			m[key] = nil
+		}
+	}
+	return m, i
+}
+
+// yamlScalar returns the value of a scalar in a yaml format plan.
+func yamlScalar(s string) interface{} {
+	if strings.HasPrefix(s, `"`) {
+		var str string
+		if err := json.Unmarshal([]byte(s), &str); err == nil {
+			return str
+		}
+	}
+	switch s {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return s
+}
@@ -0,0 +1,691 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package query
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+// evalCtx is what an expression is evaluated on: a row, or if grouped, the
+// rows of a group, with row being the first of them.
+type evalCtx struct {
+	row     []interface{}
+	group   [][]interface{}
+	grouped bool
+}
+
+// aggregates are the names of the aggregate functions.
+var aggregates = map[string]bool{
+	"count": true, "sum": true, "avg": true, "min": true, "max": true,
+	"string_agg": true,
+}
+
+var errDivByZero = errors.New("division by zero")
+
+func (x *executor) eval(e expr, ctx *evalCtx) (interface{}, error) {
+	switch e := e.(type) {
+	case *literal:
+		return e.v, nil
+	case *colRef:
+		if ctx.row == nil {
+			return nil, nil
+		}
+		return ctx.row[e.idx], nil
+	case *unaryExpr:
+		v, err := x.eval(e.x, ctx)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		if e.op == "NOT" {
+			b, err := toBool(v)
+			if err != nil {
+				return nil, err
+			}
+			return !b, nil
+		}
+		switch n := v.(type) {
+		case int64:
+			return -n, nil
+		case float64:
+			return -n, nil
+		}
+		return nil, fmt.Errorf("operator - needs a number, not %s", typeName(v))
+	case *binaryExpr:
+		return x.evalBinary(e, ctx)
+	case *isNullExpr:
+		v, err := x.eval(e.x, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return (v == nil) != e.not, nil
+	case *inExpr:
+		v, err := x.eval(e.x, ctx)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		var sawNull bool
+		for _, le := range e.list {
+			lv, err := x.eval(le, ctx)
+			if err != nil {
+				return nil, err
+			}
+			if lv == nil {
+				sawNull = true
+			} else if equal(v, lv) {
+				return !e.not, nil
+			}
+		}
+		if sawNull {
+			return nil, nil
+		}
+		return e.not, nil
+	case *betweenExpr:
+		v, err := x.eval(e.x, ctx)
+		if err != nil {
+			return nil, err
+		}
+		lo, err := x.eval(e.lo, ctx)
+		if err != nil {
+			return nil, err
+		}
+		hi, err := x.eval(e.hi, ctx)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil || lo == nil || hi == nil {
+			return nil, nil
+		}
+		c1, err := compare(v, lo)
+		if err != nil {
+			return nil, err
+		}
+		c2, err := compare(v, hi)
+		if err != nil {
+			return nil, err
+		}
+		return (c1 >= 0 && c2 <= 0) != e.not, nil
+	case *caseExpr:
+		var operand interface{}
+		if e.operand != nil {
+			var err error
+			if operand, err = x.eval(e.operand, ctx); err != nil {
+				return nil, err
+			}
+		}
+		for _, w := range e.whens {
+			v, err := x.eval(w.cond, ctx)
+			if err != nil {
+				return nil, err
+			}
+			if (e.operand == nil && isTrue(v)) ||
+				(e.operand != nil && operand != nil && v != nil && equal(operand, v)) {
+				return x.eval(w.result, ctx)
+			}
+		}
+		if e.els != nil {
+			return x.eval(e.els, ctx)
+		}
+		return nil, nil
+	case *funcCall:
+		if aggregates[e.name] {
+			return x.evalAggregate(e, ctx)
+		}
+		if e.star || e.distinct {
+			return nil, fmt.Errorf("%s is not an aggregate function", e.name)
+		}
+		args := make([]interface{}, len(e.args))
+		for i, a := range e.args {
+			v, err := x.eval(a, ctx)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = v
+		}
+		return callFunc(e.name, args)
+	}
+	return nil, fmt.Errorf("unsupported expression %T", e)
+}
+
+func (x *executor) evalBinary(e *binaryExpr, ctx *evalCtx) (interface{}, error) {
+	l, err := x.eval(e.l, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// three-valued logic, without evaluating the right side if not needed
+	if e.op == "AND" || e.op == "OR" {
+		var lb bool
+		if l != nil {
+			if lb, err = toBool(l); err != nil {
+				return nil, err
+			}
+			if e.op == "AND" && !lb {
+				return false, nil
+			}
+			if e.op == "OR" && lb {
+				return true, nil
+			}
+		}
+		r, err := x.eval(e.r, ctx)
+		if err != nil {
+			return nil, err
+		}
+		var rb bool
+		if r != nil {
+			if rb, err = toBool(r); err != nil {
+				return nil, err
+			}
+		}
+		switch {
+		case e.op == "AND" && r != nil && !rb:
+			return false, nil
+		case e.op == "OR" && r != nil && rb:
+			return true, nil
+		case l == nil || r == nil:
+			return nil, nil
+		}
+		return rb, nil
+	}
+
+	r, err := x.eval(e.r, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil || r == nil {
+		return nil, nil
+	}
+	switch e.op {
+	case "=":
+		return equal(l, r), nil
+	case "<>":
+		return !equal(l, r), nil
+	case "<", "<=", ">", ">=":
+		c, err := compare(l, r)
+		if err != nil {
+			return nil, err
+		}
+		switch e.op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	case "||":
+		return Format(l) + Format(r), nil
+	case "LIKE", "ILIKE":
+		s, ok1 := l.(string)
+		pat, ok2 := r.(string)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("operator %s needs text, not %s and %s", e.op,
+				typeName(l), typeName(r))
+		}
+		return x.like(pat, e.op == "ILIKE").MatchString(s), nil
+	}
+	return arith(e.op, l, r)
+}
+
+func (x *executor) evalAggregate(f *funcCall, ctx *evalCtx) (interface{}, error) {
+	if !ctx.grouped {
+		return nil, fmt.Errorf("aggregate function %s is not allowed here", f.name)
+	}
+	if f.star {
+		if f.name != "count" {
+			return nil, fmt.Errorf("%s(*) is not valid, only count(*) is", f.name)
+		}
+		return int64(len(ctx.group)), nil
+	}
+	want := 1
+	if f.name == "string_agg" {
+		want = 2
+	}
+	if len(f.args) != want {
+		return nil, fmt.Errorf("%s needs %d argument(s)", f.name, want)
+	}
+
+	// the values that are not NULL, once each if DISTINCT
+	var vals []interface{}
+	seen := make(map[string]bool)
+	var sep string
+	for i, row := range ctx.group {
+		v, err := x.eval(f.args[0], &evalCtx{row: row})
+		if err != nil {
+			return nil, err
+		}
+		if want == 2 && i == 0 {
+			s, err := x.eval(f.args[1], &evalCtx{row: row})
+			if err != nil {
+				return nil, err
+			}
+			sep = Format(s)
+		}
+		if v == nil {
+			continue
+		}
+		if f.distinct {
+			if k := keyOf(v); seen[k] {
+				continue
+			} else {
+				seen[k] = true
+			}
+		}
+		vals = append(vals, v)
+	}
+
+	switch f.name {
+	case "count":
+		return int64(len(vals)), nil
+	case "sum", "avg":
+		if len(vals) == 0 {
+			return nil, nil
+		}
+		var sum interface{} = int64(0)
+		for _, v := range vals {
+			var err error
+			if sum, err = arith("+", sum, v); err != nil {
+				return nil, fmt.Errorf("%s needs numbers, not %s", f.name, typeName(v))
+			}
+		}
+		if f.name == "avg" {
+			return toFloat(sum) / float64(len(vals)), nil
+		}
+		return sum, nil
+	case "min", "max":
+		var best interface{}
+		for _, v := range vals {
+			if best == nil {
+				best = v
+				continue
+			}
+			c, err := compare(v, best)
+			if err != nil {
+				return nil, err
+			}
+			if (f.name == "min" && c < 0) || (f.name == "max" && c > 0) {
+				best = v
+			}
+		}
+		return best, nil
+	}
+	// string_agg
+	if len(vals) == 0 {
+		return nil, nil
+	}
+	parts := make([]string, len(vals))
+	for i, v := range vals {
+		parts[i] = Format(v)
+	}
+	return strings.Join(parts, sep), nil
+}
+
+// callFunc calls the scalar function name. Like in Postgres, most functions
+// return NULL if an argument is NULL.
+func callFunc(name string, args []interface{}) (interface{}, error) {
+	nargs := func(min, max int) error {
+		if len(args) < min || len(args) > max {
+			if min == max {
+				return fmt.Errorf("%s needs %d argument(s)", name, min)
+			}
+			return fmt.Errorf("%s needs %d to %d arguments", name, min, max)
+		}
+		return nil
+	}
+	switch name {
+	case "coalesce":
+		for _, a := range args {
+			if a != nil {
+				return a, nil
+			}
+		}
+		return nil, nil
+	case "nullif":
+		if err := nargs(2, 2); err != nil {
+			return nil, err
+		}
+		if args[0] != nil && args[1] != nil && equal(args[0], args[1]) {
+			return nil, nil
+		}
+		return args[0], nil
+	}
+
+	var err error
+	switch name {
+	case "lower", "upper", "length", "abs", "datetime", "size_pretty":
+		err = nargs(1, 1)
+	case "round":
+		err = nargs(1, 2)
+	case "substr", "substring":
+		err = nargs(2, 3)
+	case "replace":
+		err = nargs(3, 3)
+	default:
+		return nil, fmt.Errorf("function %s does not exist", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range args {
+		if a == nil {
+			return nil, nil
+		}
+	}
+
+	switch name {
+	case "lower":
+		return strings.ToLower(Format(args[0])), nil
+	case "upper":
+		return strings.ToUpper(Format(args[0])), nil
+	case "length":
+		return int64(len([]rune(Format(args[0])))), nil
+	case "abs":
+		switch n := args[0].(type) {
+		case int64:
+			if n < 0 {
+				return -n, nil
+			}
+			return n, nil
+		case float64:
+			return math.Abs(n), nil
+		}
+	case "round":
+		if !isNumber(args[0]) {
+			break
+		}
+		var places int64
+		if len(args) == 2 {
+			var ok bool
+			if places, ok = args[1].(int64); !ok {
+				return nil, fmt.Errorf("round needs an integer number of places")
+			}
+		}
+		if n, ok := args[0].(int64); ok && places >= 0 {
+			return n, nil
+		}
+		p := math.Pow(10, float64(places))
+		return math.Round(toFloat(args[0])*p) / p, nil
+	case "substr", "substring":
+		rs := []rune(Format(args[0]))
+		start, ok := args[1].(int64)
+		if !ok {
+			return nil, fmt.Errorf("%s needs an integer start", name)
+		}
+		end := int64(len(rs)) + 1
+		if len(args) == 3 {
+			n, ok := args[2].(int64)
+			if !ok || n < 0 {
+				return nil, fmt.Errorf("%s needs a non-negative integer length", name)
+			}
+			end = start + n
+		}
+		if start < 1 {
+			start = 1
+		}
+		if end > int64(len(rs))+1 {
+			end = int64(len(rs)) + 1
+		}
+		if start >= end {
+			return "", nil
+		}
+		return string(rs[start-1 : end-1]), nil
+	case "replace":
+		return strings.Replace(Format(args[0]), Format(args[1]), Format(args[2]), -1), nil
+	case "datetime":
+		// times are seconds since the epoch, with 0 meaning not set
+		if !isNumber(args[0]) {
+			break
+		}
+		secs := toFloat(args[0])
+		if secs == 0 {
+			return nil, nil
+		}
+		t := time.Unix(int64(secs), 0).UTC()
+		return t.Format("2006-01-02 15:04:05"), nil
+	case "size_pretty":
+		if !isNumber(args[0]) {
+			break
+		}
+		n := toFloat(args[0])
+		if n < 0 {
+			return "-" + humanize.IBytes(uint64(-n)), nil
+		}
+		return humanize.IBytes(uint64(n)), nil
+	}
+	return nil, fmt.Errorf("%s needs a number, not %s", name, typeName(args[0]))
+}
+
+// arith applies the arithmetic operator op to the non-NULL values. Integers
+// stay integers, except when combined with floats.
+func arith(op string, l, r interface{}) (interface{}, error) {
+	if !isNumber(l) || !isNumber(r) {
+		return nil, fmt.Errorf("operator %s needs numbers, not %s and %s", op,
+			typeName(l), typeName(r))
+	}
+	a, aok := l.(int64)
+	b, bok := r.(int64)
+	if aok && bok {
+		switch op {
+		case "+":
+			return a + b, nil
+		case "-":
+			return a - b, nil
+		case "*":
+			return a * b, nil
+		case "/", "%":
+			if b == 0 {
+				return nil, errDivByZero
+			}
+			if op == "/" {
+				return a / b, nil
+			}
+			return a % b, nil
+		}
+	}
+	fa, fb := toFloat(l), toFloat(r)
+	switch op {
+	case "+":
+		return fa + fb, nil
+	case "-":
+		return fa - fb, nil
+	case "*":
+		return fa * fb, nil
+	}
+	if fb == 0 {
+		return nil, errDivByZero
+	}
+	if op == "/" {
+		return fa / fb, nil
+	}
+	return math.Mod(fa, fb), nil
+}
+
+// compare returns -1, 0 or 1 as a is less than, equal to or greater than b,
+// which are not NULL and are both numbers, strings or booleans.
+func compare(a, b interface{}) (int, error) {
+	switch {
+	case isNumber(a) && isNumber(b):
+		ai, aok := a.(int64)
+		bi, bok := b.(int64)
+		if aok && bok {
+			return cmpInt(ai, bi), nil
+		}
+		fa, fb := toFloat(a), toFloat(b)
+		switch {
+		case fa < fb:
+			return -1, nil
+		case fa > fb:
+			return 1, nil
+		}
+		return 0, nil
+	}
+	switch av := a.(type) {
+	case string:
+		if bv, ok := b.(string); ok {
+			return strings.Compare(av, bv), nil
+		}
+	case bool:
+		if bv, ok := b.(bool); ok {
+			switch {
+			case av == bv:
+				return 0, nil
+			case bv:
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %s with %s", typeName(a), typeName(b))
+}
+
+func cmpInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// equal returns true if the non-NULL values are equal. Values of different
+// types are not equal, except integers and floats.
+func equal(a, b interface{}) bool {
+	c, err := compare(a, b)
+	return err == nil && c == 0
+}
+
+// keyOf returns a string that is the same for values that are equal, and
+// for NULLs.
+func keyOf(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return "z"
+	case int64:
+		return "n" + strconv.FormatInt(x, 10)
+	case float64:
+		if x == math.Trunc(x) && math.Abs(x) < 1e18 {
+			return "n" + strconv.FormatInt(int64(x), 10)
+		}
+		return "f" + strconv.FormatFloat(x, 'g', -1, 64)
+	case string:
+		return "s" + x
+	case bool:
+		if x {
+			return "t"
+		}
+		return "f"
+	}
+	return fmt.Sprint(v)
+}
+
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case int64, float64:
+		return true
+	}
+	return false
+}
+
+func toFloat(v interface{}) float64 {
+	switch x := v.(type) {
+	case int64:
+		return float64(x)
+	case float64:
+		return x
+	}
+	return 0
+}
+
+func toBool(v interface{}) (bool, error) {
+	switch x := v.(type) {
+	case bool:
+		return x, nil
+	case int64:
+		return x != 0, nil
+	case float64:
+		return x != 0, nil
+	}
+	return false, fmt.Errorf("expected a boolean, not %s", typeName(v))
+}
+
+// isTrue returns true if v is true, as needed for a row to be selected.
+func isTrue(v interface{}) bool {
+	b, err := toBool(v)
+	return err == nil && b
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case int64, float64:
+		return "number"
+	case string:
+		return "text"
+	case bool:
+		return "boolean"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// like returns the regexp for the LIKE pattern, where % matches any number
+// of characters, _ matches one and \ escapes the next character.
+func (x *executor) like(pat string, fold bool) *regexp.Regexp {
+	key := "c" + pat
+	if fold {
+		key = "i" + pat
+	}
+	if re, ok := x.likes[key]; ok {
+		return re
+	}
+	if x.likes == nil {
+		x.likes = make(map[string]*regexp.Regexp)
+	}
+	var b strings.Builder
+	b.WriteString("(?s)")
+	if fold {
+		b.WriteString("(?i)")
+	}
+	b.WriteString("^")
+	rs := []rune(pat)
+	for i := 0; i < len(rs); i++ {
+		switch c := rs[i]; {
+		case c == '\\' && i+1 < len(rs):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(rs[i])))
+		case c == '%':
+			b.WriteString(".*")
+		case c == '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	re := regexp.MustCompile(b.String())
+	x.likes[key] = re
+	return re
+}
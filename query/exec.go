@@ -0,0 +1,618 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// executor runs a statement against the tables of a DB.
+type executor struct {
+	db    *DB
+	scope []scopeColumn             // columns of the rows of the FROM clause
+	likes map[string]*regexp.Regexp // LIKE patterns, compiled
+}
+
+type scopeColumn struct {
+	table, name string
+}
+
+// output is a row of the result, with the values to sort it by.
+type output struct {
+	row  []interface{}
+	keys []interface{}
+}
+
+func (x *executor) run(s *selectStmt) (*Result, error) {
+	rows, err := x.from(s.from)
+	if err != nil {
+		return nil, err
+	}
+
+	// the columns of the result
+	res := &Result{}
+	var items []selectItem // with the stars expanded
+	for _, item := range s.items {
+		if !item.star {
+			items = append(items, item)
+			res.Columns = append(res.Columns, itemName(item))
+			continue
+		}
+		found := false
+		for i, c := range x.scope {
+			if len(item.table) == 0 || c.table == item.table {
+				items = append(items, selectItem{e: &colRef{table: c.table, name: c.name, idx: i}})
+				res.Columns = append(res.Columns, c.name)
+				found = true
+			}
+		}
+		if !found && len(item.table) > 0 {
+			return nil, fmt.Errorf("missing FROM entry for table %q", item.table)
+		} else if !found {
+			return nil, fmt.Errorf("SELECT * with no tables specified")
+		}
+	}
+
+	// resolve the columns, with ORDER BY and GROUP BY able to use the
+	// aliases and numbers of the result columns
+	for _, item := range items {
+		if err := x.resolve(item.e); err != nil {
+			return nil, err
+		}
+	}
+	resultColumn := func(e expr, clause string) (expr, error) {
+		if l, ok := e.(*literal); ok {
+			if n, ok := l.v.(int64); ok {
+				if n < 1 || int(n) > len(items) {
+					return nil, fmt.Errorf("%s position %d is not in select list", clause, n)
+				}
+				return items[n-1].e, nil
+			}
+		}
+		if c, ok := e.(*colRef); ok && len(c.table) == 0 && !x.inScope(c.name) {
+			for _, item := range items {
+				if item.alias == c.name {
+					return item.e, nil
+				}
+			}
+		}
+		return e, nil
+	}
+	for i := range s.groupBy {
+		if s.groupBy[i], err = resultColumn(s.groupBy[i], "GROUP BY"); err != nil {
+			return nil, err
+		}
+	}
+	for i := range s.orderBy {
+		if s.orderBy[i].e, err = resultColumn(s.orderBy[i].e, "ORDER BY"); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range []expr{s.where, s.having} {
+		if err := x.resolve(e); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range s.groupBy {
+		if err := x.resolve(e); err != nil {
+			return nil, err
+		}
+	}
+	for _, o := range s.orderBy {
+		if err := x.resolve(o.e); err != nil {
+			return nil, err
+		}
+	}
+	if s.where != nil && hasAggregate(s.where) {
+		return nil, fmt.Errorf("aggregate functions are not allowed in WHERE")
+	}
+
+	// filter
+	if s.where != nil {
+		var kept [][]interface{}
+		for _, row := range rows {
+			v, err := x.eval(s.where, &evalCtx{row: row})
+			if err != nil {
+				return nil, err
+			}
+			if isTrue(v) {
+				kept = append(kept, row)
+			}
+		}
+		rows = kept
+	}
+
+	// the contexts to compute the result rows in: each row, or each group
+	var ctxs []*evalCtx
+	grouped := len(s.groupBy) > 0 || (s.having != nil && hasAggregate(s.having))
+	for _, item := range items {
+		grouped = grouped || hasAggregate(item.e)
+	}
+	for _, o := range s.orderBy {
+		grouped = grouped || hasAggregate(o.e)
+	}
+	if grouped {
+		// like Postgres, columns outside of aggregates must be grouped by
+		check := []expr{s.having}
+		for _, item := range items {
+			check = append(check, item.e)
+		}
+		for _, o := range s.orderBy {
+			check = append(check, o.e)
+		}
+		for _, e := range check {
+			if err := x.checkGrouped(e, s.groupBy); err != nil {
+				return nil, err
+			}
+		}
+		index := make(map[string]int)
+		for _, row := range rows {
+			var key strings.Builder
+			for _, e := range s.groupBy {
+				v, err := x.eval(e, &evalCtx{row: row})
+				if err != nil {
+					return nil, err
+				}
+				key.WriteString(keyOf(v))
+				key.WriteByte(0)
+			}
+			i, ok := index[key.String()]
+			if !ok {
+				i = len(ctxs)
+				index[key.String()] = i
+				ctxs = append(ctxs, &evalCtx{row: row, grouped: true})
+			}
+			ctxs[i].group = append(ctxs[i].group, row)
+		}
+		if len(ctxs) == 0 && len(s.groupBy) == 0 {
+			ctxs = append(ctxs, &evalCtx{grouped: true}) // aggregates of no rows
+		}
+		if s.having != nil {
+			var kept []*evalCtx
+			for _, ctx := range ctxs {
+				v, err := x.eval(s.having, ctx)
+				if err != nil {
+					return nil, err
+				}
+				if isTrue(v) {
+					kept = append(kept, ctx)
+				}
+			}
+			ctxs = kept
+		}
+	} else {
+		if s.having != nil {
+			return nil, fmt.Errorf("HAVING needs GROUP BY or aggregate functions")
+		}
+		if len(s.from) == 0 {
+			rows = [][]interface{}{nil}
+		}
+		for _, row := range rows {
+			ctxs = append(ctxs, &evalCtx{row: row})
+		}
+	}
+
+	// compute the result rows and their sort keys
+	outs := make([]output, 0, len(ctxs))
+	seen := make(map[string]bool)
+	for _, ctx := range ctxs {
+		o := output{row: make([]interface{}, len(items))}
+		for i, item := range items {
+			v, err := x.eval(item.e, ctx)
+			if err != nil {
+				return nil, err
+			}
+			o.row[i] = v
+		}
+		if s.distinct {
+			var key strings.Builder
+			for _, v := range o.row {
+				key.WriteString(keyOf(v))
+				key.WriteByte(0)
+			}
+			if seen[key.String()] {
+				continue
+			}
+			seen[key.String()] = true
+		}
+		for _, ob := range s.orderBy {
+			v, err := x.eval(ob.e, ctx)
+			if err != nil {
+				return nil, err
+			}
+			o.keys = append(o.keys, v)
+		}
+		outs = append(outs, o)
+	}
+
+	// sort, with NULLs last in ascending order, like Postgres
+	if len(s.orderBy) > 0 {
+		var sortErr error
+		sort.SliceStable(outs, func(i, j int) bool {
+			for k, ob := range s.orderBy {
+				a, b := outs[i].keys[k], outs[j].keys[k]
+				var c int
+				switch {
+				case a == nil && b == nil:
+					continue
+				case a == nil:
+					c = 1
+				case b == nil:
+					c = -1
+				default:
+					var err error
+					if c, err = compare(a, b); err != nil && sortErr == nil {
+						sortErr = err
+					}
+				}
+				if c == 0 {
+					continue
+				}
+				if ob.desc {
+					return c > 0
+				}
+				return c < 0
+			}
+			return false
+		})
+		if sortErr != nil {
+			return nil, sortErr
+		}
+	}
+
+	// offset and limit
+	if s.offset != nil {
+		n, err := x.count(s.offset, "OFFSET")
+		if err != nil {
+			return nil, err
+		}
+		if n > len(outs) {
+			n = len(outs)
+		}
+		outs = outs[n:]
+	}
+	if s.limit != nil {
+		n, err := x.count(s.limit, "LIMIT")
+		if err != nil {
+			return nil, err
+		}
+		if n < len(outs) {
+			outs = outs[:n]
+		}
+	}
+
+	res.Rows = make([][]interface{}, len(outs))
+	for i, o := range outs {
+		res.Rows[i] = o.row
+	}
+	return res, nil
+}
+
+// from returns the rows of the FROM clause, which have the values of the
+// columns in x.scope.
+func (x *executor) from(items []fromItem) ([][]interface{}, error) {
+	var rows [][]interface{}
+	for i, f := range items {
+		t := x.table(f.table)
+		if t == nil {
+			return nil, fmt.Errorf("table %q does not exist", f.table)
+		}
+		for _, prev := range items[:i] {
+			if prev.alias == f.alias {
+				return nil, fmt.Errorf("table name %q specified more than once", f.alias)
+			}
+		}
+		left := len(x.scope)
+		for _, c := range t.Columns {
+			x.scope = append(x.scope, scopeColumn{table: f.alias, name: c})
+		}
+		if i == 0 {
+			rows = t.Rows
+			continue
+		}
+		if err := x.resolve(f.on); err != nil {
+			return nil, err
+		}
+		if f.on != nil && hasAggregate(f.on) {
+			return nil, fmt.Errorf("aggregate functions are not allowed in JOIN conditions")
+		}
+		var err error
+		if rows, err = x.join(rows, t.Rows, left, f); err != nil {
+			return nil, err
+		}
+	}
+	return rows, nil
+}
+
+// join joins the rows so far with those of a table, whose columns start at
+// left in the scope. If the condition is or includes the equality of a
+// column of each side, the rows of the table are looked up by that column
+// instead of being scanned for each row.
+func (x *executor) join(rows, trows [][]interface{}, left int, f fromItem) ([][]interface{}, error) {
+	li, ri := -1, -1
+	for _, e := range conjuncts(f.on) {
+		if b, ok := e.(*binaryExpr); ok && b.op == "=" {
+			l, lok := b.l.(*colRef)
+			r, rok := b.r.(*colRef)
+			if lok && rok {
+				if l.idx >= left && r.idx < left {
+					l, r = r, l
+				}
+				if l.idx < left && r.idx >= left {
+					li, ri = l.idx, r.idx-left
+					break
+				}
+			}
+		}
+	}
+	var lookup map[string][]int
+	if li >= 0 {
+		lookup = make(map[string][]int)
+		for j, tr := range trows {
+			if tr[ri] != nil {
+				k := keyOf(tr[ri])
+				lookup[k] = append(lookup[k], j)
+			}
+		}
+	}
+
+	var out [][]interface{}
+	width := len(x.scope)
+	for _, row := range rows {
+		matched := false
+		try := func(tr []interface{}) error {
+			joined := make([]interface{}, 0, width)
+			joined = append(append(joined, row...), tr...)
+			if f.on != nil {
+				v, err := x.eval(f.on, &evalCtx{row: joined})
+				if err != nil {
+					return err
+				}
+				if !isTrue(v) {
+					return nil
+				}
+			}
+			matched = true
+			out = append(out, joined)
+			return nil
+		}
+		if lookup != nil {
+			if row[li] != nil {
+				for _, j := range lookup[keyOf(row[li])] {
+					if err := try(trows[j]); err != nil {
+						return nil, err
+					}
+				}
+			}
+		} else {
+			for _, tr := range trows {
+				if err := try(tr); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if !matched && f.join == "LEFT" {
+			out = append(out, append(append(make([]interface{}, 0, width), row...),
+				make([]interface{}, width-left)...))
+		}
+	}
+	return out, nil
+}
+
+func (x *executor) table(name string) *Table {
+	if t, ok := x.db.tables[name]; ok {
+		return t
+	}
+	return x.db.tables[strings.ToLower(name)]
+}
+
+func (x *executor) inScope(name string) bool {
+	for _, c := range x.scope {
+		if c.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve sets the index in the row of the columns used in e.
+func (x *executor) resolve(e expr) (err error) {
+	walk(e, func(e expr) {
+		c, ok := e.(*colRef)
+		if !ok || err != nil {
+			return
+		}
+		c.idx = -1
+		for i, sc := range x.scope {
+			if sc.name == c.name && (len(c.table) == 0 || sc.table == c.table) {
+				if c.idx >= 0 {
+					err = fmt.Errorf("column reference %q is ambiguous", c.name)
+					return
+				}
+				c.idx = i
+			}
+		}
+		if c.idx < 0 {
+			if len(c.table) > 0 {
+				err = fmt.Errorf("column %s.%s does not exist", c.table, c.name)
+			} else {
+				err = fmt.Errorf("column %q does not exist", c.name)
+			}
+		}
+	})
+	return
+}
+
+// count evaluates the LIMIT or OFFSET.
+func (x *executor) count(e expr, what string) (int, error) {
+	v, err := x.eval(e, &evalCtx{})
+	if err != nil {
+		return 0, err
+	}
+	n, ok := v.(int64)
+	if !ok || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", what)
+	}
+	return int(n), nil
+}
+
+func itemName(item selectItem) string {
+	if len(item.alias) > 0 {
+		return item.alias
+	}
+	switch e := item.e.(type) {
+	case *colRef:
+		return e.name
+	case *funcCall:
+		return e.name
+	}
+	return "?column?"
+}
+
+// conjuncts returns the expressions that are ANDed together in e.
+func conjuncts(e expr) []expr {
+	if b, ok := e.(*binaryExpr); ok && b.op == "AND" {
+		return append(conjuncts(b.l), conjuncts(b.r)...)
+	}
+	if e == nil {
+		return nil
+	}
+	return []expr{e}
+}
+
+// walk calls f for e and the expressions in it.
+func walk(e expr, f func(expr)) {
+	if e == nil {
+		return
+	}
+	f(e)
+	for _, c := range children(e) {
+		walk(c, f)
+	}
+}
+
+// children returns the expressions directly within e. Those of a CASE can
+// be nil.
+func children(e expr) []expr {
+	switch x := e.(type) {
+	case *unaryExpr:
+		return []expr{x.x}
+	case *binaryExpr:
+		return []expr{x.l, x.r}
+	case *isNullExpr:
+		return []expr{x.x}
+	case *inExpr:
+		return append([]expr{x.x}, x.list...)
+	case *betweenExpr:
+		return []expr{x.x, x.lo, x.hi}
+	case *caseExpr:
+		out := []expr{x.operand}
+		for _, w := range x.whens {
+			out = append(out, w.cond, w.result)
+		}
+		return append(out, x.els)
+	case *funcCall:
+		return x.args
+	}
+	return nil
+}
+
+// checkGrouped returns an error if e, of a grouped query, uses a column
+// other than within an aggregate or as part of one of the groupBy
+// expressions.
+func (x *executor) checkGrouped(e expr, groupBy []expr) error {
+	if e == nil {
+		return nil
+	}
+	key := exprKey(e)
+	for _, g := range groupBy {
+		if exprKey(g) == key {
+			return nil
+		}
+	}
+	switch e := e.(type) {
+	case *funcCall:
+		if aggregates[e.name] {
+			return nil
+		}
+	case *colRef:
+		c := x.scope[e.idx]
+		return fmt.Errorf("column \"%s.%s\" must appear in the GROUP BY clause or be used in an aggregate function",
+			c.table, c.name)
+	}
+	for _, c := range children(e) {
+		if err := x.checkGrouped(c, groupBy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exprKey returns a text form of the resolved expression e, which is the
+// same for expressions that compute the same value in the same way, however
+// their columns are qualified.
+func exprKey(e expr) string {
+	var b strings.Builder
+	var write func(e expr)
+	write = func(e expr) {
+		switch x := e.(type) {
+		case nil:
+			b.WriteString("nil")
+			return
+		case *colRef:
+			fmt.Fprintf(&b, "#%d", x.idx)
+			return
+		case *literal:
+			fmt.Fprintf(&b, "%T:%v", x.v, x.v)
+			return
+		case *unaryExpr:
+			b.WriteString(x.op)
+		case *binaryExpr:
+			b.WriteString(x.op)
+		case *isNullExpr:
+			fmt.Fprintf(&b, "isnull:%v", x.not)
+		case *inExpr:
+			fmt.Fprintf(&b, "in:%v", x.not)
+		case *betweenExpr:
+			fmt.Fprintf(&b, "between:%v", x.not)
+		case *caseExpr:
+			b.WriteString("case")
+		case *funcCall:
+			fmt.Fprintf(&b, "%s:%v:%v", x.name, x.star, x.distinct)
+		}
+		b.WriteByte('(')
+		for _, c := range children(e) {
+			write(c)
+			b.WriteByte(',')
+		}
+		b.WriteByte(')')
+	}
+	write(e)
+	return b.String()
+}
+
+func hasAggregate(e expr) (found bool) {
+	walk(e, func(e expr) {
+		if f, ok := e.(*funcCall); ok && aggregates[f.name] {
+			found = true
+		}
+	})
+	return
+}
@@ -0,0 +1,824 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//------------------------------------------------------------------------------
+// syntax tree
+
+type expr interface{}
+
+type literal struct {
+	v interface{}
+}
+
+type colRef struct {
+	table, name string // table is the table name or alias, if given
+	idx         int    // index in the row, set when resolved
+}
+
+type unaryExpr struct {
+	op string // "-" or "NOT"
+	x  expr
+}
+
+type binaryExpr struct {
+	op   string // like "+", "=", "AND", "LIKE"
+	l, r expr
+}
+
+type isNullExpr struct {
+	x   expr
+	not bool
+}
+
+type inExpr struct {
+	x    expr
+	list []expr
+	not  bool
+}
+
+type betweenExpr struct {
+	x, lo, hi expr
+	not       bool
+}
+
+type caseExpr struct {
+	operand expr // nil for a searched CASE
+	whens   []whenClause
+	els     expr
+}
+
+type whenClause struct {
+	cond, result expr
+}
+
+type funcCall struct {
+	name     string // in lower case
+	args     []expr
+	star     bool // like count(*)
+	distinct bool // like count(DISTINCT x)
+}
+
+type selectItem struct {
+	e     expr
+	alias string
+	star  bool   // "*" or "t.*"
+	table string // of "t.*"
+}
+
+type fromItem struct {
+	table, alias string
+	join         string // "", "INNER", "LEFT" or "CROSS", for all but the first
+	on           expr
+}
+
+type orderItem struct {
+	e    expr
+	desc bool
+}
+
+type selectStmt struct {
+	distinct bool
+	items    []selectItem
+	from     []fromItem
+	where    expr
+	groupBy  []expr
+	having   expr
+	orderBy  []orderItem
+	limit    expr
+	offset   expr
+}
+
+//------------------------------------------------------------------------------
+// lexer
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokQuotedIdent
+	tokNumber
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func lex(s string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '-' && i+1 < len(s) && s[i+1] == '-':
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case isIdentStart(c):
+			j := i + 1
+			for j < len(s) && (isIdentStart(s[j]) || isDigit(s[j]) || s[j] == '$') {
+				j++
+			}
+			toks = append(toks, token{tokIdent, s[i:j], i})
+			i = j
+		case isDigit(c) || (c == '.' && i+1 < len(s) && isDigit(s[i+1])):
+			j := i
+			for j < len(s) && isDigit(s[j]) {
+				j++
+			}
+			if j < len(s) && s[j] == '.' {
+				for j++; j < len(s) && isDigit(s[j]); j++ {
+				}
+			}
+			if j < len(s) && (s[j] == 'e' || s[j] == 'E') {
+				k := j + 1
+				if k < len(s) && (s[k] == '+' || s[k] == '-') {
+					k++
+				}
+				if k < len(s) && isDigit(s[k]) {
+					for j = k; j < len(s) && isDigit(s[j]); j++ {
+					}
+				}
+			}
+			toks = append(toks, token{tokNumber, s[i:j], i})
+			i = j
+		case c == '\'' || c == '"':
+			var b strings.Builder
+			j := i + 1
+			for {
+				if j >= len(s) {
+					return nil, fmt.Errorf("unterminated quoted string at position %d", i+1)
+				}
+				if s[j] == c {
+					if j+1 < len(s) && s[j+1] == c { // doubled quote
+						b.WriteByte(c)
+						j += 2
+						continue
+					}
+					break
+				}
+				b.WriteByte(s[j])
+				j++
+			}
+			kind := tokString
+			if c == '"' {
+				kind = tokQuotedIdent
+			}
+			toks = append(toks, token{kind, b.String(), i})
+			i = j + 1
+		default:
+			op := string(c)
+			if i+1 < len(s) {
+				switch two := s[i : i+2]; two {
+				case "<=", ">=", "<>", "!=", "||", "==":
+					op = two
+				}
+			}
+			if !strings.Contains("(),.*+-/%=<>;", op) && len(op) == 1 {
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, i+1)
+			}
+			toks = append(toks, token{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(toks, token{tokEOF, "", len(s)}), nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+//------------------------------------------------------------------------------
+// parser
+
+// reserved are the keywords that cannot be used as aliases without quoting.
+var reserved = map[string]bool{
+	"SELECT": true, "DISTINCT": true, "ALL": true, "FROM": true, "WHERE": true,
+	"GROUP": true, "BY": true, "HAVING": true, "ORDER": true, "LIMIT": true,
+	"OFFSET": true, "JOIN": true, "INNER": true, "LEFT": true, "OUTER": true,
+	"CROSS": true, "ON": true, "AS": true, "AND": true, "OR": true, "NOT": true,
+	"IS": true, "NULL": true, "IN": true, "LIKE": true, "ILIKE": true,
+	"BETWEEN": true, "CASE": true, "WHEN": true, "THEN": true, "ELSE": true,
+	"END": true, "ASC": true, "DESC": true, "TRUE": true, "FALSE": true,
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func parse(sql string) (*selectStmt, error) {
+	toks, err := lex(sql)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	stmt, err := p.parseSelect()
+	if err != nil {
+		return nil, err
+	}
+	p.acceptOp(";")
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", describe(t))
+	}
+	return stmt, nil
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isKeyword(kw string) bool {
+	t := p.peek()
+	return t.kind == tokIdent && strings.EqualFold(t.text, kw)
+}
+
+func (p *parser) acceptKeyword(kw string) bool {
+	if p.isKeyword(kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(kw string) error {
+	if !p.acceptKeyword(kw) {
+		return p.errorf("expected %s, found %s", kw, describe(p.peek()))
+	}
+	return nil
+}
+
+func (p *parser) isOp(op string) bool {
+	t := p.peek()
+	return t.kind == tokOp && t.text == op
+}
+
+func (p *parser) acceptOp(op string) bool {
+	if p.isOp(op) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectOp(op string) error {
+	if !p.acceptOp(op) {
+		return p.errorf("expected %q, found %s", op, describe(p.peek()))
+	}
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("syntax error at position %d: %s", p.peek().pos+1,
+		fmt.Sprintf(format, args...))
+}
+
+func describe(t token) string {
+	switch t.kind {
+	case tokEOF:
+		return "end of query"
+	case tokString:
+		return fmt.Sprintf("'%s'", t.text)
+	case tokQuotedIdent:
+		return fmt.Sprintf(`"%s"`, t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// name parses an identifier, which is folded to lower case unless quoted.
+func (p *parser) name() (string, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokQuotedIdent:
+		p.pos++
+		return t.text, nil
+	case t.kind == tokIdent && !reserved[strings.ToUpper(t.text)]:
+		p.pos++
+		return strings.ToLower(t.text), nil
+	}
+	return "", p.errorf("expected a name, found %s", describe(t))
+}
+
+// alias parses an optional alias, with or without AS.
+func (p *parser) alias() (string, error) {
+	if p.acceptKeyword("AS") {
+		return p.name()
+	}
+	if t := p.peek(); t.kind == tokQuotedIdent ||
+		(t.kind == tokIdent && !reserved[strings.ToUpper(t.text)]) {
+		return p.name()
+	}
+	return "", nil
+}
+
+func (p *parser) parseSelect() (*selectStmt, error) {
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+	s := &selectStmt{}
+	if p.acceptKeyword("DISTINCT") {
+		s.distinct = true
+	} else {
+		p.acceptKeyword("ALL")
+	}
+
+	// select list
+	for {
+		var item selectItem
+		if p.acceptOp("*") {
+			item.star = true
+		} else if t := p.peek(); (t.kind == tokIdent || t.kind == tokQuotedIdent) &&
+			p.pos+2 < len(p.toks) && p.toks[p.pos+1].text == "." &&
+			p.toks[p.pos+2].kind == tokOp && p.toks[p.pos+2].text == "*" {
+			table, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			p.pos += 2
+			item.star, item.table = true, table
+		} else {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			item.e = e
+			if item.alias, err = p.alias(); err != nil {
+				return nil, err
+			}
+		}
+		s.items = append(s.items, item)
+		if !p.acceptOp(",") {
+			break
+		}
+	}
+
+	// from
+	if p.acceptKeyword("FROM") {
+		for first := true; ; first = false {
+			var f fromItem
+			switch {
+			case first:
+			case p.acceptOp(","):
+				f.join = "CROSS"
+			case p.acceptKeyword("CROSS"):
+				if err := p.expectKeyword("JOIN"); err != nil {
+					return nil, err
+				}
+				f.join = "CROSS"
+			case p.acceptKeyword("LEFT"):
+				p.acceptKeyword("OUTER")
+				if err := p.expectKeyword("JOIN"); err != nil {
+					return nil, err
+				}
+				f.join = "LEFT"
+			case p.acceptKeyword("INNER"), p.isKeyword("JOIN"):
+				if err := p.expectKeyword("JOIN"); err != nil {
+					return nil, err
+				}
+				f.join = "INNER"
+			}
+			if !first && len(f.join) == 0 {
+				break
+			}
+			var err error
+			if f.table, err = p.name(); err != nil {
+				return nil, err
+			}
+			if f.alias, err = p.alias(); err != nil {
+				return nil, err
+			}
+			if len(f.alias) == 0 {
+				f.alias = f.table
+			}
+			if f.join == "INNER" || f.join == "LEFT" {
+				if err := p.expectKeyword("ON"); err != nil {
+					return nil, err
+				}
+				if f.on, err = p.parseExpr(); err != nil {
+					return nil, err
+				}
+			}
+			s.from = append(s.from, f)
+		}
+	}
+
+	var err error
+	if p.acceptKeyword("WHERE") {
+		if s.where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("GROUP") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			s.groupBy = append(s.groupBy, e)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+	}
+	if p.acceptKeyword("HAVING") {
+		if s.having, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("ORDER") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			item := orderItem{e: e}
+			if p.acceptKeyword("DESC") {
+				item.desc = true
+			} else {
+				p.acceptKeyword("ASC")
+			}
+			s.orderBy = append(s.orderBy, item)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+	}
+	if p.acceptKeyword("LIMIT") {
+		if s.limit, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("OFFSET") {
+		if s.offset, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// parseExpr parses an expression. The precedence of the operators, from the
+// lowest, is: OR, AND, NOT, comparisons (including IS, IN, LIKE and BETWEEN),
+// ||, + and -, * / and %, and unary minus.
+func (p *parser) parseExpr() (expr, error) {
+	return p.parseOr()
+}
+
+func (p *parser) parseOr() (expr, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryExpr{op: "OR", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	l, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		r, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryExpr{op: "AND", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if p.acceptKeyword("NOT") {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: "NOT", x: x}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (expr, error) {
+	l, err := p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if t := p.peek(); t.kind == tokOp {
+			switch op := t.text; op {
+			case "=", "==", "<>", "!=", "<", "<=", ">", ">=":
+				p.pos++
+				r, err := p.parseConcat()
+				if err != nil {
+					return nil, err
+				}
+				switch op {
+				case "==":
+					op = "="
+				case "!=":
+					op = "<>"
+				}
+				l = &binaryExpr{op: op, l: l, r: r}
+				continue
+			}
+		}
+		if p.acceptKeyword("IS") {
+			not := p.acceptKeyword("NOT")
+			if err := p.expectKeyword("NULL"); err != nil {
+				return nil, err
+			}
+			l = &isNullExpr{x: l, not: not}
+			continue
+		}
+		// [NOT] IN, LIKE, ILIKE or BETWEEN
+		save := p.pos
+		not := p.acceptKeyword("NOT")
+		switch {
+		case p.acceptKeyword("IN"):
+			if err := p.expectOp("("); err != nil {
+				return nil, err
+			}
+			in := &inExpr{x: l, not: not}
+			for {
+				e, err := p.parseExpr()
+				if err != nil {
+					return nil, err
+				}
+				in.list = append(in.list, e)
+				if !p.acceptOp(",") {
+					break
+				}
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			l = in
+		case p.isKeyword("LIKE"), p.isKeyword("ILIKE"):
+			op := strings.ToUpper(p.next().text)
+			r, err := p.parseConcat()
+			if err != nil {
+				return nil, err
+			}
+			l = &binaryExpr{op: op, l: l, r: r}
+			if not {
+				l = &unaryExpr{op: "NOT", x: l}
+			}
+		case p.acceptKeyword("BETWEEN"):
+			lo, err := p.parseConcat()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectKeyword("AND"); err != nil {
+				return nil, err
+			}
+			hi, err := p.parseConcat()
+			if err != nil {
+				return nil, err
+			}
+			l = &betweenExpr{x: l, lo: lo, hi: hi, not: not}
+		default:
+			p.pos = save
+			return l, nil
+		}
+	}
+}
+
+func (p *parser) parseConcat() (expr, error) {
+	l, err := p.parseAdd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptOp("||") {
+		r, err := p.parseAdd()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryExpr{op: "||", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAdd() (expr, error) {
+	l, err := p.parseMul()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("+") || p.isOp("-") {
+		op := p.next().text
+		r, err := p.parseMul()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryExpr{op: op, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseMul() (expr, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("*") || p.isOp("/") || p.isOp("%") {
+		op := p.next().text
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryExpr{op: op, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseUnary() (expr, error) {
+	if p.acceptOp("-") {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: "-", x: x}, nil
+	}
+	p.acceptOp("+")
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (expr, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokNumber:
+		p.pos++
+		if i, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return &literal{i}, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %q at position %d", t.text, t.pos+1)
+		}
+		return &literal{f}, nil
+	case tokString:
+		p.pos++
+		return &literal{t.text}, nil
+	case tokOp:
+		if p.acceptOp("(") {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			return e, nil
+		}
+	case tokIdent:
+		switch strings.ToUpper(t.text) {
+		case "NULL":
+			p.pos++
+			return &literal{nil}, nil
+		case "TRUE":
+			p.pos++
+			return &literal{true}, nil
+		case "FALSE":
+			p.pos++
+			return &literal{false}, nil
+		case "CASE":
+			p.pos++
+			return p.parseCase()
+		}
+		// function call
+		if p.toks[p.pos+1].kind == tokOp && p.toks[p.pos+1].text == "(" {
+			p.pos += 2
+			f := &funcCall{name: strings.ToLower(t.text)}
+			if p.acceptOp("*") {
+				f.star = true
+			} else if !p.isOp(")") {
+				f.distinct = p.acceptKeyword("DISTINCT")
+				for {
+					e, err := p.parseExpr()
+					if err != nil {
+						return nil, err
+					}
+					f.args = append(f.args, e)
+					if !p.acceptOp(",") {
+						break
+					}
+				}
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			return f, nil
+		}
+	}
+	if t.kind != tokIdent && t.kind != tokQuotedIdent {
+		return nil, p.errorf("unexpected %s", describe(t))
+	}
+
+	// column, possibly qualified by the table
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if p.acceptOp(".") {
+		// after the table, keywords can be used as column names
+		t := p.next()
+		switch t.kind {
+		case tokIdent:
+			return &colRef{table: name, name: strings.ToLower(t.text)}, nil
+		case tokQuotedIdent:
+			return &colRef{table: name, name: t.text}, nil
+		}
+		p.pos--
+		return nil, p.errorf("expected a column name, found %s", describe(t))
+	}
+	return &colRef{name: name}, nil
+}
+
+func (p *parser) parseCase() (expr, error) {
+	c := &caseExpr{}
+	if !p.isKeyword("WHEN") {
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		c.operand = e
+	}
+	for p.acceptKeyword("WHEN") {
+		cond, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("THEN"); err != nil {
+			return nil, err
+		}
+		result, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		c.whens = append(c.whens, whenClause{cond, result})
+	}
+	if len(c.whens) == 0 {
+		return nil, p.errorf("expected WHEN, found %s", describe(p.peek()))
+	}
+	if p.acceptKeyword("ELSE") {
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		c.els = e
+	}
+	if err := p.expectKeyword("END"); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,315 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package query runs SQL queries on pgmetrics models, like those loaded from
+// JSON files saved earlier, as done by "pgmetrics query".
+//
+// The models are loaded into in-memory tables. Each section of the model that
+// is a list (like "tables" or "indexes") is a table named by its key in the
+// JSON form of the model, with a column for each field. Sections that are
+// objects (like "bg_writer") are tables of one row, and maps (like
+// "settings") have a "name" column with the key. The fields at the top level
+// of the model are in the "snapshots" table. Every table has a "snapshot"
+// column, which is the number of the model the row is from, starting at 1.
+// Fields that are not numbers, strings or booleans have their JSON text as
+// the value.
+//
+// The SQL supported is a subset of SELECT, with joins, grouping, ordering
+// and the common operators and functions. See the usage of "pgmetrics query"
+// for the details.
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rapidloop/pgmetrics"
+)
+
+// Table is a table that can be queried.
+type Table struct {
+	Name    string
+	Columns []string
+	Rows    [][]interface{} // values are nil, int64, float64, string or bool
+}
+
+// Result is the result of a query.
+type Result struct {
+	Columns []string
+	Rows    [][]interface{} // values are nil, int64, float64, string or bool
+}
+
+// DB is a set of tables loaded from pgmetrics models.
+type DB struct {
+	tables map[string]*Table
+}
+
+// Load returns a DB with the tables loaded from the models. The names are
+// those of the files the models were loaded from, for the "file" column of
+// the snapshots table, and may be nil. The tables are present even if no
+// models are given.
+func Load(models []*pgmetrics.Model, names []string) *DB {
+	db := &DB{tables: make(map[string]*Table)}
+	mt := reflect.TypeOf(pgmetrics.Model{})
+	snaps := db.add("snapshots", []string{"snapshot", "file"})
+	for _, f := range jsonFields(mt) {
+		switch ft := deref(f.typ); {
+		case isScalar(ft):
+			snaps.Columns = append(snaps.Columns, f.name)
+		case ft.Kind() == reflect.Slice:
+			db.add(f.name, append([]string{"snapshot"}, elemColumns(ft.Elem())...))
+		case ft.Kind() == reflect.Map:
+			db.add(f.name, append([]string{"snapshot", "name"}, elemColumns(ft.Elem())...))
+		case ft.Kind() == reflect.Struct:
+			db.add(f.name, append([]string{"snapshot"}, structColumns(ft)...))
+			for _, sf := range jsonFields(ft) {
+				if st := deref(sf.typ); st.Kind() == reflect.Slice {
+					db.add(f.name+"_"+sf.name,
+						append([]string{"snapshot"}, elemColumns(st.Elem())...))
+				}
+			}
+		}
+	}
+
+	for i, m := range models {
+		snap := int64(i + 1)
+		var file interface{}
+		if i < len(names) {
+			file = names[i]
+		}
+		mv := reflect.ValueOf(m).Elem()
+		srow := []interface{}{snap, file}
+		for _, f := range jsonFields(mt) {
+			fv := mv.Field(f.index)
+			switch ft := deref(f.typ); {
+			case isScalar(ft):
+				srow = append(srow, value(fv))
+			case ft.Kind() == reflect.Slice:
+				addList(db.tables[f.name], snap, fv)
+			case ft.Kind() == reflect.Map:
+				t := db.tables[f.name]
+				keys := fv.MapKeys()
+				sort.Slice(keys, func(i, j int) bool {
+					return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+				})
+				for _, k := range keys {
+					row := append([]interface{}{snap, fmt.Sprint(k.Interface())},
+						elemRow(fv.MapIndex(k))...)
+					t.Rows = append(t.Rows, row)
+				}
+			case ft.Kind() == reflect.Struct:
+				if fv.Kind() == reflect.Ptr {
+					if fv.IsNil() {
+						continue
+					}
+					fv = fv.Elem()
+				}
+				t := db.tables[f.name]
+				t.Rows = append(t.Rows, append([]interface{}{snap}, structRow(fv)...))
+				for _, sf := range jsonFields(ft) {
+					if st := deref(sf.typ); st.Kind() == reflect.Slice {
+						addList(db.tables[f.name+"_"+sf.name], snap, fv.Field(sf.index))
+					}
+				}
+			}
+		}
+		snaps.Rows = append(snaps.Rows, srow)
+	}
+	return db
+}
+
+// add adds an empty table with the given columns.
+func (db *DB) add(name string, columns []string) *Table {
+	t := &Table{Name: name, Columns: columns}
+	db.tables[name] = t
+	return t
+}
+
+// addList adds the elements of the slice v as rows of t.
+func addList(t *Table, snap int64, v reflect.Value) {
+	for i := 0; i < v.Len(); i++ {
+		t.Rows = append(t.Rows, append([]interface{}{snap}, elemRow(v.Index(i))...))
+	}
+}
+
+// Tables returns the tables, sorted by name.
+func (db *DB) Tables() []*Table {
+	out := make([]*Table, 0, len(db.tables))
+	for _, t := range db.tables {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Query runs the SQL SELECT statement and returns its result.
+func (db *DB) Query(sql string) (*Result, error) {
+	stmt, err := parse(sql)
+	if err != nil {
+		return nil, err
+	}
+	x := &executor{db: db}
+	return x.run(stmt)
+}
+
+// Format returns the text form of a value from a table or result, which is
+// empty for NULL.
+func Format(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case bool:
+		if x {
+			return "true"
+		}
+		return "false"
+	}
+	return fmt.Sprint(v)
+}
+
+//------------------------------------------------------------------------------
+// mapping the model to tables
+
+type field struct {
+	name  string // from the json tag
+	index int
+	typ   reflect.Type
+}
+
+// fieldCache has the jsonFields of the types seen so far.
+var fieldCache sync.Map // reflect.Type => []field
+
+// jsonFields returns the fields of the struct type t that are in its JSON
+// form.
+func jsonFields(t reflect.Type) (out []field) {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.([]field)
+	}
+	defer func() { fieldCache.Store(t, out) }()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if len(f.PkgPath) > 0 { // unexported
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if len(name) == 0 {
+			name = f.Name
+		}
+		out = append(out, field{name: name, index: i, typ: f.Type})
+	}
+	return
+}
+
+func deref(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return t
+}
+
+func isScalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// elemColumns returns the columns for the elements of a list or map of
+// type t: the fields if they are structs, else the value.
+func elemColumns(t reflect.Type) []string {
+	if t = deref(t); t.Kind() == reflect.Struct {
+		return structColumns(t)
+	}
+	return []string{"value"}
+}
+
+func structColumns(t reflect.Type) (out []string) {
+	for _, f := range jsonFields(t) {
+		out = append(out, f.name)
+	}
+	return
+}
+
+// elemRow returns the values for the element v of a list or map, for the
+// columns given by elemColumns.
+func elemRow(v reflect.Value) []interface{} {
+	if t := deref(v.Type()); t.Kind() == reflect.Struct {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return make([]interface{}, len(jsonFields(t)))
+			}
+			v = v.Elem()
+		}
+		return structRow(v)
+	}
+	return []interface{}{value(v)}
+}
+
+func structRow(v reflect.Value) (out []interface{}) {
+	for _, f := range jsonFields(v.Type()) {
+		out = append(out, value(v.Field(f.index)))
+	}
+	return
+}
+
+// value returns the value of v for a column, the JSON text if it is not a
+// scalar.
+func value(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.String:
+		return v.String()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint())
+	case reflect.Slice, reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+	}
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		return nil
+	}
+	return string(b)
+}
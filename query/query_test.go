@@ -0,0 +1,136 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package query
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rapidloop/pgmetrics"
+)
+
+func testDB() *DB {
+	m1 := &pgmetrics.Model{
+		Tables: []pgmetrics.Table{
+			{OID: 1, DBName: "app", SchemaName: "public", Name: "users", SeqScan: 10, Size: 8192},
+			{OID: 2, DBName: "app", SchemaName: "public", Name: "orders", SeqScan: 5, Size: 16384},
+			{OID: 3, DBName: "app", SchemaName: "audit", Name: "log", SeqScan: 0, Size: -1},
+		},
+		Indexes: []pgmetrics.Index{
+			{OID: 11, DBName: "app", TableOID: 1, Name: "users_pkey", IdxScan: 7},
+			{OID: 12, DBName: "app", TableOID: 2, Name: "orders_pkey", IdxScan: 3},
+			{OID: 13, DBName: "app", TableOID: 2, Name: "orders_user", IdxScan: 1},
+		},
+	}
+	m2 := &pgmetrics.Model{
+		Tables: []pgmetrics.Table{
+			{OID: 1, DBName: "app", SchemaName: "public", Name: "users", SeqScan: 20, Size: 8192},
+		},
+	}
+	return Load([]*pgmetrics.Model{m1, m2}, []string{"a.json", "b.json"})
+}
+
+func TestQuery(t *testing.T) {
+	db := testDB()
+	cases := []struct {
+		sql  string
+		cols []string
+		rows [][]interface{}
+	}{
+		{`SELECT name FROM tables WHERE snapshot = 1 ORDER BY name`,
+			[]string{"name"},
+			[][]interface{}{{"log"}, {"orders"}, {"users"}}},
+		{`SELECT name, seq_scan FROM tables ORDER BY 2 DESC, 1 LIMIT 2`,
+			[]string{"name", "seq_scan"},
+			[][]interface{}{{"users", int64(20)}, {"users", int64(10)}}},
+		{`SELECT snapshot, count(*) AS n FROM tables GROUP BY snapshot ORDER BY n`,
+			[]string{"snapshot", "n"},
+			[][]interface{}{{int64(2), int64(1)}, {int64(1), int64(3)}}},
+		{`SELECT t.name, count(i.name) FROM tables t LEFT JOIN indexes i
+				ON i.table_oid = t.oid AND i.snapshot = t.snapshot
+			WHERE t.snapshot = 1 GROUP BY t.name ORDER BY 2 DESC, t.name`,
+			[]string{"name", "count"},
+			[][]interface{}{{"orders", int64(2)}, {"users", int64(1)}, {"log", int64(0)}}},
+		{`SELECT upper(name), sum(seq_scan) FROM tables GROUP BY upper(name)
+			HAVING sum(seq_scan) > 5 ORDER BY 1`,
+			[]string{"upper", "sum"},
+			[][]interface{}{{"USERS", int64(30)}}},
+		{`SELECT lower(t.name) FROM tables t GROUP BY lower(name) ORDER BY 1`,
+			[]string{"lower"},
+			[][]interface{}{{"log"}, {"orders"}, {"users"}}},
+		{`SELECT count(*), max(size) FROM tables WHERE name = 'none'`,
+			[]string{"count", "max"},
+			[][]interface{}{{int64(0), nil}}},
+		{`SELECT DISTINCT schema_name FROM tables ORDER BY schema_name DESC`,
+			[]string{"schema_name"},
+			[][]interface{}{{"public"}, {"audit"}}},
+		{`SELECT name FROM tables WHERE snapshot = 1 ORDER BY nullif(size, -1) DESC`,
+			[]string{"name"},
+			[][]interface{}{{"log"}, {"orders"}, {"users"}}}, // NULLs first, like Postgres
+		{`SELECT file FROM snapshots ORDER BY snapshot OFFSET 1`,
+			[]string{"file"},
+			[][]interface{}{{"b.json"}}},
+	}
+	for _, c := range cases {
+		r, err := db.Query(c.sql)
+		if err != nil {
+			t.Errorf("%s: %v", c.sql, err)
+			continue
+		}
+		if !reflect.DeepEqual(r.Columns, c.cols) {
+			t.Errorf("%s: columns %v, want %v", c.sql, r.Columns, c.cols)
+		}
+		if !reflect.DeepEqual(r.Rows, c.rows) {
+			t.Errorf("%s: rows %v, want %v", c.sql, r.Rows, c.rows)
+		}
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	db := testDB()
+	cases := []struct {
+		sql, err string
+	}{
+		{`SELECT name, count(*) FROM tables`,
+			`column "tables.name" must appear in the GROUP BY clause or be used in an aggregate function`},
+		{`SELECT name, seq_scan FROM tables GROUP BY name`,
+			`column "tables.seq_scan" must appear in the GROUP BY clause`},
+		{`SELECT count(*) FROM tables ORDER BY name`,
+			`column "tables.name" must appear in the GROUP BY clause`},
+		{`SELECT schema_name FROM tables GROUP BY schema_name HAVING size > 0`,
+			`column "tables.size" must appear in the GROUP BY clause`},
+		{`SELECT name FROM tables ORDER BY 5`, `ORDER BY position 5 is not in select list`},
+		{`SELECT name FROM tables ORDER BY 0`, `ORDER BY position 0 is not in select list`},
+		{`SELECT name, count(*) FROM tables GROUP BY 3`, `GROUP BY position 3 is not in select list`},
+		{`SELECT nosuch FROM tables`, `column "nosuch" does not exist`},
+		{`SELECT oid FROM tables, indexes`, `column reference "oid" is ambiguous`},
+		{`SELECT * FROM nosuch`, `nosuch`},
+		{`SELECT name FROM tables WHERE count(*) > 1`, `aggregate functions are not allowed in WHERE`},
+		{`SELECT name FROM tables HAVING name = 'x'`, `HAVING needs GROUP BY or aggregate functions`},
+		{`SELECT name FROM tables LIMIT -1`, `LIMIT must be a non-negative integer`},
+		{`SELECT FROM tables`, ``},
+	}
+	for _, c := range cases {
+		_, err := db.Query(c.sql)
+		if err == nil {
+			t.Errorf("%s: no error, want %q", c.sql, c.err)
+		} else if !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: error %q, want %q", c.sql, err, c.err)
+		}
+	}
+}
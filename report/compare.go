@@ -0,0 +1,344 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package report
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/rapidloop/pgmetrics"
+)
+
+// writeCompareTo renders the key information from multiple snapshots side
+// by side, one column per snapshot, in the order given.
+func writeCompareTo(fd io.Writer, o Options, results []*pgmetrics.Model) {
+	fmt.Fprint(fd, `
+pgmetrics comparison of snapshots:
+`)
+	tw := tableWriter{o: o}
+	hdr := []interface{}{"Snapshot"}
+	for i := range results {
+		hdr = append(hdr, fmt.Sprintf("#%d", i+1))
+	}
+	tw.add(hdr...)
+	tw.add(cmpRow(results, "Taken At", func(r *pgmetrics.Model) string {
+		return fmtTime(o, r.Metadata.At)
+	})...)
+	tw.add(cmpRow(results, "Cluster Name", func(r *pgmetrics.Model) string {
+		if len(r.Metadata.ClusterName) > 0 {
+			return r.Metadata.ClusterName
+		}
+		return getSetting(r, "cluster_name")
+	})...)
+	tw.add(cmpRow(results, "Server Version", func(r *pgmetrics.Model) string {
+		return getSetting(r, "server_version")
+	})...)
+	tw.add(cmpRow(results, "Server Started", func(r *pgmetrics.Model) string {
+		return fmtTime(o, r.StartTime)
+	})...)
+	tw.add(cmpRow(results, "Recovery Mode?", func(r *pgmetrics.Model) string {
+		return fmtYesNo(r.IsInRecovery)
+	})...)
+	tw.write(fd, "    ")
+
+	compareCluster(fd, o, results)
+	compareSettings(fd, o, results)
+	compareDatabases(fd, o, results)
+	compareTables(fd, o, results)
+	fmt.Fprintln(fd)
+}
+
+// cmpRow makes a table row with the given label, and one value per snapshot.
+func cmpRow(results []*pgmetrics.Model, label string, f func(*pgmetrics.Model) string) []interface{} {
+	row := []interface{}{label}
+	for _, r := range results {
+		row = append(row, f(r))
+	}
+	return row
+}
+
+// cmpRowInt is like cmpRow, but for integer counters. If ok returns false for
+// a snapshot, the value is left blank. A final "Change" column has the
+// difference between the last and the first values.
+func cmpRowInt(results []*pgmetrics.Model, label string, f func(*pgmetrics.Model) (int64, bool), fmtv func(int64) string) []interface{} {
+	row := []interface{}{label}
+	var first, last int64
+	var haveFirst, haveLast bool
+	for i, r := range results {
+		v, ok := f(r)
+		if ok {
+			row = append(row, fmtv(v))
+		} else {
+			row = append(row, "")
+		}
+		if i == 0 {
+			first, haveFirst = v, ok
+		}
+		if i == len(results)-1 {
+			last, haveLast = v, ok
+		}
+	}
+	if haveFirst && haveLast {
+		d := last - first
+		if d < 0 {
+			row = append(row, "-"+fmtv(-d))
+		} else {
+			row = append(row, "+"+fmtv(d))
+		}
+	} else {
+		row = append(row, "")
+	}
+	return row
+}
+
+func cmpHeader(results []*pgmetrics.Model, first string) []interface{} {
+	hdr := []interface{}{first}
+	for i := range results {
+		hdr = append(hdr, fmt.Sprintf("#%d", i+1))
+	}
+	return append(hdr, "Change")
+}
+
+func fmtInt(v int64) string {
+	return strconv.FormatInt(v, 10)
+}
+
+func fmtBytes(v int64) string {
+	return humanize.IBytes(uint64(v))
+}
+
+func compareCluster(fd io.Writer, o Options, results []*pgmetrics.Model) {
+	fmt.Fprint(fd, `
+Cluster:
+`)
+	tw := tableWriter{o: o}
+	tw.add(cmpHeader(results, "Counter")...)
+	always := func(f func(*pgmetrics.Model) int64) func(*pgmetrics.Model) (int64, bool) {
+		return func(r *pgmetrics.Model) (int64, bool) { return f(r), true }
+	}
+	tw.add(cmpRowInt(results, "Backends", always(func(r *pgmetrics.Model) int64 {
+		return int64(len(r.Backends))
+	}), fmtInt)...)
+	tw.add(cmpRowInt(results, "Next Transaction ID", func(r *pgmetrics.Model) (int64, bool) {
+		return int64(r.NextXid), r.NextXid != 0
+	}, fmtInt)...)
+	tw.add(cmpRowInt(results, "WAL Files", func(r *pgmetrics.Model) (int64, bool) {
+		return int64(r.WALCount), r.WALCount != -1
+	}, fmtInt)...)
+	tw.add(cmpRowInt(results, "WAL Files Archived", always(func(r *pgmetrics.Model) int64 {
+		return int64(r.WALArchiving.ArchivedCount)
+	}), fmtInt)...)
+	tw.add(cmpRowInt(results, "WAL Archive Failures", always(func(r *pgmetrics.Model) int64 {
+		return int64(r.WALArchiving.FailedCount)
+	}), fmtInt)...)
+	tw.add(cmpRowInt(results, "Checkpoints (Timed)", always(func(r *pgmetrics.Model) int64 {
+		return r.BGWriter.CheckpointsTimed
+	}), fmtInt)...)
+	tw.add(cmpRowInt(results, "Checkpoints (Req.)", always(func(r *pgmetrics.Model) int64 {
+		return r.BGWriter.CheckpointsRequested
+	}), fmtInt)...)
+	tw.add(cmpRowInt(results, "Buffers by Checkpoint", always(func(r *pgmetrics.Model) int64 {
+		return r.BGWriter.BuffersCheckpoint
+	}), fmtInt)...)
+	tw.add(cmpRowInt(results, "Buffers by BG Writer", always(func(r *pgmetrics.Model) int64 {
+		return r.BGWriter.BuffersClean
+	}), fmtInt)...)
+	tw.add(cmpRowInt(results, "Buffers by Backends", always(func(r *pgmetrics.Model) int64 {
+		return r.BGWriter.BuffersBackend
+	}), fmtInt)...)
+	tw.write(fd, "    ")
+}
+
+func compareSettings(fd io.Writer, o Options, results []*pgmetrics.Model) {
+	// collect names of all settings that differ across the snapshots
+	names := make(map[string]bool)
+	for _, r := range results {
+		for k := range r.Settings {
+			names[k] = true
+		}
+	}
+	var diff []string
+	for k := range names {
+		v0, ok0 := results[0].Settings[k]
+		for _, r := range results[1:] {
+			if v, ok := r.Settings[k]; ok != ok0 || v.Setting != v0.Setting {
+				diff = append(diff, k)
+				break
+			}
+		}
+	}
+	sort.Strings(diff)
+
+	fmt.Fprint(fd, `
+Settings:
+`)
+	if len(diff) == 0 {
+		fmt.Fprint(fd, `    No differences in settings.
+`)
+		return
+	}
+	tw := tableWriter{o: o}
+	hdr := []interface{}{"Setting"}
+	for i := range results {
+		hdr = append(hdr, fmt.Sprintf("#%d", i+1))
+	}
+	tw.add(hdr...)
+	for _, k := range diff {
+		tw.add(cmpRow(results, k, func(r *pgmetrics.Model) string {
+			return getSetting(r, k)
+		})...)
+	}
+	tw.write(fd, "    ")
+}
+
+func compareDatabases(fd io.Writer, o Options, results []*pgmetrics.Model) {
+	// databases, in order of first appearance
+	var names []string
+	seen := make(map[string]bool)
+	for _, r := range results {
+		for _, d := range r.Databases {
+			if !seen[d.Name] {
+				seen[d.Name] = true
+				names = append(names, d.Name)
+			}
+		}
+	}
+
+	for _, name := range names {
+		fmt.Fprintf(fd, `
+Database %s:
+`, name)
+		get := func(f func(*pgmetrics.Database) int64) func(*pgmetrics.Model) (int64, bool) {
+			return func(r *pgmetrics.Model) (int64, bool) {
+				if d := r.DatabaseByName(name); d != nil {
+					return f(d), true
+				}
+				return 0, false
+			}
+		}
+		tw := tableWriter{o: o}
+		tw.add(cmpHeader(results, "Counter")...)
+		tw.add(cmpRowInt(results, "Size", func(r *pgmetrics.Model) (int64, bool) {
+			if d := r.DatabaseByName(name); d != nil && d.Size != -1 {
+				return d.Size, true
+			}
+			return 0, false
+		}, fmtBytes)...)
+		tw.add(cmpRowInt(results, "Backends", get(func(d *pgmetrics.Database) int64 {
+			return int64(d.NumBackends)
+		}), fmtInt)...)
+		tw.add(cmpRowInt(results, "Commits", get(func(d *pgmetrics.Database) int64 {
+			return d.XactCommit
+		}), fmtInt)...)
+		tw.add(cmpRowInt(results, "Rollbacks", get(func(d *pgmetrics.Database) int64 {
+			return d.XactRollback
+		}), fmtInt)...)
+		tw.add(cmpRowInt(results, "Blocks Read", get(func(d *pgmetrics.Database) int64 {
+			return d.BlksRead
+		}), fmtInt)...)
+		tw.add(cmpRowInt(results, "Blocks Hit", get(func(d *pgmetrics.Database) int64 {
+			return d.BlksHit
+		}), fmtInt)...)
+		tw.add(cmpRowInt(results, "Tuples Inserted", get(func(d *pgmetrics.Database) int64 {
+			return d.TupInserted
+		}), fmtInt)...)
+		tw.add(cmpRowInt(results, "Tuples Updated", get(func(d *pgmetrics.Database) int64 {
+			return d.TupUpdated
+		}), fmtInt)...)
+		tw.add(cmpRowInt(results, "Tuples Deleted", get(func(d *pgmetrics.Database) int64 {
+			return d.TupDeleted
+		}), fmtInt)...)
+		tw.add(cmpRowInt(results, "Temp Files", get(func(d *pgmetrics.Database) int64 {
+			return d.TempFiles
+		}), fmtInt)...)
+		tw.add(cmpRowInt(results, "Temp Bytes", get(func(d *pgmetrics.Database) int64 {
+			return d.TempBytes
+		}), fmtBytes)...)
+		tw.add(cmpRowInt(results, "Deadlocks", get(func(d *pgmetrics.Database) int64 {
+			return d.Deadlocks
+		}), fmtInt)...)
+		tw.add(cmpRowInt(results, "Xid Age", get(func(d *pgmetrics.Database) int64 {
+			return int64(d.AgeDatFrozenXid)
+		}), fmtInt)...)
+		tw.write(fd, "    ")
+	}
+}
+
+func compareTables(fd io.Writer, o Options, results []*pgmetrics.Model) {
+	// tables, in order of first appearance
+	var names []string
+	seen := make(map[string]bool)
+	for _, r := range results {
+		for _, t := range r.Tables {
+			n := t.DBName + "." + t.SchemaName + "." + t.Name
+			if !seen[n] {
+				seen[n] = true
+				names = append(names, n)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	// index the tables of each snapshot by name
+	byName := make([]map[string]*pgmetrics.Table, len(results))
+	for i, r := range results {
+		byName[i] = make(map[string]*pgmetrics.Table)
+		for j := range r.Tables {
+			t := &r.Tables[j]
+			byName[i][t.DBName+"."+t.SchemaName+"."+t.Name] = t
+		}
+	}
+	index := make(map[*pgmetrics.Model]int)
+	for i, r := range results {
+		index[r] = i
+	}
+
+	fmt.Fprint(fd, `
+Table Sizes:
+`)
+	tw := tableWriter{o: o}
+	tw.add(cmpHeader(results, "Table")...)
+	for _, n := range names {
+		tw.add(cmpRowInt(results, n, func(r *pgmetrics.Model) (int64, bool) {
+			if t := byName[index[r]][n]; t != nil && t.Size != -1 {
+				return t.Size, true
+			}
+			return 0, false
+		}, fmtBytes)...)
+	}
+	tw.write(fd, "    ")
+
+	fmt.Fprint(fd, `
+Table Dead Tuples:
+`)
+	tw.clear()
+	tw.add(cmpHeader(results, "Table")...)
+	for _, n := range names {
+		tw.add(cmpRowInt(results, n, func(r *pgmetrics.Model) (int64, bool) {
+			if t := byName[index[r]][n]; t != nil {
+				return t.NDeadTup, true
+			}
+			return 0, false
+		}, fmtInt)...)
+	}
+	tw.write(fd, "    ")
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package report
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fmtLayout formats the unix time at using the layout, which should use
+// the 12-hour clock and not have a zone. The layout is changed to use the
+// 24-hour clock and the time is shown in the zone of the options o, if set.
+func fmtLayout(o Options, at int64, layout string) string {
+	t := dispTime(o, at)
+	if o.Clock24 {
+		layout = strings.NewReplacer("3:04:05 PM", "15:04:05", "3:04 PM", "15:04",
+			"3 PM", "15:00").Replace(layout)
+	}
+	if o.Location != nil {
+		layout += " MST"
+	}
+	return t.Format(layout)
+}
+
+// dispTime returns the unix time at in the zone of the options o, or in the
+// local zone.
+func dispTime(o Options, at int64) time.Time {
+	t := time.Unix(at, 0)
+	if o.Location != nil {
+		t = t.In(o.Location)
+	}
+	return t
+}
+
+// fmtCount returns the counter n with its digits grouped in thousands, if a
+// separator was set in the options o.
+func fmtCount(o Options, n int64) string {
+	s := strconv.FormatInt(n, 10)
+	sep := o.ThousandsSep
+	if len(sep) == 0 {
+		return s
+	}
+	var sign string
+	if n < 0 {
+		sign, s = "-", s[1:]
+	}
+	var b strings.Builder
+	for i, d := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteString(sep)
+		}
+		b.WriteRune(d)
+	}
+	return sign + b.String()
+}
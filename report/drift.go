@@ -0,0 +1,162 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package report
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/rapidloop/pgmetrics"
+)
+
+// driftIgnored are settings that are expected to be different for each
+// server, and are not reported as drift.
+var driftIgnored = map[string]bool{
+	"cluster_name":          true,
+	"config_file":           true,
+	"data_directory":        true,
+	"external_pid_file":     true,
+	"hba_file":              true,
+	"ident_file":            true,
+	"in_hot_standby":        true,
+	"primary_conninfo":      true,
+	"primary_slot_name":     true,
+	"transaction_read_only": true,
+}
+
+// writeDriftTo reports the settings of each server that differ from the
+// value used by the majority of the servers of the same role.
+func writeDriftTo(fd io.Writer, o Options, results []*pgmetrics.Model) {
+	groups := make(map[string][]int)
+	for i, r := range results {
+		role := serverRole(r)
+		groups[role] = append(groups[role], i)
+	}
+
+	fmt.Fprint(fd, `
+pgmetrics configuration drift report:
+`)
+	for _, role := range []string{"primary", "standby"} {
+		idx := groups[role]
+		if len(idx) == 0 {
+			continue
+		}
+		label := "Primaries"
+		if role == "standby" {
+			label = "Standbys"
+		}
+		var names []string
+		for _, i := range idx {
+			names = append(names, serverName(results[i], i))
+		}
+		fmt.Fprintf(fd, `
+%s (%d): %s
+`, label, len(idx), strings.Join(names, ", "))
+		if len(idx) < 2 {
+			fmt.Fprint(fd, `    Need at least 2 servers to find drift.
+`)
+			continue
+		}
+		reportDrift(fd, o, results, idx)
+	}
+	fmt.Fprintln(fd)
+}
+
+func reportDrift(fd io.Writer, o Options, results []*pgmetrics.Model, idx []int) {
+	keys := make(map[string]bool)
+	for _, i := range idx {
+		for k := range results[i].Settings {
+			if !driftIgnored[k] {
+				keys[k] = true
+			}
+		}
+	}
+	var sorted []string
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	tw := tableWriter{o: o}
+	tw.add("Setting", "Majority", "Drifted Servers")
+	for _, k := range sorted {
+		counts := make(map[string]int)
+		for _, i := range idx {
+			counts[getDriftSetting(results[i], k)]++
+		}
+		if len(counts) == 1 {
+			continue
+		}
+		// find the value with a strict majority, if any
+		majority, found := "", false
+		for v, n := range counts {
+			if 2*n > len(idx) {
+				majority, found = v, true
+			}
+		}
+		var drifted []string
+		for _, i := range idx {
+			if v := getDriftSetting(results[i], k); !found || v != majority {
+				drifted = append(drifted, serverName(results[i], i)+"="+v)
+			}
+		}
+		if !found {
+			majority = "(none)"
+		}
+		tw.add(k, majority, strings.Join(drifted, ", "))
+	}
+	if len(tw.data) == 1 {
+		fmt.Fprint(fd, `    No drift in settings.
+`)
+		return
+	}
+	tw.write(fd, "    ")
+}
+
+func getDriftSetting(r *pgmetrics.Model, key string) string {
+	if s, ok := r.Settings[key]; ok {
+		return s.Setting
+	}
+	return "(not set)"
+}
+
+func serverRole(r *pgmetrics.Model) string {
+	if r.Metadata.ServerRole != "" {
+		return r.Metadata.ServerRole
+	}
+	if r.IsInRecovery {
+		return "standby"
+	}
+	return "primary"
+}
+
+// serverName returns a name for the i'th (0-based) server, for use in
+// reports that cover multiple servers.
+func serverName(r *pgmetrics.Model, i int) string {
+	if r.Metadata.ClusterName != "" {
+		return r.Metadata.ClusterName
+	}
+	if n := getSetting(r, "cluster_name"); n != "" {
+		return n
+	}
+	if r.System != nil && r.System.Hostname != "" {
+		return r.System.Hostname
+	}
+	return fmt.Sprintf("#%d", i+1)
+}
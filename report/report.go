@@ -0,0 +1,3519 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package report renders the human-readable text report of a pgmetrics
+// model, as displayed by the pgmetrics command.
+package report
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/rapidloop/pgmetrics"
+)
+
+// Options control how the report is rendered.
+type Options struct {
+	// Transactions running longer than this many seconds are considered too
+	// long.
+	TooLongSecs uint
+
+	// Times are shown in this zone, and with the zone name, if set. By
+	// default, they are shown in the local zone without the zone name.
+	Location *time.Location
+
+	// Show times using the 24-hour clock instead of AM/PM.
+	Clock24 bool
+
+	// Group the digits of counters in tables with this separator, like ","
+	// or ".", if set.
+	ThousandsSep string
+}
+
+// DefaultOptions returns the options used by the pgmetrics command by default.
+func DefaultOptions() Options {
+	return Options{
+		TooLongSecs: 60,
+	}
+}
+
+// Render returns the text report for the model.
+func Render(model *pgmetrics.Model, o Options) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := Write(&buf, model, o); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Write writes the text report for the model into w. The first error
+// returned by w, if any, stops the rendering and is returned.
+func Write(w io.Writer, model *pgmetrics.Model, o Options) error {
+	if model == nil {
+		return errors.New("report: nil model")
+	}
+	return safeWrite(w, func(fd io.Writer) {
+		writeHumanTo(fd, o, model)
+	})
+}
+
+// WriteCompare writes a report with key information from 2 or more models
+// side by side, one column per model, in the order given.
+func WriteCompare(w io.Writer, models []*pgmetrics.Model, o Options) error {
+	if len(models) < 2 {
+		return errors.New("report: need at least 2 models to compare")
+	}
+	for _, m := range models {
+		if m == nil {
+			return errors.New("report: nil model")
+		}
+	}
+	return safeWrite(w, func(fd io.Writer) {
+		writeCompareTo(fd, o, models)
+	})
+}
+
+// WriteDrift writes a report of the settings that differ from the value used
+// by the majority of the servers, for a set of models each collected from a
+// different server. Primaries and standbys are compared separately.
+func WriteDrift(w io.Writer, models []*pgmetrics.Model, o Options) error {
+	if len(models) < 2 {
+		return errors.New("report: need at least 2 models to find drift")
+	}
+	for _, m := range models {
+		if m == nil {
+			return errors.New("report: nil model")
+		}
+	}
+	return safeWrite(w, func(fd io.Writer) {
+		writeDriftTo(fd, o, models)
+	})
+}
+
+// WriteTrend writes a report of how the calls and total time of the top
+// statements changed across a series of models collected from the same
+// cluster at different times, including statements that newly appeared.
+func WriteTrend(w io.Writer, models []*pgmetrics.Model, o Options) error {
+	if len(models) < 2 {
+		return errors.New("report: need at least 2 models to find trends")
+	}
+	for _, m := range models {
+		if m == nil {
+			return errors.New("report: nil model")
+		}
+		if m.SystemIdentifier != models[0].SystemIdentifier {
+			return errors.New("report: models are from different clusters")
+		}
+	}
+	return safeWrite(w, func(fd io.Writer) {
+		writeTrendTo(fd, o, models)
+	})
+}
+
+// WriteRollup writes a report of the events seen in the log files, like
+// errors, slow queries and deadlocks, counted by week over a series of models
+// collected periodically from the same cluster.
+func WriteRollup(w io.Writer, models []*pgmetrics.Model, o Options) error {
+	if len(models) == 0 {
+		return errors.New("report: need at least 1 model for a rollup")
+	}
+	for _, m := range models {
+		if m == nil {
+			return errors.New("report: nil model")
+		}
+		if m.SystemIdentifier != models[0].SystemIdentifier {
+			return errors.New("report: models are from different clusters")
+		}
+	}
+	return safeWrite(w, func(fd io.Writer) {
+		writeRollupTo(fd, o, models)
+	})
+}
+
+// errWriter remembers the first error from the underlying writer, and does
+// not write anything after that.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	n, err := e.w.Write(p)
+	e.err = err
+	return n, err
+}
+
+// safeWrite calls f with a writer wrapping w, and returns the first write
+// error, or any panic(error) raised during rendering, as the error.
+func safeWrite(w io.Writer, f func(fd io.Writer)) (err error) {
+	ew := &errWriter{w: w}
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				err = e
+				return
+			}
+			panic(r)
+		}
+	}()
+	f(ew)
+	return ew.err
+}
+
+func writeHumanTo(fd io.Writer, o Options, result *pgmetrics.Model) {
+	if result.PgBouncer != nil {
+		pgbouncerWriteHumanTo(fd, o, result)
+	} else {
+		postgresWriteHumanTo(fd, o, result)
+	}
+}
+
+func postgresWriteHumanTo(fd io.Writer, o Options, result *pgmetrics.Model) {
+	version := getVersion(result)
+	sincePrior, _ := lsnDiff(result.RedoLSN, result.PriorLSN)
+	sinceRedo, _ := lsnDiff(result.CheckpointLSN, result.RedoLSN)
+	name := result.Metadata.ClusterName
+	if len(name) == 0 {
+		name = getSetting(result, "cluster_name")
+	}
+	fmt.Fprintf(fd, `
+pgmetrics run at: %s%s
+
+PostgreSQL Cluster:
+    Name:                %s`,
+		fmtTimeAndSince(o, result.Metadata.At),
+		fmtCollectorStats(result.Metadata.Collector),
+		name,
+	)
+	if len(result.Metadata.Labels) > 0 {
+		fmt.Fprintf(fd, `
+    Labels:              %s`, fmtLabels(result.Metadata.Labels))
+	}
+	if len(result.Metadata.Replica) > 0 {
+		fmt.Fprintf(fd, `
+    Heavy Queries On:    %s (replica)`, result.Metadata.Replica)
+	}
+	if skew := result.Metadata.ClockSkew; result.Metadata.ServerAt > 0 && math.Abs(skew) >= 1 {
+		fmt.Fprintf(fd, `
+    Clock Skew:          %s`, fmtClockSkew(skew))
+		if math.Abs(skew) >= summaryClockSkew {
+			fmt.Fprint(fd, " (warning: times from the server and from pgmetrics do not match)")
+		}
+	}
+	fmt.Fprintf(fd, `
+    Server Version:      %s
+    Server Started:      %s`,
+		getSetting(result, "server_version"),
+		fmtTimeAndSince(o, result.StartTime),
+	)
+	if version >= 90600 {
+		fmt.Fprintf(fd, `
+    System Identifier:   %s
+    Timeline:            %d
+    Last Checkpoint:     %s`,
+			result.SystemIdentifier,
+			result.TimelineID,
+			fmtTimeAndSince(o, result.CheckpointTime),
+		)
+		if result.PriorLSN != "" && result.RedoLSN != "" && result.CheckpointLSN != "" {
+			fmt.Fprintf(fd, `
+    Prior LSN:           %s
+    REDO LSN:            %s (%s since Prior)
+    Checkpoint LSN:      %s (%s since REDO)`,
+				result.PriorLSN,
+				result.RedoLSN, humanize.IBytes(uint64(sincePrior)),
+				result.CheckpointLSN, humanize.IBytes(uint64(sinceRedo)),
+			)
+		} else if result.PriorLSN == "" && result.RedoLSN != "" && result.CheckpointLSN != "" {
+			fmt.Fprintf(fd, `
+    REDO LSN:            %s
+    Checkpoint LSN:      %s (%s since REDO)`,
+				result.RedoLSN,
+				result.CheckpointLSN, humanize.IBytes(uint64(sinceRedo)),
+			)
+		}
+		fmt.Fprintf(fd, `
+    Transaction IDs:     %d to %d (diff = %d)`,
+			result.OldestXid, result.NextXid-1,
+			result.NextXid-1-result.OldestXid,
+		)
+	}
+
+	if result.LastXactTimestamp != 0 {
+		fmt.Fprintf(fd, `
+    Last Transaction:    %s`,
+			fmtTimeAndSince(o, result.LastXactTimestamp),
+		)
+	}
+	if result.OldestCommitTs != 0 {
+		fmt.Fprintf(fd, `
+    Oldest Commit TS:    %s (xid %d)`,
+			fmtTimeAndSince(o, result.OldestCommitTs), result.OldestCommitTsXid,
+		)
+	}
+
+	if version >= 90600 {
+		fmt.Fprintf(fd, `
+    Notification Queue:  %.1f%% used`, result.NotificationQueueUsage)
+	}
+
+	fmt.Fprintf(fd, `
+    Active Backends:     %d (max %s)
+    Recovery Mode?       %s
+`,
+		len(result.Backends), getSetting(result, "max_connections"),
+		fmtYesNo(result.IsInRecovery),
+	)
+
+	if result.System != nil {
+		reportSystem(fd, o, result)
+	}
+
+	if len(result.TimelineHistory) > 0 {
+		reportTimelineHistory(fd, o, result)
+	}
+
+	if result.IsInRecovery {
+		reportRecovery(fd, o, result)
+	}
+
+	if result.ReplicationIncoming != nil {
+		reportReplicationIn(fd, result)
+	}
+
+	if len(result.ReplicationOutgoing) > 0 {
+		reportReplicationOut(fd, o, result)
+	}
+
+	if len(result.ReplicationSlots) > 0 {
+		reportReplicationSlots(fd, o, result, version)
+	}
+
+	if len(result.ReplicationOrigins) > 0 {
+		reportReplicationOrigins(fd, o, result)
+	}
+
+	reportXminHorizon(fd, o, result)
+
+	reportReplicationReadiness(fd, o, result)
+
+	reportWAL(fd, o, result)
+	if result.BackupState != nil {
+		reportBackupState(fd, o, result)
+	}
+	reportBGWriter(fd, o, result)
+	if len(result.IOStats) > 0 {
+		reportIOStats(fd, o, result)
+	}
+	if result.Rates != nil {
+		reportRates(fd, o, result)
+	}
+	reportBackends(fd, o, result)
+	reportLocks(fd, o, result)
+	if len(result.BackendTypeCounts) > 0 || len(result.PreloadLibraries) > 0 {
+		reportBGWorkers(fd, o, result)
+	}
+	if len(result.LogHours) > 0 {
+		reportLogHours(fd, o, result)
+	}
+	if result.LogVolume != nil {
+		reportLogVolume(fd, o, result)
+	}
+	if len(result.LogErrorSummary) > 0 {
+		reportLogErrorSummary(fd, o, result)
+	}
+	if len(result.DDLEvents) > 0 {
+		reportDDLEvents(fd, o, result)
+	}
+	if len(result.Checkpoints) > 0 {
+		reportCheckpoints(fd, o, result)
+	}
+	if len(result.LockWaits) > 0 {
+		reportLockWaits(fd, o, result)
+	}
+	if len(result.TempFileEvents) > 0 {
+		reportTempFiles(fd, o, result)
+	}
+	if result.ConnectionChurn != nil {
+		reportConnectionChurn(fd, o, result)
+	}
+	if version >= 90600 {
+		reportVacuumProgress(fd, o, result)
+	}
+	if result.AutovacuumSaturation != nil {
+		reportAutovacuumSaturation(fd, result)
+	}
+	reportRoles(fd, o, result)
+	reportSecurity(fd, o, result)
+	reportTablespaces(fd, o, result)
+	if len(result.Tables) > 0 || len(result.Indexes) > 0 {
+		reportTablespaceIO(fd, o, result)
+	}
+	reportDatabases(fd, o, result)
+	if len(result.MatViews) > 0 {
+		reportMatViews(fd, o, result)
+	}
+	reportWriteChurn(fd, o, result)
+	reportTables(fd, o, result)
+	if result.Diagnostics != nil {
+		reportDiagnostics(fd, o, result)
+	}
+	fmt.Fprintln(fd)
+}
+
+func fmtLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		keys[i] = k + "=" + labels[k]
+	}
+	return strings.Join(keys, ", ")
+}
+
+func reportTimelineHistory(fd io.Writer, o Options, result *pgmetrics.Model) {
+	fmt.Fprint(fd, `
+Timeline History:
+`)
+	tw := tableWriter{o: o}
+	tw.add("From", "To", "Switched At", "Time", "Reason")
+	for _, t := range result.TimelineHistory {
+		tw.add(t.ParentTLI, t.TLI, t.SwitchLSN, fmtTimeAndSince(o, t.At), t.Reason)
+	}
+	tw.write(fd, "    ")
+}
+
+func reportRecovery(fd io.Writer, o Options, result *pgmetrics.Model) {
+	fmt.Fprintf(fd, `
+Recovery Status:
+    Replay paused:       %s
+    Received LSN:        %s
+    Replayed LSN:        %s%s
+    Last Replayed Txn:   %s
+`,
+		fmtYesNo(result.IsWalReplayPaused),
+		result.LastWALReceiveLSN,
+		result.LastWALReplayLSN,
+		fmtLag(result.LastWALReceiveLSN, result.LastWALReplayLSN, ""),
+		fmtTimeAndSince(o, result.LastXActReplayTimestamp))
+
+	if p := result.RecoveryPrefetch; p != nil {
+		fmt.Fprintf(fd, `    Prefetched Blocks:   %d prefetched, %d hit, %d skipped
+    Prefetch Distance:   %s of WAL, %d blocks, %d I/Os in flight
+`,
+			p.Prefetch, p.Hit, p.SkipInit+p.SkipNew+p.SkipFPW+p.SkipRep,
+			humanize.IBytes(uint64(p.WALDistance)), p.BlockDistance, p.IODepth)
+	}
+}
+
+func reportReplicationIn(fd io.Writer, result *pgmetrics.Model) {
+	ri := result.ReplicationIncoming
+	var recvDiff string
+	if d, ok := lsnDiff(ri.ReceivedLSN, ri.ReceiveStartLSN); ok && d > 0 {
+		recvDiff = ", " + humanize.IBytes(uint64(d))
+	}
+
+	fmt.Fprintf(fd, `
+Incoming Replication Stats:
+    Status:              %s
+    Received LSN:        %s (started at %s%s)
+    Timeline:            %d (was %d at start)
+    Latency:             %s
+    Replication Slot:    %s
+`,
+		ri.Status,
+		ri.ReceivedLSN, ri.ReceiveStartLSN, recvDiff,
+		ri.ReceivedTLI, ri.ReceiveStartTLI,
+		fmtMicros(ri.Latency),
+		ri.SlotName)
+	if len(ri.WrittenLSN) > 0 {
+		fmt.Fprintf(fd, `    Written LSN:         %s%s
+`,
+			ri.WrittenLSN, fmtLag(ri.WrittenLSN, ri.ReceivedLSN, "flush"))
+	}
+	if len(result.Metadata.Upstream) > 0 {
+		fmt.Fprintf(fd, `    Upstream:            %s
+`,
+			result.Metadata.Upstream)
+	}
+}
+
+func reportReplicationOut(fd io.Writer, o Options, result *pgmetrics.Model) {
+	routs := result.ReplicationOutgoing
+	fmt.Fprintf(fd, `
+Outgoing Replication Stats:`)
+	for i, r := range routs {
+		var sp string
+		if r.SyncPriority != -1 {
+			sp = strconv.Itoa(r.SyncPriority)
+		}
+		fmt.Fprintf(fd, `
+    Destination #%d:
+      User:              %s
+      Application:       %s
+      Client Address:    %s
+      State:             %s
+      Started At:        %s
+      Sent LSN:          %s
+      Written Until:     %s%s
+      Flushed Until:     %s%s
+      Replayed Until:    %s%s
+      Sync Priority:     %s
+      Sync State:        %s`,
+			i+1,
+			r.RoleName,
+			r.ApplicationName,
+			r.ClientAddr,
+			r.State,
+			fmtTimeAndSince(o, r.BackendStart),
+			r.SentLSN,
+			r.WriteLSN, fmtLag(r.SentLSN, r.WriteLSN, "write"),
+			r.FlushLSN, fmtLag(r.WriteLSN, r.FlushLSN, "flush"),
+			r.ReplayLSN, fmtLag(r.FlushLSN, r.ReplayLSN, "replay"),
+			sp,
+			r.SyncState,
+		)
+	}
+	fmt.Fprintln(fd)
+}
+
+func reportReplicationSlots(fd io.Writer, o Options, result *pgmetrics.Model, version int) {
+	// the WAL retained by slots is known only on primaries
+	retained := !result.IsInRecovery && len(result.WALLSN) > 0
+	var phy, log int
+	for _, r := range result.ReplicationSlots {
+		if r.SlotType == "physical" {
+			phy++
+		} else {
+			log++
+		}
+	}
+	if phy > 0 {
+		fmt.Fprintf(fd, `
+Physical Replication Slots:
+`)
+		tw := tableWriter{o: o}
+		cols := []interface{}{"Name", "Active", "Oldest Txn ID", "Restart LSN"}
+		if version >= 100000 {
+			cols = append(cols, "Temporary")
+		}
+		if retained {
+			cols = append(cols, "Retained WAL", "Inactive For")
+		}
+		tw.add(cols...)
+		for _, r := range result.ReplicationSlots {
+			if r.SlotType != "physical" {
+				continue
+			}
+			vals := []interface{}{r.SlotName, fmtYesNo(r.Active),
+				fmtIntZero(r.Xmin), r.RestartLSN}
+			if version >= 100000 {
+				vals = append(vals, fmtYesNo(r.Temporary))
+			}
+			if retained {
+				bytes, since := fmtSlotRetained(result, &r)
+				vals = append(vals, bytes, since)
+			}
+			tw.add(vals...)
+		}
+		tw.write(fd, "    ")
+	}
+	if log > 0 {
+		fmt.Fprintf(fd, `
+Logical Replication Slots:
+`)
+		tw := tableWriter{o: o}
+		cols := []interface{}{"Name", "Plugin", "Database", "Active",
+			"Oldest Txn ID", "Restart LSN", "Flushed Until"}
+		if version >= 100000 {
+			cols = append(cols, "Temporary")
+		}
+		if version >= 140000 {
+			cols = append(cols, "Two Phase")
+		}
+		if retained {
+			cols = append(cols, "Retained WAL", "Inactive For")
+		}
+		tw.add(cols...)
+		for _, r := range result.ReplicationSlots {
+			if r.SlotType != "logical" {
+				continue
+			}
+			vals := []interface{}{r.SlotName, r.Plugin, r.DBName,
+				fmtYesNo(r.Active), fmtIntZero(r.Xmin), r.RestartLSN,
+				r.ConfirmedFlushLSN}
+			if version >= 100000 {
+				vals = append(vals, fmtYesNo(r.Temporary))
+			}
+			if version >= 140000 {
+				vals = append(vals, fmtYesNo(r.TwoPhase))
+			}
+			if retained {
+				bytes, since := fmtSlotRetained(result, &r)
+				vals = append(vals, bytes, since)
+			}
+			tw.add(vals...)
+		}
+		tw.write(fd, "    ")
+	}
+}
+
+// WAL files and archiving
+// reportXminHorizon reports what is holding back vacuum, if anything, and
+// which of them is the limiting factor.
+// walRate returns the rate at which WAL was being generated, in bytes per
+// second, if it was measured.
+func walRate(result *pgmetrics.Model) float64 {
+	if result.Rates != nil && result.Rates.WALBytes > 0 {
+		return result.Rates.WALBytes
+	}
+	if result.WALActivity != nil {
+		return result.WALActivity.BytesPerSec
+	}
+	return 0
+}
+
+// fmtSlotRetained returns the WAL retained by the slot, and if it is
+// inactive, for how long. Before v17, which records when the slot became
+// inactive, this is estimated from the retained WAL and the WAL rate, if it
+// was measured.
+func fmtSlotRetained(result *pgmetrics.Model, r *pgmetrics.ReplicationSlot) (string, string) {
+	n, ok := lsnDiff(result.WALLSN, r.RestartLSN)
+	if !ok || n < 0 {
+		return "", ""
+	}
+	bytes := humanize.IBytes(uint64(n))
+	if r.Active {
+		return bytes, ""
+	}
+	if r.InactiveSince > 0 {
+		secs := result.Metadata.At - r.InactiveSince
+		return bytes, fmt.Sprintf("%.1f hours", float64(secs)/3600)
+	}
+	if rate := walRate(result); rate > 0 {
+		return bytes, fmt.Sprintf("~%.1f hours (est.)", float64(n)/rate/3600)
+	}
+	return bytes, "unknown"
+}
+
+func reportXminHorizon(fd io.Writer, o Options, result *pgmetrics.Model) {
+	feedback := result.IsInRecovery && getSetting(result, "hot_standby_feedback") == "on"
+	deferAge := getSettingInt(result, "vacuum_defer_cleanup_age") // removed in v16
+	if len(result.XminHolders) == 0 && !feedback && deferAge <= 0 {
+		return
+	}
+
+	fmt.Fprint(fd, `
+Xmin Horizon:`)
+	if feedback {
+		fmt.Fprint(fd, `
+    Standby Feedback:    on, queries on this standby hold back vacuum upstream`)
+	}
+	if deferAge > 0 {
+		fmt.Fprintf(fd, `
+    Cleanup Deferred By: %d transactions (vacuum_defer_cleanup_age)`, deferAge)
+	}
+	if len(result.XminHolders) == 0 {
+		fmt.Fprintln(fd)
+		return
+	}
+	// catalog_xmin holds back vacuum of catalog tables only, so prefer
+	// something else as the limiting factor
+	limit := &result.XminHolders[0]
+	for i := range result.XminHolders {
+		if result.XminHolders[i].Kind != "slot catalog" {
+			limit = &result.XminHolders[i]
+			break
+		}
+	}
+	fmt.Fprintf(fd, `
+    Limiting Factor:     %s %s, xmin age %d
+`, limit.Kind, limit.Name, limit.Age)
+
+	tw := tableWriter{o: o}
+	tw.add("Kind", "Name", "Xmin", "Age", "Note")
+	for _, h := range result.XminHolders {
+		tw.add(h.Kind, h.Name, h.Xmin, h.Age, xminHolderNote(result, &h))
+	}
+	tw.write(fd, "    ")
+}
+
+func xminHolderNote(result *pgmetrics.Model, h *pgmetrics.XminHolder) string {
+	switch h.Kind {
+	case "standby":
+		return "hot_standby_feedback from standby"
+	case "backend":
+		var pid int
+		if _, err := fmt.Sscanf(h.Name, "%d", &pid); err == nil {
+			if be := getBE(result, pid); be != nil {
+				return be.State
+			}
+		}
+	case "prepared":
+		return "prepared transaction, needs COMMIT/ROLLBACK PREPARED"
+	case "slot", "slot catalog":
+		var note string
+		for _, s := range result.ReplicationSlots {
+			if s.SlotName != h.Name {
+				continue
+			}
+			if h.Kind == "slot catalog" {
+				note = "catalog tables only"
+			} else if s.SlotType == "physical" {
+				note = "hot_standby_feedback via slot"
+			}
+			if !s.Active {
+				if len(note) > 0 {
+					note += ", "
+				}
+				note += "slot is inactive"
+			}
+		}
+		return note
+	}
+	return ""
+}
+
+// reportReplicationReadiness checks the settings and pg_hba.conf rules that
+// are needed for serving replicas and replication slots, against how many
+// are in use.
+func reportReplicationReadiness(fd io.Writer, o Options, result *pgmetrics.Model) {
+	var problems []string
+	tw := tableWriter{o: o}
+	tw.add("Prerequisite", "Value", "In Use", "Status")
+
+	// wal_level
+	walLevel := getSetting(result, "wal_level")
+	var logicalSlots, physicalSlots int
+	for _, rs := range result.ReplicationSlots {
+		if rs.SlotType == "logical" {
+			logicalSlots++
+		} else {
+			physicalSlots++
+		}
+	}
+	status := "ok"
+	switch {
+	case walLevel == "minimal":
+		status = "replicas not possible, needs replica or logical"
+		problems = append(problems, "wal_level")
+	case logicalSlots > 0 && walLevel != "logical":
+		status = "logical slots need logical"
+		problems = append(problems, "wal_level")
+	}
+	tw.add("wal_level", walLevel, "", status)
+
+	// senders and slots
+	capacity := func(name string, used int) {
+		if _, ok := result.Settings[name]; !ok {
+			return
+		}
+		max := getSettingInt(result, name)
+		status := "ok"
+		switch {
+		case max == 0:
+			status = "disabled"
+			problems = append(problems, name)
+		case used >= max:
+			status = "all in use"
+			problems = append(problems, name)
+		case used == max-1:
+			status = "only 1 left"
+		}
+		tw.add(name, max, used, status)
+	}
+	capacity("max_wal_senders", len(result.ReplicationOutgoing))
+	capacity("max_replication_slots", len(result.ReplicationSlots))
+
+	// retention of WAL for replicas that do not use slots
+	archiveMode := getSetting(result, "archive_mode")
+	keepName := "wal_keep_size" // v13+
+	if _, ok := result.Settings[keepName]; !ok {
+		keepName = "wal_keep_segments"
+	}
+	if keep, ok := result.Settings[keepName]; ok {
+		status = "ok"
+		if keep.Setting == "0" && physicalSlots == 0 && archiveMode == "off" {
+			status = "replicas without slots or an archive can fall behind"
+		}
+		tw.add(keepName, keep.Setting, "", status)
+	}
+	tw.add("archive_mode", archiveMode, "", "")
+
+	// pg_hba.conf rules for replication connections, available only in v10+
+	// and to superusers
+	if len(result.HBARules) > 0 {
+		var n int
+		for _, r := range result.HBARules {
+			for _, d := range r.Databases {
+				if d == "replication" && len(r.Error) == 0 {
+					n++
+					break
+				}
+			}
+		}
+		status = "ok"
+		if n == 0 {
+			status = "no rules allow replication connections"
+			problems = append(problems, "pg_hba.conf")
+		}
+		tw.add("pg_hba.conf replication rules", n, "", status)
+	}
+
+	ready := "yes"
+	if len(problems) > 0 {
+		ready = "no, check " + strings.Join(problems, ", ")
+	}
+	fmt.Fprintf(fd, `
+Replication Readiness:
+    Can Serve Replicas?  %s
+`, ready)
+	tw.write(fd, "    ")
+}
+
+func reportReplicationOrigins(fd io.Writer, o Options, result *pgmetrics.Model) {
+	fmt.Fprintf(fd, `
+Replication Origins:
+`)
+	tw := tableWriter{o: o}
+	tw.add("ID", "Name", "Remote LSN", "Local LSN")
+	for _, r := range result.ReplicationOrigins {
+		tw.add(r.ID, r.Name, r.RemoteLSN, r.LocalLSN)
+	}
+	tw.write(fd, "    ")
+}
+
+func reportWAL(fd io.Writer, o Options, result *pgmetrics.Model) {
+
+	archiveMode := getSetting(result, "archive_mode") == "on"
+	fmt.Fprintf(fd, `
+WAL Files:
+    WAL Archiving?       %s`,
+		fmtYesNo(archiveMode),
+	)
+	if result.WALCount != -1 {
+		fmt.Fprintf(fd, `
+    WAL Files:           %d`,
+			result.WALCount)
+	}
+	if archiveMode {
+		var rate float64
+		secs := result.Metadata.At - result.WALArchiving.StatsReset
+		if secs > 0 {
+			rate = float64(result.WALArchiving.ArchivedCount) / (float64(secs) / 60)
+		}
+		var rf string
+		if result.WALReadyCount > -1 {
+			rf = strconv.Itoa(result.WALReadyCount)
+		}
+		fmt.Fprintf(fd, `
+    Ready Files:         %s
+    Archive Rate:        %.2f per min
+    Last Archived:       %s
+    Last Failure:        %s
+    Totals:              %d succeeded, %d failed
+    Totals Since:        %s`,
+			rf,
+			rate,
+			fmtTimeAndSince(o, result.WALArchiving.LastArchivedTime),
+			fmtTimeAndSince(o, result.WALArchiving.LastFailedTime),
+			result.WALArchiving.ArchivedCount, result.WALArchiving.FailedCount,
+			fmtTimeAndSince(o, result.WALArchiving.StatsReset),
+		)
+		if a := result.WALArchiving; len(a.CurrentWAL) > 0 {
+			var warn string
+			if a.LagSegments >= summaryArchiveLag {
+				warn = " (warning: archiving is falling behind)"
+			}
+			fmt.Fprintf(fd, `
+    Current WAL File:    %s
+    Archive Lag:         %d files, %s%s`,
+				a.CurrentWAL,
+				a.LagSegments, humanize.IBytes(uint64(a.LagBytes)), warn,
+			)
+		}
+	}
+	fmt.Fprintln(fd)
+	maxwalk, maxwalv := getMaxWalSize(result)
+	tw1 := tableWriter{o: o}
+	tw1.add("Setting", "Value")
+	tw1.add("wal_level", getSetting(result, "wal_level"))
+	tw1.add("archive_timeout", getSetting(result, "archive_timeout"))
+	tw1.add("wal_compression", getSetting(result, "wal_compression"))
+	tw1.add(maxwalk, maxwalv)
+	tw1.add("min_wal_size", getSettingBytes(result, "min_wal_size", 16*1024*1024)) //getMinWalSize(result))
+	tw1.add("checkpoint_timeout", getSetting(result, "checkpoint_timeout"))
+	tw1.add("full_page_writes", getSetting(result, "full_page_writes"))
+	tw1.add("wal_keep_segments", getSetting(result, "wal_keep_segments"))
+	tw1.write(fd, "    ")
+
+	if result.WALActivity != nil {
+		reportWALActivity(fd, o, result)
+	}
+	if result.WALSummarizer != nil {
+		reportWALSummarizer(fd, result)
+	}
+	if len(result.ArchiveFailures) > 0 {
+		reportArchiveFailures(fd, o, result)
+	}
+	if len(result.ArchivedWALs) > 0 {
+		reportArchivedWALs(fd, o, result)
+	}
+}
+
+func reportWALSummarizer(fd io.Writer, result *pgmetrics.Model) {
+	ws := result.WALSummarizer
+	running := "no"
+	if ws.PID != 0 {
+		running = fmt.Sprintf("yes, pid %d", ws.PID)
+	}
+	var oldest string
+	if len(ws.OldestLSN) > 0 {
+		oldest = fmt.Sprintf(" (oldest from %s)", ws.OldestLSN)
+	}
+	fmt.Fprintf(fd, `
+    WAL Summarizer:
+      Running?           %s
+      Summarized Upto:   %s (timeline %d)
+      Pending Upto:      %s
+      Summaries:         %d%s
+      Keep Time:         %s
+`,
+		running,
+		ws.SummarizedLSN, ws.SummarizedTLI,
+		ws.PendingLSN,
+		ws.Summaries, oldest,
+		getSetting(result, "wal_summary_keep_time")+" min",
+	)
+}
+
+func reportWALActivity(fd io.Writer, o Options, result *pgmetrics.Model) {
+	wa := result.WALActivity
+	fmt.Fprintf(fd, `
+    WAL Activity:
+      Generation Rate:   %s/s
+      Sampled:           %s over %.1fs (%s to %s)
+`,
+		humanize.IBytes(uint64(wa.BytesPerSec)),
+		humanize.IBytes(uint64(wa.Bytes)), wa.Interval, wa.StartLSN, wa.EndLSN,
+	)
+	if len(wa.TopStatements) == 0 {
+		return
+	}
+	fmt.Fprint(fd, `
+      Top WAL Producers:
+`)
+	tw := tableWriter{o: o}
+	tw.add("Query", "Database", "User", "Calls", "WAL", "FPI", "Share")
+	for _, s := range wa.TopStatements {
+		tw.add(prepQ(s.Query), s.DBName, s.UserName, s.Calls,
+			humanize.IBytes(uint64(s.WALBytes)), s.WALFPI,
+			fmtPct(s.WALBytes, wa.Bytes))
+	}
+	tw.write(fd, "      ")
+}
+
+// reportArchiveFailures lists the WAL files that failed to archive, as seen in
+// the log, along with the last error for each.
+func reportArchiveFailures(fd io.Writer, o Options, result *pgmetrics.Model) {
+	var files []string
+	byFile := make(map[string][]*pgmetrics.ArchiveFailure)
+	for i := range result.ArchiveFailures {
+		f := &result.ArchiveFailures[i]
+		if _, ok := byFile[f.WALFile]; !ok {
+			files = append(files, f.WALFile)
+		}
+		byFile[f.WALFile] = append(byFile[f.WALFile], f)
+	}
+
+	fmt.Fprint(fd, `
+    Archive Failures (from log):
+`)
+	tw := tableWriter{o: o}
+	tw.add("WAL File", "Failures", "Last Failure", "Error")
+	for _, name := range files {
+		ff := byFile[name]
+		last := ff[len(ff)-1]
+		msg := last.Error
+		if len(last.Command) > 0 {
+			msg += ": " + last.Command
+		}
+		tw.add(name, len(ff), fmtTimeAndSince(o, last.At), prepQ(msg))
+	}
+	tw.write(fd, "      ")
+}
+
+// only these many of the most recently archived or restored files are listed
+const archivedWALRows = 20
+
+// reportArchivedWALs summarizes the intervals between archiving or restoring
+// successive WAL files, and lists the most recent ones, as seen in the log.
+func reportArchivedWALs(fd io.Writer, o Options, result *pgmetrics.Model) {
+	fmt.Fprint(fd, `
+    Archived/Restored WAL Files (from log):`)
+	for _, op := range []string{"archive", "restore"} {
+		var n, retried, timed int
+		var total, max float64
+		for _, a := range result.ArchivedWALs {
+			if a.Op != op {
+				continue
+			}
+			n++
+			if a.Failures > 0 {
+				retried++
+			}
+			if a.Interval > 0 {
+				timed++
+				total += a.Interval
+				if a.Interval > max {
+					max = a.Interval
+				}
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		label := "Archived:          "
+		if op == "restore" {
+			label = "Restored:          "
+		}
+		var times string
+		if timed > 0 {
+			times = fmt.Sprintf(", every %.1fs avg, %.1fs max", total/float64(timed), max)
+		}
+		fmt.Fprintf(fd, `
+      %s%d files, %d needed retries%s`, label, n, retried, times)
+	}
+	fmt.Fprintln(fd)
+
+	list := result.ArchivedWALs
+	if len(list) > archivedWALRows {
+		list = list[len(list)-archivedWALRows:]
+		fmt.Fprintf(fd, `      Last %d files:
+`, archivedWALRows)
+	}
+	tw := tableWriter{o: o}
+	tw.add("WAL File", "Op", "At", "Interval", "Failures")
+	for _, a := range list {
+		var interval string
+		if a.Interval > 0 {
+			interval = fmt.Sprintf("%.1fs", a.Interval)
+		}
+		tw.add(a.WALFile, a.Op, fmtTime(o, a.At), interval, a.Failures)
+	}
+	tw.write(fd, "      ")
+}
+
+// backups running for longer than this are flagged as possibly stuck
+const backupStuckSecs = 24 * 3600
+
+func reportBackupState(fd io.Writer, o Options, result *pgmetrics.Model) {
+	bs := result.BackupState
+	stuck := func(start int64) string {
+		if start > 0 && result.Metadata.At-start > backupStuckSecs {
+			return ", running for over a day, stuck?"
+		}
+		return ""
+	}
+	fmt.Fprint(fd, `
+Backups in Progress:`)
+	if bs.ExclusiveInProgress {
+		fmt.Fprintf(fd, `
+    Exclusive Backup:        started %s%s`,
+			fmtTimeAndSince(o, bs.ExclusiveStart), stuck(bs.ExclusiveStart))
+	}
+	if bs.LabelFileTime > 0 {
+		var stale string
+		if !bs.ExclusiveInProgress && !result.IsInRecovery {
+			stale = `
+      warning: no exclusive backup is in progress, so this file is stale
+      and will prevent the server from restarting after a crash`
+		}
+		fmt.Fprintf(fd, `
+    backup_label File:       present, modified %s%s`,
+			fmtTimeAndSince(o, bs.LabelFileTime), stale)
+	}
+	fmt.Fprintln(fd)
+	if len(bs.BaseBackups) == 0 {
+		return
+	}
+
+	fmt.Fprint(fd, `    Base Backups:
+`)
+	tw := tableWriter{o: o}
+	tw.add("PID", "Client", "App", "Phase", "Streamed", "Tablespaces", "Started")
+	for _, b := range bs.BaseBackups {
+		streamed := humanize.IBytes(uint64(b.BackupStreamed))
+		if b.BackupTotal > 0 {
+			streamed += fmt.Sprintf(" of %s (%.1f%%)",
+				humanize.IBytes(uint64(b.BackupTotal)),
+				100*safeDiv(b.BackupStreamed, b.BackupTotal))
+		}
+		tw.add(b.PID, b.ClientAddr, b.ApplicationName, b.Phase, streamed,
+			fmt.Sprintf("%d of %d", b.TablespacesStreamed, b.TablespacesTotal),
+			fmtTimeAndSince(o, b.BackendStart)+stuck(b.BackendStart))
+	}
+	tw.write(fd, "      ")
+}
+
+func reportBGWriter(fd io.Writer, o Options, result *pgmetrics.Model) {
+
+	bgw := result.BGWriter
+	blkSize := getBlockSize(result)
+	var rate float64
+	secs := result.Metadata.At - bgw.StatsReset
+	ncps := bgw.CheckpointsTimed + bgw.CheckpointsRequested
+	if secs > 0 {
+		rate = float64(ncps) / (float64(secs) / 60)
+	}
+	totBuffers := bgw.BuffersCheckpoint + bgw.BuffersClean + bgw.BuffersBackend
+	var pctSched, pctReq, avgWrite, rateBuffers float64
+	if ncps > 0 {
+		ncpsf := float64(ncps)
+		pctSched = 100 * float64(bgw.CheckpointsTimed) / ncpsf
+		pctReq = 100 * float64(bgw.CheckpointsRequested) / ncpsf
+		avgWrite = float64(bgw.BuffersCheckpoint) * float64(blkSize) / ncpsf
+	}
+	if secs > 0 {
+		rateBuffers = float64(totBuffers) / float64(secs)
+	}
+	var pctBufCP, pctBufBGW, pctBufBE float64
+	if totBuffers > 0 {
+		totBuffersf := float64(totBuffers)
+		pctBufCP = 100 * float64(bgw.BuffersCheckpoint) / totBuffersf
+		pctBufBGW = 100 * float64(bgw.BuffersClean) / totBuffersf
+		pctBufBE = 100 * float64(bgw.BuffersBackend) / totBuffersf
+	}
+	fmt.Fprintf(fd, `
+BG Writer:
+    Checkpoint Rate:     %.2f per min
+    Average Write:       %s per checkpoint
+    Total Checkpoints:   %d sched (%.1f%%) + %d req (%.1f%%) = %d
+    Total Write:         %s, @ %s per sec
+    Buffers Allocated:   %d (%s)
+    Buffers Written:     %d chkpt (%.1f%%) + %d bgw (%.1f%%) + %d be (%.1f%%)
+    Clean Scan Stops:    %d
+    BE fsyncs:           %d
+    Counts Since:        %s
+`,
+		rate,
+		humanize.IBytes(uint64(avgWrite)),
+		bgw.CheckpointsTimed, pctSched,
+		bgw.CheckpointsRequested, pctReq, ncps,
+		humanize.IBytes(uint64(blkSize)*uint64(totBuffers)),
+		humanize.IBytes(uint64(float64(blkSize)*rateBuffers)),
+		bgw.BuffersAlloc, humanize.IBytes(uint64(blkSize)*uint64(bgw.BuffersAlloc)),
+		bgw.BuffersCheckpoint, pctBufCP,
+		bgw.BuffersClean, pctBufBGW,
+		bgw.BuffersBackend, pctBufBE,
+		bgw.MaxWrittenClean, bgw.BuffersBackendFsync,
+		fmtTimeAndSince(o, bgw.StatsReset),
+	)
+	if cp := result.Checkpointer; cp != nil {
+		if cp.NumDone > 0 {
+			fmt.Fprintf(fd, `    Checkpoints Done:    %d of %d (rest were skipped)
+`,
+				cp.NumDone, ncps)
+		}
+		if nrps := cp.RestartpointsTimed + cp.RestartpointsRequested; nrps > 0 || result.IsInRecovery {
+			fmt.Fprintf(fd, `    Restartpoints:       %d sched + %d req = %d, %d done
+`,
+				cp.RestartpointsTimed, cp.RestartpointsRequested, nrps,
+				cp.RestartpointsDone)
+		}
+		if cp.SLRUWritten > 0 {
+			fmt.Fprintf(fd, `    SLRU Writes:         %d
+`,
+				cp.SLRUWritten)
+		}
+		if cp.StatsReset != bgw.StatsReset {
+			fmt.Fprintf(fd, `    Checkpointer Since:  %s
+`,
+				fmtTimeAndSince(o, cp.StatsReset))
+		}
+	}
+
+	tw := tableWriter{o: o}
+	tw.add("Setting", "Value")
+	tw.add("bgwriter_delay", getSetting(result, "bgwriter_delay")+" msec")
+	tw.add("bgwriter_flush_after", getSettingBytes(result, "bgwriter_flush_after", uint64(blkSize)))
+	tw.add("bgwriter_lru_maxpages", getSetting(result, "bgwriter_lru_maxpages"))
+	tw.add("bgwriter_lru_multiplier", getSetting(result, "bgwriter_lru_multiplier"))
+	tw.add("block_size", getSetting(result, "block_size"))
+	tw.add("checkpoint_timeout", getSetting(result, "checkpoint_timeout")+" sec")
+	tw.add("checkpoint_completion_target", getSetting(result, "checkpoint_completion_target"))
+	tw.write(fd, "    ")
+}
+
+func reportIOStats(fd io.Writer, o Options, result *pgmetrics.Model) {
+	fmt.Fprint(fd, `
+I/O Stats:
+`)
+	tw := tableWriter{o: o}
+	tw.add("Backend Type", "Object", "Context", "Read", "Written", "Extended",
+		"Hits", "Evictions", "Reuses", "Fsyncs")
+	for _, s := range result.IOStats {
+		if s.Reads+s.Writes+s.Extends+s.Hits+s.Evictions+s.Reuses+s.Fsyncs == 0 {
+			continue
+		}
+		tw.add(s.BackendType, s.Object, s.Context,
+			humanize.IBytes(uint64(s.ReadBytes)),
+			humanize.IBytes(uint64(s.WriteBytes)),
+			humanize.IBytes(uint64(s.ExtendBytes)),
+			s.Hits, s.Evictions, s.Reuses, s.Fsyncs)
+	}
+	if len(tw.data) == 1 {
+		fmt.Fprint(fd, `    No I/O recorded.
+`)
+		return
+	}
+	tw.write(fd, "    ")
+	if len(result.IOStats) > 0 {
+		fmt.Fprintf(fd, `    Counts Since:        %s
+`,
+			fmtTimeAndSince(o, result.IOStats[0].StatsReset))
+	}
+}
+
+// logHeatWidth is the width of the bar showing the relative amount of
+// activity in each hour.
+const logHeatWidth = 30
+
+func reportLogHours(fd io.Writer, o Options, result *pgmetrics.Model) {
+	max := 0
+	for _, h := range result.LogHours {
+		if n := h.Errors + h.SlowQueries + h.AutoVacuums + h.Deadlocks; n > max {
+			max = n
+		}
+	}
+	fmt.Fprint(fd, `
+Log Activity by Hour:
+`)
+	tw := tableWriter{o: o}
+	tw.add("Hour", "Errors", "Slow Queries", "Autovacuums", "Deadlocks", "Activity")
+	var prev int64
+	for _, h := range result.LogHours {
+		// show the hours without any entries too
+		for prev > 0 && h.Hour-prev > 3600 {
+			prev += 3600
+			tw.add(fmtLayout(o, prev, "2 Jan 2006 3 PM"), 0, 0, 0, 0,
+				strings.Repeat(" ", logHeatWidth))
+		}
+		prev = h.Hour
+		var bar string
+		if n := h.Errors + h.SlowQueries + h.AutoVacuums + h.Deadlocks; n > 0 {
+			bar = strings.Repeat("#", 1+(logHeatWidth-1)*n/max)
+		}
+		bar += strings.Repeat(" ", logHeatWidth-len(bar)) // left-align
+		tw.add(fmtLayout(o, h.Hour, "2 Jan 2006 3 PM"), h.Errors,
+			h.SlowQueries, h.AutoVacuums, h.Deadlocks, bar)
+	}
+	tw.write(fd, "    ")
+}
+
+func reportLogVolume(fd io.Writer, o Options, result *pgmetrics.Model) {
+	v := result.LogVolume
+	fmt.Fprintf(fd, `
+Log Volume:
+    Entries:             %d
+    Lines:               %d
+    Size:                %s
+`,
+		v.Entries, v.Lines, humanize.IBytes(uint64(v.Bytes)))
+	if len(v.TopMessages) == 0 {
+		return
+	}
+	tw := tableWriter{o: o}
+	tw.add("Count", "Level", "Last Logged", "Message")
+	for _, m := range v.TopMessages {
+		tw.add(m.Count, m.Level, fmtTime(o, m.Last), prepQ(m.Message))
+	}
+	tw.write(fd, "    ")
+}
+
+func reportLogErrorSummary(fd io.Writer, o Options, result *pgmetrics.Model) {
+	fmt.Fprint(fd, `
+Errors by SQLSTATE (from log):
+`)
+	list := append([]pgmetrics.LogErrorCount(nil), result.LogErrorSummary...)
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Count > list[j].Count })
+	tw := tableWriter{o: o}
+	tw.add("Count", "Level", "SQLSTATE", "Condition", "Last Logged", "Message")
+	for _, e := range list {
+		tw.add(e.Count, e.Level, e.SQLState, e.Condition, fmtTime(o, e.Last), prepQ(e.Message))
+	}
+	tw.write(fd, "    ")
+}
+
+func reportDDLEvents(fd io.Writer, o Options, result *pgmetrics.Model) {
+	fmt.Fprint(fd, `
+DDL Statements (from log):
+`)
+	tw := tableWriter{o: o}
+	tw.add("Time", "User", "Database", "Command", "Statement")
+	for _, e := range result.DDLEvents {
+		tw.add(fmtTime(o, e.At), e.UserName, e.Database, e.Command, prepQ(e.Statement))
+	}
+	tw.write(fd, "    ")
+}
+
+func reportCheckpoints(fd io.Writer, o Options, result *pgmetrics.Model) {
+	fmt.Fprint(fd, `
+Checkpoints (from log):
+`)
+	tw := tableWriter{o: o}
+	tw.add("Started", "Completed", "Reason", "Buffers", "Write", "Sync", "Total", "Distance")
+	for _, cp := range result.Checkpoints {
+		start, reason := "?", cp.Reason
+		if cp.Start > 0 {
+			start = fmtTime(o, cp.Start)
+		}
+		if cp.Restartpoint {
+			reason = strings.TrimSpace("restartpoint " + reason)
+		}
+		var dist string
+		if cp.Distance > 0 {
+			dist = humanize.IBytes(uint64(cp.Distance))
+		}
+		tw.add(start, fmtTime(o, cp.End), reason,
+			fmt.Sprintf("%s (%.1f%%)", fmtCount(o, cp.Buffers), 100*cp.BuffersUsage),
+			fmt.Sprintf("%.3fs", cp.WriteTime), fmt.Sprintf("%.3fs", cp.SyncTime),
+			fmt.Sprintf("%.3fs", cp.TotalTime), dist)
+	}
+	tw.write(fd, "    ")
+}
+
+func reportLockWaits(fd io.Writer, o Options, result *pgmetrics.Model) {
+	fmt.Fprint(fd, `
+Lock Waits (from log):
+`)
+	tw := tableWriter{o: o}
+	tw.add("Time", "PID", "Status", "Lock", "Waited", "Blocked By", "Database")
+	for _, w := range result.LockWaits {
+		status := "waiting"
+		if w.Acquired {
+			status = "acquired"
+		}
+		lock := w.Mode + " on " + w.Object
+		if len(w.Relation) > 0 {
+			lock = w.Mode + " on " + w.Relation
+		}
+		var pids []string
+		for _, pid := range w.BlockingPIDs {
+			pids = append(pids, strconv.Itoa(pid))
+		}
+		tw.add(fmtTime(o, w.At), w.PID, status, lock, fmt.Sprintf("%.3fs", w.Wait),
+			strings.Join(pids, ", "), w.Database)
+	}
+	tw.write(fd, "    ")
+}
+
+// reportTempFiles lists the statements that created the most temporary
+// files, by total size.
+func reportTempFiles(fd io.Writer, o Options, result *pgmetrics.Model) {
+	type tempStats struct {
+		db, stmt       string
+		count          int
+		total, largest int64
+	}
+	var list []*tempStats
+	var total int64
+	index := make(map[[2]string]*tempStats)
+	for _, t := range result.TempFileEvents {
+		key := [2]string{t.Database, t.Statement}
+		ts, ok := index[key]
+		if !ok {
+			ts = &tempStats{db: t.Database, stmt: t.Statement}
+			index[key] = ts
+			list = append(list, ts)
+		}
+		ts.count++
+		ts.total += t.Size
+		if t.Size > ts.largest {
+			ts.largest = t.Size
+		}
+		total += t.Size
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].total > list[j].total })
+	fmt.Fprintf(fd, `
+Temporary Files (from log):
+    %d files, %s in total
+`, len(result.TempFileEvents), humanize.IBytes(uint64(total)))
+	tw := tableWriter{o: o}
+	tw.add("Files", "Total Size", "Largest", "Database", "Statement")
+	for i, ts := range list {
+		if i == 20 {
+			break
+		}
+		tw.add(ts.count, humanize.IBytes(uint64(ts.total)),
+			humanize.IBytes(uint64(ts.largest)), ts.db, prepQ(ts.stmt))
+	}
+	tw.write(fd, "    ")
+}
+
+func reportConnectionChurn(fd io.Writer, o Options, result *pgmetrics.Model) {
+	cc := result.ConnectionChurn
+	var conns, disconns int
+	var total float64
+	for _, c := range cc.Counts {
+		conns += c.Connections
+		disconns += c.Disconnections
+		total += c.SessionTime
+	}
+	fmt.Fprintf(fd, `
+Connections (from log):
+    Received:            %d
+    Authorized:          %d
+    Disconnected:        %d%s
+`,
+		cc.Received, conns, disconns, fmtAvgSession(total, disconns, ", average session "))
+	if len(cc.Counts) == 0 {
+		return
+	}
+	counts := append([]pgmetrics.ConnectionCounts(nil), cc.Counts...)
+	sort.SliceStable(counts, func(i, j int) bool {
+		return counts[i].Connections+counts[i].Disconnections >
+			counts[j].Connections+counts[j].Disconnections
+	})
+	tw := tableWriter{o: o}
+	head := []interface{}{"Database", "User", "Connections", "Disconnections", "Avg Session"}
+	for _, b := range cc.Buckets {
+		head = append(head, "<="+fmtBucket(b))
+	}
+	if len(cc.Buckets) > 0 {
+		head = append(head, ">"+fmtBucket(cc.Buckets[len(cc.Buckets)-1]))
+	}
+	tw.add(head...)
+	for _, c := range counts {
+		row := []interface{}{c.Database, c.UserName, c.Connections, c.Disconnections,
+			fmtAvgSession(c.SessionTime, c.Disconnections, "")}
+		for _, n := range c.Histogram {
+			row = append(row, n)
+		}
+		tw.add(row...)
+	}
+	tw.write(fd, "    ")
+}
+
+// fmtAvgSession formats the average of the total session time over n
+// sessions, after the prefix. It is empty if there were no sessions.
+func fmtAvgSession(total float64, n int, prefix string) string {
+	if n == 0 {
+		return ""
+	}
+	d := time.Duration(total / float64(n) * float64(time.Second))
+	return prefix + d.Round(time.Millisecond).String()
+}
+
+// fmtBucket formats an upper bound of a session time bucket, like "10s" or
+// "1h".
+func fmtBucket(secs float64) string {
+	switch {
+	case secs >= 3600:
+		return strconv.FormatFloat(secs/3600, 'f', -1, 64) + "h"
+	case secs >= 60:
+		return strconv.FormatFloat(secs/60, 'f', -1, 64) + "m"
+	}
+	return strconv.FormatFloat(secs, 'f', -1, 64) + "s"
+}
+
+func reportDiagnostics(fd io.Writer, o Options, result *pgmetrics.Model) {
+	d := result.Diagnostics
+	fmt.Fprint(fd, `
+Collection Errors:
+`)
+	tw := tableWriter{o: o}
+	tw.add("Time", "SQLSTATE", "Error", "Query")
+	for _, e := range d.Errors {
+		tw.add(fmtTime(o, e.At), e.SQLState, e.Message,
+			prepQ(strings.Join(strings.Fields(e.Query), " ")))
+	}
+	tw.write(fd, "    ")
+	if d.MoreErrors > 0 {
+		fmt.Fprintf(fd, "    (%d more not shown)\n", d.MoreErrors)
+	}
+}
+
+func reportRates(fd io.Writer, o Options, result *pgmetrics.Model) {
+	r := result.Rates
+	fmt.Fprintf(fd, `
+Rates (sampled over %.1fs):`, r.Interval)
+	if !result.IsInRecovery {
+		fmt.Fprintf(fd, `
+    WAL Generated:       %s/s`, humanize.IBytes(uint64(r.WALBytes)))
+	}
+	fmt.Fprintln(fd)
+
+	if len(r.Databases) > 0 {
+		tw := tableWriter{o: o}
+		tw.add("Database", "TPS", "Commits/s", "Rollbacks/s", "Blks Read/s",
+			"Blks Hit/s", "Tup Ins/s", "Tup Upd/s", "Tup Del/s")
+		for _, d := range r.Databases {
+			tw.add(d.Name, fmtRate(d.TPS), fmtRate(d.XactCommit),
+				fmtRate(d.XactRollback), fmtRate(d.BlksRead), fmtRate(d.BlksHit),
+				fmtRate(d.TupInserted), fmtRate(d.TupUpdated),
+				fmtRate(d.TupDeleted))
+		}
+		tw.write(fd, "    ")
+		reportDeadlockRates(fd, o, r)
+	}
+
+	// only tables which had some activity during the interval
+	tw := tableWriter{o: o}
+	tw.add("Table", "Seq Scan/s", "Seq Tup Read/s", "Idx Scan/s",
+		"Idx Tup Fetch/s", "Ins/s", "Upd/s", "Del/s", "HOT Upd/s")
+	for _, t := range r.Tables {
+		if t.SeqScan+t.IdxScan+t.NTupIns+t.NTupUpd+t.NTupDel == 0 {
+			continue
+		}
+		tw.add(t.DBName+"."+t.SchemaName+"."+t.Name, fmtRate(t.SeqScan),
+			fmtRate(t.SeqTupRead), fmtRate(t.IdxScan), fmtRate(t.IdxTupFetch),
+			fmtRate(t.NTupIns), fmtRate(t.NTupUpd), fmtRate(t.NTupDel),
+			fmtRate(t.NTupHotUpd))
+	}
+	if len(tw.data) > 1 {
+		fmt.Fprint(fd, `
+    Active Tables:
+`)
+		tw.write(fd, "      ")
+	}
+
+	if len(r.Slots) > 0 {
+		fmt.Fprint(fd, `
+    Logical Slots:
+`)
+		tw := tableWriter{o: o}
+		tw.add("Slot", "Flushed/s", "Lag Change/s", "Warning")
+		for _, s := range r.Slots {
+			var lag, warn string
+			if !result.IsInRecovery {
+				if s.LagDelta < 0 {
+					lag = "-" + humanize.IBytes(uint64(-s.LagDelta))
+				} else {
+					lag = "+" + humanize.IBytes(uint64(s.LagDelta))
+				}
+				if s.Flushed == 0 && s.LagDelta > 0 {
+					warn = "not advancing"
+				}
+			}
+			tw.add(s.SlotName, humanize.IBytes(uint64(s.Flushed)), lag, warn)
+		}
+		tw.write(fd, "      ")
+	}
+}
+
+// reportDeadlockRates lists the databases that had deadlocks or recovery
+// conflicts during the interval.
+func reportDeadlockRates(fd io.Writer, o Options, r *pgmetrics.Rates) {
+	tw := tableWriter{o: o}
+	tw.add("Database", "Deadlocks/s", "Conflicts/s", "Deadlocks", "Conflicts")
+	for _, d := range r.Databases {
+		if d.Deadlocks+d.Conflicts == 0 {
+			continue
+		}
+		tw.add(d.Name, fmtRate(d.Deadlocks), fmtRate(d.Conflicts),
+			int64(math.Round(d.Deadlocks*r.Interval)),
+			int64(math.Round(d.Conflicts*r.Interval)))
+	}
+	if len(tw.data) == 1 {
+		fmt.Fprint(fd, `
+    No deadlocks or recovery conflicts during the interval.
+`)
+		return
+	}
+	fmt.Fprint(fd, `
+    Deadlocks and Recovery Conflicts:
+`)
+	tw.write(fd, "      ")
+}
+
+func fmtRate(v float64) string {
+	if v == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%.1f", v)
+}
+
+func isWaitingLock(be *pgmetrics.Backend) bool {
+	if be.WaitEventType == "waiting" && be.WaitEvent == "waiting" {
+		return true // before v9.6, see collector.getActivity94
+	}
+	return be.WaitEventType == "Lock"
+}
+
+func isWaitingOther(be *pgmetrics.Backend) bool {
+	return len(be.WaitEventType) > 0 && be.WaitEventType != "Lock" && be.WaitEventType != "waiting"
+}
+
+func reportBackends(fd io.Writer, o Options, result *pgmetrics.Model) {
+	n := len(result.Backends)
+	max := getSettingInt(result, "max_connections")
+	isTooLong := func(be *pgmetrics.Backend) bool {
+		return be.XactStart > 0 && result.Metadata.At-be.XactStart > int64(o.TooLongSecs)
+	}
+	var waitingLocks, waitingOther, idlexact, toolong, truncated int
+	for _, be := range result.Backends {
+		if be.QueryTruncated {
+			truncated++
+		}
+		if isWaitingLock(&be) {
+			waitingLocks++
+		}
+		if isWaitingOther(&be) {
+			waitingOther++
+		}
+		if strings.HasPrefix(be.State, "idle in transaction") {
+			idlexact++
+		}
+		if isTooLong(&be) {
+			toolong++
+		}
+	}
+
+	// header
+	fmt.Fprintf(fd, `
+Backends:
+    Total Backends:      %d (%.1f%% of max %d)
+    Problematic:         %d waiting on locks, %d waiting on other, %d xact too long, %d idle in xact`,
+		n, 100*safeDiv(int64(n), int64(max)), max,
+		waitingLocks, waitingOther, toolong, idlexact,
+	)
+	if truncated > 0 {
+		fmt.Fprintf(fd, `
+    Truncated Queries:   %d (track_activity_query_size = %s)`,
+			truncated, getSettingBytes(result, "track_activity_query_size", 1))
+	}
+
+	// "waiting for locks" backends
+	if waitingLocks > 0 {
+		fmt.Fprint(fd, `
+    Waiting for Locks:
+`)
+		tw := tableWriter{o: o}
+		tw.add("PID", "User", "App", "Client Addr", "Database", "Wait", "Query Start")
+		for _, be := range result.Backends {
+			if isWaitingLock(&be) {
+				tw.add(be.PID, be.RoleName, be.ApplicationName, be.ClientAddr,
+					be.DBName, be.WaitEventType+" / "+be.WaitEvent,
+					fmtTime(o, be.QueryStart))
+			}
+		}
+		tw.write(fd, "      ")
+	}
+
+	// "other waiting" backends
+	if waitingOther > 0 {
+		fmt.Fprint(fd, `
+    Other Waiting Backends:
+`)
+		tw := tableWriter{o: o}
+		tw.add("PID", "User", "App", "Client Addr", "Database", "Wait", "Query Start")
+		for _, be := range result.Backends {
+			if isWaitingOther(&be) {
+				tw.add(be.PID, be.RoleName, be.ApplicationName, be.ClientAddr,
+					be.DBName, be.WaitEventType+" / "+be.WaitEvent,
+					fmtTime(o, be.QueryStart))
+			}
+		}
+		tw.write(fd, "      ")
+	}
+
+	// long running xacts
+	if toolong > 0 {
+		fmt.Fprintf(fd, `
+    Long Running (>%d sec) Transactions:
+`, o.TooLongSecs)
+		tw := tableWriter{o: o}
+		tw.add("PID", "User", "App", "Client Addr", "Database", "Transaction Start")
+		for _, be := range result.Backends {
+			if isTooLong(&be) {
+				tw.add(be.PID, be.RoleName, be.ApplicationName, be.ClientAddr, be.DBName,
+					fmtTimeAndSince(o, be.XactStart))
+			}
+		}
+		tw.write(fd, "      ")
+	}
+
+	// idle in xact backends
+	if idlexact > 0 {
+		fmt.Fprint(fd, `
+    Idling in Transaction:
+`)
+		tw := tableWriter{o: o}
+		tw.add("PID", "User", "App", "Client Addr", "Database", "Aborted?", "State Change")
+		for _, be := range result.Backends {
+			if strings.HasPrefix(be.State, "idle in transaction") {
+				tw.add(be.PID, be.RoleName, be.ApplicationName, be.ClientAddr,
+					be.DBName, fmtYesNo(strings.Contains(be.State, "aborted")),
+					fmtTime(o, be.StateChange))
+			}
+		}
+		tw.write(fd, "      ")
+	}
+
+	if waitingOther+waitingLocks+idlexact+toolong == 0 {
+		fmt.Fprintln(fd)
+	}
+}
+
+// nonWorkerTypes are the backend types that are not background workers, and
+// do not count towards max_worker_processes.
+var nonWorkerTypes = map[string]bool{
+	"archiver":            true,
+	"autovacuum launcher": true,
+	"autovacuum worker":   true,
+	"background writer":   true,
+	"checkpointer":        true,
+	"client backend":      true,
+	"io worker":           true,
+	"logger":              true,
+	"slotsync worker":     true,
+	"standalone backend":  true,
+	"startup":             true,
+	"stats collector":     true,
+	"walreceiver":         true,
+	"walsender":           true,
+	"walsummarizer":       true,
+	"walwriter":           true,
+}
+
+func reportBGWorkers(fd io.Writer, o Options, result *pgmetrics.Model) {
+	var types []string
+	var total int
+	for t, n := range result.BackendTypeCounts {
+		if !nonWorkerTypes[t] {
+			types = append(types, t)
+			total += n
+		}
+	}
+	sort.Strings(types)
+
+	fmt.Fprint(fd, `
+Background Workers:`)
+	if len(result.BackendTypeCounts) > 0 {
+		fmt.Fprintf(fd, `
+    Running:             %d (max_worker_processes = %s)
+`, total, getSetting(result, "max_worker_processes"))
+		if len(types) > 0 {
+			tw := tableWriter{o: o}
+			tw.add("Type", "Count")
+			for _, t := range types {
+				tw.add(t, result.BackendTypeCounts[t])
+			}
+			tw.write(fd, "      ")
+		}
+	} else {
+		fmt.Fprintln(fd)
+	}
+
+	if len(result.PreloadLibraries) == 0 {
+		return
+	}
+	fmt.Fprint(fd, `    Preloaded Libraries:
+`)
+	tw := tableWriter{o: o}
+	tw.add("Library", "Extension?", "Installed In", "Warning")
+	for _, pl := range result.PreloadLibraries {
+		var warn string
+		if pl.Extension && len(pl.InstalledIn) == 0 {
+			warn = "extension not installed"
+		}
+		tw.add(pl.Name, fmtYesBlank(pl.Extension),
+			strings.Join(pl.InstalledIn, ", "), warn)
+	}
+	tw.write(fd, "      ")
+}
+
+type lockCount struct {
+	notGranted int
+	total      int
+}
+
+func reportLocks(fd io.Writer, o Options, result *pgmetrics.Model) {
+	if len(result.Locks) == 0 {
+		return
+	}
+
+	c := make(map[string]*lockCount)
+	for _, l := range result.Locks {
+		lc, ok := c[l.LockType]
+		if !ok {
+			lc = &lockCount{}
+			c[l.LockType] = lc
+		}
+		if !l.Granted {
+			lc.notGranted++
+		}
+		lc.total++
+	}
+	lt := make([]string, 0, len(c))
+	for k := range c {
+		lt = append(lt, k)
+	}
+	sort.Strings(lt)
+
+	fmt.Fprint(fd, `
+Locks:
+`)
+	tw := tableWriter{o: o}
+	tw.add("Lock Type", "Not Granted", "Total")
+	var tot1, tot2 int
+	for _, t := range lt {
+		lc, ok := c[t]
+		if !ok || lc == nil {
+			continue
+		}
+		tw.add(t, lc.notGranted, lc.total)
+		tot1 += lc.notGranted
+		tot2 += lc.total
+	}
+	tw.add("", tot1, tot2)
+	tw.hasFooter = true
+	tw.write(fd, "    ")
+}
+
+func reportVacuumProgress(fd io.Writer, o Options, result *pgmetrics.Model) {
+	fmt.Fprint(fd, `
+Vacuum Progress:`)
+	if len(result.VacuumProgress) > 0 {
+		for i, v := range result.VacuumProgress {
+			sp := fmt.Sprintf("%d of %d (%.1f%% complete)", v.HeapBlksScanned,
+				v.HeapBlksTotal, 100*safeDiv(v.HeapBlksScanned, v.HeapBlksTotal))
+			fmt.Fprintf(fd, `
+    Vacuum Process #%d:
+      Phase:             %s
+      Database:          %s
+      Table:             %s
+      Scan Progress:     %s
+      Heap Blks Vac'ed:  %d of %d
+      Idx Vac Cycles:    %d`,
+				i+1,
+				v.Phase,
+				v.DBName,
+				v.TableName,
+				sp,
+				v.HeapBlksVacuumed, v.HeapBlksTotal,
+				v.IndexVacuumCount,
+			)
+			if v.MaxDeadTupleBytes > 0 { // v17+
+				fmt.Fprintf(fd, `
+      Indexes Vac'ed:    %d of %d
+      Dead Item IDs:     %d
+      Dead Tuple Mem:    %s of %s`,
+					v.IndexesProcessed, v.IndexesTotal,
+					v.NumDeadTuples,
+					humanize.IBytes(uint64(v.DeadTupleBytes)),
+					humanize.IBytes(uint64(v.MaxDeadTupleBytes)))
+			} else {
+				fmt.Fprintf(fd, `
+      Dead Tuples:       %d
+      Dead Tuples Max:   %d`,
+					v.NumDeadTuples,
+					v.MaxDeadTuples)
+			}
+			if v.ScanRate > 0 {
+				fmt.Fprintf(fd, `
+      Scan Rate:         %.1f blocks/sec`, v.ScanRate)
+			}
+			if v.ScanETA > 0 {
+				fmt.Fprintf(fd, `
+      Scan ETA:          %s`, fmtTimeAndSince(o, v.ScanETA))
+			}
+		}
+	} else {
+		fmt.Fprint(fd, `
+    No manual or auto vacuum jobs in progress.`)
+	}
+	fmt.Fprintln(fd)
+
+	// settings
+	tw := tableWriter{o: o}
+	add := func(s string) { tw.add(s, getSetting(result, s)) }
+	tw.add("Setting", "Value")
+	tw.add("maintenance_work_mem", getSettingBytes(result, "maintenance_work_mem", 1024))
+	add("autovacuum")
+	add("autovacuum_analyze_threshold")
+	add("autovacuum_vacuum_threshold")
+	add("autovacuum_freeze_max_age")
+	add("autovacuum_max_workers")
+	tw.add("autovacuum_naptime", getSetting(result, "autovacuum_naptime")+" sec")
+	add("vacuum_freeze_min_age")
+	add("vacuum_freeze_table_age")
+	tw.write(fd, "    ")
+}
+
+func reportAutovacuumSaturation(fd io.Writer, result *pgmetrics.Model) {
+	av := result.AutovacuumSaturation
+	var over string
+	if av.Samples > 1 {
+		over = fmt.Sprintf(" (%d samples over %.0f sec)", av.Samples, av.Interval)
+	}
+	fmt.Fprintf(fd, `
+Autovacuum Workers:
+    Max Workers:             %d
+    Running, Avg / Peak:     %.1f / %d%s
+    All Workers Busy:        %d of %d samples`,
+		av.MaxWorkers,
+		av.AvgWorkers, av.PeakWorkers, over,
+		av.BusySamples, av.Samples)
+	if len(result.Tables) > 0 {
+		fmt.Fprintf(fd, `
+    Tables Due for Vacuum:   %d`, av.TablesDue)
+	}
+
+	// the workers are the bottleneck if they are all busy most of the time,
+	// and there are more tables waiting than they can take on
+	busy := 2*av.BusySamples > av.Samples
+	var verdict string
+	switch {
+	case busy && av.TablesDue > av.MaxWorkers:
+		verdict = "yes, consider raising autovacuum_max_workers"
+	case busy && len(result.Tables) > 0:
+		verdict = "maybe, though few tables are waiting"
+	case busy:
+		verdict = "maybe, tables were not collected"
+	default:
+		verdict = "no"
+	}
+	fmt.Fprintf(fd, `
+    Workers a Bottleneck?:   %s
+`, verdict)
+}
+
+func reportRoles(fd io.Writer, o Options, result *pgmetrics.Model) {
+	fmt.Fprint(fd, `
+Roles:
+`)
+	tw := tableWriter{o: o}
+	tw.add("Name", "Login", "Repl", "Super", "Creat Rol", "Creat DB", "Bypass RLS", "Inherit", "Expires", "Member Of")
+	for _, r := range result.Roles {
+		tw.add(
+			r.Name,
+			fmtYesBlank(r.Rolcanlogin),
+			fmtYesBlank(r.Rolreplication),
+			fmtYesBlank(r.Rolsuper),
+			fmtYesBlank(r.Rolcreaterole),
+			fmtYesBlank(r.Rolcreatedb),
+			fmtYesBlank(r.Rolbypassrls),
+			fmtYesBlank(r.Rolinherit),
+			fmtTime(o, r.Rolvaliduntil),
+			strings.Join(r.MemberOf, ", "),
+		)
+	}
+	tw.write(fd, "    ")
+}
+
+func reportSecurity(fd io.Writer, o Options, result *pgmetrics.Model) {
+	version := getVersion(result)
+	ssl := getSetting(result, "ssl") == "on"
+	pwenc := getSetting(result, "password_encryption")
+	if pwenc == "on" { // before v10, "on" meant md5
+		pwenc = "md5"
+	}
+	cb := "no (needs v11+, SSL and scram-sha-256)"
+	if version >= 110000 && ssl && pwenc == "scram-sha-256" {
+		cb = "supported"
+	}
+	certs := "no (needs SSL and ssl_ca_file)"
+	if ca := getSetting(result, "ssl_ca_file"); ssl && len(ca) > 0 {
+		certs = "verified against " + ca
+	}
+	fmt.Fprintf(fd, `
+Security:
+    Password Encryption: %s
+    SSL:                 %s
+    Channel Binding:     %s
+    Client Certificates: %s
+`,
+		pwenc, fmtYesNo(ssl), cb, certs)
+
+	// login roles with passwords that are not stored as scram
+	var known bool
+	var md5, plain []string
+	for _, r := range result.Roles {
+		if len(r.PasswordType) > 0 {
+			known = true
+		}
+		if !r.Rolcanlogin {
+			continue
+		}
+		switch r.PasswordType {
+		case "md5":
+			md5 = append(md5, r.Name)
+		case "plain":
+			plain = append(plain, r.Name)
+		}
+	}
+	if known {
+		fmt.Fprintf(fd, `    MD5 Passwords:       %s
+    Plain Passwords:     %s
+`,
+			fmtNames(md5), fmtNames(plain))
+	}
+
+	if len(result.HBARules) > 0 {
+		reportHBARules(fd, o, result)
+	}
+	if len(result.FailedLogins) > 0 {
+		reportFailedLogins(fd, o, result)
+	}
+	if len(result.SuspiciousQueries) > 0 {
+		reportSuspiciousQueries(fd, o, result)
+	}
+}
+
+func reportSuspiciousQueries(fd io.Writer, o Options, result *pgmetrics.Model) {
+	fmt.Fprintf(fd, `    Suspicious Queries:  %d
+`, len(result.SuspiciousQueries))
+	tw := tableWriter{o: o}
+	tw.add("Source", "Pattern", "Database", "User", "Count", "Query")
+	for _, s := range result.SuspiciousQueries {
+		tw.add(s.Source, s.Pattern, s.DBName, s.UserName, s.Count, prepQ(s.Query))
+	}
+	tw.write(fd, "      ")
+}
+
+func reportHBARules(fd io.Writer, o Options, result *pgmetrics.Model) {
+	tw := tableWriter{o: o}
+	var flagged int
+	tw.add("Line", "Type", "Database", "User", "Address", "Method", "Warning")
+	for _, r := range result.HBARules {
+		w := hbaWarning(&r)
+		if len(w) > 0 {
+			flagged++
+		}
+		addr := r.Address
+		if len(r.Netmask) > 0 {
+			addr += "/" + r.Netmask
+		}
+		tw.add(r.Line, r.Type, strings.Join(r.Databases, ","),
+			strings.Join(r.Users, ","), addr, r.AuthMethod, w)
+	}
+	fmt.Fprintf(fd, `    HBA Rules:           %d rules, %d flagged
+`, len(result.HBARules), flagged)
+	tw.write(fd, "      ")
+}
+
+// Clients with at least this many failed logins within the log span are
+// reported as possible brute-force attempts.
+const bruteForceMin = 10
+
+func reportFailedLogins(fd io.Writer, o Options, result *pgmetrics.Model) {
+	var total int
+	byHost := make(map[string]int)
+	var hosts []string
+	tw := tableWriter{o: o}
+	tw.add("User", "Database", "Client", "Reason", "Count", "Last Attempt")
+	for _, f := range result.FailedLogins {
+		total += f.Count
+		if len(f.Host) > 0 {
+			if _, ok := byHost[f.Host]; !ok {
+				hosts = append(hosts, f.Host)
+			}
+			byHost[f.Host] += f.Count
+		}
+		tw.add(f.User, f.Database, f.Host, f.Reason, f.Count, fmtTimeAndSince(o, f.Last))
+	}
+	fmt.Fprintf(fd, `    Failed Logins:       %d (from log)
+`, total)
+	tw.write(fd, "      ")
+	for _, h := range hosts {
+		if n := byHost[h]; n >= bruteForceMin {
+			fmt.Fprintf(fd, `      warning: %d failed logins from %s, possible brute-force attempt
+`, n, h)
+		}
+	}
+}
+
+// hbaWarning returns a warning for HBA rules that use weak authentication
+// methods, or have errors.
+func hbaWarning(r *pgmetrics.HBARule) string {
+	if len(r.Error) > 0 {
+		return "error: " + r.Error
+	}
+	switch r.AuthMethod {
+	case "trust":
+		return "no authentication"
+	case "password":
+		return "password sent in clear text"
+	case "md5":
+		return "legacy md5"
+	}
+	return ""
+}
+
+func fmtNames(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%d (%s)", len(names), strings.Join(names, ", "))
+}
+
+func reportTablespaces(fd io.Writer, o Options, result *pgmetrics.Model) {
+	fmt.Fprint(fd, `
+Tablespaces:
+`)
+	tw := tableWriter{o: o}
+	if result.Metadata.Local {
+		tw.add("Name", "Owner", "Location", "Size", "Disk Used", "Inode Used")
+	} else {
+		tw.add("Name", "Owner", "Location", "Size")
+	}
+	for _, t := range result.Tablespaces {
+		var s, du, iu string
+		if t.Size != -1 {
+			s = humanize.IBytes(uint64(t.Size))
+		}
+		if result.Metadata.Local && t.DiskUsed > 0 && t.DiskTotal > 0 {
+			du = fmt.Sprintf("%s (%.1f%%) of %s",
+				humanize.IBytes(uint64(t.DiskUsed)),
+				100*safeDiv(t.DiskUsed, t.DiskTotal),
+				humanize.IBytes(uint64(t.DiskTotal)))
+		}
+		if result.Metadata.Local && t.InodesUsed > 0 && t.InodesTotal > 0 {
+			iu = fmt.Sprintf("%d (%.1f%%) of %d",
+				t.InodesUsed,
+				100*safeDiv(t.InodesUsed, t.InodesTotal),
+				t.InodesTotal)
+		}
+		if (t.Name == "pg_default" || t.Name == "pg_global") && t.Location != "" {
+			t.Location = "$PGDATA = " + t.Location
+		}
+		if result.Metadata.Local {
+			tw.add(t.Name, t.Owner, t.Location, s, du, iu)
+		} else {
+			tw.add(t.Name, t.Owner, t.Location, s)
+		}
+	}
+	tw.write(fd, "    ")
+}
+
+// reportTablespaceIO attributes the block reads of the tables and indexes of
+// the collected databases to their tablespaces. Writes are not tracked per
+// relation by Postgres, so only reads are shown.
+func reportTablespaceIO(fd io.Writer, o Options, result *pgmetrics.Model) {
+	type tsio struct {
+		ts, db    string
+		read, hit int64
+	}
+	var all []*tsio
+	var total int64
+	get := func(ts, db string) *tsio {
+		if len(ts) == 0 { // in the default tablespace of the database
+			if d := result.DatabaseByName(db); d != nil {
+				ts = getTablespaceName(d.DatTablespace, result)
+			}
+		}
+		for _, x := range all {
+			if x.ts == ts && x.db == db {
+				return x
+			}
+		}
+		x := &tsio{ts: ts, db: db}
+		all = append(all, x)
+		return x
+	}
+	for _, t := range result.Tables {
+		x := get(t.TablespaceName, t.DBName)
+		x.read += t.HeapBlksRead + t.ToastBlksRead + t.TidxBlksRead
+		x.hit += t.HeapBlksHit + t.ToastBlksHit + t.TidxBlksHit
+	}
+	for _, idx := range result.Indexes {
+		x := get(idx.TablespaceName, idx.DBName)
+		x.read += idx.IdxBlksRead
+		x.hit += idx.IdxBlksHit
+	}
+	for _, x := range all {
+		total += x.read
+	}
+	if total == 0 {
+		return
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].read > all[j].read })
+
+	devices := make(map[string]string)
+	for _, t := range result.Tablespaces {
+		devices[t.Name] = t.Device
+	}
+	blkSize := uint64(getBlockSize(result))
+	fmt.Fprint(fd, `
+Tablespace I/O (reads by user tables and indexes):
+`)
+	tw := tableWriter{o: o}
+	if result.Metadata.Local {
+		tw.add("Tablespace", "Device", "Database", "Read", "% of Reads", "Cache Hits")
+	} else {
+		tw.add("Tablespace", "Database", "Read", "% of Reads", "Cache Hits")
+	}
+	for _, x := range all {
+		read := humanize.IBytes(uint64(x.read) * blkSize)
+		pct := fmt.Sprintf("%.1f%%", 100*safeDiv(x.read, total))
+		hits := fmt.Sprintf("%.1f%%", 100*safeDiv(x.hit, x.hit+x.read))
+		if result.Metadata.Local {
+			tw.add(x.ts, devices[x.ts], x.db, read, pct, hits)
+		} else {
+			tw.add(x.ts, x.db, read, pct, hits)
+		}
+	}
+	tw.write(fd, "    ")
+}
+
+func getTablespaceName(oid int, result *pgmetrics.Model) string {
+	for _, t := range result.Tablespaces {
+		if t.OID == oid {
+			return t.Name
+		}
+	}
+	return ""
+}
+
+func getRoleName(oid int, result *pgmetrics.Model) string {
+	for _, r := range result.Roles {
+		if r.OID == oid {
+			return r.Name
+		}
+	}
+	return ""
+}
+
+func fmtConns(d *pgmetrics.Database) string {
+	if d.DatConnLimit < 0 {
+		return fmt.Sprintf("%d (no max limit)", d.NumBackends)
+	}
+	pct := 100 * safeDiv(int64(d.NumBackends), int64(d.DatConnLimit))
+	return fmt.Sprintf("%d (%.1f%%) of %d", d.NumBackends, pct, d.DatConnLimit)
+}
+
+func fmtLocale(d *pgmetrics.Database) string {
+	var s string
+	if d.Collate == d.CType {
+		s = d.Collate
+	} else {
+		s = "collate " + d.Collate + ", ctype " + d.CType
+	}
+	if len(d.LocaleProvider) > 0 && d.LocaleProvider != "libc" {
+		s = d.LocaleProvider + " " + d.Locale + " (libc " + s + ")"
+	}
+	return s
+}
+
+// failsafeNote returns a warning if the age is past vacuum_failsafe_age (v14+),
+// beyond which vacuum skips non-essential work to avoid wraparound.
+func failsafeNote(result *pgmetrics.Model, age int) string {
+	if fa := getSettingInt(result, "vacuum_failsafe_age"); fa > 0 && age > fa {
+		return ", past vacuum_failsafe_age!"
+	}
+	return ""
+}
+
+func fmtLargeObjects(d *pgmetrics.Database) string {
+	var approx string
+	if d.LOEstimated {
+		approx = "~"
+	}
+	out := approx + strconv.FormatInt(d.LOCount, 10)
+	if d.LOSize != -1 {
+		out += ", " + humanize.IBytes(uint64(d.LOSize))
+	}
+	if d.LOOrphans != -1 {
+		out += fmt.Sprintf(", %s%d (%.1f%%) orphaned", approx, d.LOOrphans,
+			100*safeDiv(d.LOOrphans, d.LOCount))
+	}
+	if d.LOEstimated {
+		out += " (est.)"
+	}
+	return out
+}
+
+// fmtRelSize formats the size of a table or index, which may be an estimate.
+func fmtRelSize(size int64, estimated bool) string {
+	if estimated {
+		return "~" + humanize.IBytes(uint64(size)) + " (est.)"
+	}
+	return humanize.IBytes(uint64(size))
+}
+
+func reportDatabases(fd io.Writer, o Options, result *pgmetrics.Model) {
+	providers := make(map[string]bool)
+	for _, d := range result.Databases {
+		if len(d.LocaleProvider) > 0 {
+			providers[d.LocaleProvider] = true
+		}
+	}
+	for i, d := range result.Databases {
+		fmt.Fprintf(fd, `
+Database #%d:
+    Name:                %s
+    Owner:               %s
+    Tablespace:          %s
+    Connections:         %s
+    Frozen Xid Age:      %d%s
+    Transactions:        %d (%.1f%%) commits, %d (%.1f%%) rollbacks
+    Cache Hits:          %.1f%%
+    Rows Changed:        ins %.1f%%, upd %.1f%%, del %.1f%%
+    Total Temp:          %s in %d files
+    Problems:            %d deadlocks, %d conflicts
+    Totals Since:        %s`,
+			i+1,
+			d.Name,
+			getRoleName(d.DatDBA, result),
+			getTablespaceName(d.DatTablespace, result),
+			fmtConns(&d),
+			d.AgeDatFrozenXid, failsafeNote(result, d.AgeDatFrozenXid),
+			d.XactCommit, 100*safeDiv(d.XactCommit, d.XactCommit+d.XactRollback),
+			d.XactRollback, 100*safeDiv(d.XactRollback, d.XactCommit+d.XactRollback),
+			100*safeDiv(d.BlksHit, d.BlksHit+d.BlksRead),
+			100*safeDiv(d.TupInserted, d.TupInserted+d.TupUpdated+d.TupDeleted),
+			100*safeDiv(d.TupUpdated, d.TupInserted+d.TupUpdated+d.TupDeleted),
+			100*safeDiv(d.TupDeleted, d.TupInserted+d.TupUpdated+d.TupDeleted),
+			humanize.IBytes(uint64(d.TempBytes)), d.TempFiles,
+			d.Deadlocks, d.Conflicts,
+			fmtTimeAndSince(o, d.StatsReset),
+		)
+		if d.Size != -1 {
+			fmt.Fprintf(fd, `
+    Size:                %s`, humanize.IBytes(uint64(d.Size)))
+		}
+		if ioTiming, ok := result.Settings["track_io_timing"]; ok {
+			if ioTiming.Setting == "on" {
+				fmt.Fprintf(fd, `
+    Block I/O Time:      read %s, write %s`,
+					prepmsec(d.BlkReadTime), prepmsec(d.BlkWriteTime))
+			} else {
+				fmt.Fprint(fd, `
+    Block I/O Time:      not tracked (track_io_timing is off)`)
+			}
+		}
+		if result.IsInRecovery {
+			fmt.Fprintf(fd, `
+    Recovery Conflicts:  %d snapshot, %d lock, %d bufferpin, %d deadlock, %d tablespace`,
+				d.ConflSnapshot, d.ConflLock, d.ConflBufferpin,
+				d.ConflDeadlock, d.ConflTablespace)
+			if d.ConflLogicalSlot > 0 {
+				fmt.Fprintf(fd, ", %d logical slot", d.ConflLogicalSlot)
+			}
+		}
+		if d.LOCount > 0 {
+			fmt.Fprintf(fd, `
+    Large Objects:       %s`, fmtLargeObjects(&d))
+		}
+		if len(d.Encoding) > 0 {
+			fmt.Fprintf(fd, `
+    Encoding:            %s`, d.Encoding)
+			if d.Encoding == "SQL_ASCII" {
+				fmt.Fprint(fd, " (warning: no encoding validation)")
+			}
+			fmt.Fprintf(fd, `
+    Locale:              %s`, fmtLocale(&d))
+			if len(providers) > 1 {
+				fmt.Fprint(fd, " (warning: databases use different locale providers)")
+			}
+		}
+		fmt.Fprintln(fd)
+
+		gap := false
+		if sqs := filterSequencesByDB(result, d.Name); len(sqs) > 0 {
+			fmt.Fprint(fd, `    Sequences:
+`)
+			tw := tableWriter{o: o}
+			tw.add("Sequence", "Cache Hits")
+			for _, sq := range sqs {
+				tw.add(sq.Name, fmtPct(sq.BlksHit, sq.BlksHit+sq.BlksRead))
+			}
+			tw.write(fd, "      ")
+			gap = true
+		}
+
+		if ufs := filterUserFuncsByDB(result, d.Name); len(ufs) > 0 {
+			if gap {
+				fmt.Fprintln(fd)
+			}
+			fmt.Fprint(fd, `    Tracked Functions:
+`)
+			tw := tableWriter{o: o}
+			tw.add("Function", "Calls", "Time (self)", "Time (self+children)")
+			for _, uf := range ufs {
+				tw.add(
+					uf.Name,
+					uf.Calls,
+					time.Duration(uf.SelfTime*1e6),
+					time.Duration(uf.TotalTime*1e6),
+				)
+			}
+			tw.write(fd, "      ")
+			gap = true
+		}
+
+		if exts := filterExtensionsByDB(result, d.Name); len(exts) > 0 {
+			if gap {
+				fmt.Fprintln(fd)
+			}
+			fmt.Fprint(fd, `    Installed Extensions:
+`)
+			var sized bool
+			for _, ext := range exts {
+				sized = sized || ext.Relations > 0
+			}
+			tw := tableWriter{o: o}
+			if sized {
+				tw.add("Name", "Version", "Relations", "Size", "Comment")
+			} else {
+				tw.add("Name", "Version", "Comment")
+			}
+			for _, ext := range exts {
+				if !sized {
+					tw.add(ext.Name, ext.InstalledVersion, ext.Comment)
+				} else if ext.Relations > 0 {
+					tw.add(ext.Name, ext.InstalledVersion, ext.Relations,
+						fmtRelSize(ext.Size, ext.SizeEstimated), ext.Comment)
+				} else {
+					tw.add(ext.Name, ext.InstalledVersion, "", "", ext.Comment)
+				}
+			}
+			tw.write(fd, "      ")
+			gap = true
+		}
+
+		if dts := filterTriggersByDB(result, d.Name); len(dts) > 0 {
+			if gap {
+				fmt.Fprintln(fd)
+			}
+			fmt.Fprint(fd, `    Disabled Triggers:
+`)
+			tw := tableWriter{o: o}
+			tw.add("Name", "Table", "Procedure")
+			for _, dt := range dts {
+				tw.add(
+					dt.Name,
+					dt.SchemaName+"."+dt.TableName,
+					dt.ProcName,
+				)
+			}
+			tw.write(fd, "      ")
+			gap = true
+		}
+
+		if ss := filterStatementsByDB(result, d.Name); len(ss) > 0 {
+			if gap {
+				fmt.Fprintln(fd)
+			}
+			if si := result.StatementsInfo; si != nil && si.StatsReset > 0 {
+				fmt.Fprintf(fd, `    Slow Queries (since %s):
+`, fmtTime(o, si.StatsReset))
+			} else {
+				fmt.Fprint(fd, `    Slow Queries:
+`)
+			}
+			ioTiming := getSetting(result, "track_io_timing") == "on"
+			tw := tableWriter{o: o}
+			if ioTiming {
+				tw.add("Calls", "Avg Time", "Total Time", "Block I/O Time", "Rows/Call", "Query")
+			} else {
+				tw.add("Calls", "Avg Time", "Total Time", "Rows/Call", "Query")
+			}
+			for _, s := range ss {
+				var rpc int64
+				if s.Calls > 0 {
+					rpc = s.Rows / s.Calls
+				}
+				if ioTiming {
+					tw.add(
+						s.Calls,
+						prepmsec(s.TotalTime/float64(s.Calls)),
+						prepmsec(s.TotalTime),
+						prepmsec(s.BlkReadTime+s.BlkWriteTime),
+						rpc,
+						prepQ(s.Query),
+					)
+					continue
+				}
+				tw.add(
+					s.Calls,
+					prepmsec(s.TotalTime/float64(s.Calls)),
+					prepmsec(s.TotalTime),
+					rpc,
+					prepQ(s.Query),
+				)
+			}
+			tw.write(fd, "      ")
+			if at := result.Metadata.StatementsReset; at > 0 {
+				fmt.Fprintf(fd, "      (reset by pgmetrics at %s, after collecting)\n", fmtTime(o, at))
+			}
+			gap = true
+		}
+
+		if pp := filterPublicationsByDB(result, d.Name); len(pp) > 0 {
+			if gap {
+				fmt.Fprintln(fd)
+			}
+			fmt.Fprintf(fd, `    Logical Replication Publications:
+`)
+			tw := tableWriter{o: o}
+			tw.add("Name", "All Tables?", "Propagate", "Tables")
+			for _, p := range pp {
+				tw.add(
+					p.Name,
+					fmtYesNo(p.AllTables),
+					fmtPropagate(p.Insert, p.Update, p.Delete),
+					p.TableCount,
+				)
+			}
+			tw.write(fd, "      ")
+			gap = true
+		}
+
+		if ss := filterSubscriptionsByDB(result, d.Name); len(ss) > 0 {
+			if gap {
+				fmt.Fprintln(fd)
+			}
+			fmt.Fprintf(fd, `    Logical Replication Subscriptions:
+`)
+			for i, s := range ss {
+				fmt.Fprintf(fd, `      Subscription #%d:
+        Name:              %s
+        Enabled?           %s
+        Publications:      %d
+        Tables:            %d
+        Workers:           %d
+        Received Until:    %s
+        Latency:           %s
+`,
+					i+1,
+					s.Name,
+					fmtYesNo(s.Enabled),
+					s.PubCount,
+					s.TableCount,
+					s.WorkerCount,
+					s.ReceivedLSN,
+					fmtMicros(s.Latency),
+				)
+			}
+			gap = true
+		}
+
+		if ls := filterLocksByDB(result, d.Name); hasBlockedQueries(ls) {
+			if gap {
+				fmt.Fprintln(fd)
+			}
+			fmt.Fprintf(fd, `    Blocked Queries:
+`)
+			count := 0
+			for _, l := range ls {
+				if l.Granted {
+					continue
+				}
+				be := getBE(result, l.PID)
+				if be == nil {
+					continue
+				}
+				count++
+				fmt.Fprintf(fd, `      Blocked Query #%d:
+        Query:             %s
+        Started By:        %s
+        Waiting Since:     %s
+`,
+					count,
+					prepQ(be.Query),
+					getBEClient(be),
+					fmtTimeAndSince(o, be.StateChange))
+				if result.BlockingPIDs == nil {
+					continue
+				}
+				pids, ok := result.BlockingPIDs[l.PID]
+				if !ok || len(pids) == 0 {
+					continue
+				}
+				for _, b := range pids {
+					bbe := getBE(result, b)
+					if bbe == nil {
+						continue
+					}
+					fmt.Fprintf(fd, `        Waiting For:
+          Query:             %s
+          Lock:              %s
+          Started By:        %s
+`,
+						prepQ(bbe.Query),
+						getLockDesc(l, result),
+						getBEClient(bbe),
+					)
+				}
+			}
+			gap = true
+		}
+	}
+}
+
+func hasBlockedQueries(locks []*pgmetrics.Lock) bool {
+	for _, l := range locks {
+		if l != nil && !l.Granted {
+			return true
+		}
+	}
+	return false
+}
+
+func getBE(result *pgmetrics.Model, pid int) *pgmetrics.Backend {
+	for i, be := range result.Backends {
+		if be.PID == pid {
+			return &result.Backends[i]
+		}
+	}
+	return nil
+}
+
+func getBEClient(be *pgmetrics.Backend) string {
+	// role@client:db (PID pid)
+	// appname role@client:db (PID pid)
+	var out string
+	if len(be.ApplicationName) > 0 {
+		out = be.ApplicationName + " "
+	}
+	out += be.RoleName
+	if len(be.ClientAddr) > 0 {
+		c := strings.TrimSuffix(be.ClientAddr, "/128")
+		c = strings.TrimSuffix(c, "/32")
+		out += "@" + c
+	}
+	out += fmt.Sprintf("/%s (PID %d)", be.DBName, be.PID)
+	return out
+}
+
+func getLockDesc(l *pgmetrics.Lock, result *pgmetrics.Model) (out string) {
+	out = l.LockType + ", " + l.Mode
+	if l.LockType == "relation" {
+		// search tables
+		if t := result.TableByOID(l.RelationOID); t != nil {
+			out += ", table " + t.SchemaName + "." + t.Name
+		} else {
+			// else search indexes
+			for _, idx := range result.Indexes {
+				if idx.OID == l.RelationOID {
+					out += ", index " + idx.SchemaName + "." + idx.Name
+					break
+				}
+			}
+		}
+	}
+	return
+}
+
+const stmtSQLDisplayLength = 50
+
+func prepQ(s string) string {
+	if len(s) > stmtSQLDisplayLength {
+		s = s[:stmtSQLDisplayLength]
+	}
+	return strings.Map(smap, s)
+}
+
+func smap(r rune) rune {
+	if r == '\r' || r == '\n' || r == '\t' {
+		return ' '
+	}
+	return r
+}
+
+func prepmsec(ms float64) string {
+	return time.Duration(1e6 * ms).Truncate(time.Millisecond).String()
+}
+
+func filterSequencesByDB(result *pgmetrics.Model, db string) (out []*pgmetrics.Sequence) {
+	for i := range result.Sequences {
+		if s := &result.Sequences[i]; s.DBName == db {
+			out = append(out, s)
+		}
+	}
+	return
+}
+
+func filterUserFuncsByDB(result *pgmetrics.Model, db string) (out []*pgmetrics.UserFunction) {
+	for i := range result.UserFunctions {
+		if uf := &result.UserFunctions[i]; uf.DBName == db {
+			out = append(out, uf)
+		}
+	}
+	return
+}
+
+func filterExtensionsByDB(result *pgmetrics.Model, db string) (out []*pgmetrics.Extension) {
+	for i := range result.Extensions {
+		if e := &result.Extensions[i]; e.DBName == db {
+			out = append(out, e)
+		}
+	}
+	return
+}
+
+func filterTriggersByDB(result *pgmetrics.Model, db string) (out []*pgmetrics.Trigger) {
+	for i := range result.DisabledTriggers {
+		if t := &result.DisabledTriggers[i]; t.DBName == db {
+			out = append(out, t)
+		}
+	}
+	return
+}
+
+func filterStatementsByDB(result *pgmetrics.Model, db string) (out []*pgmetrics.Statement) {
+	for i := range result.Statements {
+		if s := &result.Statements[i]; s.DBName == db {
+			out = append(out, s)
+		}
+	}
+	return
+}
+
+// dbStatsReset returns the time the statistics of the named database were
+// last reset, which also resets those of its tables and indexes. It is 0 if
+// not known or never reset.
+func dbStatsReset(result *pgmetrics.Model, db string) int64 {
+	for i := range result.Databases {
+		if result.Databases[i].Name == db {
+			return result.Databases[i].StatsReset
+		}
+	}
+	return 0
+}
+
+func filterTablesByDB(result *pgmetrics.Model, db string) (out []*pgmetrics.Table) {
+	for i := range result.Tables {
+		if t := &result.Tables[i]; t.DBName == db {
+			out = append(out, t)
+		}
+	}
+	return
+}
+
+func filterPublicationsByDB(result *pgmetrics.Model, db string) (out []*pgmetrics.Publication) {
+	for i := range result.Publications {
+		if p := &result.Publications[i]; p.DBName == db {
+			out = append(out, p)
+		}
+	}
+	return
+}
+
+func filterSubscriptionsByDB(result *pgmetrics.Model, db string) (out []*pgmetrics.Subscription) {
+	for i := range result.Subscriptions {
+		if s := &result.Subscriptions[i]; s.DBName == db {
+			out = append(out, s)
+		}
+	}
+	return
+}
+
+func filterLocksByDB(result *pgmetrics.Model, db string) (out []*pgmetrics.Lock) {
+	for i := range result.Locks {
+		if l := &result.Locks[i]; l.DBName == db {
+			out = append(out, l)
+		}
+	}
+	return
+}
+
+// Duh. Did anyone say generics?
+
+func fmtPct(a, b int64) string {
+	if b == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(a)/float64(b))
+}
+
+func fmtCountAndTime(n, last int64) string {
+	if n == 0 || last == 0 {
+		return "never"
+	}
+	return fmt.Sprintf("%d, last %s", n, fmtSince(last))
+}
+
+func filterIndexesByTable(result *pgmetrics.Model, db, schema, table string) (out []*pgmetrics.Index) {
+	for i := range result.Indexes {
+		idx := &result.Indexes[i]
+		if idx.DBName == db && idx.SchemaName == schema && idx.TableName == table {
+			out = append(out, idx)
+		}
+	}
+	return
+}
+
+func reportMatViews(fd io.Writer, o Options, result *pgmetrics.Model) {
+	fmt.Fprint(fd, `
+Materialized Views:
+`)
+	tw := tableWriter{o: o}
+	tw.add("Name", "Populated?", "Size", "Last Refresh (from log)")
+	for _, mv := range result.MatViews {
+		populated := "yes"
+		if !mv.Populated {
+			populated = "no, never refreshed"
+		}
+		var size, refresh string
+		if mv.Size != -1 {
+			size = humanize.IBytes(uint64(mv.Size))
+		}
+		if mv.LastRefresh > 0 {
+			refresh = fmtTimeAndSince(o, mv.LastRefresh)
+		}
+		tw.add(mv.DBName+"."+mv.SchemaName+"."+mv.Name, populated, size, refresh)
+	}
+	tw.write(fd, "    ")
+}
+
+func reportTables(fd io.Writer, o Options, result *pgmetrics.Model) {
+	for _, db := range result.Metadata.CollectedDBs {
+		tables := filterTablesByDB(result, db)
+		if len(tables) == 0 {
+			continue
+		}
+		for i, t := range tables {
+			nTup := t.NLiveTup + t.NDeadTup
+			nTupChanged := t.NTupIns + t.NTupUpd + t.NTupDel
+			attrs := tableAttrs(t)
+			fmt.Fprintf(fd, `
+Table #%d in "%s":
+    Name:                %s.%s.%s`,
+				i+1,
+				db,
+				db, t.SchemaName, t.Name)
+			if len(attrs) > 0 {
+				fmt.Fprintf(fd, `
+    Attributes:          %s`, attrs)
+			}
+			if len(t.ParentName) > 0 {
+				if len(t.PartitionCV) > 0 {
+					fmt.Fprintf(fd, `
+    Partition of:        %s, %s`, t.ParentName, t.PartitionCV)
+				} else {
+					fmt.Fprintf(fd, `
+    Inherits from:       %s`, t.ParentName)
+				}
+			}
+			if len(t.TablespaceName) > 0 {
+				fmt.Fprintf(fd, `
+    Tablespace:          %s`, t.TablespaceName)
+			}
+			if reset := dbStatsReset(result, db); reset > 0 {
+				fmt.Fprintf(fd, `
+    Counters Since:      %s`, fmtTimeAndSince(o, reset))
+			}
+			fmt.Fprintf(fd, `
+    Columns:             %d
+    Manual Vacuums:      %s
+    Manual Analyze:      %s
+    Auto Vacuums:        %s
+    Auto Analyze:        %s
+    Post-Analyze:        %.1f%% est. rows modified
+    Row Estimate:        %.1f%% live of total %d
+    Rows Changed:        ins %.1f%%, upd %.1f%%, del %.1f%%
+    HOT Updates:         %.1f%% of all updates%s
+    Seq Scans:           %d, %.1f rows/scan
+    Idx Scans:           %d, %.1f rows/scan
+    Cache Hits:          %.1f%% (idx=%.1f%%)`,
+				t.RelNAtts,
+				fmtCountAndTime(t.VacuumCount, t.LastVacuum),
+				fmtCountAndTime(t.AnalyzeCount, t.LastAnalyze),
+				fmtCountAndTime(t.AutovacuumCount, t.LastAutovacuum),
+				fmtCountAndTime(t.AutoanalyzeCount, t.LastAutoanalyze),
+				100*safeDiv(t.NModSinceAnalyze, nTup),
+				100*safeDiv(t.NLiveTup, nTup), nTup,
+				100*safeDiv(t.NTupIns, nTupChanged),
+				100*safeDiv(t.NTupHotUpd, nTupChanged),
+				100*safeDiv(t.NTupDel, nTupChanged),
+				100*safeDiv(t.NTupHotUpd, t.NTupUpd), fmtHOTNote(t),
+				t.SeqScan, safeDiv(t.SeqTupRead, t.SeqScan),
+				t.IdxScan, safeDiv(t.IdxTupFetch, t.IdxScan),
+				100*safeDiv(t.HeapBlksHit+t.ToastBlksHit+t.TidxBlksHit,
+					t.HeapBlksHit+t.HeapBlksRead+
+						t.ToastBlksHit+t.ToastBlksRead+
+						t.TidxBlksHit+t.TidxBlksRead),
+				100*safeDiv(t.IdxBlksHit, t.IdxBlksHit+t.IdxBlksRead),
+			)
+			if t.Size != -1 {
+				fmt.Fprintf(fd, `
+    Size:                %s`, fmtRelSize(t.Size, t.SizeEstimated))
+			}
+			if t.Bloat != -1 {
+				if t.Size != -1 {
+					fmt.Fprintf(fd, `
+    Bloat:               %s (%.1f%%)`,
+						humanize.IBytes(uint64(t.Bloat)),
+						100*safeDiv(t.Bloat, t.Size))
+				} else {
+					fmt.Fprintf(fd, `
+    Bloat:               %s`, humanize.IBytes(uint64(t.Bloat)))
+				}
+			}
+			if t.FillFactor > 0 {
+				fmt.Fprintf(fd, `
+    Fill Factor:         %d`, t.FillFactor)
+			}
+			if t.IndexCount > 0 {
+				fmt.Fprintf(fd, `
+    Index Writes:        %s`, fmtIndexWrites(t))
+			}
+			if acls := parseACL(t.ACL); len(acls) > 0 {
+				fmt.Fprintf(fd, `
+    ACL:
+`)
+				tw := tableWriter{o: o}
+				tw.add("Role", "Privileges", "Granted By")
+				for _, a := range acls {
+					tw.add(a.role, strings.Join(a.privs, ", "), a.grantor)
+				}
+				tw.write(fd, "      ")
+			}
+			fmt.Fprintln(fd)
+
+			idxs := filterIndexesByTable(result, db, t.SchemaName, t.Name)
+			if len(idxs) == 0 {
+				continue
+			}
+			tw := tableWriter{o: o}
+			tw.add("Index", "Type", "Size", "Bloat", "Cache Hits", "Scans", "Rows Read/Scan", "Rows Fetched/Scan")
+			for _, idx := range idxs {
+				var sz, bloat string
+				if idx.Size != -1 {
+					sz = fmtRelSize(idx.Size, idx.SizeEstimated)
+				}
+				if idx.Bloat != -1 {
+					if idx.Size != -1 {
+						bloat = fmt.Sprintf("%s (%.1f%%)",
+							humanize.IBytes(uint64(idx.Bloat)),
+							100*safeDiv(idx.Bloat, idx.Size))
+					} else {
+						bloat = humanize.IBytes(uint64(idx.Bloat))
+					}
+				}
+				tw.add(
+					idx.Name,
+					idx.AMName,
+					sz,
+					bloat,
+					fmtPct(idx.IdxBlksHit, idx.IdxBlksHit+idx.IdxBlksRead),
+					idx.IdxScan,
+					fmt.Sprintf("%.1f", safeDiv(idx.IdxTupRead, idx.IdxScan)),
+					fmt.Sprintf("%.1f", safeDiv(idx.IdxTupFetch, idx.IdxScan)),
+				)
+			}
+			tw.write(fd, "    ")
+		}
+	}
+}
+
+// writeAmpWarn is the number of index tuple writes per heap tuple write
+// beyond which a table is considered to be over-indexed.
+const writeAmpWarn = 8
+
+// indexWriteAmp estimates the number of index tuples written for each heap
+// tuple written. Inserts and non-HOT updates write a new entry into every
+// index, HOT updates and deletes do not touch the indexes.
+func indexWriteAmp(t *pgmetrics.Table) float64 {
+	idxWrites := (t.NTupIns + t.NTupUpd - t.NTupHotUpd) * int64(t.IndexCount)
+	return safeDiv(idxWrites, t.NTupIns+t.NTupUpd+t.NTupDel)
+}
+
+func fmtIndexWrites(t *pgmetrics.Table) string {
+	amp := indexWriteAmp(t)
+	out := fmt.Sprintf("%.1f per row write, %d indexes", amp, t.IndexCount)
+	if amp >= writeAmpWarn {
+		out += " (over-indexed?)"
+	}
+	return out
+}
+
+// Tables with at least hotMinUpdates updates, of which less than hotLowPct
+// percent were HOT updates, are flagged as having a low HOT ratio.
+const (
+	hotMinUpdates = 1000
+	hotLowPct     = 50
+)
+
+// fmtHOTNote returns a note if the table has a low HOT ratio, with the likely
+// reason: no free space left in the pages for the new row versions, or
+// updates of indexed columns, which cannot be HOT.
+func fmtHOTNote(t *pgmetrics.Table) string {
+	if t.NTupUpd < hotMinUpdates || 100*safeDiv(t.NTupHotUpd, t.NTupUpd) >= hotLowPct {
+		return ""
+	}
+	if t.FillFactor == 0 || t.FillFactor >= 100 {
+		return " (low, try a lower fillfactor)"
+	}
+	return " (low, are indexed columns updated?)"
+}
+
+// writeChurnTopN is the number of tables shown in the write churn section.
+const writeChurnTopN = 10
+
+// reportWriteChurn lists the tables with the most rows written, across all
+// collected databases.
+func reportWriteChurn(fd io.Writer, o Options, result *pgmetrics.Model) {
+	var tables []*pgmetrics.Table
+	for i := range result.Tables {
+		if t := &result.Tables[i]; t.NTupIns+t.NTupUpd+t.NTupDel > 0 {
+			tables = append(tables, t)
+		}
+	}
+	if len(tables) == 0 {
+		return
+	}
+	writes := func(t *pgmetrics.Table) int64 { return t.NTupIns + t.NTupUpd + t.NTupDel }
+	sort.SliceStable(tables, func(i, j int) bool { return writes(tables[i]) > writes(tables[j]) })
+	if len(tables) > writeChurnTopN {
+		tables = tables[:writeChurnTopN]
+	}
+
+	fmt.Fprint(fd, `
+Tables by Write Churn:
+`)
+	tw := tableWriter{o: o}
+	tw.add("Table", "Rows Written", "Updates", "HOT Updates", "Fill Factor", "Indexes", "Note")
+	for _, t := range tables {
+		var ff string
+		if t.FillFactor > 0 {
+			ff = strconv.Itoa(t.FillFactor)
+		}
+		tw.add(t.DBName+"."+t.SchemaName+"."+t.Name, writes(t), t.NTupUpd,
+			fmtPct(t.NTupHotUpd, t.NTupUpd), ff, t.IndexCount,
+			strings.Trim(fmtHOTNote(t), " ()"))
+	}
+	tw.write(fd, "    ")
+}
+
+func tableAttrs(t *pgmetrics.Table) string {
+	var parts []string
+	if t.RelPersistence == "u" {
+		parts = append(parts, "unlogged")
+	} else if t.RelPersistence == "t" {
+		parts = append(parts, "temporary")
+	}
+	if t.RelKind == "m" {
+		parts = append(parts, "materialized view")
+	} else if t.RelKind == "p" {
+		parts = append(parts, "partition parent")
+	}
+	if t.RelIsPartition {
+		parts = append(parts, "partition")
+	}
+	return strings.Join(parts, ", ")
+}
+
+func reportSystem(fd io.Writer, o Options, result *pgmetrics.Model) {
+	s := result.System
+	fmt.Fprintf(fd, `
+System Information:
+    Hostname:            %s
+    CPU Cores:           %d x %s
+    Load Average:        %.2f
+    Memory:              used=%s, free=%s, buff=%s, cache=%s
+    Swap:                used=%s, free=%s
+`,
+		s.Hostname,
+		s.NumCores, s.CPUModel,
+		s.LoadAvg,
+		humanize.IBytes(uint64(s.MemUsed)),
+		humanize.IBytes(uint64(s.MemFree)),
+		humanize.IBytes(uint64(s.MemBuffers)),
+		humanize.IBytes(uint64(s.MemCached)),
+		humanize.IBytes(uint64(s.SwapUsed)),
+		humanize.IBytes(uint64(s.SwapFree)),
+	)
+	tw := tableWriter{o: o}
+	tw.add("Setting", "Value")
+	add := func(k string) { tw.add(k, getSetting(result, k)) }
+	addBytes := func(k string, f uint64) { tw.add(k, getSettingBytes(result, k, f)) }
+	addBytes("shared_buffers", 8192)
+	addBytes("work_mem", 1024)
+	addBytes("maintenance_work_mem", 1024)
+	addBytes("temp_buffers", 8192)
+	if v := getSetting(result, "autovacuum_work_mem"); v == "-1" {
+		tw.add("autovacuum_work_mem", v)
+	} else {
+		addBytes("autovacuum_work_mem", 1024)
+	}
+	if v := getSetting(result, "temp_file_limit"); v == "-1" {
+		tw.add("temp_file_limit", v)
+	} else {
+		addBytes("temp_file_limit", 1024)
+	}
+	add("max_worker_processes")
+	add("autovacuum_max_workers")
+	add("max_parallel_workers_per_gather")
+	add("effective_io_concurrency")
+	tw.write(fd, "    ")
+}
+
+//------------------------------------------------------------------------------
+// pgbouncer
+
+func pgbouncerWriteHumanTo(fd io.Writer, o Options, result *pgmetrics.Model) {
+	tw := tableWriter{o: o}
+	fmt.Fprintf(fd, `
+pgmetrics run at: %s%s
+`,
+		fmtTimeAndSince(o, result.Metadata.At),
+		fmtCollectorStats(result.Metadata.Collector),
+	)
+
+	// databases
+	fmt.Fprintf(fd, `
+PgBouncer Databases:
+`)
+	tw.clear()
+	tw.add("Database", "Maps To", "Paused?", "Disabled?", "Clients", "Xacts*", "Queries*", "Client Wait*")
+	var dbs []string
+	for _, db := range result.PgBouncer.Databases {
+		dbs = append(dbs, db.Database)
+	}
+	sort.Strings(dbs)
+	for _, name := range dbs {
+		cols := []interface{}{name}
+		for _, db := range result.PgBouncer.Databases {
+			if db.Database == name {
+				if name == "pgbouncer" {
+					cols = append(cols, "(internal)")
+				} else {
+					host := db.Host
+					if strings.Contains(host, ":") {
+						host = "[" + host + "]"
+					}
+					user := db.User
+					if len(user) > 0 {
+						user += "@"
+					}
+					cols = append(cols, fmt.Sprintf("%s%s:%d/%s", user, host, db.Port, db.SourceDatabase))
+				}
+				cols = append(cols, fmtYesNo(db.Paused), fmtYesNo(db.Disabled))
+				if db.MaxConn != 0 {
+					cols = append(cols, fmt.Sprintf("%d of %d", db.CurrConn, db.MaxConn))
+				} else {
+					cols = append(cols, db.CurrConn)
+				}
+				break
+			}
+		}
+		found := false
+		for _, s := range result.PgBouncer.Stats {
+			if s.Database == name {
+				cols = append(cols,
+					s.TotalXactCount,
+					s.TotalQueryCount,
+					time.Duration(s.TotalWaitTime*1e9).Truncate(time.Millisecond))
+				found = true
+				break
+			}
+		}
+		if !found {
+			cols = append(cols, "0", "0", "0s")
+		}
+		tw.add(cols...)
+	}
+	w := tw.write(fd, "    ")
+	msg := "* = cumulative values since start of PgBouncer"
+	fmt.Fprintf(fd, `%*s
+`,
+		w, msg)
+
+	// pools
+	fmt.Fprintf(fd, `
+PgBouncer Pools:
+`)
+	tw.clear()
+	tw.add("User", "Database", "Mode", "Client Conns", "Server Conns", "Max Wait")
+	for _, p := range result.PgBouncer.Pools {
+		tw.add(
+			p.UserName,
+			p.Database,
+			p.Mode,
+			fmt.Sprintf("%d actv, %d wtng", p.ClActive, p.ClWaiting),
+			fmt.Sprintf("%d actv, %d idle, %d othr", p.SvActive, p.SvIdle, p.SvUsed+p.SvTested),
+			time.Duration(p.MaxWait*1e9).Truncate(time.Millisecond))
+	}
+	tw.write(fd, "    ")
+
+	// client connections
+	r := result.PgBouncer
+	fmt.Fprintf(fd, `
+Current Connections:
+    Clients: %d active, %d waiting, %d idle, %d used
+    Servers: %d active, %d idle, %d used
+    Client Wait Times: max %v, avg %v
+
+`,
+		r.CCActive, r.CCWaiting, r.CCIdle, r.CCUsed,
+		r.SCActive, r.SCIdle, r.SCUsed,
+		time.Duration(r.CCMaxWait*1e9).Truncate(time.Millisecond),
+		time.Duration(r.CCAvgWait*1e9).Truncate(time.Millisecond))
+}
+
+//------------------------------------------------------------------------------
+
+func fmtTime(o Options, at int64) string {
+	if at == 0 {
+		return ""
+	}
+	return fmtLayout(o, at, "2 Jan 2006 3:04:05 PM")
+}
+
+func fmtTimeAndSince(o Options, at int64) string {
+	if at == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s (%s)", fmtLayout(o, at, "2 Jan 2006 3:04:05 PM"),
+		humanize.Time(time.Unix(at, 0)))
+}
+
+// fmtClockSkew describes how far ahead of the clock of the machine pgmetrics
+// ran on the server's clock was.
+func fmtClockSkew(skew float64) string {
+	dir := "ahead of"
+	if skew < 0 {
+		dir = "behind"
+	}
+	return fmt.Sprintf("server clock is %.1fs %s pgmetrics", math.Abs(skew), dir)
+}
+
+// fmtCollectorStats returns a line describing the work pgmetrics did for
+// the collection, or an empty string if it was not recorded.
+func fmtCollectorStats(cs *pgmetrics.CollectorStats) string {
+	if cs == nil {
+		return ""
+	}
+	s := fmt.Sprintf("\npgmetrics took:   %.1fs (%d queries, %d rows fetched",
+		cs.Duration, cs.Queries, cs.RowsFetched)
+	if cs.PeakRSS > 0 {
+		s += ", " + humanize.IBytes(uint64(cs.PeakRSS)) + " peak memory"
+	}
+	return s + ")"
+}
+
+/* currently unused:
+func fmtTimeDef(at int64, def string) string {
+	if at == 0 {
+		return def
+	}
+	return time.Unix(at, 0).Format("2 Jan 2006 3:04:05 PM")
+}
+
+func fmtTimeAndSinceDef(at int64, def string) string {
+	if at == 0 {
+		return def
+	}
+	t := time.Unix(at, 0)
+	return fmt.Sprintf("%s (%s)", t.Format("2 Jan 2006 3:04:05 PM"),
+		humanize.Time(t))
+}
+
+func fmtSeconds(s string) string {
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return s
+	}
+	return (time.Duration(v) * time.Second).String()
+}
+*/
+
+func fmtSince(at int64) string {
+	if at == 0 {
+		return "never"
+	}
+	return humanize.Time(time.Unix(at, 0))
+}
+
+func fmtYesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+	return "no"
+}
+
+func fmtYesBlank(v bool) string {
+	if v {
+		return "yes"
+	}
+	return ""
+}
+
+func fmtLag(a, b, qual string) string {
+	if len(qual) > 0 && !strings.HasSuffix(qual, " ") {
+		qual += " "
+	}
+	if d, ok := lsnDiff(a, b); ok {
+		if d == 0 {
+			return " (no " + qual + "lag)"
+		}
+		return fmt.Sprintf(" (%slag = %s)", qual, humanize.IBytes(uint64(d)))
+	}
+	return ""
+}
+
+func fmtIntZero(i int) string {
+	if i == 0 {
+		return ""
+	}
+	return strconv.Itoa(i)
+}
+
+func fmtPropagate(ins, upd, del bool) string {
+	parts := make([]string, 0, 3)
+	if ins {
+		parts = append(parts, "inserts")
+	}
+	if upd {
+		parts = append(parts, "updates")
+	}
+	if del {
+		parts = append(parts, "deletes")
+	}
+	return strings.Join(parts, ", ")
+}
+
+func fmtMicros(v int64) string {
+	s := (time.Duration(v) * time.Microsecond).String()
+	return strings.Replace(s, "µ", "u", -1)
+}
+
+func getSetting(result *pgmetrics.Model, key string) string {
+	if s, ok := result.Settings[key]; ok {
+		return s.Setting
+	}
+	return ""
+}
+
+func getSettingInt(result *pgmetrics.Model, key string) int {
+	s := getSetting(result, key)
+	if len(s) == 0 {
+		return 0
+	}
+	val, err := strconv.Atoi(s)
+	if err != nil {
+		return 0
+	}
+	return val
+}
+
+func getSettingBytes(result *pgmetrics.Model, key string, factor uint64) string {
+	s := getSetting(result, key)
+	if len(s) == 0 {
+		return s
+	}
+	val, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || val == 0 {
+		return s
+	}
+	return s + " (" + humanize.IBytes(val*factor) + ")"
+}
+
+func safeDiv(a, b int64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b)
+}
+
+func lsn2int(s string) int64 {
+	if len(s) == 0 {
+		return -1
+	}
+	if pos := strings.IndexByte(s, '/'); pos >= 0 {
+		val1, err1 := strconv.ParseUint(s[:pos], 16, 64)
+		val2, err2 := strconv.ParseUint(s[pos+1:], 16, 64)
+		if err1 != nil || err2 != nil {
+			return -1
+		}
+		return int64(val1<<32 | val2)
+	}
+	return -1
+}
+
+func lsnDiff(a, b string) (int64, bool) {
+	va := lsn2int(a)
+	vb := lsn2int(b)
+	if va == -1 || vb == -1 {
+		return -1, false
+	}
+	return va - vb, true
+}
+
+func getBlockSize(result *pgmetrics.Model) int {
+	s := getSetting(result, "block_size")
+	if len(s) == 0 {
+		return 8192
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v == 0 {
+		return 8192
+	}
+	return v
+}
+
+func getVersion(result *pgmetrics.Model) int {
+	s := getSetting(result, "server_version_num")
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+func getMaxWalSize(result *pgmetrics.Model) (string, string) {
+	var key string
+	if version := getVersion(result); version >= 90500 {
+		key = "max_wal_size"
+	} else {
+		key = "checkpoint_segments"
+	}
+	return key, getSettingBytes(result, key, 16*1024*1024)
+}
+
+type aclItem struct {
+	role    string
+	privs   []string
+	grantor string
+}
+
+var aclMap = map[byte]string{
+	'a': "INSERT",
+	'r': "SELECT",
+	'w': "UPDATE",
+	'd': "DELETE",
+	'D': "TRUNCATE",
+	'x': "REFERENCES",
+	't': "TRIGGER",
+	'X': "EXECUTE",
+	'U': "USAGE",
+	'C': "CREATE",
+	'T': "TEMPORARY",
+	'c': "CONNECT",
+}
+
+// see src/backend/utils/adt/acl.c
+func parseACL(acl string) (out []aclItem) {
+	for _, item := range strings.Split(acl, "\n") {
+		if slash := strings.Split(item, "/"); len(slash) == 2 {
+			e := aclItem{grantor: slash[1]}
+			if eq := strings.Split(slash[0], "="); len(eq) == 2 {
+				if eq[0] == "" {
+					e.role = "PUBLIC"
+				} else {
+					e.role = eq[0]
+				}
+				for _, c := range eq[1] {
+					if p, ok := aclMap[byte(c)]; ok {
+						e.privs = append(e.privs, p)
+					}
+				}
+				out = append(out, e)
+			}
+		}
+	}
+	return
+}
+
+//------------------------------------------------------------------------------
+
+type tableWriter struct {
+	o         Options // for formatting the counters
+	data      [][]string
+	hasFooter bool
+}
+
+func (t *tableWriter) add(cols ...interface{}) {
+	row := make([]string, len(cols))
+	for i, c := range cols {
+		switch v := c.(type) {
+		case int64: // counters, unlike ids
+			row[i] = fmtCount(t.o, v)
+		default:
+			row[i] = fmt.Sprintf("%v", c)
+		}
+	}
+	t.data = append(t.data, row)
+}
+
+func (t *tableWriter) clear() {
+	t.data = nil
+}
+
+func (t *tableWriter) cols() int {
+	n := 0
+	for _, row := range t.data {
+		if n < len(row) {
+			n = len(row)
+		}
+	}
+	return n
+}
+
+func (t *tableWriter) write(fd io.Writer, pfx string) (tw int) {
+	if len(t.data) == 0 {
+		return
+	}
+	ncols := t.cols()
+	if ncols == 0 {
+		return
+	}
+	// calculate widths
+	widths := make([]int, ncols)
+	for _, row := range t.data {
+		for c, col := range row {
+			w := len(col)
+			if widths[c] < w {
+				widths[c] = w
+			}
+		}
+	}
+	// calculate total width
+	tw = len(pfx) + 1 // "prefix", "|"
+	for _, w := range widths {
+		tw += 1 + w + 1 + 1 // blank, "value", blank, "|"
+	}
+	// print line
+	line := func() {
+		fmt.Fprintf(fd, "%s+", pfx)
+		for _, w := range widths {
+			fmt.Fprint(fd, strings.Repeat("-", w+2))
+			fmt.Fprintf(fd, "+")
+		}
+		fmt.Fprintln(fd)
+	}
+	line()
+	for i, row := range t.data {
+		if i == 1 || (t.hasFooter && i == len(t.data)-1) {
+			line()
+		}
+		fmt.Fprintf(fd, "%s|", pfx)
+		for c, col := range row {
+			fmt.Fprintf(fd, " %*s |", widths[c], col)
+		}
+		fmt.Fprintln(fd)
+	}
+	line()
+	return
+}
@@ -0,0 +1,200 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package report
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/rapidloop/pgmetrics"
+)
+
+const rollupTopErrors = 10 // number of error messages listed
+
+// rollupWeek has the counts of the log events in a week.
+type rollupWeek struct {
+	start                                time.Time
+	errors, slow, autovacuums, deadlocks int
+	failedLogins, ddl                    int
+}
+
+// rollupError is an error message, summed over all the snapshots.
+type rollupError struct {
+	level, message string
+	count          int
+	first, last    int64
+}
+
+// weekOf returns the local midnight of the Monday of the week at is in.
+func weekOf(o Options, at int64) time.Time {
+	t := dispTime(o, at)
+	wd := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-wd, 0, 0, 0, 0, t.Location())
+}
+
+// writeRollupTo reports the events seen in the log files by week, summed
+// over the snapshots, which are all from the same cluster. The snapshots are
+// expected to be collected periodically, with a log span that does not
+// overlap with the previous one.
+func writeRollupTo(fd io.Writer, o Options, results []*pgmetrics.Model) {
+	sorted := append([]*pgmetrics.Model(nil), results...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Metadata.At < sorted[j].Metadata.At
+	})
+
+	weeks := make(map[int64]*rollupWeek)
+	week := func(at int64) *rollupWeek {
+		start := weekOf(o, at)
+		w := weeks[start.Unix()]
+		if w == nil {
+			w = &rollupWeek{start: start}
+			weeks[start.Unix()] = w
+		}
+		return w
+	}
+	errs := make(map[[2]string]*rollupError)
+	var errList []*rollupError
+	var used, dups, nolog int
+	var lastAt int64
+	for i, r := range sorted {
+		// the same file given twice
+		if i > 0 && r.Metadata.At == lastAt {
+			dups++
+			continue
+		}
+		lastAt = r.Metadata.At
+		if len(r.LogHours) == 0 && r.LogVolume == nil {
+			nolog++
+			continue
+		}
+		used++
+		for _, h := range r.LogHours {
+			w := week(h.Hour)
+			w.errors += h.Errors
+			w.slow += h.SlowQueries
+			w.autovacuums += h.AutoVacuums
+			w.deadlocks += h.Deadlocks
+		}
+		for _, f := range r.FailedLogins {
+			if f.Last > 0 {
+				week(f.Last).failedLogins += f.Count
+			}
+		}
+		for _, d := range r.DDLEvents {
+			if d.At > 0 {
+				week(d.At).ddl++
+			}
+		}
+		if r.LogVolume == nil {
+			continue
+		}
+		for _, m := range r.LogVolume.TopMessages {
+			if m.Level != "ERROR" && m.Level != "FATAL" && m.Level != "PANIC" {
+				continue
+			}
+			k := [2]string{m.Level, m.Message}
+			e := errs[k]
+			if e == nil {
+				e = &rollupError{level: m.Level, message: m.Message, first: m.First}
+				errs[k] = e
+				errList = append(errList, e)
+			}
+			e.count += m.Count
+			if m.First < e.first {
+				e.first = m.First
+			}
+			if m.Last > e.last {
+				e.last = m.Last
+			}
+		}
+	}
+
+	fmt.Fprintf(fd, `
+pgmetrics weekly log rollup:
+
+    Snapshots:           %d, from %s to %s`,
+		len(sorted), fmtTime(o, sorted[0].Metadata.At),
+		fmtTime(o, sorted[len(sorted)-1].Metadata.At))
+	if nolog > 0 {
+		fmt.Fprintf(fd, `
+                         (%d without log information not used)`, nolog)
+	}
+	if dups > 0 {
+		fmt.Fprintf(fd, `
+                         (%d duplicates not used)`, dups)
+	}
+	fmt.Fprintln(fd)
+	if used == 0 {
+		fmt.Fprint(fd, `
+    No log information in the snapshots, was the log file examined?
+
+`)
+		return
+	}
+
+	var list []*rollupWeek
+	for _, w := range weeks {
+		list = append(list, w)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].start.Before(list[j].start) })
+	fmt.Fprint(fd, `
+Log Events by Week:
+`)
+	tw := tableWriter{o: o}
+	tw.add("Week Of", "Errors", "Slow Queries", "Autovacuums", "Deadlocks",
+		"Failed Logins", "DDL")
+	var total rollupWeek
+	for _, w := range list {
+		tw.add(w.start.Format("Mon 2 Jan 2006"), w.errors, w.slow,
+			w.autovacuums, w.deadlocks, w.failedLogins, w.ddl)
+		total.errors += w.errors
+		total.slow += w.slow
+		total.autovacuums += w.autovacuums
+		total.deadlocks += w.deadlocks
+		total.failedLogins += w.failedLogins
+		total.ddl += w.ddl
+	}
+	if len(list) > 1 {
+		tw.add("Total", total.errors, total.slow, total.autovacuums,
+			total.deadlocks, total.failedLogins, total.ddl)
+	}
+	tw.write(fd, "    ")
+
+	fmt.Fprint(fd, `
+Most Frequent Errors:
+`)
+	if len(errList) == 0 {
+		fmt.Fprint(fd, `    No errors among the most frequent log messages.
+`)
+	} else {
+		sort.SliceStable(errList, func(i, j int) bool {
+			return errList[i].count > errList[j].count
+		})
+		if len(errList) > rollupTopErrors {
+			errList = errList[:rollupTopErrors]
+		}
+		tw.clear()
+		tw.add("Count", "Level", "First", "Last", "Message")
+		for _, e := range errList {
+			tw.add(e.count, e.level, fmtTime(o, e.first), fmtTime(o, e.last), prepQ(e.message))
+		}
+		tw.write(fd, "    ")
+	}
+	fmt.Fprintln(fd)
+}
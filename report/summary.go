@@ -0,0 +1,320 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/rapidloop/pgmetrics"
+)
+
+// Thresholds beyond which the health summary reports an issue.
+const (
+	summaryConnPct     = 80 // % of max_connections in use
+	summaryDiskPct     = 90 // % of disk used by a tablespace
+	summaryXidAgePct   = 50 // % of the xid wraparound limit
+	summaryArchiveLag  = 64 // WAL files completed but not yet archived
+	summaryClockSkew   = 5  // seconds the server's clock is off from pgmetrics'
+	xidWraparoundLimit = 1 << 31
+)
+
+// summary is a short health summary of a model, with a few key facts and a
+// list of issues that need attention. The issues are the messages of the
+// failed checks.
+type summary struct {
+	title  string
+	facts  [][2]string
+	checks []pgmetrics.HealthCheck
+	issues []string
+	at     int64
+}
+
+func summarize(result *pgmetrics.Model, o Options) *summary {
+	s := &summary{at: result.Metadata.At}
+	if result.PgBouncer != nil {
+		s.title = "PgBouncer"
+		s.facts = append(s.facts,
+			[2]string{"Pools", strconv.Itoa(len(result.PgBouncer.Pools))},
+			[2]string{"Databases", strconv.Itoa(len(result.PgBouncer.Databases))})
+		return s
+	}
+
+	name := result.Metadata.ClusterName
+	if len(name) == 0 {
+		name = getSetting(result, "cluster_name")
+	}
+	if len(name) == 0 {
+		name = "(unnamed)"
+	}
+	s.title = "PostgreSQL Cluster " + name
+	maxConn, _ := strconv.Atoi(getSetting(result, "max_connections"))
+	s.facts = append(s.facts,
+		[2]string{"Version", getSetting(result, "server_version")},
+		[2]string{"Role", result.Metadata.ServerRole},
+		[2]string{"Started", fmtSince(result.StartTime)},
+		[2]string{"Backends", fmt.Sprintf("%d of %d", len(result.Backends), maxConn)})
+	if len(result.Metadata.Labels) > 0 {
+		s.facts = append(s.facts, [2]string{"Labels", fmtLabels(result.Metadata.Labels)})
+	}
+
+	check := func(rule, object string, value, threshold float64, unit, format string, args ...interface{}) {
+		hc := pgmetrics.HealthCheck{Rule: rule, Object: object, Value: value,
+			Threshold: threshold, Unit: unit, Failed: value >= threshold}
+		if hc.Failed {
+			hc.Message = fmt.Sprintf(format, args...)
+			s.issues = append(s.issues, hc.Message)
+		}
+		s.checks = append(s.checks, hc)
+	}
+	yes := func(b bool) float64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+
+	// clock skew
+	if result.Metadata.ServerAt > 0 {
+		skew := result.Metadata.ClockSkew
+		check("clock_skew", "", math.Abs(skew), summaryClockSkew, "s", "%s", fmtClockSkew(skew))
+	}
+
+	// connections
+	if maxConn > 0 {
+		check("connections", "", 100*float64(len(result.Backends))/float64(maxConn),
+			summaryConnPct, "%", "%d of %d connections in use", len(result.Backends), maxConn)
+	}
+
+	// long-running transactions and lock waits
+	var tooLong, waiting int
+	for i := range result.Backends {
+		be := &result.Backends[i]
+		if be.XactStart > 0 && result.Metadata.At-be.XactStart > int64(o.TooLongSecs) {
+			tooLong++
+		}
+		if isWaitingLock(be) {
+			waiting++
+		}
+	}
+	check("long_transactions", "", float64(tooLong), 1, "",
+		"%d transactions open for more than %d seconds", tooLong, o.TooLongSecs)
+	check("lock_waits", "", float64(waiting), 1, "",
+		"%d backends waiting for locks", waiting)
+
+	// replication and archiving
+	for _, rs := range result.ReplicationSlots {
+		if !rs.Temporary {
+			check("inactive_slot", rs.SlotName, yes(!rs.Active), 1, "",
+				"replication slot %s is inactive", rs.SlotName)
+		}
+	}
+	a := result.WALArchiving
+	check("archiving_failing", "", yes(a.LastFailedTime > a.LastArchivedTime), 1, "",
+		"WAL archiving failing since %s", fmtTime(o, a.LastFailedTime))
+	if len(a.CurrentWAL) > 0 {
+		check("archive_lag", "", float64(a.LagSegments), summaryArchiveLag, "files",
+			"WAL archiving is %d files (%s) behind", a.LagSegments,
+			humanize.IBytes(uint64(a.LagBytes)))
+	}
+	bs := result.BackupState
+	check("stale_backup_label", "", yes(bs != nil && bs.LabelFileTime > 0 &&
+		!bs.ExclusiveInProgress && !result.IsInRecovery), 1, "",
+		"stale backup_label file in the data directory")
+
+	// vacuum
+	for _, d := range result.Databases {
+		pct := 100 * float64(d.AgeDatFrozenXid) / xidWraparoundLimit
+		check("xid_age", d.Name, pct, summaryXidAgePct, "%",
+			"database %s is at %.0f%% of the transaction id wraparound limit", d.Name, pct)
+	}
+	if av := result.AutovacuumSaturation; av != nil {
+		check("autovacuum_saturated", "", yes(2*av.BusySamples > av.Samples &&
+			av.TablesDue > av.MaxWorkers), 1, "",
+			"all %d autovacuum workers busy, %d tables due for vacuum",
+			av.MaxWorkers, av.TablesDue)
+	}
+
+	// disk
+	for _, t := range result.Tablespaces {
+		if t.DiskTotal > 0 {
+			pct := 100 * safeDiv(t.DiskUsed, t.DiskTotal)
+			check("disk_usage", t.Name, pct, summaryDiskPct, "%",
+				"disk of tablespace %s is %.0f%% full", t.Name, pct)
+		}
+	}
+
+	// from the log
+	n := len(result.Deadlocks)
+	check("deadlocks", "", float64(n), 1, "", "%d deadlocks in the log", n)
+	byHost := make(map[string]int)
+	var hosts []string
+	for _, f := range result.FailedLogins {
+		if _, ok := byHost[f.Host]; !ok && len(f.Host) > 0 {
+			hosts = append(hosts, f.Host)
+		}
+		byHost[f.Host] += f.Count
+	}
+	for _, h := range hosts {
+		check("failed_logins", h, float64(byHost[h]), bruteForceMin, "",
+			"%d failed logins from %s", byHost[h], h)
+	}
+	n = len(result.SuspiciousQueries)
+	check("suspicious_queries", "", float64(n), 1, "", "%d suspicious queries seen", n)
+	return s
+}
+
+func (s *summary) status() string {
+	switch n := len(s.issues); n {
+	case 0:
+		return "No issues found"
+	case 1:
+		return "1 issue needs attention"
+	default:
+		return fmt.Sprintf("%d issues need attention", n)
+	}
+}
+
+func (s *summary) footer(o Options) string {
+	// always with the zone name, the reader can be elsewhere
+	layout := "2 Jan 2006 3:04:05 PM"
+	if o.Location == nil {
+		layout += " MST"
+	}
+	return "pgmetrics run at " + fmtLayout(o, s.at, layout)
+}
+
+// Issues returns the issues found by the health summary of the model, as used
+// by the "slack" and "teams" formats. It is empty if the model looks healthy.
+func Issues(model *pgmetrics.Model, o Options) []string {
+	if model == nil {
+		return nil
+	}
+	return summarize(model, o).issues
+}
+
+// HealthChecks returns the results of all the checks done for the health
+// summary of the model, including those that passed, with the thresholds
+// used.
+func HealthChecks(model *pgmetrics.Model, o Options) []pgmetrics.HealthCheck {
+	if model == nil {
+		return nil
+	}
+	return summarize(model, o).checks
+}
+
+// WriteSummary writes the health summary of the model as plain text.
+func WriteSummary(w io.Writer, model *pgmetrics.Model, o Options) error {
+	if model == nil {
+		return errors.New("report: nil model")
+	}
+	s := summarize(model, o)
+	return safeWrite(w, func(fd io.Writer) {
+		fmt.Fprintf(fd, "%s: %s\n", s.title, s.status())
+		for _, issue := range s.issues {
+			fmt.Fprintf(fd, "  - %s\n", issue)
+		}
+		for _, f := range s.facts {
+			fmt.Fprintf(fd, "%s: %s\n", f[0], f[1])
+		}
+		fmt.Fprintln(fd, s.footer(o))
+	})
+}
+
+// WriteSlack writes a health summary of the model as a Slack message, using
+// Block Kit, suitable for posting to a Slack incoming webhook.
+func WriteSlack(w io.Writer, model *pgmetrics.Model, o Options) error {
+	if model == nil {
+		return errors.New("report: nil model")
+	}
+	s := summarize(model, o)
+
+	type obj = map[string]interface{}
+	text := func(t string) obj { return obj{"type": "mrkdwn", "text": t} }
+	var fields []obj
+	for _, f := range s.facts {
+		fields = append(fields, text("*"+f[0]+"*\n"+f[1]))
+	}
+	status := ":white_check_mark: " + s.status()
+	if len(s.issues) > 0 {
+		status = ":warning: *" + s.status() + "*\n• " + strings.Join(s.issues, "\n• ")
+	}
+	msg := obj{
+		"text": s.title + ": " + s.status(),
+		"blocks": []obj{
+			{"type": "header", "text": obj{"type": "plain_text", "text": s.title}},
+			{"type": "section", "fields": fields},
+			{"type": "section", "text": text(status)},
+			{"type": "context", "elements": []obj{text(s.footer(o))}},
+		},
+	}
+	return writeSummaryJSON(w, msg)
+}
+
+// WriteTeams writes a health summary of the model as a Microsoft Teams
+// message with an Adaptive Card, suitable for posting to a Teams webhook.
+func WriteTeams(w io.Writer, model *pgmetrics.Model, o Options) error {
+	if model == nil {
+		return errors.New("report: nil model")
+	}
+	s := summarize(model, o)
+
+	type obj = map[string]interface{}
+	var facts []obj
+	for _, f := range s.facts {
+		facts = append(facts, obj{"title": f[0], "value": f[1]})
+	}
+	body := []obj{
+		{"type": "TextBlock", "text": s.title, "size": "Large", "weight": "Bolder", "wrap": true},
+		{"type": "FactSet", "facts": facts},
+	}
+	if len(s.issues) == 0 {
+		body = append(body, obj{"type": "TextBlock", "text": s.status(), "color": "Good", "wrap": true})
+	} else {
+		body = append(body, obj{"type": "TextBlock", "text": s.status(), "color": "Attention",
+			"weight": "Bolder", "wrap": true})
+		for _, issue := range s.issues {
+			body = append(body, obj{"type": "TextBlock", "text": "- " + issue, "spacing": "None", "wrap": true})
+		}
+	}
+	body = append(body, obj{"type": "TextBlock", "text": s.footer(o), "size": "Small", "isSubtle": true, "wrap": true})
+	msg := obj{
+		"type": "message",
+		"attachments": []obj{{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": obj{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"body":    body,
+			},
+		}},
+	}
+	return writeSummaryJSON(w, msg)
+}
+
+func writeSummaryJSON(w io.Writer, msg interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(msg)
+}
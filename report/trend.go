@@ -0,0 +1,342 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/rapidloop/pgmetrics"
+)
+
+const (
+	trendTopN         = 10 // number of statements listed
+	trendMaxSnapshots = 8  // only the latest these many snapshots are used
+	trendPlanLines    = 15 // lines of each plan shown for a plan change
+)
+
+// trendKey identifies a statement across snapshots. The query text is used
+// only if there is no queryid.
+type trendKey struct {
+	db, user string
+	queryID  int64
+	query    string
+}
+
+func getTrendKey(s *pgmetrics.Statement) trendKey {
+	k := trendKey{db: s.DBName, user: s.UserName, queryID: s.QueryID}
+	if s.QueryID == 0 {
+		k.query = s.Query
+	}
+	return k
+}
+
+// trendStmt has the calls and total time of a statement in each interval
+// between successive snapshots.
+type trendStmt struct {
+	s       *pgmetrics.Statement // as in the latest snapshot it was seen in
+	calls   []int64
+	times   []float64
+	seen    []bool
+	isNew   bool // not present in the first snapshot
+	firstAt int64
+	total   float64 // total time over all intervals
+}
+
+// writeTrendTo reports how the calls and total time of the top statements
+// changed across the snapshots, which are all from the same cluster.
+func writeTrendTo(fd io.Writer, o Options, results []*pgmetrics.Model) {
+	sorted := append([]*pgmetrics.Model(nil), results...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Metadata.At < sorted[j].Metadata.At
+	})
+	var dropped int
+	if len(sorted) > trendMaxSnapshots {
+		dropped = len(sorted) - trendMaxSnapshots
+		sorted = sorted[dropped:]
+	}
+	n := len(sorted) - 1 // number of intervals
+
+	// statements are counted from when they are first seen, and the
+	// counters of a statement can drop if pg_stat_statements was reset
+	inFirst := make(map[trendKey]bool)
+	last := make(map[trendKey]*pgmetrics.Statement)
+	stmts := make(map[trendKey]*trendStmt)
+	var all []*trendStmt
+	for i, r := range sorted {
+		for j := range r.Statements {
+			s := &r.Statements[j]
+			k := getTrendKey(s)
+			prev, ok := last[k]
+			last[k] = s
+			if i == 0 {
+				inFirst[k] = true
+				continue
+			}
+			ts := stmts[k]
+			if ts == nil {
+				ts = &trendStmt{
+					calls:   make([]int64, n),
+					times:   make([]float64, n),
+					seen:    make([]bool, n),
+					isNew:   !inFirst[k],
+					firstAt: r.Metadata.At,
+				}
+				stmts[k] = ts
+				all = append(all, ts)
+			}
+			ts.s = s
+			calls, t := s.Calls, s.TotalTime
+			if ok && s.Calls >= prev.Calls {
+				calls -= prev.Calls
+				t -= prev.TotalTime
+			}
+			ts.calls[i-1], ts.times[i-1], ts.seen[i-1] = calls, t, true
+			ts.total += t
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].total > all[j].total })
+	var top, added []*trendStmt
+	for _, ts := range all {
+		if len(top) < trendTopN {
+			top = append(top, ts)
+		}
+		if ts.isNew && len(added) < trendTopN {
+			added = append(added, ts)
+		}
+	}
+
+	first, latest := sorted[0].Metadata.At, sorted[n].Metadata.At
+	fmt.Fprintf(fd, `
+pgmetrics statement trend report:
+
+    Snapshots:           %d, from %s to %s`,
+		len(sorted), fmtTime(o, first), fmtTime(o, latest))
+	if dropped > 0 {
+		fmt.Fprintf(fd, `
+                         (%d older snapshots not used)`, dropped)
+	}
+	fmt.Fprintf(fd, `
+    Statements Tracked:  %d (%d new)
+`, len(all), countNew(all))
+	if len(all) == 0 {
+		fmt.Fprint(fd, `
+    No statements in the snapshots, is pg_stat_statements installed?
+`)
+		writePlanFlips(fd, o, sorted)
+		fmt.Fprintln(fd)
+		return
+	}
+
+	header := []interface{}{"#"}
+	for _, r := range sorted[1:] {
+		header = append(header, "To "+fmtLayout(o, r.Metadata.At, "2 Jan 3:04 PM"))
+	}
+	header = append(header, "Change")
+
+	fmt.Fprint(fd, `
+Total Time of Top Statements, in Each Interval:
+`)
+	tw := tableWriter{o: o}
+	tw.add(header...)
+	for i, ts := range top {
+		row := []interface{}{i + 1}
+		for j := range ts.times {
+			if ts.seen[j] {
+				row = append(row, prepmsec(ts.times[j]))
+			} else {
+				row = append(row, "")
+			}
+		}
+		tw.add(append(row, ts.change(func(j int) float64 { return ts.times[j] }))...)
+	}
+	tw.write(fd, "    ")
+
+	fmt.Fprint(fd, `
+Calls of Top Statements, in Each Interval:
+`)
+	tw.clear()
+	tw.add(header...)
+	for i, ts := range top {
+		row := []interface{}{i + 1}
+		for j := range ts.calls {
+			if ts.seen[j] {
+				row = append(row, ts.calls[j])
+			} else {
+				row = append(row, "")
+			}
+		}
+		tw.add(append(row, ts.change(func(j int) float64 { return float64(ts.calls[j]) }))...)
+	}
+	tw.write(fd, "    ")
+
+	fmt.Fprint(fd, `
+Top Statements:
+`)
+	tw.clear()
+	tw.add("#", "Database", "User", "Query")
+	for i, ts := range top {
+		tw.add(i+1, ts.s.DBName, ts.s.UserName, prepQ(ts.s.Query))
+	}
+	tw.write(fd, "    ")
+
+	fmt.Fprint(fd, `
+New Statements:
+`)
+	if len(added) == 0 {
+		fmt.Fprint(fd, `    No new statements.
+`)
+	} else {
+		tw.clear()
+		tw.add("First Seen", "Database", "User", "Calls", "Total Time", "Query")
+		for _, ts := range added {
+			var calls int64
+			for _, c := range ts.calls {
+				calls += c
+			}
+			tw.add(fmtTime(o, ts.firstAt), ts.s.DBName, ts.s.UserName, calls,
+				prepmsec(ts.total), prepQ(ts.s.Query))
+		}
+		tw.write(fd, "    ")
+	}
+	writePlanFlips(fd, o, sorted)
+	fmt.Fprintln(fd)
+}
+
+// planFlip is a change in the shape of the plan of a query, between two of
+// the plans logged by auto_explain.
+type planFlip struct {
+	before, after *pgmetrics.Plan
+}
+
+// findPlanFlips returns the changes in the shapes of the plans of each query
+// across all the snapshots, oldest first.
+func findPlanFlips(results []*pgmetrics.Model) (flips []planFlip) {
+	var plans []*pgmetrics.Plan
+	for _, r := range results {
+		for i := range r.Plans {
+			plans = append(plans, &r.Plans[i])
+		}
+	}
+	sort.SliceStable(plans, func(i, j int) bool { return plans[i].At < plans[j].At })
+
+	type planKey struct{ db, fp string }
+	last := make(map[planKey]*pgmetrics.Plan)
+	shapes := make(map[planKey]string)
+	for _, p := range plans {
+		shape := pgmetrics.PlanShape(p.Plan, p.Format)
+		fp := p.Fingerprint
+		if len(fp) == 0 {
+			fp = pgmetrics.Fingerprint(p.Query)
+		}
+		if len(shape) == 0 || len(fp) == 0 {
+			continue
+		}
+		k := planKey{p.Database, fp}
+		if prev, ok := last[k]; ok && shapes[k] != shape {
+			flips = append(flips, planFlip{before: prev, after: p})
+		}
+		last[k], shapes[k] = p, shape
+	}
+	return
+}
+
+func writePlanFlips(fd io.Writer, o Options, results []*pgmetrics.Model) {
+	fmt.Fprint(fd, `
+Plan Changes:
+`)
+	flips := findPlanFlips(results)
+	if len(flips) == 0 {
+		fmt.Fprint(fd, `    No changes in the plans logged by auto_explain.
+`)
+		return
+	}
+	if len(flips) > trendTopN {
+		fmt.Fprintf(fd, "    (only the latest %d of %d changes are shown)\n", trendTopN, len(flips))
+		flips = flips[len(flips)-trendTopN:]
+	}
+	for i, f := range flips {
+		fmt.Fprintf(fd, `    %d. Changed at %s, in database %s:
+       Query:  %s
+       Before (%s):
+`, i+1, fmtTime(o, f.after.At), f.after.Database, prepQ(f.after.Query), fmtTime(o, f.before.At))
+		for _, line := range fmtPlanLines(f.before) {
+			fmt.Fprintf(fd, "           %s\n", line)
+		}
+		fmt.Fprint(fd, `       After:
+`)
+		for _, line := range fmtPlanLines(f.after) {
+			fmt.Fprintf(fd, "           %s\n", line)
+		}
+	}
+}
+
+// fmtPlanLines returns the lines of the plan to display, at most
+// trendPlanLines of them.
+func fmtPlanLines(p *pgmetrics.Plan) []string {
+	text := p.Plan
+	if p.Format == "json" {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, []byte(p.Plan), "", "  "); err == nil {
+			text = buf.String()
+		}
+	}
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimRight(strings.TrimPrefix(line, "\t"), " "); len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	if n := len(lines); n > trendPlanLines {
+		lines = append(lines[:trendPlanLines], fmt.Sprintf("... (%d more lines)", n-trendPlanLines))
+	}
+	return lines
+}
+
+func countNew(all []*trendStmt) (n int) {
+	for _, ts := range all {
+		if ts.isNew {
+			n++
+		}
+	}
+	return
+}
+
+// change returns the change in the value f(j) between the first and the last
+// intervals the statement was seen in.
+func (ts *trendStmt) change(f func(j int) float64) string {
+	if ts.isNew {
+		return "new"
+	}
+	from, to := -1, -1
+	for j := range ts.seen {
+		if ts.seen[j] {
+			if from == -1 {
+				from = j
+			}
+			to = j
+		}
+	}
+	if from == to || f(from) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%+.0f%%", 100*(f(to)-f(from))/f(from))
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright 2020 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pgmetrics
+
+import (
+	"reflect"
+	"strings"
+)
+
+// The units of the numeric fields of the model, as given by the "unit" tag of
+// each field. Fields without a unit tag are counts, identifiers or other
+// unitless values.
+const (
+	UnitBytes        = "bytes"
+	UnitBlocks       = "blocks" // of block_size bytes, usually 8 KiB
+	UnitSegments     = "segments"
+	UnitMilliseconds = "ms"
+	UnitMicroseconds = "us"
+	UnitSeconds      = "s"
+	UnitEpoch        = "epoch" // a time, as seconds since the Unix epoch, 0 if not set
+	UnitXids         = "xids"  // number of transactions, as in the age of an xid
+	UnitFraction     = "fraction"
+	UnitBytesPerSec  = "bytes/s"
+	UnitBlocksPerSec = "blocks/s"
+	UnitPerSec       = "1/s" // a count per second
+)
+
+// Units returns the unit of each field of the model that has one, keyed by
+// the path to the field in the JSON form of the model, with the keys joined
+// by ".", like "tables.size" or "meta.at". Arrays are not part of the
+// path, so "tables.size" is the size of each table. The keys of maps are
+// given as "*".
+func Units() map[string]string {
+	units := make(map[string]string)
+	addUnits(units, "", reflect.TypeOf(Model{}))
+	return units
+}
+
+func addUnits(units map[string]string, prefix string, t reflect.Type) {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Map:
+		addUnits(units, prefix+"*.", t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if len(name) == 0 || name == "-" {
+				continue
+			}
+			if u := f.Tag.Get("unit"); len(u) > 0 {
+				units[prefix+name] = u
+			}
+			addUnits(units, prefix+name+".", f.Type)
+		}
+	}
+}